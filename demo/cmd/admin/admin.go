@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,6 +10,8 @@ import (
 	"github.com/hexa-org/policy-mapper/pkg/keysupport"
 	"github.com/hexa-org/policy-mapper/pkg/sessionSupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/hexaConstants"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
 	log "golang.org/x/exp/slog"
 
 	"github.com/hexa-org/policy-orchestrator/demo/internal/admin"
@@ -23,7 +26,15 @@ func App(addr string, orchestratorUrl string) *http.Server {
 	sessionHandler := sessionSupport.NewSessionManager()
 
 	handlers := admin.LoadHandlers(orchestratorUrl, client, sessionHandler)
-	return websupport.Create(addr, handlers, websupport.Options{})
+	server := websupport.Create(addr, handlers, websupport.Options{})
+	server.Handler = prometheussupport.Wrap(server.Handler)
+
+	shutdownTracing, err := tracesupport.Init("hexa-admin")
+	if err != nil {
+		panic(err)
+	}
+	server.RegisterOnShutdown(func() { _ = shutdownTracing(context.Background()) })
+	return server
 }
 
 func newApp(addr string) (*http.Server, net.Listener) {
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/hexa-org/policy-mapper/pkg/keysupport"
 	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/hexaConstants"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
 
 	log "golang.org/x/exp/slog"
 
@@ -28,19 +35,114 @@ func (s ServerHealthCheck) Check() bool {
 	return true
 }
 
+// EnvDataStore selects where integrations and applications are stored: "file" (default) or "sql". The sql store is
+// configured with dataConfigGateway.EnvDatabaseDriver and dataConfigGateway.EnvDatabaseUrl.
+const EnvDataStore = "ORCHESTRATOR_DATA_STORE"
+
+// EnvSchedulerDelay is how often, in milliseconds, the orchestrator checks for scheduled orchestrations that are due.
+const EnvSchedulerDelay = "ORCHESTRATOR_SCHEDULER_DELAY"
+
+// EnvDriftCheckDelay is how often, in milliseconds, the policies of applications are checked for drift.
+const EnvDriftCheckDelay = "ORCHESTRATOR_DRIFT_CHECK_DELAY"
+
+// EnvJobDelay is how often, in milliseconds, the orchestrator checks for orchestrations submitted as jobs.
+const EnvJobDelay = "ORCHESTRATOR_JOB_DELAY"
+
+// EnvSchedulerSchedule, EnvDriftCheckSchedule and EnvJobSchedule replace the matching delay with a cron expression,
+// such as "0 * * * *" to check for drift hourly. See workflowsupport.ParseCron.
+const (
+	EnvSchedulerSchedule  = "ORCHESTRATOR_SCHEDULER_SCHEDULE"
+	EnvDriftCheckSchedule = "ORCHESTRATOR_DRIFT_CHECK_SCHEDULE"
+	EnvJobSchedule        = "ORCHESTRATOR_JOB_SCHEDULE"
+)
+
+const (
+	defaultSchedulerDelay  = 30000
+	defaultDriftCheckDelay = 300000
+	defaultJobDelay        = 1000
+)
+
+func newDataGateway() (dataConfigGateway.DataGateway, error) {
+	switch store := os.Getenv(EnvDataStore); store {
+	case "", "file":
+		return dataConfigGateway.NewIntegrationConfigData()
+	case "sql":
+		log.Info("Orchestrator Start", "data store", store, "driver", os.Getenv(dataConfigGateway.EnvDatabaseDriver))
+		return dataConfigGateway.NewSqlConfigData(os.Getenv(dataConfigGateway.EnvDatabaseDriver), os.Getenv(dataConfigGateway.EnvDatabaseUrl))
+	default:
+		return nil, fmt.Errorf("unsupported %s value: %s", EnvDataStore, store)
+	}
+}
+
 func App(key string, addr string, hostPort string) *http.Server {
 
-	config, err := dataConfigGateway.NewIntegrationConfigData()
+	config, err := newDataGateway()
 	if err != nil {
 		panic(err)
 	}
 
-	handlers := orchestrator.LoadHandlers(config, nil)
-	return websupport.Create(addr, handlers, websupport.Options{
+	auditLog, err := auditsupport.Open(os.Getenv(auditsupport.EnvAuditFile))
+	if err != nil {
+		panic(err)
+	}
+	handlers := orchestrator.LoadHandlers(config, nil, auditLog)
+	app := websupport.Create(addr, handlers, websupport.Options{
 		HealthChecks: []healthsupport.HealthCheck{
 			ServerHealthCheck{},
 		},
 	})
+	app.Handler = prometheussupport.Wrap(app.Handler)
+
+	// the lock keeps the master key from being rotated while the server is using it
+	if lock, err := lockConfigDir(); err != nil {
+		log.Warn("Orchestrator Start", "msg", "unable to lock the config directory", "error", err)
+	} else {
+		app.RegisterOnShutdown(func() { _ = lock.Close() })
+	}
+
+	shutdownTracing, err := tracesupport.Init("hexa-orchestrator")
+	if err != nil {
+		panic(err)
+	}
+	app.RegisterOnShutdown(func() { _ = shutdownTracing(context.Background()) })
+
+	scheduler := orchestrator.NewOrchestrationScheduler(config, nil, scheduleFromEnv(EnvSchedulerSchedule, EnvSchedulerDelay, defaultSchedulerDelay), workflowsupport.SystemClock)
+	scheduler.Start()
+	app.RegisterOnShutdown(scheduler.Stop)
+
+	driftScheduler := orchestrator.NewDriftScheduler(config, nil, scheduleFromEnv(EnvDriftCheckSchedule, EnvDriftCheckDelay, defaultDriftCheckDelay))
+	driftScheduler.Start()
+	app.RegisterOnShutdown(driftScheduler.Stop)
+
+	jobScheduler := orchestrator.NewJobScheduler(config, nil, scheduleFromEnv(EnvJobSchedule, EnvJobDelay, defaultJobDelay))
+	jobScheduler.Start()
+	app.RegisterOnShutdown(jobScheduler.Stop)
+	return app
+}
+
+// scheduleFromEnv returns the cron schedule in scheduleName when set, otherwise the delay in delayName.
+func scheduleFromEnv(scheduleName string, delayName string, defaultDelay int64) workflowsupport.Schedule {
+	if found := os.Getenv(scheduleName); found != "" {
+		schedule, err := workflowsupport.ParseCron(found)
+		if err == nil {
+			return schedule
+		}
+		log.Warn("Orchestrator Start", "msg", "invalid "+scheduleName+", using "+delayName, "error", err)
+	}
+	return workflowsupport.Every(time.Duration(delayFromEnv(delayName, defaultDelay)) * time.Millisecond)
+}
+
+func delayFromEnv(name string, defaultDelay int64) int64 {
+	found := os.Getenv(name)
+	if found == "" {
+		return defaultDelay
+	}
+	delay, err := strconv.ParseInt(found, 10, 64)
+	if err != nil || delay <= 0 {
+		log.Warn("Orchestrator Start", "msg", "invalid "+name+", using the default", "value", found)
+		return defaultDelay
+	}
+	return delay
 }
 
 func newApp(addr string) (*http.Server, net.Listener) {
@@ -77,6 +179,14 @@ func newApp(addr string) (*http.Server, net.Listener) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == rotateMasterKeyCommand {
+		if err := rotateMasterKey(os.Args[2:], os.Stdout); err != nil {
+			log.Error("Unable to rotate master key", "error", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Info("Hexa Orchestrator API Server starting...", "version", hexaConstants.HexaOrchestratorVersion)
 
 	app, listener := newApp("0.0.0.0:8885")
@@ -11,10 +11,12 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/hexa-org/policy-mapper/pkg/healthsupport"
 	"github.com/hexa-org/policy-mapper/pkg/keysupport"
 	"github.com/hexa-org/policy-mapper/pkg/websupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -93,3 +95,36 @@ func must(file []byte, err error) []byte {
 	}
 	return file
 }
+
+func TestNewDataGateway(t *testing.T) {
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	gateway, err := newDataGateway()
+	assert.NoError(t, err)
+	assert.IsType(t, &dataConfigGateway.ConfigData{}, gateway)
+
+	t.Setenv(EnvDataStore, "sql")
+	t.Setenv(dataConfigGateway.EnvDatabaseDriver, dataConfigGateway.DriverSqlite)
+	t.Setenv(dataConfigGateway.EnvDatabaseUrl, filepath.Join(t.TempDir(), "orchestrator.db"))
+	gateway, err = newDataGateway()
+	assert.NoError(t, err)
+	assert.IsType(t, &dataConfigGateway.SqlData{}, gateway)
+	_ = gateway.(*dataConfigGateway.SqlData).Close()
+
+	t.Setenv(EnvDataStore, "unknown")
+	_, err = newDataGateway()
+	assert.EqualError(t, err, "unsupported ORCHESTRATOR_DATA_STORE value: unknown")
+}
+
+func TestScheduleFromEnv(t *testing.T) {
+	now := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)
+	assert.Equal(t, now.Add(time.Second), scheduleFromEnv(EnvJobSchedule, EnvJobDelay, 1000).Next(now))
+
+	t.Setenv(EnvJobDelay, "500")
+	assert.Equal(t, now.Add(500*time.Millisecond), scheduleFromEnv(EnvJobSchedule, EnvJobDelay, 1000).Next(now))
+
+	t.Setenv(EnvJobSchedule, "0 * * * *")
+	assert.Equal(t, now.Add(30*time.Minute), scheduleFromEnv(EnvJobSchedule, EnvJobDelay, 1000).Next(now))
+
+	t.Setenv(EnvJobSchedule, "often")
+	assert.Equal(t, now.Add(500*time.Millisecond), scheduleFromEnv(EnvJobSchedule, EnvJobDelay, 1000).Next(now), "an invalid schedule falls back to the delay")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+const rotateMasterKeyCommand = "rotate-master-key"
+
+// masterKeyStore is a data store that seals integration keys with a master key.
+type masterKeyStore interface {
+	MasterKey() *dataConfigGateway.MasterKey
+	RotateMasterKey(newKey *dataConfigGateway.MasterKey) error
+}
+
+// rotateMasterKey re-encrypts the integration keys held in the data store selected by ORCHESTRATOR_DATA_STORE with a
+// new master key. The current key is located the same way the server does (see dataConfigGateway.LoadMasterKey). When
+// the current key is file based the new key replaces it once the store has been re-encrypted, otherwise the new key is
+// printed so that the secret holding ORCHESTRATOR_MASTER_KEY can be updated.
+//
+// A running server keeps decrypting with the key it loaded at start, so servers must be stopped before the rotation and
+// restarted after it. The rotation is refused while a server holds the lock of the config directory.
+func rotateMasterKey(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet(rotateMasterKeyCommand, flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(out, `Usage: hexaOrchestrator %s [flags]
+
+Re-encrypts the integration keys of the store selected by %s with a new master key.
+Running servers keep using the master key they were started with, so:
+  1. stop every orchestrator server using the store
+  2. run %s
+  3. update %s when the new key is printed, then restart the servers
+The rotation is refused while a server is running with the same config directory. Servers on other hosts sharing a
+sql database are not detected.
+
+Flags:
+`, rotateMasterKeyCommand, EnvDataStore, rotateMasterKeyCommand, dataConfigGateway.EnvMasterKey)
+		flags.PrintDefaults()
+	}
+	newKeyValue := flags.String("new-key", "", "base64 encoded 256-bit key to rotate to (default: generated)")
+	keyFile := flags.String("key-file", "", "file to write the new master key to (default: the current master key file)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	lock, err := lockConfigDir()
+	if err != nil {
+		return fmt.Errorf("stop the server before rotating the master key and restart it afterwards: %w", err)
+	}
+	defer func() { _ = lock.Close() }()
+
+	gateway, err := newDataGateway()
+	if err != nil {
+		return err
+	}
+	if closer, ok := gateway.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+	config, ok := gateway.(masterKeyStore)
+	if !ok {
+		return fmt.Errorf("the %s data store does not support master key rotation", os.Getenv(EnvDataStore))
+	}
+	location := storeLocation(gateway)
+	current := config.MasterKey()
+
+	var newKey *dataConfigGateway.MasterKey
+	if *newKeyValue != "" {
+		newKey, err = dataConfigGateway.ParseMasterKey(*newKeyValue)
+	} else {
+		newKey, err = dataConfigGateway.NewMasterKey()
+	}
+	if err != nil {
+		return err
+	}
+	if newKey.Id == current.Id {
+		return errors.New("new master key is the same as the current master key")
+	}
+
+	target := *keyFile
+	if target == "" {
+		target = current.Source
+	}
+	if target == "" {
+		if err = config.RotateMasterKey(newKey); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "Rotated master key %s to %s for %s\n", current.Id, newKey.Id, location)
+		if *newKeyValue == "" {
+			_, _ = fmt.Fprintf(out, "Set %s to the new master key:\n%s\n", dataConfigGateway.EnvMasterKey, newKey.Encode())
+		}
+		return nil
+	}
+
+	// write the new key aside first so that it is never lost if re-encrypting the store fails part way
+	pending := target + ".new"
+	if err = newKey.WriteFile(pending); err != nil {
+		return err
+	}
+	if err = config.RotateMasterKey(newKey); err != nil {
+		_ = os.Remove(pending)
+		return err
+	}
+	if err = os.Rename(pending, target); err != nil {
+		return fmt.Errorf("keys re-encrypted but the new master key is still in %s: %w", pending, err)
+	}
+	_, _ = fmt.Fprintf(out, "Rotated master key %s to %s for %s, new key written to %s\n", current.Id, newKey.Id, location, target)
+	return nil
+}
+
+// storeLocation describes where a data store keeps its integrations.
+func storeLocation(gateway dataConfigGateway.DataGateway) string {
+	switch store := gateway.(type) {
+	case *dataConfigGateway.ConfigData:
+		return store.ConfigFile
+	case *dataConfigGateway.SqlData:
+		return "the " + store.Driver + " database"
+	default:
+		return os.Getenv(EnvDataStore)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateMasterKey(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	t.Setenv(dataConfigGateway.EnvMasterKey, "")
+	t.Setenv(dataConfigGateway.EnvMasterKeyFile, "")
+
+	config, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+	_, err = config.Create("anAlias", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	oldKey := config.MasterKey()
+
+	var out bytes.Buffer
+	err = rotateMasterKey([]string{}, &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Rotated master key "+oldKey.Id)
+
+	keyFile := filepath.Join(dir, dataConfigGateway.MasterKeyFile)
+	newKey, err := dataConfigGateway.LoadMasterKey(dir)
+	assert.NoError(t, err)
+	assert.NotEqual(t, oldKey.Id, newKey.Id, "new key replaces the key file")
+	assert.NoFileExists(t, keyFile+".new")
+
+	rotated, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aKey"), rotated.GetIntegration("anAlias").Opts.Info.Key)
+
+	err = rotateMasterKey([]string{"-new-key", newKey.Encode()}, &out)
+	assert.EqualError(t, err, "new master key is the same as the current master key")
+}
+
+func TestRotateMasterKey_fromEnv(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	t.Setenv(dataConfigGateway.EnvMasterKeyFile, "")
+	oldKey, _ := dataConfigGateway.NewMasterKey()
+	t.Setenv(dataConfigGateway.EnvMasterKey, oldKey.Encode())
+
+	config, _ := dataConfigGateway.NewIntegrationConfigData()
+	_, err := config.Create("anAlias", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	err = rotateMasterKey([]string{}, &out)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3, "new key is printed")
+	assert.NoFileExists(t, filepath.Join(dir, dataConfigGateway.MasterKeyFile))
+
+	t.Setenv(dataConfigGateway.EnvMasterKey, lines[2])
+	rotated, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aKey"), rotated.GetIntegration("anAlias").Opts.Info.Key)
+
+	err = rotateMasterKey([]string{"-new-key", "invalid"}, &out)
+	assert.ErrorContains(t, err, "invalid master key")
+}
+
+func TestRotateMasterKey_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	t.Setenv(dataConfigGateway.EnvMasterKey, "")
+	t.Setenv(dataConfigGateway.EnvMasterKeyFile, "")
+	t.Setenv(EnvDataStore, "sql")
+	t.Setenv(dataConfigGateway.EnvDatabaseDriver, dataConfigGateway.DriverSqlite)
+	t.Setenv(dataConfigGateway.EnvDatabaseUrl, filepath.Join(dir, "orchestrator.db"))
+
+	data, err := dataConfigGateway.NewSqlConfigData(dataConfigGateway.DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	_, err = data.Create("anAlias", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	oldKey := data.MasterKey()
+	_ = data.Close()
+
+	var out bytes.Buffer
+	err = rotateMasterKey([]string{}, &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Rotated master key "+oldKey.Id)
+	assert.Contains(t, out.String(), "the sqlite database")
+
+	rotated, err := dataConfigGateway.NewSqlConfigData(dataConfigGateway.DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer rotated.Close()
+	assert.NotEqual(t, oldKey.Id, rotated.MasterKey().Id, "new key replaces the key file")
+	record, err := rotated.FindById("anAlias")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aKey"), record.Key)
+}
+
+func TestRotateMasterKey_whileServerRunning(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	t.Setenv(dataConfigGateway.EnvMasterKey, "")
+	t.Setenv(dataConfigGateway.EnvMasterKeyFile, "")
+	_, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	lock, err := lockConfigDir()
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	err = rotateMasterKey([]string{}, &out)
+	assert.ErrorIs(t, err, errServerRunning)
+	assert.ErrorContains(t, err, dir)
+	assert.NoFileExists(t, filepath.Join(dir, dataConfigGateway.MasterKeyFile+".new"))
+
+	_ = lock.Close()
+	assert.NoError(t, rotateMasterKey([]string{}, &out), "the lock is released when the server stops")
+
+	out.Reset()
+	assert.ErrorIs(t, rotateMasterKey([]string{"-h"}, &out), flag.ErrHelp)
+	assert.Contains(t, out.String(), "stop every orchestrator server")
+}
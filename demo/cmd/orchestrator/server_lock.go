@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+// serverLockFile is locked by a running server in the config directory, so that the master key is not rotated under it.
+const serverLockFile = "orchestrator.lock"
+
+var errServerRunning = errors.New("an orchestrator server is running")
+
+// lockConfigDir takes the server lock in the config directory. The lock is released by closing the returned file, or by
+// the operating system when the process exits, so a server that was killed does not leave it behind.
+func lockConfigDir() (*os.File, error) {
+	configDir, err := dataConfigGateway.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(configDir, serverLockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(file); err != nil {
+		_ = file.Close()
+		if errors.Is(err, errServerRunning) {
+			return nil, fmt.Errorf("%w with the config directory %s", err, configDir)
+		}
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile does not lock where advisory file locks are not available, the usage of rotate-master-key asks for the
+// server to be stopped first.
+func lockFile(_ *os.File) error {
+	return nil
+}
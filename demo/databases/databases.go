@@ -0,0 +1,8 @@
+// Package databases embeds the orchestrator schema migrations so that they can be applied by the SQL data gateway
+// as well as by the migrate tool used in the docker and dev scripts.
+package databases
+
+import "embed"
+
+//go:embed orchestrator/*.sql
+var Orchestrator embed.FS
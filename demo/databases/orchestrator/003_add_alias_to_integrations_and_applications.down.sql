@@ -0,0 +1,4 @@
+drop index if exists applications_alias_idx;
+drop index if exists integrations_alias_idx;
+alter table applications drop column alias;
+alter table integrations drop column alias;
@@ -0,0 +1,6 @@
+alter table integrations add column alias varchar(255);
+alter table applications add column alias varchar(255);
+update integrations set alias = cast(id as varchar(255));
+update applications set alias = cast(id as varchar(255));
+create unique index integrations_alias_idx on integrations (alias);
+create unique index applications_alias_idx on applications (alias);
@@ -0,0 +1,2 @@
+alter table integrations add column updated_at timestamp;
+update integrations set updated_at = created_at;
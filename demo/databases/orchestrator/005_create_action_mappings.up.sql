@@ -0,0 +1,7 @@
+create table action_mappings (
+    from_id       varchar(255) not null,
+    to_id         varchar(255) not null,
+    source_action varchar(512) not null,
+    target_action varchar(512) not null,
+    primary key (from_id, to_id, source_action, target_action)
+);
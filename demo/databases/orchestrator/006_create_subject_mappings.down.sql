@@ -0,0 +1 @@
+drop table if exists subject_mappings;
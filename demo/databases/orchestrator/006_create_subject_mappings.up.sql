@@ -0,0 +1,8 @@
+create table subject_mappings (
+    from_id varchar(255) not null,
+    to_id   varchar(255) not null,
+    kind    varchar(32)  not null,
+    source  varchar(512) not null,
+    target  varchar(512) not null,
+    primary key (from_id, to_id, kind, source)
+);
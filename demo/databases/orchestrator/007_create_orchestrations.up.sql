@@ -0,0 +1,14 @@
+create table orchestrations (
+    id               varchar(255) not null primary key,
+    name             varchar(255) not null,
+    from_id          varchar(255) not null,
+    targets          text         not null,
+    resources        text,
+    schedule         varchar(255),
+    paused           boolean      not null default false,
+    last_started_at  timestamp,
+    last_finished_at timestamp,
+    last_error       text,
+    created_at       timestamp default now(),
+    updated_at       timestamp default now()
+);
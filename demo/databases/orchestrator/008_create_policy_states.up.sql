@@ -0,0 +1,10 @@
+create table policy_states (
+    application_id varchar(255) not null primary key,
+    desired        text         not null,
+    declared       boolean      not null default false,
+    desired_at     timestamp    default now(),
+    checked_at     timestamp,
+    drifted        boolean      not null default false,
+    found          text,
+    drift_error    text
+);
@@ -0,0 +1,9 @@
+create table policy_versions (
+    application_id varchar(255) not null,
+    version        integer      not null,
+    policies       text         not null,
+    author         varchar(255),
+    reason         text,
+    created_at     timestamp    default now(),
+    primary key (application_id, version)
+);
@@ -0,0 +1,11 @@
+create table if not exists jobs (
+    id         varchar(255) not null primary key,
+    state      varchar(32)  not null,
+    author     varchar(255),
+    request    text         not null,
+    steps      text,
+    result     text,
+    error      text,
+    created_at timestamp    default now(),
+    updated_at timestamp    default now()
+);
@@ -0,0 +1,8 @@
+create table if not exists dead_letters (
+    id        varchar(255) not null primary key,
+    kind      varchar(64)  not null,
+    task_id   varchar(255) not null,
+    attempts  integer      not null,
+    error     text,
+    failed_at timestamp    default now()
+);
@@ -0,0 +1 @@
+alter table integrations drop column key_rotated_at;
@@ -0,0 +1 @@
+alter table integrations add column key_rotated_at timestamp;
@@ -0,0 +1,2 @@
+alter table integrations drop column wrapped_key;
+alter table integrations drop column master_key_id;
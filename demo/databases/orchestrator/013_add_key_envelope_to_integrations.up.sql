@@ -0,0 +1,2 @@
+alter table integrations add column master_key_id varchar(255);
+alter table integrations add column wrapped_key bytea;
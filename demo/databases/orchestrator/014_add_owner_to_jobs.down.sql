@@ -0,0 +1,2 @@
+alter table jobs drop column heartbeat_at;
+alter table jobs drop column owner;
@@ -0,0 +1,2 @@
+alter table jobs add column owner varchar(255);
+alter table jobs add column heartbeat_at timestamp;
@@ -17,14 +17,19 @@ var resources embed.FS
 
 type Client interface {
 	Health() (string, error)
+	IntegrationHealth() ([]IntegrationHealth, error)
 	Integrations() ([]Integration, error)
 	CreateIntegration(name string, provider string, key []byte) error
 	DeleteIntegration(id string) error
+	RotateIntegrationKey(id string, key []byte) error
 	Applications(refresh bool) ([]Application, error)
 	Application(id string) (Application, error)
-	GetPolicies(id string) ([]hexapolicy.PolicyInfo, string, error)
-	SetPolicies(id string, policies string) error
+	GetPolicies(id string) ([]hexapolicy.PolicyInfo, string, string, error)
+	SetPolicies(id string, policies string, etag string) error
 	Orchestration(from string, to string) error
+	OrchestrationPreview(from string, to string) (OrchestrationPreview, error)
+	Audit(filter AuditFilter) ([]AuditEntry, error)
+	VerifyAudit() (AuditVerification, error)
 	GetHttpClient() HTTPClient
 }
 
@@ -40,6 +45,11 @@ func LoadHandlers(orchestratorUrl string, client Client, sessionHandler sessionS
 	integrations := NewIntegrationsHandler(orchestratorUrl, client, sessionHandler)
 	orchestration := NewOrchestrationHandler(orchestratorUrl, client, sessionHandler)
 	status := NewStatusHandler(orchestratorUrl, client)
+	audit := NewAuditHandler(client, sessionHandler)
+
+	// oidcSupport only checks that there is a session, it does not check its scopes. Scopes are enforced by the
+	// orchestrator on the token the admin calls it with, see hexaConstants.
+	scopes := []string{"integration"}
 
 	return func(router *mux.Router) {
 
@@ -52,18 +62,21 @@ func LoadHandlers(orchestratorUrl string, client Client, sessionHandler sessionS
 			router.HandleFunc("/", IndexHandler)
 		}
 
-		router.HandleFunc("/integrations", oidcHandler.HandleSessionScope(integrations.List, []string{"integration"})).Methods("GET")
-		router.HandleFunc("/integrations/new", oidcHandler.HandleSessionScope(integrations.New, []string{"integration"})).Methods("GET").Queries("provider", "{provider}")
-		router.HandleFunc("/integrations", oidcHandler.HandleSessionScope(integrations.CreateIntegration, []string{"integration"})).Methods("POST")
-		router.HandleFunc("/integrations/{id}", oidcHandler.HandleSessionScope(integrations.Delete, []string{"integration"})).Methods("POST")
-		router.HandleFunc("/applications", oidcHandler.HandleSessionScope(apps.List, []string{"integration"})).Methods("GET")
-		router.HandleFunc("/applications/{id}", oidcHandler.HandleSessionScope(apps.Show, []string{"integration"})).Methods("GET")
-		router.HandleFunc("/applications/{id}/policies", oidcHandler.HandleSessionScope(apps.Policies, []string{"integration"})).Methods("GET")
-		router.HandleFunc("/applications/{id}/edit", oidcHandler.HandleSessionScope(apps.Edit, []string{"integration"})).Methods("GET")
-		router.HandleFunc("/applications/{id}", oidcHandler.HandleSessionScope(apps.Update, []string{"integration"})).Methods("POST")
-		router.HandleFunc("/orchestration/new", oidcHandler.HandleSessionScope(orchestration.New, []string{"integration"})).Methods("GET")
-		router.HandleFunc("/orchestration", oidcHandler.HandleSessionScope(orchestration.Update, []string{"integration"})).Methods("POST")
-		router.HandleFunc("/status", oidcHandler.HandleSessionScope(status.StatusHandler, []string{"integration"})).Methods("GET")
+		router.HandleFunc("/integrations", oidcHandler.HandleSessionScope(integrations.List, scopes)).Methods("GET")
+		router.HandleFunc("/integrations/new", oidcHandler.HandleSessionScope(integrations.New, scopes)).Methods("GET").Queries("provider", "{provider}")
+		router.HandleFunc("/integrations", oidcHandler.HandleSessionScope(integrations.CreateIntegration, scopes)).Methods("POST")
+		router.HandleFunc("/integrations/{id}", oidcHandler.HandleSessionScope(integrations.Delete, scopes)).Methods("POST")
+		router.HandleFunc("/integrations/{id}/credentials", oidcHandler.HandleSessionScope(integrations.RotateKey, scopes)).Methods("POST")
+		router.HandleFunc("/applications", oidcHandler.HandleSessionScope(apps.List, scopes)).Methods("GET")
+		router.HandleFunc("/applications/{id}", oidcHandler.HandleSessionScope(apps.Show, scopes)).Methods("GET")
+		router.HandleFunc("/applications/{id}/policies", oidcHandler.HandleSessionScope(apps.Policies, scopes)).Methods("GET")
+		router.HandleFunc("/applications/{id}/edit", oidcHandler.HandleSessionScope(apps.Edit, scopes)).Methods("GET")
+		router.HandleFunc("/applications/{id}", oidcHandler.HandleSessionScope(apps.Update, scopes)).Methods("POST")
+		router.HandleFunc("/orchestration/new", oidcHandler.HandleSessionScope(orchestration.New, scopes)).Methods("GET")
+		router.HandleFunc("/orchestration/preview", oidcHandler.HandleSessionScope(orchestration.Preview, scopes)).Methods("POST")
+		router.HandleFunc("/orchestration", oidcHandler.HandleSessionScope(orchestration.Update, scopes)).Methods("POST")
+		router.HandleFunc("/status", oidcHandler.HandleSessionScope(status.StatusHandler, scopes)).Methods("GET")
+		router.HandleFunc("/audit", oidcHandler.HandleSessionScope(audit.List, scopes)).Methods("GET")
 
 		staticFs, _ := fs.Sub(resources, "resources/static")
 		fileServer := http.FileServer(http.FS(staticFs))
@@ -3,6 +3,7 @@ package admin
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -20,6 +21,7 @@ type Application struct {
 	Description   string
 	ProviderName  string
 	Service       string
+	Drift         string // in_sync, drifted, error or unknown, see the orchestrator's GET /applications/{id}/drift
 }
 
 type ApplicationsHandler interface {
@@ -74,7 +76,7 @@ func (p appsHandler) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// / todo - consider one rest call here?
-	foundPolicies, rawJson, policiesError := p.client.GetPolicies(identifier)
+	foundPolicies, rawJson, _, policiesError := p.client.GetPolicies(identifier)
 	if policiesError != nil {
 		model := websupport.Model{Map: map[string]interface{}{"resource": "applications", "message": policiesError.Error()}}
 		_ = websupport.ModelAndView(w, &resources, "applications_show", model)
@@ -108,7 +110,7 @@ func (p appsHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		sessionInfo = &sessionSupport.SessionInfo{}
 	}
-	foundPolicies, rawJson, policiesError := p.client.GetPolicies(identifier)
+	foundPolicies, rawJson, etag, policiesError := p.client.GetPolicies(identifier)
 	if policiesError != nil {
 
 		model := websupport.Model{Map: map[string]interface{}{"resource": "applications", "application": foundApplication, "message": policiesError.Error(), "session": sessionInfo}}
@@ -119,15 +121,19 @@ func (p appsHandler) Edit(w http.ResponseWriter, r *http.Request) {
 
 	var buffer bytes.Buffer
 	_ = json.Indent(&buffer, []byte(rawJson), "", "  ")
-	model := websupport.Model{Map: map[string]interface{}{"resource": "applications", "application": foundApplication, "policies": foundPolicies, "rawJson": buffer.String(), "session": sessionInfo}}
+	model := websupport.Model{Map: map[string]interface{}{"resource": "applications", "application": foundApplication, "policies": foundPolicies, "rawJson": buffer.String(), "etag": etag, "session": sessionInfo}}
 	_ = websupport.ModelAndView(w, &resources, "applications_edit", model)
 }
 
 func (p appsHandler) Update(w http.ResponseWriter, r *http.Request) {
 	identifier := mux.Vars(r)["id"]
 	desiredPolicies := r.FormValue("policy")
-	clientErr := p.client.SetPolicies(identifier, desiredPolicies)
+	clientErr := p.client.SetPolicies(identifier, desiredPolicies, r.FormValue("etag"))
 
+	if errors.Is(clientErr, ErrPolicyConflict) {
+		p.conflict(w, r, identifier, desiredPolicies)
+		return
+	}
 	if clientErr != nil {
 		foundApplication, _ := p.client.Application(identifier)
 		model := websupport.Model{Map: map[string]interface{}{"resource": "applications", "application": foundApplication, "policies": desiredPolicies, "message": clientErr.Error()}}
@@ -139,11 +145,34 @@ func (p appsHandler) Update(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, applicationsEndpoint, http.StatusMovedPermanently)
 }
 
+// conflict shows the policies someone else saved next to the desired policies, so the desired policies can be
+// merged and saved again against the policies the application has now.
+func (p appsHandler) conflict(w http.ResponseWriter, r *http.Request, identifier string, desiredPolicies string) {
+	sessionInfo, err := p.session.Session(r)
+	if err != nil {
+		sessionInfo = &sessionSupport.SessionInfo{}
+	}
+	foundApplication, _ := p.client.Application(identifier)
+	_, rawJson, etag, policiesError := p.client.GetPolicies(identifier)
+	if policiesError != nil {
+		model := websupport.Model{Map: map[string]interface{}{"resource": "applications", "application": foundApplication, "message": policiesError.Error(), "session": sessionInfo}}
+		_ = websupport.ModelAndView(w, &resources, "applications_edit", model)
+		log.Println(policiesError)
+		return
+	}
+
+	var buffer bytes.Buffer
+	_ = json.Indent(&buffer, []byte(rawJson), "", "  ")
+	model := websupport.Model{Map: map[string]interface{}{"resource": "applications", "application": foundApplication, "currentJson": buffer.String(), "rawJson": desiredPolicies, "etag": etag, "session": sessionInfo}}
+	w.WriteHeader(http.StatusConflict)
+	_ = websupport.ModelAndView(w, &resources, "applications_conflict", model)
+}
+
 // todo - maybe the below should be closer to the orchestration functions
 
 func (p appsHandler) Policies(w http.ResponseWriter, r *http.Request) {
 	identifier := mux.Vars(r)["id"]
-	_, rawJson, _ := p.client.GetPolicies(identifier)
+	_, rawJson, _, _ := p.client.GetPolicies(identifier)
 	var buffer bytes.Buffer
 	_ = json.Indent(&buffer, []byte(rawJson), "", "  ")
 	w.Header().Set("content-type", "application/json")
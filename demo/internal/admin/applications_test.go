@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"testing"
 
@@ -75,6 +76,20 @@ func (suite *ApplicationsSuite) TestApplications() {
 	assert.Contains(suite.T(), string(body), "AppEngine")
 }
 
+func (suite *ApplicationsSuite) TestApplications_drift() {
+	suite.client.DesiredApplications = []admin.Application{
+		{ID: "anId", ObjectId: "anObjectId", Drift: "drifted"},
+		{ID: "anotherId", ObjectId: "anotherObjectId", Drift: "in_sync"},
+		{ID: "yetAnotherId", ObjectId: "yetAnotherObjectId", Drift: "unknown"},
+	}
+
+	resp, _ := http.Get(fmt.Sprintf("http://%s/applications", suite.server.Addr))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), `<a class="status orange"></a> Drifted`)
+	assert.Contains(suite.T(), string(body), `<a class="status green"></a> In sync`)
+	assert.NotContains(suite.T(), string(body), "Unable to check")
+}
+
 func (suite *ApplicationsSuite) TestApplications_with_error() {
 	suite.client.Errs = map[string]error{"http://noop/applications": errors.New("oops")}
 
@@ -229,6 +244,37 @@ func (suite *ApplicationsSuite) TestApplication_Update() {
 	assert.Contains(suite.T(), sbody, "aResourceId")
 }
 
+func (suite *ApplicationsSuite) TestApplication_Edit_keepsEtag() {
+	suite.client.DesiredApplications = []admin.Application{
+		{ID: "anId", IntegrationId: "anIntegrationId", ObjectId: "anObjectId", Name: "aName", Description: "aDescription", ProviderName: "google_cloud"},
+	}
+	suite.client.DesiredEtag = `"anEtag"`
+
+	resp, _ := http.Get(fmt.Sprintf("http://%s/applications/anId/edit", suite.server.Addr))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), `name="etag" value="&#34;anEtag&#34;"`)
+}
+
+func (suite *ApplicationsSuite) TestApplication_Update_withConflict() {
+	suite.client.DesiredApplications = []admin.Application{
+		{ID: "anId", IntegrationId: "anIntegrationId", ObjectId: "anObjectId", Name: "aName", Description: "aDescription", ProviderName: "google_cloud"},
+	}
+	suite.client.DesiredEtag = `"theirEtag"`
+
+	form := url.Values{"policy": {"myPolicies"}, "etag": {`"myEtag"`}}
+	resp, _ := http.PostForm(fmt.Sprintf("http://%s/applications/anId", suite.server.Addr), form)
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), "changed by someone else")
+	assert.Contains(suite.T(), string(body), "myPolicies")
+	assert.Contains(suite.T(), string(body), `name="etag" value="&#34;theirEtag&#34;"`)
+
+	form.Set("etag", `"theirEtag"`)
+	resp, _ = http.PostForm(fmt.Sprintf("http://%s/applications/anId", suite.server.Addr), form)
+	body, _ = io.ReadAll(resp.Body)
+	assert.NotContains(suite.T(), string(body), "changed by someone else")
+}
+
 func (suite *ApplicationsSuite) TestApplication_Update_withErroneousGet() {
 	suite.client.Errs = map[string]error{"http://noop/applications/anId": errors.New("oops")}
 
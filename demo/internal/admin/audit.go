@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/pkg/sessionSupport"
+	"github.com/hexa-org/policy-mapper/pkg/websupport"
+)
+
+// AuditEntry is a change made through the orchestrator, by whom, and how it went. Subject is the email of the caller
+// when the orchestrator knows it.
+type AuditEntry struct {
+	Sequence int64
+	Time     time.Time
+	Subject  string
+	Action   string
+	Targets  []string
+	Policies []AuditPolicyChange
+	Outcome  string
+	Status   int
+	Hash     string
+}
+
+// AuditPolicyChange is the hash of the policies of an application before and after they were written.
+type AuditPolicyChange struct {
+	Application string
+	Before      string
+	After       string
+}
+
+// ShortBefore and ShortAfter abbreviate the hashes for display, the full hashes are in the audit log.
+func (change AuditPolicyChange) ShortBefore() string {
+	return shortHash(change.Before)
+}
+
+func (change AuditPolicyChange) ShortAfter() string {
+	return shortHash(change.After)
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	if hash == "" {
+		return "-"
+	}
+	return hash
+}
+
+// AuditFilter selects audit entries, fields that are empty select every entry.
+type AuditFilter struct {
+	Subject string
+	Action  string
+	Target  string
+	Outcome string
+}
+
+// AuditVerification is whether the hash chain of the audit log of the orchestrator is intact.
+type AuditVerification struct {
+	Valid   bool
+	Entries int64
+	Error   string
+}
+
+type AuditHandler struct {
+	client  Client
+	session sessionSupport.SessionManager
+}
+
+func NewAuditHandler(client Client, sessionHandler sessionSupport.SessionManager) AuditHandler {
+	return AuditHandler{client, sessionHandler}
+}
+
+// List shows the latest audit entries, filtered by the subject, action, target and outcome parameters.
+func (a AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := AuditFilter{Subject: query.Get("subject"), Action: query.Get("action"), Target: query.Get("target"), Outcome: query.Get("outcome")}
+	sessionInfo, err := a.session.Session(r)
+	if err != nil {
+		sessionInfo = &sessionSupport.SessionInfo{}
+	}
+
+	entries, err := a.client.Audit(filter)
+	if err != nil {
+		model := websupport.Model{Map: map[string]interface{}{"resource": "audit", "filter": filter, "message": err.Error(), "session": sessionInfo}}
+		_ = websupport.ModelAndView(w, &resources, "audit", model)
+		log.Println(err)
+		return
+	}
+	verification, err := a.client.VerifyAudit()
+	if err != nil {
+		verification = AuditVerification{Error: err.Error()}
+	}
+	model := websupport.Model{Map: map[string]interface{}{"resource": "audit", "filter": filter, "entries": entries, "verification": verification, "session": sessionInfo}}
+	_ = websupport.ModelAndView(w, &resources, "audit", model)
+}
@@ -0,0 +1,90 @@
+package admin_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-mapper/pkg/healthsupport"
+	"github.com/hexa-org/policy-mapper/pkg/sessionSupport"
+	"github.com/hexa-org/policy-mapper/pkg/websupport"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/admin"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/admin/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+type AuditData struct {
+	server *http.Server
+	client adminMock.MockClient
+}
+
+func (data *AuditData) SetUp() {
+	data.client = adminMock.MockClient{Url: "http://noop"}
+	handler := admin.NewAuditHandler(&data.client, sessionSupport.NewSessionManager())
+	listener, _ := net.Listen("tcp", "localhost:0")
+	data.server = websupport.Create(listener.Addr().String(), func(router *mux.Router) {
+		router.HandleFunc("/audit", handler.List).Methods("GET")
+	}, websupport.Options{})
+
+	go websupport.Start(data.server, listener)
+	healthsupport.WaitForHealthy(data.server)
+}
+
+func (data *AuditData) TearDown() {
+	websupport.Stop(data.server)
+	data.server = nil
+}
+
+func TestAuditHandler(t *testing.T) {
+	testsupport.WithSetUp(&AuditData{}, func(data *AuditData) {
+		data.client.DesiredAudit = []admin.AuditEntry{{
+			Sequence: 7,
+			Time:     time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+			Subject:  "a@example.com",
+			Action:   "policies.set",
+			Targets:  []string{"anApp"},
+			Policies: []admin.AuditPolicyChange{{Application: "anApp", Before: "0123456789abcdef", After: "fedcba9876543210"}},
+			Outcome:  "success",
+			Status:   http.StatusCreated,
+		}}
+		data.client.DesiredVerification = admin.AuditVerification{Valid: true, Entries: 7}
+
+		resp, _ := http.Get(fmt.Sprintf("http://%s/audit?subject=a@example.com&outcome=success", data.server.Addr))
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, admin.AuditFilter{Subject: "a@example.com", Outcome: "success"}, data.client.DesiredAuditFilter)
+		assert.Contains(t, string(body), "The hash chain of the 7 entries is intact.")
+		assert.Contains(t, string(body), `<option value="success" selected>`)
+		assert.Contains(t, string(body), "<td>2024-05-06 07:08:09</td>")
+		assert.Contains(t, string(body), "<td>policies.set</td>")
+		assert.Contains(t, string(body), "anApp: 0123456789ab &rarr; fedcba987654")
+	})
+}
+
+func TestAuditHandler_tampered(t *testing.T) {
+	testsupport.WithSetUp(&AuditData{}, func(data *AuditData) {
+		data.client.DesiredVerification = admin.AuditVerification{Error: "audit log hash chain is broken: entry 2 does not match its hash"}
+
+		resp, _ := http.Get(fmt.Sprintf("http://%s/audit", data.server.Addr))
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Contains(t, string(body), "The audit log may have been tampered with. audit log hash chain is broken: entry 2 does not match its hash")
+	})
+}
+
+func TestAuditHandler_withErroneousGet(t *testing.T) {
+	testsupport.WithSetUp(&AuditData{}, func(data *AuditData) {
+		data.client.Errs = map[string]error{"http://noop/audit": errors.New("oops")}
+
+		resp, _ := http.Get(fmt.Sprintf("http://%s/audit", data.server.Addr))
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Contains(t, string(body), "Something went wrong. oops")
+	})
+}
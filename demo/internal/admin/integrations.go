@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hexa-org/policy-mapper/pkg/sessionSupport"
@@ -19,10 +20,14 @@ type IntegrationProviderInterface interface {
 }
 
 type Integration struct {
-	ID       string
-	Name     string
-	Provider string
-	Key      []byte
+	ID             string
+	Name           string
+	Provider       string
+	KeyFingerprint string
+	CreatedAt      *time.Time
+	UpdatedAt      *time.Time
+	KeyRotatedAt   *time.Time
+	AppCount       int
 }
 
 type IntegrationHandler interface {
@@ -30,6 +35,7 @@ type IntegrationHandler interface {
 	New(w http.ResponseWriter, r *http.Request)
 	CreateIntegration(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
+	RotateKey(w http.ResponseWriter, r *http.Request)
 }
 
 type integrationsHandler struct {
@@ -49,6 +55,10 @@ func NewIntegrationsHandler(orchestratorUrl string, client Client, sessionHandle
 }
 
 func (i integrationsHandler) List(w http.ResponseWriter, r *http.Request) {
+	i.listWithMessage(w, r, "")
+}
+
+func (i integrationsHandler) listWithMessage(w http.ResponseWriter, r *http.Request, message string) {
 	integrations, err := i.client.Integrations()
 	if err != nil {
 		model := websupport.Model{Map: map[string]interface{}{"resource": "integrations", "message": "Unable to contact orchestrator."}}
@@ -70,6 +80,9 @@ func (i integrationsHandler) List(w http.ResponseWriter, r *http.Request) {
 		sessionInfo = &sessionSupport.SessionInfo{}
 	}
 	model := websupport.Model{Map: map[string]interface{}{"resource": "integrations", "integrations": integrations, "session": sessionInfo}}
+	if message != "" {
+		model.Map["message"] = message
+	}
 	_ = websupport.ModelAndView(w, &resources, "integrations", model)
 }
 
@@ -152,6 +165,33 @@ func (i integrationsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/integrations", http.StatusMovedPermanently)
 }
 
+// RotateKey replaces the key of an integration with an uploaded key file. The orchestrator refuses a key that its
+// applications cannot be discovered with.
+func (i integrationsHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	identifier := mux.Vars(r)["id"]
+	message := ""
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		message = "Missing key file."
+	} else if file, _, err := r.FormFile("key"); err != nil {
+		message = "Missing key file."
+	} else {
+		key, err := io.ReadAll(file)
+		_ = file.Close()
+		if err == nil {
+			err = i.client.RotateIntegrationKey(identifier, key)
+		}
+		if err != nil {
+			log.Println(err)
+			message = "Unable to rotate the key of " + identifier + ", the key was not changed."
+		}
+	}
+	if message != "" {
+		i.listWithMessage(w, r, message)
+		return
+	}
+	http.Redirect(w, r, "/integrations", http.StatusMovedPermanently)
+}
+
 func (i integrationsHandler) viewWithMessage(w http.ResponseWriter, provider string, message string, integrationView string) {
 
 	model := websupport.Model{Map: map[string]interface{}{"resource": "integrations", "provider": provider, "message": message}}
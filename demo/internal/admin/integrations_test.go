@@ -52,6 +52,9 @@ func (suite *IntegrationsSuite) TestListIntegrations() {
 	resp := suite.must(http.Get(fmt.Sprintf("http://%s/integrations", suite.server.Addr)))
 	body, _ := io.ReadAll(resp.Body)
 	assert.Contains(suite.T(), string(body), "Discovery")
+	assert.Contains(suite.T(), string(body), "Key Fingerprint")
+	assert.Contains(suite.T(), string(body), "HMAC-SHA256:2c2e8f0d14b1a4c8")
+	assert.Contains(suite.T(), string(body), `action="integrations/anId/credentials"`)
 }
 
 func (suite *IntegrationsSuite) TestListIntegrations_templateRenders() {
@@ -201,6 +204,31 @@ func (suite *IntegrationsSuite) TestDeleteIntegration_with_error() {
 	assert.Equal(suite.T(), http.StatusInternalServerError, resp.StatusCode)
 }
 
+func (suite *IntegrationsSuite) TestRotateIntegrationKey() {
+	suite.client.On("RotateIntegrationKey", "http://noop/integrations/101/credentials").Return()
+	buf, contentType := suite.multipartFormSuccessAzure()
+	resp := suite.must(http.Post(fmt.Sprintf("http://%s/integrations/101/credentials", suite.server.Addr), contentType, buf))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), "Discovery")
+	assert.NotContains(suite.T(), string(body), "Something went wrong.")
+	assert.Contains(suite.T(), string(suite.client.Key), "anAppId")
+}
+
+func (suite *IntegrationsSuite) TestRotateIntegrationKey_withMissingFile() {
+	buf, contentType := suite.multipartFormMissingFile()
+	resp := suite.must(http.Post(fmt.Sprintf("http://%s/integrations/101/credentials", suite.server.Addr), contentType, buf))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), "Something went wrong. Missing key file.")
+}
+
+func (suite *IntegrationsSuite) TestRotateIntegrationKey_with_error() {
+	suite.client.On("RotateIntegrationKey", "http://noop/integrations/101/credentials").Return(errors.New("the provider did not accept the key"))
+	buf, contentType := suite.multipartFormSuccessAzure()
+	resp := suite.must(http.Post(fmt.Sprintf("http://%s/integrations/101/credentials", suite.server.Addr), contentType, buf))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), "Something went wrong. Unable to rotate the key of 101, the key was not changed.")
+}
+
 func (suite *IntegrationsSuite) must(resp *http.Response, _ error) *http.Response {
 	return resp
 }
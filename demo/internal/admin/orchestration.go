@@ -1,15 +1,36 @@
 package admin
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/pkg/sessionSupport"
 	"github.com/hexa-org/policy-mapper/pkg/websupport"
 )
 
+type OrchestrationPreview struct {
+	Policies []hexapolicy.PolicyInfo
+	Added    []hexapolicy.PolicyInfo
+	Removed  []hexapolicy.PolicyInfo
+	Changed  []PolicyChange
+}
+
+type PolicyChange struct {
+	PolicyId    string
+	Differences []string
+	Before      hexapolicy.PolicyInfo
+	After       hexapolicy.PolicyInfo
+}
+
+func (o OrchestrationPreview) HasChanges() bool {
+	return len(o.Added) > 0 || len(o.Removed) > 0 || len(o.Changed) > 0
+}
+
 type OrchestrationHandler interface {
 	New(w http.ResponseWriter, r *http.Request)
+	Preview(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
 }
 
@@ -50,6 +71,44 @@ func (p orchestrationHandler) New(w http.ResponseWriter, r *http.Request) {
 	_ = websupport.ModelAndView(w, &resources, "orchestration_new", model)
 }
 
+func (p orchestrationHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	from := r.FormValue("from")
+	to := r.FormValue("to")
+	sessionInfo, err := p.session.Session(r)
+	if err != nil {
+		sessionInfo = &sessionSupport.SessionInfo{}
+	}
+
+	foundApplications, clientErr := p.client.Applications(false)
+	if clientErr != nil {
+		model := websupport.Model{Map: map[string]interface{}{"resource": "orchestration", "message": clientErr.Error(), "session": sessionInfo}}
+		_ = websupport.ModelAndView(w, &resources, "orchestration_new", model)
+		log.Println(clientErr)
+		return
+	}
+
+	preview, clientErr := p.client.OrchestrationPreview(from, to)
+	if clientErr != nil {
+		model := websupport.Model{Map: map[string]interface{}{"resource": "orchestration", "applications": foundApplications, "from": from, "to": to, "message": clientErr.Error(), "session": sessionInfo}}
+		_ = websupport.ModelAndView(w, &resources, "orchestration_new", model)
+		log.Println(clientErr)
+		return
+	}
+
+	model := websupport.Model{Map: map[string]interface{}{
+		"resource":     "orchestration",
+		"applications": foundApplications,
+		"from":         from,
+		"to":           to,
+		"preview":      preview,
+		"addedJson":    indentedJson(preview.Added),
+		"removedJson":  indentedJson(preview.Removed),
+		"changedJson":  indentedJson(preview.Changed),
+		"session":      sessionInfo,
+	}}
+	_ = websupport.ModelAndView(w, &resources, "orchestration_new", model)
+}
+
 func (p orchestrationHandler) Update(w http.ResponseWriter, r *http.Request) {
 	clientErr := p.client.Orchestration(r.FormValue("from"), r.FormValue("to"))
 	if clientErr != nil {
@@ -60,3 +119,8 @@ func (p orchestrationHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	http.Redirect(w, r, "/orchestration/new", http.StatusMovedPermanently)
 }
+
+func indentedJson(value interface{}) string {
+	data, _ := json.MarshalIndent(value, "", "  ")
+	return string(data)
+}
@@ -6,8 +6,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"testing"
 
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/pkg/sessionSupport"
 	"github.com/hexa-org/policy-orchestrator/demo/internal/admin"
 	"github.com/hexa-org/policy-orchestrator/demo/internal/admin/test"
@@ -79,3 +81,37 @@ func (suite *OrchestrationSuite) TestUpdateOrchestration_withError() {
 	body, _ := io.ReadAll(resp.Body)
 	assert.Contains(suite.T(), string(body), "oops")
 }
+
+func (suite *OrchestrationSuite) TestPreviewOrchestration() {
+	suite.client.DesiredApplications = []admin.Application{
+		{ID: "anId", IntegrationId: "anIntegrationId", ObjectId: "anObjectId", Name: "aName", Description: "aDescription", ProviderName: "google_cloud"},
+		{ID: "anotherId", IntegrationId: "anotherIntegrationId", ObjectId: "anotherObjectId", Name: "anotherName", Description: "anotherDescription", ProviderName: "google_cloud"},
+	}
+	added := hexapolicy.PolicyInfo{Meta: hexapolicy.MetaInfo{Version: "0.7"}, Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"user:aUser"}, Object: "anObjectId"}
+	suite.client.DesiredPreview = admin.OrchestrationPreview{Policies: []hexapolicy.PolicyInfo{added}, Added: []hexapolicy.PolicyInfo{added}}
+
+	resp, _ := http.PostForm(fmt.Sprintf("http://%s/orchestration/preview", suite.server.Addr), url.Values{"from": {"anId"}, "to": {"anotherId"}})
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Contains(suite.T(), string(body), "Pending Changes")
+	assert.Contains(suite.T(), string(body), "Added (1)")
+	assert.Contains(suite.T(), string(body), "Removed (0)")
+	assert.Contains(suite.T(), string(body), "user:aUser")
+	assert.Contains(suite.T(), string(body), "<option value=\"anotherId\" selected>")
+	assert.Contains(suite.T(), string(body), "<input type=\"hidden\" name=\"to\" value=\"anotherId\"/>")
+}
+
+func (suite *OrchestrationSuite) TestPreviewOrchestration_withoutChanges() {
+	resp, _ := http.PostForm(fmt.Sprintf("http://%s/orchestration/preview", suite.server.Addr), url.Values{"from": {"anId"}, "to": {"anotherId"}})
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), "No changes.")
+}
+
+func (suite *OrchestrationSuite) TestPreviewOrchestration_withError() {
+	suite.client.Errs = map[string]error{"http://noop/orchestration?dryRun=true": errors.New("oops")}
+
+	resp, _ := http.PostForm(fmt.Sprintf("http://%s/orchestration/preview", suite.server.Addr), url.Values{"from": {"anId"}, "to": {"anotherId"}})
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(suite.T(), string(body), "oops")
+	assert.NotContains(suite.T(), string(body), "Pending Changes")
+}
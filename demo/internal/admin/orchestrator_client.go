@@ -7,14 +7,21 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	log "golang.org/x/exp/slog"
 
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
 )
 
+// ErrPolicyConflict is returned by SetPolicies when the policies were changed by someone else since they were read.
+var ErrPolicyConflict = errors.New("the policies were changed by someone else since they were read")
+
 type HTTPClient interface {
 	Get(url string) (resp *http.Response, err error)
 	Do(req *http.Request) (*http.Response, error)
@@ -28,6 +35,9 @@ type orchestratorClient struct {
 
 // GetHttpClient used mainly for testing
 func (c orchestratorClient) GetHttpClient() HTTPClient {
+	if instrumented, ok := c.client.(instrumentedClient); ok {
+		return instrumented.client
+	}
 	return c.client
 }
 
@@ -40,7 +50,54 @@ func NewOrchestratorClient(client HTTPClient, url string) Client {
 		client = jwtHandler.GetHttpClient()
 	}
 
-	return &orchestratorClient{client, jwtHandler, url}
+	return &orchestratorClient{instrumentedClient{client}, jwtHandler, url}
+}
+
+// routeSegments are the literal path segments of the orchestrator API. Any other segment is an id, and is replaced
+// by {id} in the route requests are measured and traced by, so that each id does not make a new series.
+var routeSegments = map[string]bool{
+	"health": true, "applications": true, "policies": true, "versions": true, "diff": true, "current": true,
+	"rollback": true, "drift": true, "desired": true, "integrations": true, "credentials": true, "orchestration": true,
+	"orchestrations": true, "run": true, "pause": true, "resume": true, "jobs": true, "dead-letters": true,
+	"mappings": true, "actions": true, "subjects": true, "audit": true, "verify": true,
+}
+
+func requestRoute(u *url.URL) string {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		if !routeSegments[segment] {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// instrumentedClient records the latency and status of each request to the orchestrator, and traces it with a client
+// span whose context is sent along so that the orchestrator continues the trace.
+type instrumentedClient struct {
+	client HTTPClient
+}
+
+func (c instrumentedClient) Get(rawUrl string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return c.client.Get(rawUrl)
+	}
+	return c.Do(req)
+}
+
+func (c instrumentedClient) Do(req *http.Request) (*http.Response, error) {
+	route := requestRoute(req.URL)
+	span := tracesupport.StartClient(req, route)
+	started := time.Now()
+	resp, err := c.client.Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	prometheussupport.ObserveClientRequest(route, req.Method, started, status)
+	tracesupport.EndClient(span, resp, err)
+	return resp, err
 }
 
 func (c orchestratorClient) Health() (string, error) {
@@ -53,6 +110,24 @@ func (c orchestratorClient) Health() (string, error) {
 	return string(body), err
 }
 
+type integrationHealthList struct {
+	Integrations []IntegrationHealth `json:"integrations"`
+}
+
+func (c orchestratorClient) IntegrationHealth() ([]IntegrationHealth, error) {
+	resp, reqErr := c.client.Get(fmt.Sprintf("%v/health/integrations", c.url))
+	if err := errorOrBadResponse(resp, http.StatusOK, reqErr); err != nil {
+		return nil, err
+	}
+
+	var jsonResponse integrationHealthList
+	if err := json.NewDecoder(resp.Body).Decode(&jsonResponse); err != nil {
+		log.Error(fmt.Sprintf("unable to parse found json: %s\n", err.Error()))
+		return nil, err
+	}
+	return jsonResponse.Integrations, nil
+}
+
 type applicationList struct {
 	Applications []application `json:"applications"`
 }
@@ -65,6 +140,7 @@ type application struct {
 	Description   string `json:"description"`
 	ProviderName  string `json:"provider_name"`
 	Service       string `json:"service"`
+	Drift         string `json:"drift"`
 }
 
 func (c orchestratorClient) Applications(refresh bool) (applications []Application, err error) {
@@ -93,6 +169,7 @@ func (c orchestratorClient) Applications(refresh bool) (applications []Applicati
 			Description:   app.Description,
 			ProviderName:  app.ProviderName,
 			Service:       app.Service,
+			Drift:         app.Drift,
 		})
 	}
 
@@ -127,10 +204,15 @@ type integrationList struct {
 }
 
 type integration struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Provider string `json:"provider"`
-	Key      []byte `json:"key"`
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Provider       string     `json:"provider"`
+	Key            []byte     `json:"key,omitempty"`
+	KeyFingerprint string     `json:"key_fingerprint,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+	KeyRotatedAt   *time.Time `json:"key_rotated_at,omitempty"`
+	AppCount       int        `json:"app_count,omitempty"`
 }
 
 func (c orchestratorClient) Integrations() (integrations []Integration, err error) {
@@ -147,7 +229,7 @@ func (c orchestratorClient) Integrations() (integrations []Integration, err erro
 	}
 
 	for _, in := range jsonResponse.Integrations {
-		integrations = append(integrations, Integration{in.ID, in.Name, in.Provider, in.Key})
+		integrations = append(integrations, Integration{in.ID, in.Name, in.Provider, in.KeyFingerprint, in.CreatedAt, in.UpdatedAt, in.KeyRotatedAt, in.AppCount})
 	}
 	return integrations, nil
 }
@@ -162,35 +244,55 @@ func (c orchestratorClient) CreateIntegration(name string, provider string, key
 
 func (c orchestratorClient) DeleteIntegration(id string) error {
 	url := fmt.Sprintf("%v/integrations/%s", c.url, id)
-	resp, reqErr := c.client.Get(url)
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	resp, reqErr := c.client.Do(req)
 	return errorOrBadResponse(resp, http.StatusOK, reqErr)
 }
 
-func (c orchestratorClient) GetPolicies(id string) ([]hexapolicy.PolicyInfo, string, error) {
+// RotateIntegrationKey replaces the key of an integration, keeping its alias and the aliases of its applications.
+func (c orchestratorClient) RotateIntegrationKey(id string, key []byte) error {
+	url := fmt.Sprintf("%v/integrations/%s/credentials", c.url, id)
+	marshal, _ := json.Marshal(integration{Key: key})
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(marshal))
+	resp, reqErr := c.client.Do(req)
+	return errorOrBadResponse(resp, http.StatusOK, reqErr)
+}
+
+// GetPolicies returns the policies of an application, their raw json and the ETag to send back when setting them.
+func (c orchestratorClient) GetPolicies(id string) ([]hexapolicy.PolicyInfo, string, string, error) {
 	url := fmt.Sprintf("%v/applications/%s/policies", c.url, id)
 	resp, reqErr := c.client.Get(url)
 	if err := errorOrBadResponse(resp, http.StatusOK, reqErr); err != nil {
-		return []hexapolicy.PolicyInfo{}, "{}", err
+		return []hexapolicy.PolicyInfo{}, "{}", "", err
 	}
 
 	jsonBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return []hexapolicy.PolicyInfo{}, "{}", err
+		return []hexapolicy.PolicyInfo{}, "{}", "", err
 	}
+	etag := resp.Header.Get("ETag")
 
 	var jsonResponse hexapolicy.Policies
 	if err := json.NewDecoder(bytes.NewReader(jsonBody)).Decode(&jsonResponse); err != nil {
 		log.Error(err.Error())
-		return []hexapolicy.PolicyInfo{}, string(jsonBody), err
+		return []hexapolicy.PolicyInfo{}, string(jsonBody), etag, err
 	}
 
-	return jsonResponse.Policies, string(jsonBody), nil
+	return jsonResponse.Policies, string(jsonBody), etag, nil
 }
 
-func (c orchestratorClient) SetPolicies(id string, policies string) error {
+// SetPolicies replaces the policies of an application. When etag is not empty the policies are only replaced if
+// they have not changed since etag was read, otherwise ErrPolicyConflict is returned.
+func (c orchestratorClient) SetPolicies(id string, policies string, etag string) error {
 	url := fmt.Sprintf("%v/applications/%s/policies", c.url, id)
 	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(policies))
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
 	resp, err := c.client.Do(req)
+	if err == nil && resp.StatusCode == http.StatusPreconditionFailed {
+		return ErrPolicyConflict
+	}
 	return errorOrBadResponse(resp, http.StatusCreated, err)
 }
 
@@ -207,6 +309,131 @@ func (c orchestratorClient) Orchestration(from string, to string) error {
 	return errorOrBadResponse(resp, http.StatusCreated, err)
 }
 
+type orchestrationResult struct {
+	Policies []hexapolicy.PolicyInfo `json:"policies"`
+	Diff     struct {
+		Added   []hexapolicy.PolicyInfo `json:"added"`
+		Removed []hexapolicy.PolicyInfo `json:"removed"`
+		Changed []policyChange          `json:"changed"`
+	} `json:"diff"`
+}
+
+type policyChange struct {
+	PolicyId    string                `json:"policy_id"`
+	Differences []string              `json:"differences"`
+	Before      hexapolicy.PolicyInfo `json:"before"`
+	After       hexapolicy.PolicyInfo `json:"after"`
+}
+
+func (c orchestratorClient) OrchestrationPreview(from string, to string) (OrchestrationPreview, error) {
+	url := fmt.Sprintf("%v/orchestration?dryRun=true", c.url)
+	marshal, _ := json.Marshal(orchestration{From: from, To: to})
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(marshal))
+	resp, reqErr := c.client.Do(req)
+	if err := errorOrBadResponse(resp, http.StatusOK, reqErr); err != nil {
+		return OrchestrationPreview{}, err
+	}
+
+	var jsonResponse orchestrationResult
+	if err := json.NewDecoder(resp.Body).Decode(&jsonResponse); err != nil {
+		log.Error(fmt.Sprintf("unable to parse found json: %s\n", err.Error()))
+		return OrchestrationPreview{}, err
+	}
+
+	preview := OrchestrationPreview{
+		Policies: jsonResponse.Policies,
+		Added:    jsonResponse.Diff.Added,
+		Removed:  jsonResponse.Diff.Removed,
+	}
+	for _, change := range jsonResponse.Diff.Changed {
+		preview.Changed = append(preview.Changed, PolicyChange{
+			PolicyId:    change.PolicyId,
+			Differences: change.Differences,
+			Before:      change.Before,
+			After:       change.After,
+		})
+	}
+	return preview, nil
+}
+
+type auditEntries struct {
+	Entries []auditEntry `json:"entries"`
+}
+
+type auditEntry struct {
+	Sequence int64     `json:"sequence"`
+	Time     time.Time `json:"time"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email"`
+	Action   string    `json:"action"`
+	Targets  []string  `json:"targets"`
+	Policies []struct {
+		Application string `json:"application"`
+		Before      string `json:"before"`
+		After       string `json:"after"`
+	} `json:"policies"`
+	Outcome string `json:"outcome"`
+	Status  int    `json:"status"`
+	Hash    string `json:"hash"`
+}
+
+// Audit returns the latest entries of the audit log of the orchestrator that match the filter, newest first.
+func (c orchestratorClient) Audit(filter AuditFilter) ([]AuditEntry, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{"subject": filter.Subject, "action": filter.Action, "target": filter.Target, "outcome": filter.Outcome} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	auditUrl := fmt.Sprintf("%v/audit", c.url)
+	if len(query) > 0 {
+		auditUrl += "?" + query.Encode()
+	}
+	resp, reqErr := c.client.Get(auditUrl)
+	if err := errorOrBadResponse(resp, http.StatusOK, reqErr); err != nil {
+		return nil, err
+	}
+
+	var jsonResponse auditEntries
+	if err := json.NewDecoder(resp.Body).Decode(&jsonResponse); err != nil {
+		log.Error(fmt.Sprintf("unable to parse found json: %s\n", err.Error()))
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(jsonResponse.Entries))
+	for i := len(jsonResponse.Entries) - 1; i >= 0; i-- {
+		entry := jsonResponse.Entries[i]
+		subject := entry.Email
+		if subject == "" {
+			subject = entry.Subject
+		}
+		mapped := AuditEntry{Sequence: entry.Sequence, Time: entry.Time, Subject: subject, Action: entry.Action, Targets: entry.Targets,
+			Outcome: entry.Outcome, Status: entry.Status, Hash: entry.Hash}
+		for _, policies := range entry.Policies {
+			mapped.Policies = append(mapped.Policies, AuditPolicyChange(policies))
+		}
+		entries = append(entries, mapped)
+	}
+	return entries, nil
+}
+
+// VerifyAudit asks the orchestrator to check the hash chain of its audit log.
+func (c orchestratorClient) VerifyAudit() (AuditVerification, error) {
+	resp, reqErr := c.client.Get(fmt.Sprintf("%v/audit/verify", c.url))
+	if err := errorOrBadResponse(resp, http.StatusOK, reqErr); err != nil {
+		return AuditVerification{}, err
+	}
+	var verification struct {
+		Valid   bool   `json:"valid"`
+		Entries int64  `json:"entries"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verification); err != nil {
+		log.Error(fmt.Sprintf("unable to parse found json: %s\n", err.Error()))
+		return AuditVerification{}, err
+	}
+	return AuditVerification(verification), nil
+}
+
 func errorOrBadResponse(response *http.Response, status int, err error) error {
 	if err != nil {
 		log.Error(err.Error())
@@ -2,42 +2,52 @@ package admin_test
 
 import (
 	"bytes"
-	"encoding/base64"
+
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/pkg/mockOidcSupport"
 	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
 	"github.com/hexa-org/policy-orchestrator/demo/internal/admin"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
 	"golang.org/x/oauth2"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type MockClient struct {
 	mock.Mock
 	response []byte
+	header   http.Header
 	status   int
 	err      error
+	request  *http.Request
 }
 
-func (m *MockClient) Do(_ *http.Request) (*http.Response, error) {
+func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
+	m.request = req
 	r := io.NopCloser(bytes.NewReader(m.response))
-	return &http.Response{StatusCode: m.status, Body: r}, m.err
+	return &http.Response{StatusCode: m.status, Header: m.header, Body: r}, m.err
 }
 
 func (m *MockClient) Get(_ string) (resp *http.Response, err error) {
 	r := io.NopCloser(bytes.NewReader(m.response))
-	return &http.Response{StatusCode: m.status, Body: r}, m.err
+	return &http.Response{StatusCode: m.status, Header: m.header, Body: r}, m.err
 }
 
 func TestOrchestratorJwtClient(t *testing.T) {
@@ -85,14 +95,37 @@ func TestOrchestratorClient_NotHealthy(t *testing.T) {
 	assert.Equal(t, "[{\"name\":\"Unreachable\",\"pass\":\"fail\"}]", resp)
 }
 
+func TestOrchestratorClient_IntegrationHealth(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.response = []byte(`{"integrations":[{"integration":"anIntegration","provider":"google_cloud","status":"credentials_rejected",` +
+		`"reachable":true,"credentials_valid":false,"latency_ms":42,"error":"anError"}]}`)
+	mockClient.status = http.StatusOK
+	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
+
+	health, err := client.IntegrationHealth()
+	assert.NoError(t, err)
+	assert.Equal(t, []admin.IntegrationHealth{{Integration: "anIntegration", Provider: "google_cloud", Status: "credentials_rejected",
+		Reachable: true, LatencyMs: 42, Error: "anError"}}, health)
+	assert.Equal(t, "localhost:8883/health/integrations", mockClient.request.URL.String())
+}
+
+func TestOrchestratorClient_IntegrationHealth_withError(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.err = errors.New("anError")
+	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
+
+	_, err := client.IntegrationHealth()
+	assert.Error(t, err)
+}
+
 func TestOrchestratorClient_Applications(t *testing.T) {
 	mockClient := new(MockClient)
-	mockClient.response = []byte("{\"applications\":[{\"id\":\"anId\", \"integration_id\":\"anIntegrationId\", \"object_id\":\"anObjectId\", \"name\":\"anApp\", \"description\":\"aDescription\", \"provider_name\":\"aProviderName\", \"service\":\"aService\"}]}")
+	mockClient.response = []byte("{\"applications\":[{\"id\":\"anId\", \"integration_id\":\"anIntegrationId\", \"object_id\":\"anObjectId\", \"name\":\"anApp\", \"description\":\"aDescription\", \"provider_name\":\"aProviderName\", \"service\":\"aService\", \"drift\":\"drifted\"}]}")
 	mockClient.status = http.StatusOK
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
 
 	resp, _ := client.Applications(false)
-	assert.Equal(t, []admin.Application{{ID: "anId", IntegrationId: "anIntegrationId", ObjectId: "anObjectId", Name: "anApp", Description: "aDescription", ProviderName: "aProviderName", Service: "aService"}}, resp)
+	assert.Equal(t, []admin.Application{{ID: "anId", IntegrationId: "anIntegrationId", ObjectId: "anObjectId", Name: "anApp", Description: "aDescription", ProviderName: "aProviderName", Service: "aService", Drift: "drifted"}}, resp)
 }
 
 func TestOrchestratorClient_Applications_withErroneousGet(t *testing.T) {
@@ -134,15 +167,15 @@ func TestOrchestratorClient_Application_withBadJson(t *testing.T) {
 }
 
 func TestOrchestratorClient_Integrations(t *testing.T) {
-	key := base64.StdEncoding.EncodeToString([]byte("anotherKey"))
-
 	mockClient := new(MockClient)
-	mockClient.response = []byte(fmt.Sprintf("{\"integrations\":[{\"provider\":\"google_cloud\", \"key\":\"%s\"}]}", key))
+	mockClient.response = []byte("{\"integrations\":[{\"id\":\"anId\",\"provider\":\"google_cloud\",\"key_fingerprint\":\"HMAC-SHA256:0123456789abcdef\",\"created_at\":\"2024-05-01T10:00:00Z\",\"updated_at\":\"2024-05-02T10:00:00Z\",\"app_count\":2}]}")
 	mockClient.status = http.StatusOK
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
 
 	resp, _ := client.Integrations()
-	assert.Equal(t, []admin.Integration{{Provider: "google_cloud", Key: []byte("anotherKey")}}, resp)
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	updatedAt := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, []admin.Integration{{ID: "anId", Provider: "google_cloud", KeyFingerprint: "HMAC-SHA256:0123456789abcdef", CreatedAt: &createdAt, UpdatedAt: &updatedAt, AppCount: 2}}, resp)
 }
 
 func TestOrchestratorClient_Integrations_withErroneousGet(t *testing.T) {
@@ -180,6 +213,24 @@ func TestOrchestratorClient_DeleteIntegrations(t *testing.T) {
 
 	err := client.DeleteIntegration("101")
 	assert.NoError(t, err)
+	assert.Equal(t, http.MethodDelete, mockClient.request.Method)
+	assert.Equal(t, "localhost:8883/integrations/101", mockClient.request.URL.String())
+}
+
+func TestOrchestratorClient_RotateIntegrationKey(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusOK
+	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
+
+	err := client.RotateIntegrationKey("101", []byte("aKey"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPut, mockClient.request.Method)
+	assert.Equal(t, "localhost:8883/integrations/101/credentials", mockClient.request.URL.String())
+	body, _ := io.ReadAll(mockClient.request.Body)
+	assert.JSONEq(t, `{"id":"","name":"","provider":"","key":"YUtleQ=="}`, string(body))
+
+	mockClient.status = http.StatusBadRequest
+	assert.Error(t, client.RotateIntegrationKey("101", []byte("aKey")))
 }
 
 func TestOrchestratorClient_GetPolicy(t *testing.T) {
@@ -214,10 +265,12 @@ func TestOrchestratorClient_GetPolicy(t *testing.T) {
   ]
 }`
 	mockClient.response = []byte(rawJson)
+	mockClient.header = http.Header{"Etag": []string{`"anEtag"`}}
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
 
-	resp, raw, _ := client.GetPolicies("anId")
+	resp, raw, etag, _ := client.GetPolicies("anId")
 	assert.Equal(t, rawJson, raw)
+	assert.Equal(t, `"anEtag"`, etag)
 	assert.Equal(t, hexapolicy.IdqlVersion, resp[0].Meta.Version)
 	assert.Equal(t, "anAction", resp[0].Actions[0].String())
 	assert.Equal(t, []string{"aUser"}, resp[0].Subjects.String())
@@ -236,17 +289,48 @@ func TestOrchestratorClient_GetPolicy_withErroneousGet(t *testing.T) {
 	mockClient.err = errors.New("oops")
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
 
-	resp, _, err := client.GetPolicies("anId")
+	resp, _, _, err := client.GetPolicies("anId")
 	assert.Error(t, err)
 	assert.Equal(t, []hexapolicy.PolicyInfo{}, resp)
 }
 
+func TestOrchestratorClient_metrics(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusNotFound
+	client := admin.NewOrchestratorClient(mockClient, "http://localhost:8883")
+	_, _, _, _ = client.GetPolicies("anId")
+	_, _, _, _ = client.GetPolicies("anotherId")
+
+	recorder := httptest.NewRecorder()
+	prometheussupport.Wrap(http.NotFoundHandler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), `hexa_admin_orchestrator_requests_total{code="404",method="GET",route="/applications/{id}/policies"} 2`)
+	assert.Contains(t, recorder.Body.String(), `hexa_admin_orchestrator_request_duration_seconds_count{method="GET",route="/applications/{id}/policies"} 2`)
+}
+
+func TestOrchestratorClient_traces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(previous)
+
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusNotFound
+	client := admin.NewOrchestratorClient(mockClient, "http://localhost:8883")
+	_, _, _, _ = client.GetPolicies("anId")
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /applications/{id}/policies", spans[0].Name())
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", spans[0].SpanContext().TraceID(), spans[0].SpanContext().SpanID()), mockClient.request.Header.Get("traceparent"))
+}
+
 func TestOrchestratorClient_GetPolicy_withBadJson(t *testing.T) {
 	mockClient := new(MockClient)
 	mockClient.status = http.StatusOK
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
 
-	resp, _, err := client.GetPolicies("anId")
+	resp, _, _, err := client.GetPolicies("anId")
 	assert.Error(t, err)
 	assert.Equal(t, []hexapolicy.PolicyInfo{}, resp)
 }
@@ -285,15 +369,27 @@ func TestOrchestratorClient_SetPolicy(t *testing.T) {
   ]
 }`
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
-	err := client.SetPolicies("anId", policies)
+	err := client.SetPolicies("anId", policies, "")
 	assert.NoError(t, err)
+	assert.Empty(t, mockClient.request.Header.Get("If-Match"))
+}
+
+func TestOrchestratorClient_SetPolicy_withEtag(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusCreated
+	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
+	assert.NoError(t, client.SetPolicies("anId", "{}", `"anEtag"`))
+	assert.Equal(t, `"anEtag"`, mockClient.request.Header.Get("If-Match"))
+
+	mockClient.status = http.StatusPreconditionFailed
+	assert.ErrorIs(t, client.SetPolicies("anId", "{}", `"anEtag"`), admin.ErrPolicyConflict)
 }
 
 func TestOrchestratorClient_SetPolicy_withErroneousSet(t *testing.T) {
 	mockClient := new(MockClient)
 	mockClient.err = errors.New("oops")
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
-	err := client.SetPolicies("anId", "")
+	err := client.SetPolicies("anId", "", "")
 	assert.Error(t, err)
 }
 
@@ -302,7 +398,7 @@ func TestOrchestratorClient_SetPolicy_withBadStatus(t *testing.T) {
 	mockClient.status = 500
 	mockClient.response = []byte("shoot")
 	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
-	err := client.SetPolicies("anId", "")
+	err := client.SetPolicies("anId", "", "")
 	assert.Error(t, err)
 	assert.Equal(t, "shoot", err.Error())
 }
@@ -322,3 +418,90 @@ func TestOrchestrationClient_Orchestration_withError(t *testing.T) {
 	err := client.Orchestration("fromId", "toId")
 	assert.Error(t, err)
 }
+
+func TestOrchestrationClient_OrchestrationPreview(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusOK
+	mockClient.response = []byte(`{
+  "policies": [{"meta": {"version": "0.7"}, "actions": ["anAction"], "subjects": ["user:aUser"], "object": "anId"}],
+  "diff": {
+    "added": [{"meta": {"version": "0.7"}, "actions": ["anAction"], "subjects": ["user:aUser"], "object": "anId"}],
+    "removed": [],
+    "changed": [{"policy_id": "aPolicyId", "differences": ["SUBJECT"],
+      "before": {"meta": {"version": "0.7"}, "actions": ["anAction"], "subjects": ["user:anotherUser"], "object": "anId"},
+      "after": {"meta": {"version": "0.7"}, "actions": ["anAction"], "subjects": ["user:aUser"], "object": "anId"}}]
+  }
+}`)
+	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
+
+	preview, err := client.OrchestrationPreview("fromId", "toId")
+	assert.NoError(t, err)
+	assert.True(t, preview.HasChanges())
+	assert.Len(t, preview.Policies, 1)
+	assert.Len(t, preview.Added, 1)
+	assert.Len(t, preview.Removed, 0)
+	assert.Equal(t, "aPolicyId", preview.Changed[0].PolicyId)
+	assert.Equal(t, []string{"SUBJECT"}, preview.Changed[0].Differences)
+	assert.Equal(t, "user:anotherUser", preview.Changed[0].Before.Subjects[0])
+}
+
+func TestOrchestrationClient_OrchestrationPreview_withError(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.err = errors.New("oops")
+	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
+
+	_, err := client.OrchestrationPreview("fromId", "toId")
+	assert.Error(t, err)
+}
+
+func TestOrchestrationClient_OrchestrationPreview_withBadJson(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusOK
+	mockClient.response = []byte("{\"_policies\":[}")
+	client := admin.NewOrchestratorClient(mockClient, "localhost:8883")
+
+	_, err := client.OrchestrationPreview("fromId", "toId")
+	assert.Error(t, err)
+}
+
+func TestOrchestratorClient_Audit(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusOK
+	mockClient.response = []byte(`{"entries":[
+		{"sequence":1,"time":"2024-05-06T07:08:09Z","subject":"aSubject","action":"integrations.create","targets":["anId"],"outcome":"success","status":201,"hash":"aHash"},
+		{"sequence":2,"time":"2024-05-06T07:09:09Z","subject":"aSubject","email":"a@example.com","action":"policies.set","targets":["anApp"],
+		 "policies":[{"application":"anApp","before":"aHash","after":"anotherHash"}],"outcome":"failure","status":409,"hash":"anotherHash"}]}`)
+	client := admin.NewOrchestratorClient(mockClient, "http://localhost:8883")
+
+	entries, err := client.Audit(admin.AuditFilter{Subject: "aSubject", Outcome: "failure"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/audit", mockClient.request.URL.Path)
+	assert.Equal(t, "outcome=failure&subject=aSubject", mockClient.request.URL.RawQuery)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, int64(2), entries[0].Sequence, "newest first")
+	assert.Equal(t, "a@example.com", entries[0].Subject, "the email when known")
+	assert.Equal(t, []admin.AuditPolicyChange{{Application: "anApp", Before: "aHash", After: "anotherHash"}}, entries[0].Policies)
+	assert.Equal(t, "aSubject", entries[1].Subject)
+	assert.Equal(t, http.StatusCreated, entries[1].Status)
+}
+
+func TestOrchestratorClient_Audit_withErroneousGet(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.err = errors.New("oops")
+	client := admin.NewOrchestratorClient(mockClient, "http://localhost:8883")
+
+	_, err := client.Audit(admin.AuditFilter{})
+	assert.Error(t, err)
+}
+
+func TestOrchestratorClient_VerifyAudit(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.status = http.StatusOK
+	mockClient.response = []byte(`{"valid":false,"entries":3,"error":"audit log hash chain is broken"}`)
+	client := admin.NewOrchestratorClient(mockClient, "http://localhost:8883")
+
+	verification, err := client.VerifyAudit()
+	assert.NoError(t, err)
+	assert.Equal(t, "/audit/verify", mockClient.request.URL.Path)
+	assert.Equal(t, admin.AuditVerification{Entries: 3, Error: "audit log hash chain is broken"}, verification)
+}
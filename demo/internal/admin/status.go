@@ -11,8 +11,9 @@ import (
 )
 
 type Status struct {
-	URL    string
-	Checks []Check
+	URL          string
+	Checks       []Check
+	Integrations []IntegrationHealth
 }
 
 type StatusHandler struct {
@@ -29,6 +30,17 @@ type Check struct {
 	Pass string `json:"pass"`
 }
 
+// IntegrationHealth is the health of the provider of an integration, as the orchestrator last checked it.
+type IntegrationHealth struct {
+	Integration      string `json:"integration"`
+	Provider         string `json:"provider"`
+	Status           string `json:"status"` // ok, credentials_rejected, unreachable or unchecked
+	Reachable        bool   `json:"reachable"`
+	CredentialsValid bool   `json:"credentials_valid"`
+	LatencyMs        int64  `json:"latency_ms"`
+	Error            string `json:"error"`
+}
+
 func (p StatusHandler) StatusHandler(w http.ResponseWriter, _ *http.Request) {
 	health, _ := p.client.Health()
 
@@ -37,7 +49,12 @@ func (p StatusHandler) StatusHandler(w http.ResponseWriter, _ *http.Request) {
 		log.Printf("unable to parse found json for status check: %s\n", err.Error())
 		checks = append(checks, Check{"Unparsable", "false"})
 	}
-	status := Status{fmt.Sprintf("%v/health", p.orchestratorUrl), checks} // todo - remove endpoint knowledge
+	status := Status{URL: fmt.Sprintf("%v/health", p.orchestratorUrl), Checks: checks} // todo - remove endpoint knowledge
+	integrations, err := p.client.IntegrationHealth()
+	if err != nil {
+		log.Printf("unable to find the health of integrations: %s\n", err.Error())
+	}
+	status.Integrations = integrations
 
 	model := websupport.Model{Map: map[string]interface{}{"resource": "status", "status": status}}
 	_ = websupport.ModelAndView(w, &resources, "status", model)
@@ -1,6 +1,7 @@
 package admin_test
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -64,3 +65,38 @@ func TestStatusHandler_withBadResponse(t *testing.T) {
 		assert.Contains(t, string(body), "<a class=\"status orange\">")
 	})
 }
+
+func TestStatusHandler_withIntegrations(t *testing.T) {
+	testsupport.WithSetUp(&StatusData{}, func(data *StatusData) {
+		data.client.Status = `[{"name":"server","pass":"true"}]`
+		data.client.DesiredHealth = []admin.IntegrationHealth{
+			{Integration: "aGoogleIntegration", Provider: "google_cloud", Status: "credentials_rejected", Reachable: true, LatencyMs: 42, Error: "oauth2: token expired"},
+			{Integration: "anAwsIntegration", Provider: "avp", Status: "unchecked"},
+		}
+
+		resp, _ := http.Get(fmt.Sprintf("http://%s/status", data.server.Addr))
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Contains(t, string(body), "<a class=\"status green\"></a>\n                        server")
+		assert.Contains(t, string(body), "<td>aGoogleIntegration</td>")
+		assert.Contains(t, string(body), "<td>google_cloud</td>")
+		assert.Contains(t, string(body), "<a class=\"status orange\"></a> invalid")
+		assert.Contains(t, string(body), "<td>42 ms</td>")
+		assert.Contains(t, string(body), "oauth2: token expired")
+		assert.Contains(t, string(body), "<a class=\"status orange\"></a> unchecked")
+	})
+}
+
+func TestStatusHandler_withoutIntegrationHealth(t *testing.T) {
+	testsupport.WithSetUp(&StatusData{}, func(data *StatusData) {
+		data.client.Status = `[{"name":"server","pass":"true"}]`
+		data.client.Errs = map[string]error{"/health/integrations": errors.New("oops")}
+
+		resp, _ := http.Get(fmt.Sprintf("http://%s/status", data.server.Addr))
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), "<a class=\"status green\"></a>\n                        server")
+		assert.NotContains(t, string(body), "<h2>Integrations</h2>")
+	})
+}
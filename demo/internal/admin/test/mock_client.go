@@ -21,6 +21,12 @@ type MockClient struct {
 
 	DesiredApplications []admin.Application
 	DesiredPolicies     []hexapolicy.PolicyInfo
+	DesiredEtag         string
+	DesiredPreview      admin.OrchestrationPreview
+	DesiredAudit        []admin.AuditEntry
+	DesiredAuditFilter  admin.AuditFilter
+	DesiredVerification admin.AuditVerification
+	DesiredHealth       []admin.IntegrationHealth
 }
 
 // GetHttpClient used mainly for testing
@@ -32,8 +38,13 @@ func (m *MockClient) Health() (string, error) {
 	return m.Status, nil
 }
 
+func (m *MockClient) IntegrationHealth() ([]admin.IntegrationHealth, error) {
+	url := fmt.Sprintf("%v/health/integrations", m.Url)
+	return m.DesiredHealth, m.Errs[url]
+}
+
 func (m *MockClient) Integrations() ([]admin.Integration, error) {
-	integration := admin.Integration{ID: "anId", Name: "aName", Provider: "google_cloud", Key: []byte("aKey")}
+	integration := admin.Integration{ID: "anId", Name: "aName", Provider: "google_cloud", KeyFingerprint: "HMAC-SHA256:2c2e8f0d14b1a4c8", AppCount: 1}
 	url := fmt.Sprintf("%v/integrations", m.Url)
 	return []admin.Integration{integration}, m.Errs[url]
 }
@@ -59,6 +70,16 @@ func (m *MockClient) DeleteIntegration(id string) error {
 	return m.Errs[url]
 }
 
+func (m *MockClient) RotateIntegrationKey(id string, key []byte) error {
+	url := fmt.Sprintf("%v/integrations/%s/credentials", m.Url, id)
+	args := m.Called(url)
+	m.Key = key
+	if len(args) > 0 {
+		return args.Error(0)
+	}
+	return m.Errs[url]
+}
+
 func (m *MockClient) Applications(bool) ([]admin.Application, error) {
 	url := fmt.Sprintf("%v/applications", m.Url)
 	return m.DesiredApplications, m.Errs[url]
@@ -72,13 +93,16 @@ func (m *MockClient) Application(id string) (admin.Application, error) {
 	return m.DesiredApplications[0], m.Errs[url]
 }
 
-func (m *MockClient) GetPolicies(id string) ([]hexapolicy.PolicyInfo, string, error) {
+func (m *MockClient) GetPolicies(id string) ([]hexapolicy.PolicyInfo, string, string, error) {
 	url := fmt.Sprintf("%v/applications/%s/policies", m.Url, id)
-	return m.DesiredPolicies, "{\"policies\":[]}", m.Errs[url]
+	return m.DesiredPolicies, "{\"policies\":[]}", m.DesiredEtag, m.Errs[url]
 }
 
-func (m *MockClient) SetPolicies(id string, _ string) error {
+func (m *MockClient) SetPolicies(id string, _ string, etag string) error {
 	url := fmt.Sprintf("%v/applications/%s/policies", m.Url, id)
+	if etag != "" && etag != m.DesiredEtag {
+		return admin.ErrPolicyConflict
+	}
 	return m.Errs[url]
 }
 
@@ -86,3 +110,19 @@ func (m *MockClient) Orchestration(_ string, _ string) error {
 	url := fmt.Sprintf("%v/orchestration", m.Url)
 	return m.Errs[url]
 }
+
+func (m *MockClient) OrchestrationPreview(_ string, _ string) (admin.OrchestrationPreview, error) {
+	url := fmt.Sprintf("%v/orchestration?dryRun=true", m.Url)
+	return m.DesiredPreview, m.Errs[url]
+}
+
+func (m *MockClient) Audit(filter admin.AuditFilter) ([]admin.AuditEntry, error) {
+	url := fmt.Sprintf("%v/audit", m.Url)
+	m.DesiredAuditFilter = filter
+	return m.DesiredAudit, m.Errs[url]
+}
+
+func (m *MockClient) VerifyAudit() (admin.AuditVerification, error) {
+	url := fmt.Sprintf("%v/audit/verify", m.Url)
+	return m.DesiredVerification, m.Errs[url]
+}
@@ -0,0 +1,81 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+// UnmappedAction reports a source action that had no entry in the action mapping of an orchestration.
+type UnmappedAction struct {
+	Action   string   `json:"action"`
+	Policies []string `json:"policies"` // the policies that used the action
+}
+
+// mapActions translates the actions of each policy with mapping. Actions without an entry are left out of the policy
+// and reported. A policy left without any action fails the translation, since the target's policies are replaced as a
+// whole and it would be removed from toType.
+func mapActions(fromPolicies []hexapolicy.PolicyInfo, mapping map[string][]string, toType string) ([]hexapolicy.PolicyInfo, []UnmappedAction, error) {
+	unmapped := newUnmappedActions()
+	modified := make([]hexapolicy.PolicyInfo, 0, len(fromPolicies))
+	for _, policy := range fromPolicies {
+		actions := make([]hexapolicy.ActionInfo, 0, len(policy.Actions))
+		var missing []string
+		for _, action := range policy.Actions {
+			targets, found := mapping[string(action)]
+			if !found {
+				unmapped.add(string(action), policy)
+				missing = append(missing, string(action))
+				continue
+			}
+			for _, target := range targets {
+				if !containsAction(actions, target) {
+					actions = append(actions, hexapolicy.ActionInfo(target))
+				}
+			}
+		}
+		if len(actions) == 0 && len(policy.Actions) > 0 {
+			return nil, nil, fmt.Errorf("policy %s would be removed from %s, none of its actions has an action mapping: %s", policyLabel(policy), toType, strings.Join(missing, ", "))
+		}
+		policy.Actions = actions
+		modified = append(modified, policy)
+	}
+	return modified, unmapped.list(), nil
+}
+
+func containsAction(actions []hexapolicy.ActionInfo, action string) bool {
+	for _, existing := range actions {
+		if string(existing) == action {
+			return true
+		}
+	}
+	return false
+}
+
+type unmappedActions map[string]*UnmappedAction
+
+func newUnmappedActions() unmappedActions {
+	return make(map[string]*UnmappedAction)
+}
+
+func (u unmappedActions) add(action string, policy hexapolicy.PolicyInfo) {
+	entry, exist := u[action]
+	if !exist {
+		entry = &UnmappedAction{Action: action, Policies: []string{}}
+		u[action] = entry
+	}
+	entry.Policies = append(entry.Policies, policyLabel(policy))
+}
+
+func (u unmappedActions) list() []UnmappedAction {
+	resp := make([]UnmappedAction, 0, len(u))
+	for _, entry := range u {
+		resp = append(resp, *entry)
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].Action < resp[j].Action
+	})
+	return resp
+}
@@ -0,0 +1,107 @@
+package orchestrator_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	orchestratorNoopProvider "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslation_Apply_mapsActions(t *testing.T) {
+	getId, postId, deleteId := "get", "post", "delete"
+	policies := []hexapolicy.PolicyInfo{
+		{Meta: hexapolicy.MetaInfo{PolicyId: &getId}, Actions: []hexapolicy.ActionInfo{"http:GET", "http:HEAD"}, Subjects: []string{"user:alice"}, Object: "/reports"},
+		{Meta: hexapolicy.MetaInfo{PolicyId: &postId}, Actions: []hexapolicy.ActionInfo{"http:POST"}, Subjects: []string{"user:bob"}, Object: "/reports"},
+		{Meta: hexapolicy.MetaInfo{PolicyId: &deleteId}, Actions: []hexapolicy.ActionInfo{"http:DELETE"}, Subjects: []string{"user:carol"}, Object: "/reports"},
+	}
+	target := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, Subjects: []string{"user:dan"}, Object: "aBackendService"},
+	}
+
+	translation := translationFor(t, sdk.ProviderTypeOpa, sdk.ProviderTypeGoogleCloudIAP)
+	translation.ActionMapping = map[string][]string{
+		"http:GET":  {"gcp:iap.webServiceVersions.accessViaIAP"},
+		"http:HEAD": {"gcp:iap.webServiceVersions.accessViaIAP"},
+		"http:POST": {"gcp:roles/iap.httpsResourceAccessor", "gcp:iap.webServiceVersions.accessViaIAP"},
+	}
+	targetPolicies := func() ([]hexapolicy.PolicyInfo, error) {
+		return target, nil
+	}
+	_, err := translation.Apply(policies, targetPolicies)
+	assert.EqualError(t, err, "policy delete would be removed from gcp_iap, none of its actions has an action mapping: http:DELETE")
+
+	translated, err := translation.Apply(policies[:2], targetPolicies)
+	assert.NoError(t, err)
+	assert.Len(t, translated.Policies, 2)
+	assert.Equal(t, []hexapolicy.ActionInfo{"gcp:iap.webServiceVersions.accessViaIAP"}, translated.Policies[0].Actions)
+	assert.Equal(t, []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor", "gcp:iap.webServiceVersions.accessViaIAP"}, translated.Policies[1].Actions)
+	assert.Equal(t, "aBackendService", translated.Policies[1].Object.String())
+	assert.Empty(t, translated.UnmappedActions)
+
+	// actions are also mapped for targets accepting any action
+	translation = translationFor(t, sdk.ProviderTypeOpa, sdk.ProviderTypeAvp)
+	translation.ActionMapping = map[string][]string{"http:GET": {"Action::\"view\""}}
+	translated, err = translation.Apply(policies[:1], noTargetPolicies(t))
+	assert.NoError(t, err)
+	assert.Equal(t, []hexapolicy.ActionInfo{"Action::\"view\""}, translated.Policies[0].Actions)
+	assert.Equal(t, []orchestrator.UnmappedAction{{Action: "http:HEAD", Policies: []string{"get"}}}, translated.UnmappedActions)
+}
+
+func TestTranslation_Apply_requiresActionMapping(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"cognito:admins"}, Subjects: []string{"user:alice"}, Object: "aUserPool"},
+	}
+
+	_, err := translationFor(t, sdk.ProviderTypeCognito, sdk.ProviderTypeGoogleCloudIAP).Apply(policies, noTargetPolicies(t))
+	assert.EqualError(t, err, "orchestration from cognito to gcp_iap requires an action mapping, none is configured for the applications or their integrations")
+}
+
+func TestApplicationsService_Preview_findsActionMapping(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	providers := make(map[string]policyprovider.Provider)
+	for _, providerType := range []string{sdk.ProviderTypeOpa, sdk.ProviderTypeAzure} {
+		_, err = data.Create(providerType, "noop", []byte("aKey"))
+		assert.NoError(t, err)
+		data.Integrations[providerType].Apps = map[string]policyprovider.ApplicationInfo{
+			providerType + "App": {ObjectID: providerType + "Object", Name: providerType},
+		}
+		providers[providerType] = &orchestratorNoopProvider.NoopProvider{OverrideName: providerType}
+	}
+
+	pb := orchestrator.NewProviderBuilder()
+	pb.AddProviders(providers)
+	mappings := data.GetActionMappingDataGateway()
+	service := orchestrator.ApplicationsService{ApplicationsGateway: data.GetApplicationDataGateway(), IntegrationsGateway: data, ActionMappingsGateway: mappings, ProviderBuilder: pb}
+	request := orchestrator.Orchestration{From: "opaApp", To: "azureApp"}
+
+	_, err = service.Preview(request)
+	assert.ErrorContains(t, err, "requires an action mapping", "actions are not replaced without a mapping")
+
+	assert.NoError(t, mappings.Save(dataConfigGateway.ActionMappingRecord{From: sdk.ProviderTypeOpa, To: sdk.ProviderTypeAzure, Actions: map[string][]string{"anAction": {"integrationRole"}}}))
+	_, err = service.Preview(request)
+	assert.EqualError(t, err, "policy anId would be removed from azure, none of its actions has an action mapping: anotherAction")
+
+	assert.NoError(t, mappings.Save(dataConfigGateway.ActionMappingRecord{From: sdk.ProviderTypeOpa, To: sdk.ProviderTypeAzure, Actions: map[string][]string{"anAction": {"integrationRole"}, "anotherAction": {"anotherIntegrationRole"}}}))
+	result, err := service.Preview(request)
+	assert.NoError(t, err)
+	assert.Empty(t, result.UnmappedActions)
+	assert.Len(t, result.Policies, 2)
+	assert.Equal(t, []hexapolicy.ActionInfo{"integrationRole"}, result.Policies[0].Actions)
+	assert.Equal(t, []hexapolicy.ActionInfo{"anotherIntegrationRole"}, result.Policies[1].Actions)
+
+	assert.NoError(t, mappings.Save(dataConfigGateway.ActionMappingRecord{From: "opaApp", To: "azureApp", Actions: map[string][]string{"anAction": {"applicationRole"}, "anotherAction": {"applicationRole"}}}))
+	result, err = service.Orchestrate(request)
+	assert.NoError(t, err)
+	assert.Equal(t, []hexapolicy.ActionInfo{"applicationRole"}, result.Policies[0].Actions, "application mappings take precedence")
+}
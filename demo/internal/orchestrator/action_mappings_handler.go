@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+type ActionMappings struct {
+	Mappings []ActionMapping `json:"mappings"`
+}
+
+// ActionMapping maps source action uris to target action uris, for a pair of applications or integrations.
+type ActionMapping struct {
+	From    string              `json:"from"`
+	To      string              `json:"to"`
+	Actions map[string][]string `json:"actions"`
+}
+
+type ActionMappingsHandler struct {
+	mappings     dataConfigGateway.ActionMappingsDataGateway
+	applications dataConfigGateway.ApplicationsDataGateway
+}
+
+// List returns the mappings between integrations and applications the token of the request is permitted to access.
+func (handler ActionMappingsHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := handler.mappings.Find()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := ActionMappings{Mappings: make([]ActionMapping, 0, len(records))}
+	access := accessOf(r)
+	for _, record := range records {
+		if access.permitsMapping(handler.applications, record.From, record.To) {
+			list.Mappings = append(list.Mappings, ActionMapping(record))
+		}
+	}
+	data, _ := json.Marshal(list)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (handler ActionMappingsHandler) Show(w http.ResponseWriter, r *http.Request) {
+	record, err := handler.mappings.FindByPair(mux.Vars(r)["from"], mux.Vars(r)["to"])
+	if err != nil {
+		writeActionMappingError(w, err)
+		return
+	}
+	data, _ := json.Marshal(ActionMapping(*record))
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (handler ActionMappingsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var jsonRequest ActionMapping
+	if err := json.NewDecoder(r.Body).Decode(&jsonRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record := dataConfigGateway.ActionMappingRecord{From: mux.Vars(r)["from"], To: mux.Vars(r)["to"], Actions: jsonRequest.Actions}
+	if err := handler.mappings.Save(record); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (handler ActionMappingsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := handler.mappings.Delete(mux.Vars(r)["from"], mux.Vars(r)["to"]); err != nil {
+		writeActionMappingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeActionMappingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dataConfigGateway.ErrActionMappingNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,69 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionMappings(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		mappingUrl := fmt.Sprintf("http://%s/mappings/actions/%s/%s", data.server.Addr, data.fromApp, data.toApp)
+
+		resp, err := data.oauthHttpClient.Get(mappingUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		marshal, _ := json.Marshal(orchestrator.ActionMapping{Actions: map[string][]string{"anAction": {"aMappedAction"}, "anotherAction": {"anotherMappedAction"}}})
+		req, _ := http.NewRequest(http.MethodPut, mappingUrl, bytes.NewReader(marshal))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, err = data.oauthHttpClient.Get(mappingUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var mapping orchestrator.ActionMapping
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&mapping))
+		assert.Equal(t, orchestrator.ActionMapping{From: data.fromApp, To: data.toApp, Actions: map[string][]string{"anAction": {"aMappedAction"}, "anotherAction": {"anotherMappedAction"}}}, mapping)
+
+		resp, err = data.oauthHttpClient.Get(fmt.Sprintf("http://%s/mappings/actions", data.server.Addr))
+		assert.NoError(t, err)
+		var list orchestrator.ActionMappings
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		assert.Equal(t, []orchestrator.ActionMapping{mapping}, list.Mappings)
+
+		// the mapping is used when orchestrating
+		marshal, _ = json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err = data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var result orchestrator.OrchestrationResult
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Len(t, result.Policies, 2)
+		assert.Equal(t, "aMappedAction", string(result.Policies[0].Actions[0]))
+		assert.Equal(t, "anotherMappedAction", string(result.Policies[1].Actions[0]))
+		assert.Empty(t, result.UnmappedActions)
+
+		req, _ = http.NewRequest(http.MethodPut, mappingUrl, bytes.NewReader([]byte(`{"actions":{}}`)))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		req, _ = http.NewRequest(http.MethodDelete, mappingUrl, nil)
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		req, _ = http.NewRequest(http.MethodDelete, mappingUrl, nil)
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sort"
@@ -28,6 +29,7 @@ type Application struct {
 	Description   string `json:"description"`
 	ProviderName  string `json:"provider_name"`
 	Service       string `json:"service"`
+	Drift         string `json:"drift,omitempty"` // one of the Drift constants, only set by List
 }
 
 type ApplicationsHandler struct {
@@ -56,9 +58,24 @@ func (handler ApplicationsHandler) List(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	statesById := make(map[string]*dataConfigGateway.PolicyStateRecord)
+	if handler.applicationsService.PolicyStatesGateway != nil {
+		states, err := handler.applicationsService.PolicyStatesGateway.Find()
+		if err != nil {
+			log.Error("Error accessing policy states: " + err.Error())
+		}
+		for i := range states {
+			statesById[states[i].ApplicationId] = &states[i]
+		}
+	}
+
 	var list Applications
+	access := accessOf(r)
 	for _, rec := range records {
-		list.Applications = append(list.Applications, Application{ID: rec.ID, IntegrationId: rec.IntegrationId, ObjectId: rec.ObjectId, Name: rec.Name, Description: rec.Description, ProviderName: integrationNamesById[rec.IntegrationId], Service: rec.Service})
+		if !access.permits(rec.IntegrationId) {
+			continue
+		}
+		list.Applications = append(list.Applications, Application{ID: rec.ID, IntegrationId: rec.IntegrationId, ObjectId: rec.ObjectId, Name: rec.Name, Description: rec.Description, ProviderName: integrationNamesById[rec.IntegrationId], Service: rec.Service, Drift: DriftStatus(statesById[rec.ID])})
 	}
 
 	// sort by "Provider" so that all app resources from a platform are grouped together.
@@ -102,7 +119,7 @@ func (handler ApplicationsHandler) Show(w http.ResponseWriter, r *http.Request)
 }
 
 func (handler ApplicationsHandler) GetPolicies(w http.ResponseWriter, r *http.Request) {
-	application, integration, provider, err := handler.applicationsService.GatherRecords(mux.Vars(r)["id"])
+	application, integration, provider, err := handler.applicationsService.WithContext(r.Context()).GatherRecords(mux.Vars(r)["id"])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -122,10 +139,13 @@ func (handler ApplicationsHandler) GetPolicies(w http.ResponseWriter, r *http.Re
 
 	data, _ := json.Marshal(policies)
 	w.Header().Set("content-type", "application/json")
+	w.Header().Set("ETag", PoliciesEtag(records))
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(data)
 }
 
+// SetPolicies replaces the policies of an application. When If-Match is sent with the ETag returned by GetPolicies,
+// the policies are only replaced if the application still has the policies that were read.
 func (handler ApplicationsHandler) SetPolicies(w http.ResponseWriter, r *http.Request) {
 	var policies hexapolicy.Policies
 	if erroneousDecode := json.NewDecoder(r.Body).Decode(&policies); erroneousDecode != nil {
@@ -139,23 +159,17 @@ func (handler ApplicationsHandler) SetPolicies(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	application, integration, provider, err := handler.applicationsService.GatherRecords(mux.Vars(r)["id"])
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	status, setErr := provider.SetPolicyInfo(integration, application, policies.Policies)
-	if setErr != nil {
+	change := Change{Author: author(r), Reason: r.URL.Query().Get("reason"), IfMatch: r.Header.Get("If-Match")}
+	if setErr := handler.applicationsService.WithContext(r.Context()).SetPolicies(mux.Vars(r)["id"], policies.Policies, change); setErr != nil {
+		if errors.Is(setErr, ErrPolicyConflict) {
+			http.Error(w, setErr.Error(), http.StatusPreconditionFailed)
+			return
+		}
 		log.Error(fmt.Sprintf("unable to update policy: %s", setErr.Error()))
 		// todo - should we return the error msg here.
 		http.Error(w, "unable to update policy.", http.StatusInternalServerError)
 		return
 	}
 
-	if status != http.StatusCreated {
-		http.Error(w, "unable to update policy.", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(status)
+	w.WriteHeader(http.StatusCreated)
 }
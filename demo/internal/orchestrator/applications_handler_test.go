@@ -88,12 +88,16 @@ func (data *applicationsHandlerData) SetUp() {
 	data.providers["yetAnotherName"] = &orchestratorNoopProvider.NoopProvider{}
 	data.providers["aName"] = &orchestratorNoopProvider.NoopProvider{}
 
-	handlers := orchestrator.LoadHandlers(data.Data, data.providers)
+	handlers := orchestrator.LoadHandlers(data.Data, data.providers, nil)
 	data.server = websupport.Create(addr, handlers, websupport.Options{})
 	go websupport.Start(data.server, listener)
 	healthsupport.WaitForHealthy(data.server)
 	apps, _ := data.gateway.Find(true)
-	data.applicationTestId = apps[0].ID
+	for _, app := range apps {
+		if app.IntegrationId == "aName" {
+			data.applicationTestId = app.ID
+		}
+	}
 }
 
 func (data *applicationsHandlerData) TearDown() {
@@ -267,3 +271,30 @@ func TestSetPolicies_withMissingJson(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
 	})
 }
+
+func TestSetPolicies_withIfMatch(t *testing.T) {
+	testsupport.WithSetUp(&applicationsHandlerData{}, func(data *applicationsHandlerData) {
+		reqUrl := fmt.Sprintf("http://%s/applications/%s/policies", data.server.Addr, data.applicationTestId)
+		resp, _ := data.oauthHttpClient.Get(reqUrl)
+		etag := resp.Header.Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		var policies hexapolicy.Policies
+		_ = json.NewDecoder(resp.Body).Decode(&policies)
+		assert.Equal(t, orchestrator.PoliciesEtag(policies.Policies), etag)
+		reversed := []hexapolicy.PolicyInfo{policies.Policies[1], policies.Policies[0]}
+		assert.Equal(t, etag, orchestrator.PoliciesEtag(reversed), "the order of policies does not matter")
+
+		marshal, _ := json.Marshal(policies)
+		post := func(ifMatch string) int {
+			req, _ := http.NewRequest(http.MethodPost, reqUrl, bytes.NewReader(marshal))
+			req.Header.Set("If-Match", ifMatch)
+			resp, err := data.oauthHttpClient.Do(req)
+			assert.NoError(t, err)
+			return resp.StatusCode
+		}
+		assert.Equal(t, http.StatusCreated, post(etag))
+		assert.Equal(t, http.StatusCreated, post("*"))
+		assert.Equal(t, http.StatusPreconditionFailed, post(orchestrator.PoliciesEtag(nil)))
+	})
+}
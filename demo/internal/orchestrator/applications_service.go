@@ -1,24 +1,78 @@
 package orchestrator
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
 	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	logger "golang.org/x/exp/slog"
 )
 
 type ApplicationsService struct {
-	ApplicationsGateway dataConfigGateway.ApplicationsDataGateway
-	IntegrationsGateway dataConfigGateway.IntegrationsDataGateway
-	ProviderBuilder     *ProviderBuilder
-	DisableChecks       bool // Only set to true by tests
+	ApplicationsGateway    dataConfigGateway.ApplicationsDataGateway
+	IntegrationsGateway    dataConfigGateway.IntegrationsDataGateway
+	ActionMappingsGateway  dataConfigGateway.ActionMappingsDataGateway  // optional, without it actions are not mapped
+	SubjectMappingsGateway dataConfigGateway.SubjectMappingsDataGateway // optional, without it subjects are not mapped
+	PolicyStatesGateway    dataConfigGateway.PolicyStatesDataGateway    // optional, without it written policies are not tracked for drift
+	PolicyVersionsGateway  dataConfigGateway.PolicyVersionsDataGateway  // optional, without it no versions are kept
+	ProviderBuilder        *ProviderBuilder
+	TargetConcurrency      int  // targets orchestrated at once by OrchestrateTargets, DefaultTargetConcurrency when 0
+	DisableChecks          bool // Only set to true by tests
+
+	ctx context.Context // the span of the caller, see WithContext
+}
+
+// DefaultTargetConcurrency is how many targets OrchestrateTargets orchestrates at once unless the service says
+// otherwise.
+const DefaultTargetConcurrency = 4
+
+// WithContext returns a copy of the service whose spans, and those of the providers it gathers, are children of the
+// span in ctx. Handlers pass the context of the request so that an orchestration is traced as part of it.
+func (service ApplicationsService) WithContext(ctx context.Context) ApplicationsService {
+	service.ctx = ctx
+	return service
+}
+
+func (service ApplicationsService) context() context.Context {
+	if service.ctx == nil {
+		return context.Background()
+	}
+	return service.ctx
+}
+
+// start starts a span, returning a copy of the service whose spans are its children.
+func (service ApplicationsService) start(name string, attributes ...attribute.KeyValue) (ApplicationsService, trace.Span) {
+	ctx, span := tracesupport.Start(service.context(), name, attributes...)
+	return service.WithContext(ctx), span
 }
 
 func (service ApplicationsService) GatherRecords(identifier string) (policyprovider.ApplicationInfo, policyprovider.IntegrationInfo, policyprovider.Provider, error) {
+	_, span := tracesupport.Start(service.context(), "ApplicationsService.GatherRecords", attribute.String("application.id", identifier))
+	application, integration, provider, err := service.gatherRecords(identifier)
+	tracesupport.End(span, err)
+	if instrumented, ok := provider.(instrumentedProvider); ok {
+		// the calls to the provider are made by the caller, after the records are gathered
+		instrumented.ctx = service.ctx
+		provider = instrumented
+	}
+	return application, integration, provider, err
+}
+
+func (service ApplicationsService) gatherRecords(identifier string) (policyprovider.ApplicationInfo, policyprovider.IntegrationInfo, policyprovider.Provider, error) {
 	applicationRecord, err := service.ApplicationsGateway.FindById(identifier)
 	if err != nil {
 		return policyprovider.ApplicationInfo{}, policyprovider.IntegrationInfo{}, nil, err
@@ -43,139 +97,414 @@ func (service ApplicationsService) GatherRecords(identifier string) (policyprovi
 }
 
 func (service ApplicationsService) Apply(jsonRequest Orchestration) error {
-	fromApplication, fromIntegration, fromProvider, fromErr := service.GatherRecords(jsonRequest.From)
-	if fromErr != nil {
-		return fromErr
+	service, span := service.start("ApplicationsService.Apply", orchestrationAttributes(jsonRequest)...)
+	_, err := service.Orchestrate(jsonRequest)
+	tracesupport.End(span, err)
+	return err
+}
+
+func orchestrationAttributes(jsonRequest Orchestration) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("orchestration.from", jsonRequest.From), attribute.String("orchestration.to", jsonRequest.To)}
+}
+
+// The steps of an orchestration, in the order OrchestrateSteps reports them.
+const (
+	StepFetchSource = "fetch_source"
+	StepTransform   = "transform"
+	StepFetchTarget = "fetch_target"
+	StepWrite       = "write"
+)
+
+// Orchestrate is Apply, returning the policies written, the changes made to the target and what could not be mapped.
+func (service ApplicationsService) Orchestrate(jsonRequest Orchestration) (OrchestrationResult, error) {
+	return service.OrchestrateSteps(jsonRequest, func(string) {})
+}
+
+// OrchestrateSteps is Orchestrate, calling step with the name of each step as it starts.
+func (service ApplicationsService) OrchestrateSteps(jsonRequest Orchestration, step func(name string)) (OrchestrationResult, error) {
+	service, span := service.start("ApplicationsService.Orchestrate", orchestrationAttributes(jsonRequest)...)
+	result, err := service.orchestrateSteps(jsonRequest, func(name string) {
+		span.AddEvent(name)
+		step(name)
+	})
+	tracesupport.End(span, err)
+	observeOrchestration(OutcomeApplied, err)
+	return result, err
+}
+
+// The outcomes orchestrations are counted by.
+const (
+	OutcomeApplied   = "applied"
+	OutcomePreviewed = "previewed"
+	OutcomeFailed    = "failed"
+)
+
+func observeOrchestration(outcome string, err error) {
+	if err != nil {
+		outcome = OutcomeFailed
 	}
+	prometheussupport.ObserveOrchestration(outcome)
+}
 
-	toApplication, toIntegration, toProvider, toErr := service.GatherRecords(jsonRequest.To)
-	if toErr != nil {
-		return toErr
+func (service ApplicationsService) orchestrateSteps(jsonRequest Orchestration, step func(name string)) (OrchestrationResult, error) {
+	plan, err := service.plan(jsonRequest, step)
+	if err != nil {
+		return OrchestrationResult{}, err
 	}
 
-	logger.Info("Apply", "fromProvider", fromProvider.Name(), "toProvider", toProvider.Name(), "fromApp", fromApplication.Name, "toApp", toApplication.Name)
+	step(StepFetchTarget)
+	if plan.toPolicies == nil {
+		if plan.toPolicies, err = plan.toProvider.GetPolicyInfo(plan.toIntegration, plan.toApplication); err != nil {
+			return OrchestrationResult{}, fmt.Errorf("unable to read the current policies: %w", err)
+		}
+		if plan.toPolicies == nil {
+			plan.toPolicies = []hexapolicy.PolicyInfo{}
+		}
+	}
 
-	if !service.DisableChecks && !orchestrationSupported(toProvider, fromProvider) { // note - this should be temporary
-		return errors.New("orchestration across providers is a work in progress and currently supports azure and google cloud")
+	step(StepWrite)
+	reason := jsonRequest.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("orchestration from %s", jsonRequest.From)
 	}
+	target := policyTarget{plan.toApplication, plan.toIntegration, plan.toProvider}
+	if err = service.write(jsonRequest.To, target, plan.toPolicies, plan.policies, Change{Author: jsonRequest.Author, Reason: reason}); err != nil {
+		return OrchestrationResult{}, err
+	}
+	return OrchestrationResult{
+		Policies:         plan.policies,
+		Diff:             DiffPolicies(plan.toPolicies, plan.policies),
+		UnmappedActions:  plan.unmappedActions,
+		UnmappedSubjects: plan.unmappedSubjects,
+	}, nil
+}
 
-	fromPolicies, getFroErr := fromProvider.GetPolicyInfo(fromIntegration, fromApplication)
-	if getFroErr != nil {
-		return getFroErr
+// OrchestrateTargets orchestrates, or previews for a dry run, from the source to each of the targets. A failing
+// target does not stop the others, the results are in the order of the targets.
+func (service ApplicationsService) OrchestrateTargets(jsonRequest Orchestration, targets []string) []OrchestrationTargetResult {
+	concurrency := service.TargetConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultTargetConcurrency
 	}
+	options := workflowsupport.Options{Limit: concurrency, Mode: workflowsupport.CollectAll}
+	results, _ := workflowsupport.Process(context.Background(), targets, options, func(_ context.Context, to string) (OrchestrationResult, error) {
+		request := jsonRequest
+		request.To = to
+		request.Targets = nil
+		if request.DryRun {
+			return service.Preview(request)
+		}
+		return service.Orchestrate(request)
+	})
 
-	if service.DisableChecks || isBetweenAmazonAndAzure(toProvider, fromProvider) {
-		status, setErr := toProvider.SetPolicyInfo(toIntegration, toApplication, fromPolicies)
-		if setErr != nil || status != http.StatusCreated {
-			return setErr
+	targetResults := make([]OrchestrationTargetResult, 0, len(targets))
+	for i, result := range results {
+		if result.Err != nil {
+			logger.Error("OrchestrateTargets", "from", jsonRequest.From, "to", targets[i], "error", result.Err)
+			targetResults = append(targetResults, OrchestrationTargetResult{To: targets[i], Error: result.Err.Error()})
+			continue
 		}
-		return nil
+		value := result.Value
+		targetResults = append(targetResults, OrchestrationTargetResult{To: targets[i], Result: &value})
 	}
+	return targetResults
+}
+
+// ErrPolicyConflict is returned when the policies of an application changed since the writer read them.
+var ErrPolicyConflict = errors.New("policies have changed since they were read")
+
+// Change identifies who is writing the policies of an application, and why. It is kept with the version of the
+// policies that are overwritten. IfMatch, when set, is the PoliciesEtag the writer read; the write fails with
+// ErrPolicyConflict unless the application still has those policies.
+type Change struct {
+	Author  string
+	Reason  string
+	IfMatch string
+}
+
+// PoliciesEtag returns a quoted entity tag for a set of policies. It is built from the etag of each policy, so it
+// does not depend on the order the provider returns them in or on their meta data.
+func PoliciesEtag(policies []hexapolicy.PolicyInfo) string {
+	return fmt.Sprintf("%q", policiesHash(policies))
+}
 
-	toPolicies, getToErr := toProvider.GetPolicyInfo(toIntegration, toApplication)
-	if getToErr != nil {
-		return getToErr
+// policiesHash is the hash of a set of policies that PoliciesEtag quotes, and that audit entries record.
+func policiesHash(policies []hexapolicy.PolicyInfo) string {
+	etags := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		etags = append(etags, policy.CalculateEtag()) // policy is a copy, the etag it sets is discarded
 	}
+	sort.Strings(etags)
+	sum := sha256.Sum256([]byte(strings.Join(etags, ",")))
+	return hex.EncodeToString(sum[:])
+}
 
-	if service.DisableChecks || onlyWorksWithGoogleAndAzure(toProvider, fromProvider) {
-		if !verifyAllMembersAreUsers(fromPolicies) { // note - this should be temporary
-			return errors.New("orchestration across providers with domain members is a work in progress")
-		}
+type policyTarget struct {
+	application policyprovider.ApplicationInfo
+	integration policyprovider.IntegrationInfo
+	provider    policyprovider.Provider
+}
+
+// SetPolicies writes policies to an application, keeping the policies it had as a new version first.
+func (service ApplicationsService) SetPolicies(applicationId string, policies []hexapolicy.PolicyInfo, change Change) error {
+	service, span := service.start("ApplicationsService.SetPolicies", attribute.String("application.id", applicationId))
+	err := service.setPolicies(applicationId, policies, change)
+	tracesupport.End(span, err)
+	return err
+}
+
+func (service ApplicationsService) setPolicies(applicationId string, policies []hexapolicy.PolicyInfo, change Change) error {
+	application, integration, provider, err := service.GatherRecords(applicationId)
+	if err != nil {
+		return err
 	}
+	return service.write(applicationId, policyTarget{application, integration, provider}, nil, policies, change)
+}
 
-	modifiedPolicies, err := service.RetainResource(fromPolicies, toPolicies)
+// Rollback writes the policies of an older version back to the application. The policies it replaces are kept as a
+// new version, so a rollback can itself be rolled back.
+func (service ApplicationsService) Rollback(applicationId string, version int, change Change) error {
+	if service.PolicyVersionsGateway == nil {
+		return dataConfigGateway.ErrPolicyVersionNotFound
+	}
+	record, err := service.PolicyVersionsGateway.FindByVersion(applicationId, version)
 	if err != nil {
 		return err
 	}
+	if change.Reason == "" {
+		change.Reason = fmt.Sprintf("rollback to version %d", version)
+	}
+	return service.SetPolicies(applicationId, record.Policies, change)
+}
 
-	if service.DisableChecks || onlyWorksWithGoogleAndAzure(toProvider, fromProvider) {
-		modifiedPolicies, err = service.RetainAction(modifiedPolicies, toPolicies)
+// write snapshots the current policies of the target, read from the provider unless they are given, and then
+// replaces them. The write is abandoned when the current policies cannot be kept, or do not match change.IfMatch.
+func (service ApplicationsService) write(applicationId string, target policyTarget, current, policies []hexapolicy.PolicyInfo, change Change) error {
+	if current == nil && (service.PolicyVersionsGateway != nil || change.IfMatch != "") {
+		var err error
+		if current, err = target.provider.GetPolicyInfo(target.integration, target.application); err != nil {
+			return fmt.Errorf("unable to read the current policies: %w", err)
+		}
+	}
+	if change.IfMatch != "" && change.IfMatch != "*" && change.IfMatch != PoliciesEtag(current) {
+		return ErrPolicyConflict
+	}
+
+	if service.PolicyVersionsGateway != nil {
+		_, err := service.PolicyVersionsGateway.Create(dataConfigGateway.PolicyVersionRecord{
+			ApplicationId: applicationId,
+			Policies:      current,
+			Author:        change.Author,
+			Reason:        change.Reason,
+		})
 		if err != nil {
 			return err
 		}
 	}
 
-	status, setErr := toProvider.SetPolicyInfo(toIntegration, toApplication, modifiedPolicies)
-	if setErr != nil || status != http.StatusCreated {
-		return setErr
+	status, err := target.provider.SetPolicyInfo(target.integration, target.application, policies)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("unable to update policy, provider returned %d", status)
 	}
+	written := auditsupport.PolicyChange{Application: applicationId, After: policiesHash(policies)}
+	if current != nil {
+		written.Before = policiesHash(current)
+	}
+	auditsupport.AddPolicyChange(service.context(), written)
+	service.RecordWritten(applicationId, policies)
 	return nil
 }
 
-func (service ApplicationsService) RetainResource(fromPolicies, toPolicies []hexapolicy.PolicyInfo) ([]hexapolicy.PolicyInfo, error) {
-	var firstResourceId string
+// RecordWritten keeps the policies written to an application as its desired policies, which drift is detected
+// against. A declared desired state is left in place. The policies have already been written, so failures are logged
+// rather than returned.
+func (service ApplicationsService) RecordWritten(applicationId string, policies []hexapolicy.PolicyInfo) {
+	if service.PolicyStatesGateway == nil {
+		return
+	}
+	state, err := service.PolicyStatesGateway.FindByApplication(applicationId)
+	if err == nil && state.Declared {
+		return
+	}
+	if err != nil && !errors.Is(err, dataConfigGateway.ErrPolicyStateNotFound) {
+		logger.Error("RecordWritten", "application", applicationId, "error", err)
+		return
+	}
+	if err = service.PolicyStatesGateway.SetDesired(applicationId, policies, false); err != nil {
+		logger.Error("RecordWritten", "application", applicationId, "error", err)
+	}
+}
 
-	resourceIds := make([]string, 0)
-	for _, policy := range toPolicies {
-		if firstResourceId == "" {
-			firstResourceId = policy.Object.String()
-		}
-		resourceIds = append(resourceIds, policy.Object.String())
+// Preview runs the same pipeline as Apply but does not write to the target. It returns the policies that would be
+// written along with a diff against the target's current policies.
+func (service ApplicationsService) Preview(jsonRequest Orchestration) (OrchestrationResult, error) {
+	service, span := service.start("ApplicationsService.Preview", orchestrationAttributes(jsonRequest)...)
+	result, err := service.preview(jsonRequest)
+	tracesupport.End(span, err)
+	observeOrchestration(OutcomePreviewed, err)
+	return result, err
+}
+
+func (service ApplicationsService) preview(jsonRequest Orchestration) (OrchestrationResult, error) {
+	plan, err := service.plan(jsonRequest, func(string) {})
+	if err != nil {
+		return OrchestrationResult{}, err
 	}
 
-	for _, foundResourceId := range resourceIds {
-		if firstResourceId != foundResourceId {
-			return []hexapolicy.PolicyInfo{}, errors.New("sorry, found more than one resource id within policies")
+	toPolicies := plan.toPolicies
+	if toPolicies == nil {
+		toPolicies, err = plan.toProvider.GetPolicyInfo(plan.toIntegration, plan.toApplication)
+		if err != nil {
+			return OrchestrationResult{}, err
 		}
 	}
 
-	modified := make([]hexapolicy.PolicyInfo, 0)
-	for _, policy := range fromPolicies {
-		policy.Object = hexapolicy.ObjectInfo(firstResourceId)
-		modified = append(modified, policy)
-	}
-	return modified, nil
+	return OrchestrationResult{
+		Policies:         plan.policies,
+		Diff:             DiffPolicies(toPolicies, plan.policies),
+		UnmappedActions:  plan.unmappedActions,
+		UnmappedSubjects: plan.unmappedSubjects,
+	}, nil
 }
 
-func (service ApplicationsService) RetainAction(fromPolicies, toPolicies []hexapolicy.PolicyInfo) ([]hexapolicy.PolicyInfo, error) {
-	firstActionUri := toPolicies[0].Actions[0] // todo update to handle all action uris from toProvider
+// orchestrationPlan holds the policies an orchestration would write, and where it would write them.
+type orchestrationPlan struct {
+	toApplication    policyprovider.ApplicationInfo
+	toIntegration    policyprovider.IntegrationInfo
+	toProvider       policyprovider.Provider
+	toPolicies       []hexapolicy.PolicyInfo // nil when the target policies were not needed to build the plan
+	policies         []hexapolicy.PolicyInfo
+	unmappedActions  []UnmappedAction
+	unmappedSubjects []UnmappedSubject
+}
 
-	modified := make([]hexapolicy.PolicyInfo, 0)
-	for _, policy := range fromPolicies {
-		policy.Actions = make([]hexapolicy.ActionInfo, 1)
-		policy.Actions[0] = firstActionUri
-		modified = append(modified, policy)
+// plan reads the source policies and translates them for the target, calling step as StepFetchSource and
+// StepTransform start.
+func (service ApplicationsService) plan(jsonRequest Orchestration, step func(name string)) (orchestrationPlan, error) {
+	step(StepFetchSource)
+	fromApplication, fromIntegration, fromProvider, fromErr := service.GatherRecords(jsonRequest.From)
+	if fromErr != nil {
+		return orchestrationPlan{}, fromErr
 	}
-	return modified, nil
-}
 
-func verifyAllMembersAreUsers(policies []hexapolicy.PolicyInfo) bool {
-	var areMembersUsers bool
-	for _, policy := range policies {
-		for _, member := range policy.Subjects {
-			areMembersUsers = strings.Contains(member, "user:")
+	toApplication, toIntegration, toProvider, toErr := service.GatherRecords(jsonRequest.To)
+	if toErr != nil {
+		return orchestrationPlan{}, toErr
+	}
+
+	logger.Info("Apply", "fromProvider", fromProvider.Name(), "toProvider", toProvider.Name(), "fromApp", fromApplication.Name, "toApp", toApplication.Name)
+
+	plan := orchestrationPlan{toApplication: toApplication, toIntegration: toIntegration, toProvider: toProvider}
+
+	var translation Translation
+	if !service.DisableChecks {
+		var err error
+		if translation, err = NewTranslation(fromProvider, toProvider); err != nil {
+			return orchestrationPlan{}, err
+		}
+		pairs, err := service.mappingPairs(jsonRequest)
+		if err != nil {
+			return orchestrationPlan{}, err
+		}
+		if translation.ActionMapping, err = service.findActionMapping(pairs); err != nil {
+			return orchestrationPlan{}, err
+		}
+		if translation.SubjectMapping, err = service.findSubjectMapping(pairs); err != nil {
+			return orchestrationPlan{}, err
 		}
 	}
-	return areMembersUsers
-}
 
-func orchestrationSupported(toProvider policyprovider.Provider, fromProvider policyprovider.Provider) bool {
-	if toProvider == fromProvider {
-		return true
+	fromPolicies, getFroErr := fromProvider.GetPolicyInfo(fromIntegration, fromApplication)
+	if getFroErr != nil {
+		return orchestrationPlan{}, getFroErr
+	}
+
+	step(StepTransform)
+	if service.DisableChecks {
+		plan.policies = fromPolicies
+		return plan, nil
+	}
+
+	targetPolicies := func() ([]hexapolicy.PolicyInfo, error) {
+		if plan.toPolicies != nil {
+			return plan.toPolicies, nil
+		}
+		toPolicies, err := toProvider.GetPolicyInfo(toIntegration, toApplication)
+		if err != nil {
+			return nil, err
+		}
+		if toPolicies == nil {
+			toPolicies = []hexapolicy.PolicyInfo{}
+		}
+		plan.toPolicies = toPolicies
+		return toPolicies, nil
+	}
+
+	translation.ResourceRules = jsonRequest.Resources
+	translated, err := translation.Apply(fromPolicies, targetPolicies)
+	if err != nil {
+		return orchestrationPlan{}, err
 	}
-	return onlyWorksWithGoogleAndAzure(toProvider, fromProvider)
+	plan.policies = translated.Policies
+	plan.unmappedActions = translated.UnmappedActions
+	plan.unmappedSubjects = translated.UnmappedSubjects
+	return plan, nil
 }
 
-func onlyWorksWithGoogleAndAzure(toProvider policyprovider.Provider, fromProvider policyprovider.Provider) bool {
-	if toProvider.Name() == "google_cloud" && fromProvider.Name() == "azure" {
-		return true
+// mappingPairs returns the pairs a mapping may be stored for, most specific first: the two applications, then their
+// integrations.
+func (service ApplicationsService) mappingPairs(jsonRequest Orchestration) ([][2]string, error) {
+	fromApp, err := service.ApplicationsGateway.FindById(jsonRequest.From)
+	if err != nil {
+		return nil, err
 	}
-	if toProvider.Name() == "azure" && fromProvider.Name() == "google_cloud" {
-		return true
+	toApp, err := service.ApplicationsGateway.FindById(jsonRequest.To)
+	if err != nil {
+		return nil, err
 	}
-	// TODO - Check this with Gerry
-	if isBetweenAmazonAndAzure(toProvider, fromProvider) {
-		return true
+	return [][2]string{{fromApp.ID, toApp.ID}, {fromApp.IntegrationId, toApp.IntegrationId}}, nil
+}
+
+// findActionMapping returns the actions mapped between the two applications, or failing that between their
+// integrations. It returns nil when neither pair has a mapping.
+func (service ApplicationsService) findActionMapping(pairs [][2]string) (map[string][]string, error) {
+	if service.ActionMappingsGateway == nil {
+		return nil, nil
 	}
-	return false
+	for _, pair := range pairs {
+		mapping, err := service.ActionMappingsGateway.FindByPair(pair[0], pair[1])
+		if errors.Is(err, dataConfigGateway.ErrActionMappingNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mapping.Actions, nil
+	}
+	return nil, nil
 }
 
-func isBetweenAmazonAndAzure(toProvider policyprovider.Provider, fromProvider policyprovider.Provider) bool {
-	if toProvider.Name() == "amazon" && fromProvider.Name() == "azure" {
-		return true
+// findSubjectMapping is findActionMapping for subjects.
+func (service ApplicationsService) findSubjectMapping(pairs [][2]string) (*SubjectMapping, error) {
+	if service.SubjectMappingsGateway == nil {
+		return nil, nil
 	}
-	if toProvider.Name() == "azure" && fromProvider.Name() == "amazon" {
-		return true
+	for _, pair := range pairs {
+		mapping, err := service.SubjectMappingsGateway.FindByPair(pair[0], pair[1])
+		if errors.Is(err, dataConfigGateway.ErrSubjectMappingNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &SubjectMapping{Subjects: mapping.Subjects, Domains: mapping.Domains, Groups: mapping.Groups}, nil
 	}
-	return false
+	return nil, nil
+}
+
+func (service ApplicationsService) RetainResource(fromPolicies, toPolicies []hexapolicy.PolicyInfo) ([]hexapolicy.PolicyInfo, error) {
+	return retainResource(fromPolicies, toPolicies)
 }
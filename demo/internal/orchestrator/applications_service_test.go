@@ -75,8 +75,8 @@ func (data *applicationsServiceData) SetUp() {
 	_, _ = data.Data.Create("50e00619-9f15-4e85-a7e9-f26d87ea12e7", "noop", []byte("aKey"))
 	integration := data.Data.Integrations["50e00619-9f15-4e85-a7e9-f26d87ea12e7"]
 	apps := []policyprovider.ApplicationInfo{
-		{"anObjectId", "aName", "aDescription", "aService"},
-		{"anotherObjectId", "anotherName", "anotherDescription", "anotherService"},
+		{ObjectID: "anObjectId", Name: "aName", Description: "aDescription", Service: "aService"},
+		{ObjectID: "anotherObjectId", Name: "anotherName", Description: "anotherDescription", Service: "anotherService"},
 	}
 	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff210"] = apps[0]
 	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff211"] = apps[0]
@@ -167,25 +167,25 @@ func TestApplicationsService_RetainResource(t *testing.T) {
 	})
 }
 
-func TestApplicationsService_RetainAction(t *testing.T) {
+func TestApplicationsService_Preview(t *testing.T) {
 	testsupport.WithSetUp(&applicationsServiceData{}, func(data *applicationsServiceData) {
+		pb := orchestrator.NewProviderBuilder()
+		pb.AddProviders(data.providers)
 
-		applicationsService := orchestrator.ApplicationsService{ApplicationsGateway: data.appGateway, IntegrationsGateway: data.intGateway, ProviderBuilder: nil}
-
-		from := []hexapolicy.PolicyInfo{
-			{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"fromAnAction"}, Subjects: hexapolicy.SubjectInfo{"fromAUser"}, Object: "fromAnId"},
-			{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"fromAnotherAction"}, Subjects: hexapolicy.SubjectInfo{"fromAnotherUser"}, Object: "fromAnId"},
-		}
-
-		to := []hexapolicy.PolicyInfo{
-			{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"toAnAction"}, Subjects: hexapolicy.SubjectInfo{"toAUser"}, Object: "toAnId"},
-			{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"toAnotherAction"}, Subjects: hexapolicy.SubjectInfo{"toAnotherUser"}, Object: "toAnId"},
-		}
+		applicationsService := orchestrator.ApplicationsService{ApplicationsGateway: data.appGateway, IntegrationsGateway: data.intGateway, ProviderBuilder: pb, DisableChecks: true}
 
-		modified, _ := applicationsService.RetainAction(from, to)
+		result, err := applicationsService.Preview(orchestrator.Orchestration{From: data.azureApp, To: data.googleApp})
+		assert.NoError(t, err)
+		assert.Len(t, result.Policies, 2)
+		assert.True(t, result.Diff.IsEmpty())
 
-		assert.Equal(t, "toAnAction", modified[0].Actions[0].String())
+		_, err = applicationsService.Preview(orchestrator.Orchestration{From: "", To: data.googleApp})
+		assert.Error(t, err)
 
-		assert.Equal(t, "toAnAction", modified[1].Actions[0].String())
+		azureProvider := data.providers["50e00619-9f15-4e85-a7e9-f26d87ea12e8"].(*orchestratorNoopProvider.NoopProvider)
+		azureProvider.SetTestErr(errors.New("oops"))
+		_, err = applicationsService.Preview(orchestrator.Orchestration{From: data.azureApp, To: data.googleApp})
+		azureProvider.SetTestErr(nil)
+		assert.Error(t, err)
 	})
 }
@@ -0,0 +1,118 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+)
+
+// DefaultAuditLimit is how many of the latest entries GET /audit returns unless the limit parameter says otherwise.
+const DefaultAuditLimit = 100
+
+// The actions recorded in the audit log, one for each route that changes something.
+const (
+	AuditIntegrationCreate    = "integrations.create"
+	AuditIntegrationDelete    = "integrations.delete"
+	AuditIntegrationUpdate    = "integrations.update"
+	AuditIntegrationRotate    = "integrations.rotate"
+	AuditPoliciesSet          = "policies.set"
+	AuditPoliciesRollback     = "policies.rollback"
+	AuditDesiredDeclare       = "desired.declare"
+	AuditDesiredUndeclare     = "desired.undeclare"
+	AuditOrchestration        = "orchestration.apply"
+	AuditOrchestrationCreate  = "orchestrations.create"
+	AuditOrchestrationUpdate  = "orchestrations.update"
+	AuditOrchestrationDelete  = "orchestrations.delete"
+	AuditOrchestrationRun     = "orchestrations.run"
+	AuditOrchestrationPause   = "orchestrations.pause"
+	AuditOrchestrationResume  = "orchestrations.resume"
+	AuditDeadLetterDelete     = "dead_letters.delete"
+	AuditActionMappingUpdate  = "action_mappings.update"
+	AuditActionMappingDelete  = "action_mappings.delete"
+	AuditSubjectMappingUpdate = "subject_mappings.update"
+	AuditSubjectMappingDelete = "subject_mappings.delete"
+)
+
+type AuditEntries struct {
+	Entries []auditsupport.Entry `json:"entries"`
+}
+
+// AuditVerification is whether the hash chain of the audit log is intact.
+type AuditVerification struct {
+	Valid   bool   `json:"valid"`
+	Entries int64  `json:"entries"`
+	Error   string `json:"error,omitempty"`
+}
+
+type AuditHandler struct {
+	log   *auditsupport.Log
+	guard integrationGuard
+}
+
+// List returns the latest entries of the audit log, oldest first. They are filtered by the subject (or email),
+// action, target and outcome parameters, and by since and until as RFC 3339 times. A token restricted to some
+// integrations only sees the entries of those integrations.
+func (handler AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if access := accessOf(r); access != nil {
+		filter.Permits = func(entry auditsupport.Entry) bool {
+			return handler.guard.permitsAuditEntry(access, entry)
+		}
+	}
+	entries, err := handler.log.Find(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, _ := json.Marshal(AuditEntries{entries})
+	w.Header().Set("content-type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// Verify checks the hash chain of the whole audit log.
+func (handler AuditHandler) Verify(w http.ResponseWriter, _ *http.Request) {
+	count, err := handler.log.Verify()
+	verification := AuditVerification{Valid: err == nil, Entries: count}
+	if err != nil {
+		verification.Error = err.Error()
+	}
+	data, _ := json.Marshal(verification)
+	w.Header().Set("content-type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func auditFilter(r *http.Request) (auditsupport.Filter, error) {
+	query := r.URL.Query()
+	filter := auditsupport.Filter{
+		Subject: query.Get("subject"),
+		Action:  query.Get("action"),
+		Target:  query.Get("target"),
+		Outcome: query.Get("outcome"),
+		Limit:   DefaultAuditLimit,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return filter, fmt.Errorf("invalid limit %s, expected a positive number", limit)
+		}
+		filter.Limit = value
+	}
+	for name, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %s, expected a time such as 2024-01-02T15:04:05Z", name, raw)
+			}
+			*value = parsed
+		}
+	}
+	return filter, nil
+}
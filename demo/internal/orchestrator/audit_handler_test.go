@@ -0,0 +1,108 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func getAudit(t *testing.T, data *orchestrationHandlerData, query string) []auditsupport.Entry {
+	resp, err := data.oauthHttpClient.Get(fmt.Sprintf("http://%s/audit%s", data.server.Addr, query))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var entries orchestrator.AuditEntries
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	return entries.Entries
+}
+
+func TestAudit_orchestration(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err := data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		entries := getAudit(t, data, "?action="+orchestrator.AuditOrchestration)
+		assert.Len(t, entries, 1)
+		entry := entries[0]
+		assert.Equal(t, "clientId", entry.Subject, "the subject of the token")
+		assert.Equal(t, []string{data.fromApp, data.toApp}, entry.Targets)
+		assert.Equal(t, auditsupport.OutcomeSuccess, entry.Outcome)
+		assert.Equal(t, http.StatusCreated, entry.Status)
+		assert.Len(t, entry.Policies, 1)
+		assert.Equal(t, data.toApp, entry.Policies[0].Application)
+		assert.Len(t, entry.Policies[0].Before, 64)
+		assert.Len(t, entry.Policies[0].After, 64)
+	})
+}
+
+func TestAudit_integrations(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		resp, err := data.oauthHttpClient.Post(fmt.Sprintf("http://%s/integrations", data.server.Addr), "application/json",
+			strings.NewReader(`{"id":"anAlias","provider":"noop","key":"YUtleQ=="}`))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("http://%s/integrations/%s", data.server.Addr, "anAlias"), strings.NewReader(`{"id":"aNewAlias"}`))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/integrations/%s", data.server.Addr, "aNewAlias"), nil)
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		entries := getAudit(t, data, "?target=anAlias")
+		assert.Len(t, entries, 2)
+		assert.Equal(t, orchestrator.AuditIntegrationCreate, entries[0].Action)
+		assert.Equal(t, orchestrator.AuditIntegrationUpdate, entries[1].Action)
+		assert.Equal(t, []string{"anAlias", "aNewAlias"}, entries[1].Targets)
+		assert.Equal(t, entries[0].Hash, entries[1].PreviousHash)
+		assert.Equal(t, orchestrator.AuditIntegrationDelete, getAudit(t, data, "?target=aNewAlias")[1].Action)
+
+		assert.Empty(t, getAudit(t, data, "?target=anAlias&outcome="+auditsupport.OutcomeFailure))
+		assert.Len(t, getAudit(t, data, "?limit=1"), 1)
+	})
+}
+
+func TestAudit_withBadFilter(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		for _, query := range []string{"?limit=none", "?since=yesterday"} {
+			resp, err := data.oauthHttpClient.Get(fmt.Sprintf("http://%s/audit%s", data.server.Addr, query))
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+}
+
+func TestAudit_verify(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		verify := func() orchestrator.AuditVerification {
+			resp, err := data.oauthHttpClient.Get(fmt.Sprintf("http://%s/audit/verify", data.server.Addr))
+			assert.NoError(t, err)
+			var verification orchestrator.AuditVerification
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&verification))
+			return verification
+		}
+
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		_, _ = data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.Equal(t, orchestrator.AuditVerification{Valid: true, Entries: 1}, verify())
+
+		path := filepath.Join(data.testDir, "audit.log")
+		log, _ := os.ReadFile(path)
+		_ = os.WriteFile(path, bytes.Replace(log, []byte(`"success"`), []byte(`"failure"`), 1), 0o600)
+		verification := verify()
+		assert.False(t, verification.Valid)
+		assert.Contains(t, verification.Error, "entry 1 does not match its hash")
+	})
+}
@@ -0,0 +1,25 @@
+package orchestrator
+
+import (
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	logger "golang.org/x/exp/slog"
+)
+
+// The kinds of scheduled work that leave a dead letter when they fail every attempt.
+const (
+	DeadLetterOrchestration = "orchestration"
+	DeadLetterJob           = "job"
+)
+
+// saveDeadLetter keeps a failure so that it can be inspected through GET /dead-letters.
+func saveDeadLetter(deadLetters dataConfigGateway.DeadLettersDataGateway, kind string, taskId string, failure workflowsupport.Failure) {
+	logger.Error("ReportFailure", kind, taskId, "attempts", failure.Attempts, "error", failure.Err)
+	record := dataConfigGateway.DeadLetterRecord{Kind: kind, TaskId: taskId, Attempts: failure.Attempts, FailedAt: failure.FailedAt}
+	if failure.Err != nil {
+		record.Error = failure.Err.Error()
+	}
+	if _, err := deadLetters.Create(record); err != nil {
+		logger.Error("ReportFailure", kind, taskId, "msg", "unable to save dead letter", "error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+// DeadLetter is scheduled work that failed every attempt it was allowed. It is kept until it is deleted.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Kind     string    `json:"kind"`    // orchestration or job
+	TaskId   string    `json:"task_id"` // the id of the orchestration or job
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type DeadLetters struct {
+	DeadLetters []DeadLetter `json:"dead_letters"`
+}
+
+type DeadLettersHandler struct {
+	deadLetters dataConfigGateway.DeadLettersDataGateway
+	guard       integrationGuard
+}
+
+// List returns the dead letters of the work the token of the request is permitted to access.
+func (handler DeadLettersHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := handler.deadLetters.Find()
+	if err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	access := accessOf(r)
+	list := make([]DeadLetter, 0, len(records))
+	for _, record := range records {
+		if handler.guard.permitsDeadLetter(access, record) {
+			list = append(list, DeadLetter(record))
+		}
+	}
+	data, _ := json.Marshal(DeadLetters{list})
+	w.Header().Set("content-type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (handler DeadLettersHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := handler.deadLetters.Delete(mux.Vars(r)["id"]); err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeDeadLetterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dataConfigGateway.ErrDeadLetterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,51 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetters(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		deadLettersUrl := fmt.Sprintf("http://%s/dead-letters", data.server.Addr)
+		listDeadLetters := func() []orchestrator.DeadLetter {
+			resp, err := data.oauthHttpClient.Get(deadLettersUrl)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var list orchestrator.DeadLetters
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+			return list.DeadLetters
+		}
+		assert.Empty(t, listDeadLetters())
+
+		id, err := data.Data.GetDeadLetterDataGateway().Create(dataConfigGateway.DeadLetterRecord{
+			Kind: orchestrator.DeadLetterJob, TaskId: "aJob", Attempts: 4, Error: "oops", FailedAt: time.Now(),
+		})
+		assert.NoError(t, err)
+		deadLetters := listDeadLetters()
+		assert.Len(t, deadLetters, 1)
+		assert.Equal(t, id, deadLetters[0].ID)
+		assert.Equal(t, orchestrator.DeadLetterJob, deadLetters[0].Kind)
+		assert.Equal(t, "aJob", deadLetters[0].TaskId)
+		assert.Equal(t, 4, deadLetters[0].Attempts)
+		assert.Equal(t, "oops", deadLetters[0].Error)
+
+		req, _ := http.NewRequest(http.MethodDelete, deadLettersUrl+"/"+id, nil)
+		resp, err := data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Empty(t, listDeadLetters())
+
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,123 @@
+package orchestrator
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	logger "golang.org/x/exp/slog"
+)
+
+const (
+	DriftInSync  = "in_sync"
+	DriftDrifted = "drifted"
+	DriftError   = "error"   // the policies could not be read at the last check
+	DriftUnknown = "unknown" // no desired policies are recorded, or the application has not been checked yet
+)
+
+// DriftStatus summarises a policy state as one of the Drift constants. A nil state is unknown.
+func DriftStatus(state *dataConfigGateway.PolicyStateRecord) string {
+	switch {
+	case state == nil || state.Drift == nil:
+		return DriftUnknown
+	case state.Drift.Error != "":
+		return DriftError
+	case state.Drift.Drifted:
+		return DriftDrifted
+	default:
+		return DriftInSync
+	}
+}
+
+// DriftDetector compares the policies of applications with their desired policies.
+type DriftDetector struct {
+	PolicyStates        dataConfigGateway.PolicyStatesDataGateway
+	ApplicationsService ApplicationsService
+}
+
+func NewDriftDetector(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider) DriftDetector {
+	return DriftDetector{
+		PolicyStates:        configHandler.GetPolicyStateDataGateway(),
+		ApplicationsService: newApplicationsService(configHandler, cacheProviders),
+	}
+}
+
+// Check reads the policies of an application and records whether they differ from its desired policies. Failing to
+// read the policies is recorded as part of the drift rather than returned. It returns ErrPolicyStateNotFound when
+// the application has no desired policies.
+func (detector DriftDetector) Check(applicationId string) (*dataConfigGateway.PolicyStateRecord, error) {
+	state, err := detector.PolicyStates.FindByApplication(applicationId)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := dataConfigGateway.DriftRecord{CheckedAt: time.Now().UTC()}
+	application, integration, provider, err := detector.ApplicationsService.GatherRecords(applicationId)
+	if err == nil {
+		drift.Found, err = provider.GetPolicyInfo(integration, application)
+	}
+	if err != nil {
+		logger.Error("Check", "msg", "unable to read policies", "application", applicationId, "error", err)
+		drift.Error = err.Error()
+	} else {
+		drift.Drifted = !DiffPolicies(state.Desired, drift.Found).IsEmpty()
+	}
+
+	if err = detector.PolicyStates.RecordDrift(applicationId, drift); err != nil {
+		return nil, err
+	}
+	state.Drift = &drift
+	return state, nil
+}
+
+// NewDriftScheduler returns a scheduler that checks every application with desired policies for drift on the given
+// schedule.
+func NewDriftScheduler(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider, schedule workflowsupport.Schedule) workflowsupport.WorkScheduler {
+	detector := NewDriftDetector(configHandler, cacheProviders)
+	return workflowsupport.NewJobScheduler(&driftFinder{detector.PolicyStates}, []workflowsupport.Job{{Name: "drift", Schedule: schedule, Worker: driftWorker{detector}}})
+}
+
+type driftFinder struct {
+	policyStates dataConfigGateway.PolicyStatesDataGateway
+}
+
+func (finder *driftFinder) FindRequested() []interface{} {
+	states, err := finder.policyStates.Find()
+	if err != nil {
+		logger.Error("FindRequested", "msg", "unable to find policy states", "error", err)
+		return nil
+	}
+	requested := make([]interface{}, 0, len(states))
+	for _, state := range states {
+		requested = append(requested, state.ApplicationId)
+	}
+	return requested
+}
+
+func (finder *driftFinder) MarkCompleted() {}
+
+func (finder *driftFinder) MarkErroneous() {}
+
+// ReportFailure only logs, the error is kept with the drift of the application and the next check is the retry.
+func (finder *driftFinder) ReportFailure(failure workflowsupport.Failure) {
+	logger.Error("ReportFailure", "application", failure.Task, "error", failure.Err)
+}
+
+func (finder *driftFinder) Stop() {}
+
+type driftWorker struct {
+	detector DriftDetector
+}
+
+func (worker driftWorker) Run(task interface{}) error {
+	state, err := worker.detector.Check(task.(string))
+	if err != nil {
+		return err
+	}
+	if state.Drift.Error != "" {
+		return errors.New(state.Drift.Error)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+// Drift is the representation of an application's drift. Diff is from the desired policies to the policies found
+// at the last check, so added policies were added outside of Hexa.
+type Drift struct {
+	ApplicationId string      `json:"application_id"`
+	Status        string      `json:"status"`
+	Declared      bool        `json:"declared"`
+	DesiredAt     *time.Time  `json:"desired_at,omitempty"`
+	CheckedAt     *time.Time  `json:"checked_at,omitempty"`
+	Diff          *PolicyDiff `json:"diff,omitempty"`
+	Error         string      `json:"error,omitempty"`
+}
+
+type DriftHandler struct {
+	applicationsGateway dataConfigGateway.ApplicationsDataGateway
+	detector            DriftDetector
+}
+
+// Show returns the drift recorded at the last check, or checks the application now when check=true.
+func (handler DriftHandler) Show(w http.ResponseWriter, r *http.Request) {
+	identifier := mux.Vars(r)["id"]
+	var state *dataConfigGateway.PolicyStateRecord
+	var err error
+	if r.URL.Query().Get("check") == "true" {
+		handler.detector.ApplicationsService = handler.detector.ApplicationsService.WithContext(r.Context())
+		state, err = handler.detector.Check(identifier)
+	} else {
+		state, err = handler.detector.PolicyStates.FindByApplication(identifier)
+	}
+	if errors.Is(err, dataConfigGateway.ErrPolicyStateNotFound) {
+		writeDrift(w, Drift{ApplicationId: identifier, Status: DriftUnknown})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeDrift(w, mapDrift(*state))
+}
+
+// Declare sets the desired policies of an application. Policies written by orchestrations no longer replace them
+// until the declaration is removed.
+func (handler DriftHandler) Declare(w http.ResponseWriter, r *http.Request) {
+	var policies hexapolicy.Policies
+	if err := json.NewDecoder(r.Body).Decode(&policies); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validator.New().Var(policies.Policies, "omitempty,dive"); err != nil {
+		http.Error(w, "unable to validate policy.", http.StatusBadRequest)
+		return
+	}
+	identifier := mux.Vars(r)["id"]
+	if _, err := handler.applicationsGateway.FindById(identifier); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	declared := auditsupport.PolicyChange{Application: identifier, After: policiesHash(policies.Policies)}
+	if previous, err := handler.detector.PolicyStates.FindByApplication(identifier); err == nil {
+		declared.Before = policiesHash(previous.Desired)
+	}
+	if err := handler.detector.PolicyStates.SetDesired(identifier, policies.Policies, true); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	auditsupport.AddPolicyChange(r.Context(), declared)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Undeclare removes the desired policies of an application, the next policies written to it become desired.
+func (handler DriftHandler) Undeclare(w http.ResponseWriter, r *http.Request) {
+	if err := handler.detector.PolicyStates.Delete(mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, dataConfigGateway.ErrPolicyStateNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func mapDrift(state dataConfigGateway.PolicyStateRecord) Drift {
+	drift := Drift{
+		ApplicationId: state.ApplicationId,
+		Status:        DriftStatus(&state),
+		Declared:      state.Declared,
+		DesiredAt:     &state.DesiredAt,
+	}
+	if state.Drift != nil {
+		drift.CheckedAt = &state.Drift.CheckedAt
+		drift.Error = state.Drift.Error
+		if state.Drift.Error == "" {
+			diff := DiffPolicies(state.Desired, state.Drift.Found)
+			drift.Diff = &diff
+		}
+	}
+	return drift
+}
+
+func writeDrift(w http.ResponseWriter, drift Drift) {
+	data, _ := json.Marshal(drift)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
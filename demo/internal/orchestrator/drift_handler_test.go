@@ -0,0 +1,100 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrift(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		driftUrl := fmt.Sprintf("http://%s/applications/%s/drift", data.server.Addr, data.toApp)
+		desiredUrl := fmt.Sprintf("http://%s/applications/%s/desired", data.server.Addr, data.toApp)
+		getDrift := func(url string) orchestrator.Drift {
+			resp, err := data.oauthHttpClient.Get(url)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var drift orchestrator.Drift
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&drift))
+			return drift
+		}
+
+		assert.Equal(t, orchestrator.Drift{ApplicationId: data.toApp, Status: orchestrator.DriftUnknown}, getDrift(driftUrl))
+
+		// the policies written by an orchestration become the desired policies
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err := data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		drift := getDrift(driftUrl)
+		assert.Equal(t, orchestrator.DriftUnknown, drift.Status, "not checked yet")
+		assert.NotNil(t, drift.DesiredAt)
+
+		drift = getDrift(driftUrl + "?check=true")
+		assert.Equal(t, orchestrator.DriftInSync, drift.Status)
+		assert.False(t, drift.Declared)
+		assert.NotNil(t, drift.CheckedAt)
+		assert.True(t, drift.Diff.IsEmpty())
+
+		// a declared desired state is compared instead
+		marshal, _ = json.Marshal(hexapolicy.Policies{Policies: []hexapolicy.PolicyInfo{
+			{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"user:aUser"}, Object: "anId"},
+		}})
+		req, _ := http.NewRequest(http.MethodPut, desiredUrl, bytes.NewReader(marshal))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		drift = getDrift(driftUrl + "?check=true")
+		assert.Equal(t, orchestrator.DriftDrifted, drift.Status)
+		assert.True(t, drift.Declared)
+		assert.Len(t, drift.Diff.Added, 1)
+		assert.Equal(t, "anotherAction", string(drift.Diff.Added[0].Actions[0]))
+		assert.Empty(t, drift.Diff.Removed)
+
+		resp, err = data.oauthHttpClient.Get(fmt.Sprintf("http://%s/applications", data.server.Addr))
+		assert.NoError(t, err)
+		var apps orchestrator.Applications
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&apps))
+		for _, app := range apps.Applications {
+			if app.ID == data.toApp {
+				assert.Equal(t, orchestrator.DriftDrifted, app.Drift)
+			} else {
+				assert.Equal(t, orchestrator.DriftUnknown, app.Drift)
+			}
+		}
+
+		// orchestrating does not replace a declared state
+		marshal, _ = json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		_, _ = data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.Equal(t, orchestrator.DriftDrifted, getDrift(driftUrl).Status)
+
+		req, _ = http.NewRequest(http.MethodDelete, desiredUrl, nil)
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, orchestrator.DriftUnknown, getDrift(driftUrl).Status)
+
+		req, _ = http.NewRequest(http.MethodDelete, desiredUrl, nil)
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestDrift_declareUnknownApplication(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/applications/anUnknownApp/desired", data.server.Addr), bytes.NewReader([]byte(`{"policies":[]}`)))
+		resp, err := data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,94 @@
+package orchestrator_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	orchestratorNoopProvider "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriftStatus(t *testing.T) {
+	assert.Equal(t, orchestrator.DriftUnknown, orchestrator.DriftStatus(nil))
+	state := dataConfigGateway.PolicyStateRecord{}
+	assert.Equal(t, orchestrator.DriftUnknown, orchestrator.DriftStatus(&state))
+	state.Drift = &dataConfigGateway.DriftRecord{}
+	assert.Equal(t, orchestrator.DriftInSync, orchestrator.DriftStatus(&state))
+	state.Drift.Drifted = true
+	assert.Equal(t, orchestrator.DriftDrifted, orchestrator.DriftStatus(&state))
+	state.Drift.Error = "oops"
+	assert.Equal(t, orchestrator.DriftError, orchestrator.DriftStatus(&state))
+}
+
+func newDriftData(t *testing.T) (*dataConfigGateway.ConfigData, *orchestratorNoopProvider.NoopProvider) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	_, err = data.Create("anIntegration", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	data.Integrations["anIntegration"].Apps = map[string]policyprovider.ApplicationInfo{
+		"anApp":      {ObjectID: "anObject", Name: "anApp"},
+		"anotherApp": {ObjectID: "anotherObject", Name: "anotherApp"},
+	}
+	return data, &orchestratorNoopProvider.NoopProvider{}
+}
+
+func TestDriftDetector_Check(t *testing.T) {
+	data, provider := newDriftData(t)
+	detector := orchestrator.NewDriftDetector(data, map[string]policyprovider.Provider{"anIntegration": provider})
+
+	_, err := detector.Check("anApp")
+	assert.ErrorIs(t, err, dataConfigGateway.ErrPolicyStateNotFound)
+
+	found, _ := provider.GetPolicyInfo(policyprovider.IntegrationInfo{}, policyprovider.ApplicationInfo{})
+	assert.NoError(t, detector.PolicyStates.SetDesired("anApp", found, false))
+	state, err := detector.Check("anApp")
+	assert.NoError(t, err)
+	assert.Equal(t, orchestrator.DriftInSync, orchestrator.DriftStatus(state))
+
+	assert.NoError(t, detector.PolicyStates.SetDesired("anApp", []hexapolicy.PolicyInfo{}, true))
+	state, err = detector.Check("anApp")
+	assert.NoError(t, err)
+	assert.Equal(t, orchestrator.DriftDrifted, orchestrator.DriftStatus(state))
+	assert.Len(t, state.Drift.Found, 2)
+
+	provider.SetTestErr(errors.New("oops"))
+	state, err = detector.Check("anApp")
+	assert.NoError(t, err, "read failures are recorded")
+	assert.Equal(t, orchestrator.DriftError, orchestrator.DriftStatus(state))
+
+	stored, _ := detector.PolicyStates.FindByApplication("anApp")
+	assert.Equal(t, "oops", stored.Drift.Error)
+}
+
+func TestDriftScheduler(t *testing.T) {
+	data, provider := newDriftData(t)
+	states := data.GetPolicyStateDataGateway()
+	assert.NoError(t, states.SetDesired("anApp", []hexapolicy.PolicyInfo{}, false))
+
+	scheduler := orchestrator.NewDriftScheduler(data, map[string]policyprovider.Provider{"anIntegration": provider}, workflowsupport.Every(200*time.Millisecond))
+	scheduler.Start()
+	assert.Eventually(t, func() bool {
+		state, _ := states.FindByApplication("anApp")
+		return state.Drift != nil
+	}, 5*time.Second, 20*time.Millisecond)
+	scheduler.Stop()
+
+	state, err := states.FindByApplication("anApp")
+	assert.NoError(t, err)
+	assert.True(t, state.Drift.Drifted)
+
+	_, err = states.FindByApplication("anotherApp")
+	assert.ErrorIs(t, err, dataConfigGateway.ErrPolicyStateNotFound, "applications without desired policies are not checked")
+}
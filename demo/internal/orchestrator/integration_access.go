@@ -0,0 +1,284 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/hexaConstants"
+)
+
+// ErrIntegrationNotPermitted is returned with a forbidden status when the token of a request is restricted to other
+// integrations, see hexaConstants.ClaimIntegrations.
+var ErrIntegrationNotPermitted = errors.New("token is not permitted to access the integration")
+
+// integrationAccess is the set of integration aliases the token of a request is restricted to. A nil access is not
+// restricted.
+type integrationAccess map[string]bool
+
+// accessOf reads the integrations claim from the bearer token of the request. The token has already been verified by
+// oauth2support.JwtAuthenticationHandler, so its claims are read without checking the signature again.
+func accessOf(r *http.Request) integrationAccess {
+	scheme, raw, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "bearer") {
+		return nil
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(strings.TrimSpace(raw), claims); err != nil {
+		return nil
+	}
+	value, ok := claims[hexaConstants.ClaimIntegrations]
+	if !ok {
+		return nil
+	}
+	access := integrationAccess{}
+	switch aliases := value.(type) {
+	case string:
+		for _, alias := range strings.Fields(aliases) {
+			access[alias] = true
+		}
+	case []interface{}:
+		for _, alias := range aliases {
+			if s, isString := alias.(string); isString {
+				access[s] = true
+			}
+		}
+	}
+	return access
+}
+
+func (access integrationAccess) permits(alias string) bool {
+	return access == nil || access[alias]
+}
+
+// permitsApplications is whether every application belongs to a permitted integration. Applications that cannot be
+// found are not permitted to a restricted token.
+func (access integrationAccess) permitsApplications(gateway dataConfigGateway.ApplicationsDataGateway, ids ...string) bool {
+	if access == nil {
+		return true
+	}
+	for _, id := range ids {
+		record, err := gateway.FindById(id)
+		if err != nil || record == nil || !access[record.IntegrationId] {
+			return false
+		}
+	}
+	return true
+}
+
+// permitsMapping is whether both ends of a mapping, each the alias of an integration or the id of an application, are
+// permitted.
+func (access integrationAccess) permitsMapping(gateway dataConfigGateway.ApplicationsDataGateway, from string, to string) bool {
+	for _, id := range []string{from, to} {
+		if !access.permits(id) && !access.permitsApplications(gateway, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// integrationGuard refuses requests for routes that name an integration, an application, a stored orchestration, a
+// job, a dead letter or a mapping outside the integrations the token is restricted to.
+type integrationGuard struct {
+	applications   dataConfigGateway.ApplicationsDataGateway
+	orchestrations dataConfigGateway.OrchestrationsDataGateway
+	jobs           dataConfigGateway.JobsDataGateway
+	deadLetters    dataConfigGateway.DeadLettersDataGateway
+	integrations   dataConfigGateway.IntegrationsDataGateway
+}
+
+// integration guards routes where the id variable is the alias of an integration.
+func (guard integrationGuard) integration(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !accessOf(r).permits(mux.Vars(r)["id"]) {
+			notPermitted(w, mux.Vars(r)["id"])
+			return
+		}
+		next(w, r)
+	}
+}
+
+// application guards routes where the id variable is the id of an application.
+func (guard integrationGuard) application(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !accessOf(r).permitsApplications(guard.applications, mux.Vars(r)["id"]) {
+			notPermitted(w, mux.Vars(r)["id"])
+			return
+		}
+		next(w, r)
+	}
+}
+
+// orchestration guards routes where the id variable is the id of a stored orchestration, which must only read from
+// and write to permitted applications. Unknown orchestrations are left to next to report.
+func (guard integrationGuard) orchestration(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access := accessOf(r)
+		if access != nil {
+			record, err := guard.orchestrations.FindById(mux.Vars(r)["id"])
+			if err == nil && !access.permitsApplications(guard.applications, append([]string{record.From}, record.To...)...) {
+				notPermitted(w, mux.Vars(r)["id"])
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// job guards routes where the id variable is the id of a job, whose orchestration must only involve permitted
+// applications. Unknown jobs are left to next to report.
+func (guard integrationGuard) job(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access := accessOf(r)
+		if access != nil {
+			record, err := guard.jobs.FindById(mux.Vars(r)["id"])
+			if err == nil && !guard.permitsJob(access, *record) {
+				notPermitted(w, mux.Vars(r)["id"])
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// deadLetter guards routes where the id variable is the id of a dead letter. Unknown dead letters are left to next to
+// report.
+func (guard integrationGuard) deadLetter(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access := accessOf(r)
+		if access != nil {
+			records, err := guard.deadLetters.Find()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, record := range records {
+				if record.ID == mux.Vars(r)["id"] && !guard.permitsDeadLetter(access, record) {
+					notPermitted(w, record.ID)
+					return
+				}
+			}
+		}
+		next(w, r)
+	}
+}
+
+// mapping guards routes where the from and to variables are the ends of an action or subject mapping.
+func (guard integrationGuard) mapping(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if !accessOf(r).permitsMapping(guard.applications, vars["from"], vars["to"]) {
+			notPermitted(w, vars["from"]+"/"+vars["to"])
+			return
+		}
+		next(w, r)
+	}
+}
+
+// permitsJob is whether the applications of the orchestration a job runs are permitted.
+func (guard integrationGuard) permitsJob(access integrationAccess, record dataConfigGateway.JobRecord) bool {
+	if access == nil {
+		return true
+	}
+	var request Orchestration
+	if err := json.Unmarshal(record.Request, &request); err != nil {
+		return false
+	}
+	applications := slices.DeleteFunc(append([]string{request.From, request.To}, request.Targets...), func(id string) bool { return id == "" })
+	return access.permitsApplications(guard.applications, applications...)
+}
+
+// permitsDeadLetter is whether the orchestration or job that failed is permitted. Dead letters of work that no longer
+// exists cannot be attributed to an integration and are not permitted to a restricted token.
+func (guard integrationGuard) permitsDeadLetter(access integrationAccess, record dataConfigGateway.DeadLetterRecord) bool {
+	if access == nil {
+		return true
+	}
+	switch record.Kind {
+	case DeadLetterOrchestration:
+		orchestration, err := guard.orchestrations.FindById(record.TaskId)
+		return err == nil && access.permitsApplications(guard.applications, append([]string{orchestration.From}, orchestration.To...)...)
+	case DeadLetterJob:
+		job, err := guard.jobs.FindById(record.TaskId)
+		return err == nil && guard.permitsJob(access, *job)
+	}
+	return false
+}
+
+// permitsAuditEntry is whether every target of an audit entry, and every application whose policies it changed,
+// that names an integration, an application or a stored orchestration is permitted. Entries none of whose targets
+// can be attributed to an integration, such as those of deleted integrations, are not permitted to a restricted token.
+func (guard integrationGuard) permitsAuditEntry(access integrationAccess, entry auditsupport.Entry) bool {
+	if access == nil {
+		return true
+	}
+	ids := slices.Clone(entry.Targets)
+	for _, change := range entry.Policies {
+		ids = append(ids, change.Application)
+	}
+	attributed := false
+	for _, id := range ids {
+		permitted, known := guard.permitsTarget(access, id)
+		if known && !permitted {
+			return false
+		}
+		attributed = attributed || known
+	}
+	return attributed
+}
+
+// permitsTarget resolves id as an integration, an application or a stored orchestration, reporting whether it is
+// known and, when it is, whether it is permitted.
+func (guard integrationGuard) permitsTarget(access integrationAccess, id string) (permitted bool, known bool) {
+	if _, err := guard.integrations.FindById(id); err == nil {
+		return access[id], true
+	}
+	if application, err := guard.applications.FindById(id); err == nil && application != nil {
+		return access[application.IntegrationId], true
+	}
+	if record, err := guard.orchestrations.FindById(id); err == nil {
+		return access.permitsApplications(guard.applications, append([]string{record.From}, record.To...)...), true
+	}
+	return false, false
+}
+
+func notPermitted(w http.ResponseWriter, id string) {
+	http.Error(w, fmt.Sprintf("%s: %s", ErrIntegrationNotPermitted.Error(), id), http.StatusForbidden)
+}
+
+// resourceAttributes resolves the integration attribute that authorization policies can refer to as
+// resource.integration: the alias of an integration route, the integration of an application route, or the
+// integrations of the applications of a stored orchestration. Routes that carry their applications in the body have
+// no integration attribute.
+func (guard integrationGuard) resourceAttributes(r *http.Request) map[string][]string {
+	template := ""
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ = route.GetPathTemplate()
+	}
+	id := mux.Vars(r)["id"]
+	var applications []string
+	switch {
+	case strings.HasPrefix(template, "/integrations/{id}"):
+		return map[string][]string{"integration": {id}}
+	case strings.HasPrefix(template, "/applications/{id}"):
+		applications = []string{id}
+	case strings.HasPrefix(template, "/orchestrations/{id}"):
+		if record, err := guard.orchestrations.FindById(id); err == nil {
+			applications = append([]string{record.From}, record.To...)
+		}
+	}
+	integrations := make([]string, 0, len(applications))
+	for _, application := range applications {
+		if record, err := guard.applications.FindById(application); err == nil && record != nil && !slices.Contains(integrations, record.IntegrationId) {
+			integrations = append(integrations, record.IntegrationId)
+		}
+	}
+	return map[string][]string{"integration": integrations}
+}
@@ -0,0 +1,191 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/healthsupport"
+	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	"github.com/hexa-org/policy-mapper/pkg/websupport"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/hexaConstants"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIntegrationAccess runs without token validation, so that the test can issue tokens with the integrations claim
+// that the mock authorization server does not support.
+func TestIntegrationAccess(t *testing.T) {
+	t.Setenv(oauth2support.EnvJwtAuth, "false")
+	t.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), ".hexa", "config.json"))
+
+	config, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+	_, _ = config.Create("anAlias", "noop", []byte("aKey"))
+	_, _ = config.Create("anotherAlias", "noop", []byte("aKey"))
+	config.Integrations["anAlias"].Apps["anApp"] = policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "aName"}
+	config.Integrations["anotherAlias"].Apps["anotherApp"] = policyprovider.ApplicationInfo{ObjectID: "anotherObjectId", Name: "anotherName"}
+
+	listener, _ := net.Listen("tcp", "localhost:0")
+	server := websupport.Create(listener.Addr().String(), orchestrator.LoadHandlers(config, nil, nil), websupport.Options{})
+	go websupport.Start(server, listener)
+	healthsupport.WaitForHealthy(server)
+	defer websupport.Stop(server)
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"sub":                           "aSubject",
+		hexaConstants.ClaimIntegrations: []string{"anAlias"},
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	do := func(method string, path string, body any) *http.Response {
+		var reader io.Reader
+		if body != nil {
+			marshal, _ := json.Marshal(body)
+			reader = bytes.NewReader(marshal)
+		}
+		req, _ := http.NewRequest(method, fmt.Sprintf("http://%s%s", server.Addr, path), reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	var integrations orchestrator.Integrations
+	_ = json.NewDecoder(do(http.MethodGet, "/integrations", nil).Body).Decode(&integrations)
+	assert.Len(t, integrations.Integrations, 1)
+	assert.Equal(t, "anAlias", integrations.Integrations[0].ID)
+
+	var applications orchestrator.Applications
+	_ = json.NewDecoder(do(http.MethodGet, "/applications", nil).Body).Decode(&applications)
+	assert.NotEmpty(t, applications.Applications)
+	for _, application := range applications.Applications {
+		assert.Equal(t, "anAlias", application.IntegrationId)
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/applications/anApp", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/applications/anotherApp", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/applications/anotherApp/policies", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/integrations/anotherAlias", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/integrations", orchestrator.Integration{ID: "yetAnotherAlias", Provider: "noop"}).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/orchestration", orchestrator.Orchestration{From: "anApp", To: "anotherApp", DryRun: true}).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/orchestrations", orchestrator.OrchestrationDefinition{Name: "aName", From: "anotherApp", To: []string{"anApp"}}).StatusCode)
+
+	stored, _ := config.GetOrchestrationDataGateway().Create(dataConfigGateway.OrchestrationRecord{Name: "anotherName", From: "anotherApp", To: []string{"anotherApp"}})
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/orchestrations/"+stored+"/run", nil).StatusCode)
+	var definitions orchestrator.OrchestrationDefinitions
+	_ = json.NewDecoder(do(http.MethodGet, "/orchestrations", nil).Body).Decode(&definitions)
+	assert.Empty(t, definitions.Orchestrations)
+
+	assert.Len(t, config.Find(), 2, "the refused requests left the integrations")
+}
+
+// TestIntegrationAccess_operations checks the routes for jobs, dead letters, the audit log and mappings, which name
+// integrations and applications indirectly.
+func TestIntegrationAccess_operations(t *testing.T) {
+	t.Setenv(oauth2support.EnvJwtAuth, "false")
+	t.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(dir, ".hexa", "config.json"))
+
+	config, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+	_, _ = config.Create("anAlias", "noop", []byte("aKey"))
+	_, _ = config.Create("anotherAlias", "noop", []byte("aKey"))
+	config.Integrations["anAlias"].Apps["anApp"] = policyprovider.ApplicationInfo{ObjectID: "anObjectId", Name: "aName"}
+	config.Integrations["anotherAlias"].Apps["anotherApp"] = policyprovider.ApplicationInfo{ObjectID: "anotherObjectId", Name: "anotherName"}
+
+	jobs := config.GetJobDataGateway()
+	permittedJob, _ := jobs.Create(dataConfigGateway.JobRecord{Request: json.RawMessage(`{"from":"anApp","to":"anApp"}`)})
+	otherJob, _ := jobs.Create(dataConfigGateway.JobRecord{Request: json.RawMessage(`{"from":"anApp","to":"anotherApp"}`)})
+	orchestrations := config.GetOrchestrationDataGateway()
+	permittedOrchestration, _ := orchestrations.Create(dataConfigGateway.OrchestrationRecord{Name: "aName", From: "anApp", To: []string{"anApp"}})
+	otherOrchestration, _ := orchestrations.Create(dataConfigGateway.OrchestrationRecord{Name: "anotherName", From: "anotherApp", To: []string{"anotherApp"}})
+	deadLetters := config.GetDeadLetterDataGateway()
+	permittedDeadLetter, _ := deadLetters.Create(dataConfigGateway.DeadLetterRecord{Kind: orchestrator.DeadLetterOrchestration, TaskId: permittedOrchestration})
+	otherDeadLetter, _ := deadLetters.Create(dataConfigGateway.DeadLetterRecord{Kind: orchestrator.DeadLetterOrchestration, TaskId: otherOrchestration})
+	_, _ = deadLetters.Create(dataConfigGateway.DeadLetterRecord{Kind: orchestrator.DeadLetterJob, TaskId: otherJob})
+	_ = config.GetActionMappingDataGateway().Save(dataConfigGateway.ActionMappingRecord{From: "anAlias", To: "anApp", Actions: map[string][]string{"read": {"get"}}})
+	_ = config.GetActionMappingDataGateway().Save(dataConfigGateway.ActionMappingRecord{From: "anAlias", To: "anotherApp", Actions: map[string][]string{"read": {"get"}}})
+	_ = config.GetSubjectMappingDataGateway().Save(dataConfigGateway.SubjectMappingRecord{From: "anotherAlias", To: "anAlias", Subjects: map[string]string{"a": "b"}})
+
+	auditLog, err := auditsupport.Open(filepath.Join(dir, "audit.log"))
+	assert.NoError(t, err)
+	_, _ = auditLog.Append(auditsupport.Entry{Action: orchestrator.AuditPoliciesSet, Targets: []string{"anApp"}})
+	_, _ = auditLog.Append(auditsupport.Entry{Action: orchestrator.AuditPoliciesSet, Targets: []string{"anotherApp"}})
+	_, _ = auditLog.Append(auditsupport.Entry{Action: orchestrator.AuditOrchestration, Targets: []string{"anApp", "anotherApp"}})
+	_, _ = auditLog.Append(auditsupport.Entry{Action: orchestrator.AuditIntegrationDelete, Targets: []string{"aDeletedAlias"}})
+
+	listener, _ := net.Listen("tcp", "localhost:0")
+	server := websupport.Create(listener.Addr().String(), orchestrator.LoadHandlers(config, nil, auditLog), websupport.Options{})
+	go websupport.Start(server, listener)
+	healthsupport.WaitForHealthy(server)
+	defer websupport.Stop(server)
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"sub":                           "aSubject",
+		hexaConstants.ClaimIntegrations: []string{"anAlias"},
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	do := func(method string, path string, body any) *http.Response {
+		var reader io.Reader
+		if body != nil {
+			marshal, _ := json.Marshal(body)
+			reader = bytes.NewReader(marshal)
+		}
+		req, _ := http.NewRequest(method, fmt.Sprintf("http://%s%s", server.Addr, path), reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/jobs/"+permittedJob, nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/jobs/"+otherJob, nil).StatusCode)
+
+	var deadLetterList orchestrator.DeadLetters
+	_ = json.NewDecoder(do(http.MethodGet, "/dead-letters", nil).Body).Decode(&deadLetterList)
+	assert.Len(t, deadLetterList.DeadLetters, 1)
+	assert.Equal(t, permittedDeadLetter, deadLetterList.DeadLetters[0].ID)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/dead-letters/"+otherDeadLetter, nil).StatusCode)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/dead-letters/"+permittedDeadLetter, nil).StatusCode)
+
+	var entries orchestrator.AuditEntries
+	_ = json.NewDecoder(do(http.MethodGet, "/audit", nil).Body).Decode(&entries)
+	for _, entry := range entries.Entries {
+		assert.NotContains(t, entry.Targets, "anotherApp")
+		assert.NotContains(t, entry.Targets, "aDeletedAlias")
+	}
+	assert.Equal(t, []string{"anApp"}, entries.Entries[0].Targets)
+
+	actions := map[string][]string{"read": {"get"}}
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/mappings/actions/anAlias/anApp", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/mappings/actions/anAlias/anotherApp", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/mappings/actions/anAlias/anotherAlias", orchestrator.ActionMapping{Actions: actions}).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/mappings/actions/anAlias/anotherApp", nil).StatusCode)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPut, "/mappings/actions/anApp/anAlias", orchestrator.ActionMapping{Actions: actions}).StatusCode)
+	var actionMappings orchestrator.ActionMappings
+	_ = json.NewDecoder(do(http.MethodGet, "/mappings/actions", nil).Body).Decode(&actionMappings)
+	assert.Len(t, actionMappings.Mappings, 2)
+
+	subjects := map[string]string{"a": "b"}
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/mappings/subjects/anotherAlias/anAlias", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/mappings/subjects/anotherAlias/anAlias", orchestrator.SubjectMappingResource{Subjects: subjects}).StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/mappings/subjects/anotherAlias/anAlias", nil).StatusCode)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPut, "/mappings/subjects/anAlias/anApp", orchestrator.SubjectMappingResource{Subjects: subjects}).StatusCode)
+	var subjectMappings orchestrator.SubjectMappings
+	_ = json.NewDecoder(do(http.MethodGet, "/mappings/subjects", nil).Body).Decode(&subjectMappings)
+	assert.Len(t, subjectMappings.Mappings, 1)
+
+	mapping, err := config.GetSubjectMappingDataGateway().FindByPair("anotherAlias", "anAlias")
+	assert.NoError(t, err, "the refused requests left the mappings")
+	assert.Equal(t, subjects, mapping.Subjects)
+}
@@ -0,0 +1,230 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	"golang.org/x/oauth2"
+)
+
+// IntegrationHealth is whether the provider of an integration could be reached and accepted its credentials.
+type IntegrationHealth struct {
+	Integration      string    `json:"integration"`
+	Provider         string    `json:"provider"`
+	Status           string    `json:"status"` // one of the Health constants
+	Reachable        bool      `json:"reachable"`
+	CredentialsValid bool      `json:"credentials_valid"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Error            string    `json:"error,omitempty"`
+	CheckedAt        time.Time `json:"checked_at"` // zero while the integration is unchecked
+}
+
+const (
+	HealthOk                  = "ok"
+	HealthCredentialsRejected = "credentials_rejected" // the provider was reached and refused the key
+	HealthUnreachable         = "unreachable"          // any other failure, including a key that cannot be used
+	HealthUnchecked           = "unchecked"            // the integration is new or changed, its check is running
+)
+
+const (
+	DefaultHealthTimeout  = 5 * time.Second
+	DefaultHealthCacheFor = time.Minute
+)
+
+// IntegrationHealthChecker discovers the applications of each integration as a lightweight call to its provider.
+// Check only reads the cached results, those older than CacheFor or taken before the integration was updated are
+// checked again in the background, so that the health can be polled freely.
+type IntegrationHealthChecker struct {
+	Integrations    dataConfigGateway.IntegrationsDataGateway
+	ProviderBuilder *ProviderBuilder
+	Timeout         time.Duration // DefaultHealthTimeout when 0
+	CacheFor        time.Duration // DefaultHealthCacheFor when 0
+
+	mu         *sync.Mutex
+	cache      map[string]cachedHealth
+	refreshing *atomic.Bool
+}
+
+type cachedHealth struct {
+	health    IntegrationHealth
+	updatedAt time.Time
+}
+
+func NewIntegrationHealthChecker(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider) IntegrationHealthChecker {
+	pb := NewProviderBuilder()
+	if cacheProviders != nil {
+		pb.AddProviders(cacheProviders)
+	}
+	return IntegrationHealthChecker{
+		Integrations:    configHandler,
+		ProviderBuilder: pb,
+		mu:              &sync.Mutex{},
+		cache:           make(map[string]cachedHealth),
+		refreshing:      &atomic.Bool{},
+	}
+}
+
+// Check returns the cached health of every integration, ordered by integration, without calling providers. Stale
+// results are refreshed in the background unless a refresh is already running.
+func (checker IntegrationHealthChecker) Check() []IntegrationHealth {
+	records := checker.Integrations.Find()
+	health := make([]IntegrationHealth, 0, len(records))
+	stale := false
+	for _, record := range records {
+		found, fresh := checker.cached(record)
+		health = append(health, found)
+		stale = stale || !fresh
+	}
+	if stale && checker.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer checker.refreshing.Store(false)
+			checker.Refresh()
+		}()
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Integration < health[j].Integration
+	})
+	return health
+}
+
+// Refresh checks the integrations whose result is stale and caches the results.
+func (checker IntegrationHealthChecker) Refresh() {
+	stale := make([]dataConfigGateway.IntegrationRecord, 0)
+	for _, record := range checker.Integrations.Find() {
+		if _, fresh := checker.cached(record); !fresh {
+			stale = append(stale, record)
+		}
+	}
+	_, _ = workflowsupport.Process(context.Background(), stale, workflowsupport.Options{Limit: 4}, func(_ context.Context, record dataConfigGateway.IntegrationRecord) (bool, error) {
+		health := checker.check(record)
+		checker.mu.Lock()
+		checker.cache[record.ID] = cachedHealth{health, record.UpdatedAt}
+		checker.mu.Unlock()
+		return true, nil
+	})
+}
+
+// cached returns the result of the last check of the integration, or HealthUnchecked when there is none for its
+// current configuration, and whether it is recent enough.
+func (checker IntegrationHealthChecker) cached(record dataConfigGateway.IntegrationRecord) (IntegrationHealth, bool) {
+	cacheFor := checker.CacheFor
+	if cacheFor == 0 {
+		cacheFor = DefaultHealthCacheFor
+	}
+	checker.mu.Lock()
+	found, exists := checker.cache[record.ID]
+	checker.mu.Unlock()
+	if !exists || !found.updatedAt.Equal(record.UpdatedAt) {
+		return IntegrationHealth{Integration: record.ID, Provider: record.Provider, Status: HealthUnchecked}, false
+	}
+	return found.health, time.Since(found.health.CheckedAt) < cacheFor
+}
+
+func (checker IntegrationHealthChecker) check(record dataConfigGateway.IntegrationRecord) IntegrationHealth {
+	health := IntegrationHealth{
+		Integration: record.ID,
+		Provider:    record.Provider,
+		Status:      HealthUnreachable,
+		CheckedAt:   time.Now().UTC(),
+	}
+	timeout := checker.Timeout
+	if timeout == 0 {
+		timeout = DefaultHealthTimeout
+	}
+
+	provider, err := checker.ProviderBuilder.GetAppsProvider(record.ID, record.Provider, record.Key)
+	if err == nil && provider == nil {
+		err = errors.New("no provider")
+	}
+	if err != nil {
+		// the key could not be used to open the provider, which was not called
+		health.Error = err.Error()
+		return health
+	}
+
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		// providers take no context, a call that times out is left to finish in the background
+		_, err := provider.DiscoverApplications(policyprovider.IntegrationInfo{Name: record.Provider, Key: record.Key})
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		health.LatencyMs = time.Since(started).Milliseconds()
+	case <-time.After(timeout):
+		health.LatencyMs = timeout.Milliseconds()
+		err = fmt.Errorf("no response within %v", timeout)
+	}
+	switch {
+	case err == nil:
+		health.Status = HealthOk
+	case credentialsRejected(err):
+		health.Status = HealthCredentialsRejected
+	}
+	if err != nil {
+		health.Error = err.Error()
+	}
+	health.Reachable = health.Status != HealthUnreachable
+	health.CredentialsValid = health.Status == HealthOk
+	return health
+}
+
+// statusError is implemented by the errors of providers that keep the http status of the response, e.g. those of the
+// AWS SDK.
+type statusError interface {
+	HTTPStatusCode() int
+}
+
+// credentialsRejected tells whether err is a response refusing the credentials. The status of the response is only
+// known when the provider returns a typed error, any other error is taken to mean the provider could not be reached.
+func credentialsRejected(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil {
+		// the token endpoint answers 400 to an unknown or expired grant
+		return refusesCredentials(retrieveErr.Response.StatusCode) || retrieveErr.Response.StatusCode == http.StatusBadRequest
+	}
+	var withStatus statusError
+	if errors.As(err, &withStatus) {
+		return refusesCredentials(withStatus.HTTPStatusCode())
+	}
+	return false
+}
+
+func refusesCredentials(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+type IntegrationsHealth struct {
+	Integrations []IntegrationHealth `json:"integrations"`
+}
+
+// IntegrationHealthHandler lists the health of the integrations the caller may access. /health only reports the
+// checks of the orchestrator itself, it is not authenticated and must stay cheap for liveness probes.
+type IntegrationHealthHandler struct {
+	checker IntegrationHealthChecker
+}
+
+func (handler IntegrationHealthHandler) List(w http.ResponseWriter, r *http.Request) {
+	list := IntegrationsHealth{Integrations: make([]IntegrationHealth, 0)}
+	access := accessOf(r)
+	for _, health := range handler.checker.Check() {
+		if access.permits(health.Integration) {
+			list.Integrations = append(list.Integrations, health)
+		}
+	}
+	data, _ := json.Marshal(list)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
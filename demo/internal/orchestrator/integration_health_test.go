@@ -0,0 +1,153 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	orchestratorNoopProvider "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestIntegrationHealthChecker(t *testing.T) {
+	data, provider := newDriftData(t)
+	checker := orchestrator.NewIntegrationHealthChecker(data, map[string]policyprovider.Provider{"anIntegration": provider})
+
+	checker.Refresh()
+	health := checker.Check()
+	assert.Len(t, health, 1)
+	assert.Equal(t, "anIntegration", health[0].Integration)
+	assert.Equal(t, "noop", health[0].Provider)
+	assert.Equal(t, orchestrator.HealthOk, health[0].Status)
+	assert.True(t, health[0].Reachable)
+	assert.True(t, health[0].CredentialsValid)
+	assert.Empty(t, health[0].Error)
+	assert.Equal(t, 3, provider.Discovered)
+
+	provider.SetTestErr(errors.New("connection refused"))
+	checker.Refresh()
+	assert.Equal(t, orchestrator.HealthOk, checker.Check()[0].Status, "the result is cached")
+	assert.Equal(t, 3, provider.Discovered)
+
+	checker.CacheFor = time.Nanosecond
+	checker.Refresh()
+	checker.CacheFor = time.Minute
+	health = checker.Check()
+	assert.Equal(t, orchestrator.HealthUnreachable, health[0].Status)
+	assert.False(t, health[0].Reachable)
+	assert.False(t, health[0].CredentialsValid)
+	assert.Equal(t, "connection refused", health[0].Error)
+}
+
+type statusErr struct {
+	status int
+}
+
+func (e statusErr) Error() string {
+	return fmt.Sprintf("status %d", e.status)
+}
+
+func (e statusErr) HTTPStatusCode() int {
+	return e.status
+}
+
+func TestIntegrationHealthChecker_credentials(t *testing.T) {
+	data, provider := newDriftData(t)
+	for _, test := range []struct {
+		err    error
+		status string
+	}{
+		{&oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}, ErrorCode: "invalid_grant"}, orchestrator.HealthCredentialsRejected},
+		{fmt.Errorf("discovery failed: %w", statusErr{http.StatusForbidden}), orchestrator.HealthCredentialsRejected},
+		{statusErr{http.StatusServiceUnavailable}, orchestrator.HealthUnreachable},
+		{&oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadGateway}}, orchestrator.HealthUnreachable},
+		{errors.New("oauth2: token expired"), orchestrator.HealthUnreachable},
+	} {
+		provider.SetTestErr(test.err)
+		checker := orchestrator.NewIntegrationHealthChecker(data, map[string]policyprovider.Provider{"anIntegration": provider})
+		checker.Refresh()
+		health := checker.Check()[0]
+		assert.Equal(t, test.status, health.Status, test.err.Error())
+		assert.Equal(t, test.status == orchestrator.HealthCredentialsRejected, health.Reachable, "a provider that refused the credentials was reached")
+		assert.False(t, health.CredentialsValid)
+	}
+}
+
+func TestIntegrationHealthChecker_checksInTheBackground(t *testing.T) {
+	data, provider := newDriftData(t)
+	checker := orchestrator.NewIntegrationHealthChecker(data, map[string]policyprovider.Provider{"anIntegration": provider})
+
+	health := checker.Check()
+	assert.Len(t, health, 1)
+	assert.Equal(t, orchestrator.HealthUnchecked, health[0].Status, "providers are not called while checking")
+	assert.True(t, health[0].CheckedAt.IsZero())
+	assert.Eventually(t, func() bool {
+		return checker.Check()[0].Status == orchestrator.HealthOk
+	}, time.Second, 10*time.Millisecond)
+}
+
+type slowProvider struct {
+	orchestratorNoopProvider.NoopProvider
+	release chan bool
+}
+
+func (s *slowProvider) DiscoverApplications(info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+	<-s.release
+	return s.NoopProvider.DiscoverApplications(info)
+}
+
+func TestIntegrationHealthChecker_timeout(t *testing.T) {
+	data, _ := newDriftData(t)
+	provider := &slowProvider{release: make(chan bool)}
+	defer close(provider.release)
+	checker := orchestrator.NewIntegrationHealthChecker(data, map[string]policyprovider.Provider{"anIntegration": provider})
+	checker.Timeout = 10 * time.Millisecond
+
+	checker.Refresh()
+	health := checker.Check()
+	assert.Equal(t, orchestrator.HealthUnreachable, health[0].Status)
+	assert.False(t, health[0].Reachable)
+	assert.Equal(t, int64(10), health[0].LatencyMs)
+	assert.Equal(t, "no response within 10ms", health[0].Error)
+}
+
+func TestIntegrationHealthHandler(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		healthUrl := fmt.Sprintf("http://%s/health/integrations", data.server.Addr)
+		resp, err := http.Get(healthUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "the health of integrations is not public")
+
+		var list orchestrator.IntegrationsHealth
+		assert.Eventually(t, func() bool {
+			resp, err := data.oauthHttpClient.Get(healthUrl)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+			for _, health := range list.Integrations {
+				if health.Status == orchestrator.HealthUnchecked {
+					return false
+				}
+			}
+			return true
+		}, 5*time.Second, 20*time.Millisecond)
+		assert.NotEmpty(t, list.Integrations)
+		for _, health := range list.Integrations {
+			assert.NotEmpty(t, health.Integration)
+			assert.False(t, health.CheckedAt.IsZero())
+		}
+
+		resp, err = http.Get(fmt.Sprintf("http://%s/health", data.server.Addr))
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.NotContains(t, string(body), "integration", "/health only reports the orchestrator itself")
+	})
+}
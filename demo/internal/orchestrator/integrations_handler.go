@@ -2,32 +2,59 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	log "golang.org/x/exp/slog"
 )
 
+// EnvLegacyIntegrationDelete restores the deprecated behaviour of GET /integrations/{id}, which deleted the integration
+// before DELETE /integrations/{id} was added, for clients that have not moved to DELETE yet. It will be removed in a
+// later release.
+const EnvLegacyIntegrationDelete = "ORCHESTRATOR_LEGACY_INTEGRATION_DELETE"
+
 type Integrations struct {
 	Integrations []Integration `json:"integrations"`
 }
 
+// Integration is both the create request and the response representation of an integration. Key is only returned
+// by the Credentials endpoint, List returns a fingerprint of the key instead.
 type Integration struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Provider string `json:"provider"`
-	Key      []byte `json:"key"`
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Provider       string     `json:"provider"`
+	Key            []byte     `json:"key,omitempty"`
+	KeyFingerprint string     `json:"key_fingerprint,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+	KeyRotatedAt   *time.Time `json:"key_rotated_at,omitempty"`
+	AppCount       int        `json:"app_count"`
+}
+
+// IntegrationDetails is an integration with its applications, returned by Show.
+type IntegrationDetails struct {
+	Integration
+	Applications []Application `json:"applications"`
 }
 
 type IntegrationsHandler struct {
-	configData dataConfigGateway.IntegrationsDataGateway
+	configData   dataConfigGateway.IntegrationsDataGateway
+	applications dataConfigGateway.ApplicationsDataGateway
+	providers    *ProviderBuilder
 }
 
-func (handler IntegrationsHandler) List(w http.ResponseWriter, _ *http.Request) {
+// List returns the integrations the token of the request is permitted to access.
+func (handler IntegrationsHandler) List(w http.ResponseWriter, r *http.Request) {
 	var list Integrations
+	access := accessOf(r)
 	for _, rec := range handler.configData.Find() {
-
-		list.Integrations = append(list.Integrations, Integration{rec.ID, rec.Name, rec.Provider, rec.Key})
+		if access.permits(rec.ID) {
+			list.Integrations = append(list.Integrations, mapIntegration(rec))
+		}
 	}
 	data, _ := json.Marshal(list)
 	w.Header().Set("content-type", "application/json")
@@ -38,19 +65,170 @@ func (handler IntegrationsHandler) List(w http.ResponseWriter, _ *http.Request)
 func (handler IntegrationsHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var jsonRequest Integration
 	_ = json.NewDecoder(r.Body).Decode(&jsonRequest)
-	_, err := handler.configData.Create(jsonRequest.ID, jsonRequest.Provider, jsonRequest.Key)
+	if !accessOf(r).permits(jsonRequest.ID) {
+		notPermitted(w, jsonRequest.ID)
+		return
+	}
+	id, err := handler.configData.Create(jsonRequest.ID, jsonRequest.Provider, jsonRequest.Key)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	auditsupport.AddTargets(r.Context(), id)
 
 	w.WriteHeader(http.StatusCreated)
 }
 
+// Show returns an integration with the applications discovered from it.
+func (handler IntegrationsHandler) Show(w http.ResponseWriter, r *http.Request) {
+	record, err := handler.configData.FindById(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	applications, err := handler.applications.Find(false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	details := IntegrationDetails{Integration: mapIntegration(record), Applications: []Application{}}
+	for _, rec := range applications {
+		if rec.IntegrationId == record.ID {
+			details.Applications = append(details.Applications, Application{ID: rec.ID, IntegrationId: rec.IntegrationId, ObjectId: rec.ObjectId, Name: rec.Name, Description: rec.Description, ProviderName: record.Provider, Service: rec.Service})
+		}
+	}
+	data, _ := json.Marshal(details)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
 func (handler IntegrationsHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	if err := handler.configData.Delete(mux.Vars(r)["id"]); err != nil {
+	id := mux.Vars(r)["id"]
+	if _, err := handler.configData.FindById(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := handler.configData.Delete(id); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	handler.providers.Evict(id)
 	w.WriteHeader(http.StatusOK)
 }
+
+// LegacyDelete deletes an integration in answer to GET /integrations/{id} when EnvLegacyIntegrationDelete is set,
+// marking the response as deprecated in favour of DELETE.
+func (handler IntegrationsHandler) LegacyDelete(w http.ResponseWriter, r *http.Request) {
+	log.Warn("GET /integrations/{id} is deprecated, use DELETE /integrations/{id} to delete an integration", "id", mux.Vars(r)["id"])
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", r.URL.Path))
+	handler.Delete(w, r)
+}
+
+// Update renames an integration or replaces its key, keeping its applications. PUT requires both the id and the key
+// of the integration, PATCH leaves those that are not given unchanged.
+func (handler IntegrationsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := handler.configData.FindById(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var jsonRequest Integration
+	if err := json.NewDecoder(r.Body).Decode(&jsonRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPut && (jsonRequest.ID == "" || len(jsonRequest.Key) == 0) {
+		http.Error(w, "the id and key of the integration are required", http.StatusBadRequest)
+		return
+	}
+	if jsonRequest.ID != "" && jsonRequest.ID != id {
+		if !accessOf(r).permits(jsonRequest.ID) {
+			notPermitted(w, jsonRequest.ID)
+			return
+		}
+		if _, err := handler.configData.FindById(jsonRequest.ID); err == nil {
+			http.Error(w, fmt.Sprintf("integration %s already exists", jsonRequest.ID), http.StatusConflict)
+			return
+		}
+	}
+	alias, err := handler.configData.Update(id, jsonRequest.ID, jsonRequest.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	handler.providers.Evict(id)
+	auditsupport.AddTargets(r.Context(), alias)
+
+	record, _ := handler.configData.FindById(alias)
+	data, _ := json.Marshal(mapIntegration(record))
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// RotateCredentials replaces the key of an integration without changing its alias or the aliases of its
+// applications. The key is only stored once the applications of the integration have been discovered with it.
+func (handler IntegrationsHandler) RotateCredentials(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := handler.configData.FindById(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var jsonRequest Integration
+	if err := json.NewDecoder(r.Body).Decode(&jsonRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(jsonRequest.Key) == 0 {
+		http.Error(w, "the key of the integration is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := handler.configData.Update(id, "", jsonRequest.Key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	handler.providers.Evict(id)
+
+	record, _ := handler.configData.FindById(id)
+	data, _ := json.Marshal(mapIntegration(record))
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// Credentials returns the key material of an integration. The route requires its own scope, see LoadHandlers.
+func (handler IntegrationsHandler) Credentials(w http.ResponseWriter, r *http.Request) {
+	record, err := handler.configData.FindById(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	integration := mapIntegration(record)
+	integration.Key = record.Key
+	data, _ := json.Marshal(integration)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func mapIntegration(rec dataConfigGateway.IntegrationRecord) Integration {
+	integration := Integration{
+		ID:             rec.ID,
+		Name:           rec.Name,
+		Provider:       rec.Provider,
+		KeyFingerprint: rec.KeyFingerprint,
+		AppCount:       rec.AppCount,
+	}
+	if !rec.CreatedAt.IsZero() {
+		integration.CreatedAt = &rec.CreatedAt
+	}
+	if !rec.UpdatedAt.IsZero() {
+		integration.UpdatedAt = &rec.UpdatedAt
+	}
+	if !rec.KeyRotatedAt.IsZero() {
+		integration.KeyRotatedAt = &rec.KeyRotatedAt
+	}
+	return integration
+}
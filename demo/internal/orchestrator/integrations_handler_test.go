@@ -20,6 +20,7 @@ import (
 	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
 	orchestratortest "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/hexaConstants"
 
 	"github.com/hexa-org/policy-mapper/pkg/healthsupport"
 	"github.com/hexa-org/policy-mapper/pkg/websupport"
@@ -79,7 +80,7 @@ func TestIntegrationsHandler(t *testing.T) {
 	hash := sha256.Sum256([]byte("aKey"))
 	s.key = hex.EncodeToString(hash[:])
 
-	handlers := orchestrator.LoadHandlers(s.Data, cache)
+	handlers := orchestrator.LoadHandlers(s.Data, cache, nil)
 	s.server = websupport.Create(addr, handlers, websupport.Options{})
 
 	go websupport.Start(s.server, listener)
@@ -112,7 +113,60 @@ func (s *HandlerSuite) TestList() {
 	integration := jsonResponse.Integrations[0]
 	// assert.Equal(s.T(), "aName", integration.Name)
 	assert.Equal(s.T(), "noop", integration.Provider)
+	assert.Nil(s.T(), integration.Key, "keys are redacted")
+	assert.Equal(s.T(), s.Data.MasterKey().Fingerprint([]byte("aKey")), integration.KeyFingerprint)
+	assert.Equal(s.T(), 1, integration.AppCount)
+	assert.NotNil(s.T(), integration.CreatedAt)
+	assert.NotNil(s.T(), integration.UpdatedAt)
+}
+
+func (s *HandlerSuite) TestCredentials() {
+	id, _ := s.gateway.Create("anId", "noop", []byte("aKey"))
+
+	credentialsUrl := fmt.Sprintf("http://%s/integrations/%s/credentials", s.server.Addr, id)
+	resp, _ := s.oauthHttpClient.Get(credentialsUrl)
+	assert.Equal(s.T(), http.StatusForbidden, resp.StatusCode, "orchestrator scope is not sufficient")
+
+	token, _ := s.MockOauth.BuildJWT(60, []string{orchestrator.ScopeIntegrationCredentials}, []string{"orchestrator"}, "", false)
+	req, _ := http.NewRequest(http.MethodGet, credentialsUrl, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	var integration orchestrator.Integration
+	_ = json.NewDecoder(resp.Body).Decode(&integration)
+	assert.Equal(s.T(), "anId", integration.ID)
 	assert.Equal(s.T(), []byte("aKey"), integration.Key)
+	assert.Equal(s.T(), s.Data.MasterKey().Fingerprint([]byte("aKey")), integration.KeyFingerprint)
+
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/integrations/%s/credentials", s.server.Addr, "0000"), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(s.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (s *HandlerSuite) TestScopes() {
+	id, _ := s.gateway.Create("anId", "noop", []byte("aKey"))
+	do := func(scope string, method string, path string) int {
+		token, _ := s.MockOauth.BuildJWT(60, []string{scope}, []string{"orchestrator"}, "", false)
+		req, _ := http.NewRequest(method, fmt.Sprintf("http://%s%s", s.server.Addr, path), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(s.T(), err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(s.T(), http.StatusOK, do(hexaConstants.ScopeIntegrationsRead, http.MethodGet, "/integrations"))
+	assert.Equal(s.T(), http.StatusOK, do(hexaConstants.ScopeIntegrationsRead, http.MethodGet, "/integrations/"+id))
+	assert.Equal(s.T(), http.StatusForbidden, do(hexaConstants.ScopeIntegrationsRead, http.MethodDelete, "/integrations/"+id), "reading does not permit deleting")
+	assert.Equal(s.T(), http.StatusForbidden, do(hexaConstants.ScopeIntegrationsRead, http.MethodPatch, "/integrations/"+id))
+	assert.Equal(s.T(), http.StatusForbidden, do(hexaConstants.ScopePoliciesWrite, http.MethodGet, "/integrations"))
+	assert.Equal(s.T(), http.StatusForbidden, do(hexaConstants.ScopeIntegrationsWrite, http.MethodGet, "/integrations/"+id+"/credentials"))
+	assert.Equal(s.T(), http.StatusForbidden, do(hexaConstants.ScopeIntegrationsRead, http.MethodPut, "/integrations/"+id+"/credentials"))
+	assert.Equal(s.T(), http.StatusForbidden, do(hexaConstants.ScopeIntegrationsRead, http.MethodGet, "/audit"))
+	assert.Equal(s.T(), http.StatusOK, do(hexaConstants.ScopeAuditRead, http.MethodGet, "/audit"))
+	assert.Equal(s.T(), http.StatusOK, do(hexaConstants.ScopeIntegrationsWrite, http.MethodGet, "/integrations"), "writing permits reading")
+	assert.Equal(s.T(), http.StatusOK, do(hexaConstants.ScopeIntegrationsWrite, http.MethodDelete, "/integrations/"+id))
 }
 
 func (s *HandlerSuite) TestCreate() {
@@ -130,11 +184,84 @@ func (s *HandlerSuite) TestCreate() {
 	assert.Equal(s.T(), []byte("aKey"), record.Key)
 }
 
+func (s *HandlerSuite) TestShow() {
+	id, _ := s.gateway.Create("anId", "noop", []byte("aKey"))
+
+	resp, _ := s.oauthHttpClient.Get(fmt.Sprintf("http://%s/integrations/%s", s.server.Addr, id))
+	assert.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	var details orchestrator.IntegrationDetails
+	_ = json.NewDecoder(resp.Body).Decode(&details)
+	assert.Equal(s.T(), "anId", details.ID)
+	assert.Nil(s.T(), details.Key, "keys are redacted")
+	assert.Equal(s.T(), s.Data.MasterKey().Fingerprint([]byte("aKey")), details.KeyFingerprint)
+	assert.Len(s.T(), details.Applications, 1)
+	assert.Equal(s.T(), "anId", details.Applications[0].IntegrationId)
+	assert.Len(s.T(), s.gateway.Find(), 1, "reading does not delete")
+
+	resp, _ = s.oauthHttpClient.Get(fmt.Sprintf("http://%s/integrations/%s", s.server.Addr, "0000"))
+	assert.Equal(s.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (s *HandlerSuite) TestUpdate() {
+	id, _ := s.gateway.Create("anId", "noop", []byte("aKey"))
+	apps := s.Data.Integrations[id].Apps
+	update := func(method string, id string, body string) *http.Response {
+		req, _ := http.NewRequest(method, fmt.Sprintf("http://%s/integrations/%s", s.server.Addr, id), bytes.NewReader([]byte(body)))
+		resp, err := s.oauthHttpClient.Do(req)
+		assert.NoError(s.T(), err)
+		return resp
+	}
+
+	resp := update(http.MethodPatch, id, `{"id":"aNewId"}`)
+	assert.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	var integration orchestrator.Integration
+	_ = json.NewDecoder(resp.Body).Decode(&integration)
+	assert.Equal(s.T(), "aNewId", integration.ID)
+	assert.Equal(s.T(), s.Data.MasterKey().Fingerprint([]byte("aKey")), integration.KeyFingerprint)
+	assert.Equal(s.T(), apps, s.Data.Integrations["aNewId"].Apps, "applications keep their aliases")
+
+	assert.Equal(s.T(), http.StatusOK, update(http.MethodPut, "aNewId", `{"id":"aNewId","key":"YW5vdGhlcktleQ=="}`).StatusCode)
+	record, _ := s.gateway.FindById("aNewId")
+	assert.Equal(s.T(), []byte("anotherKey"), record.Key)
+
+	assert.Equal(s.T(), http.StatusBadRequest, update(http.MethodPut, "aNewId", `{"id":"aNewId"}`).StatusCode, "PUT replaces the key")
+	assert.Equal(s.T(), http.StatusBadRequest, update(http.MethodPatch, "aNewId", `not json`).StatusCode)
+	assert.Equal(s.T(), http.StatusNotFound, update(http.MethodPatch, "0000", `{"id":"aNewId"}`).StatusCode)
+	_, _ = s.gateway.Create("anotherId", "noop", []byte("aKey"))
+	assert.Equal(s.T(), http.StatusConflict, update(http.MethodPatch, "aNewId", `{"id":"anotherId"}`).StatusCode)
+}
+
+func (s *HandlerSuite) TestRotateCredentials() {
+	id, _ := s.gateway.Create("anId", "noop", []byte("aKey"))
+	apps := s.Data.Integrations[id].Apps
+	rotate := func(id string, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/integrations/%s/credentials", s.server.Addr, id), bytes.NewReader([]byte(body)))
+		resp, err := s.oauthHttpClient.Do(req)
+		assert.NoError(s.T(), err)
+		return resp
+	}
+
+	resp := rotate(id, `{"key":"YW5vdGhlcktleQ=="}`)
+	assert.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	var integration orchestrator.Integration
+	_ = json.NewDecoder(resp.Body).Decode(&integration)
+	assert.Equal(s.T(), "anId", integration.ID)
+	assert.Nil(s.T(), integration.Key, "keys are redacted")
+	assert.Equal(s.T(), s.Data.MasterKey().Fingerprint([]byte("anotherKey")), integration.KeyFingerprint)
+	assert.NotNil(s.T(), integration.KeyRotatedAt)
+	assert.Equal(s.T(), apps, s.Data.Integrations[id].Apps, "applications keep their aliases")
+
+	assert.Equal(s.T(), http.StatusBadRequest, rotate(id, `{}`).StatusCode)
+	assert.Equal(s.T(), http.StatusNotFound, rotate("0000", `{"key":"YW5vdGhlcktleQ=="}`).StatusCode)
+}
+
 func (s *HandlerSuite) TestDelete() {
 	id, _ := s.gateway.Create("anId", "noop", []byte("aKey"))
 	assert.Equal(s.T(), "anId", id)
 
-	resp, _ := s.oauthHttpClient.Get(fmt.Sprintf("http://%s/integrations/%s", s.server.Addr, id))
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/integrations/%s", s.server.Addr, id), nil)
+	resp, _ := s.oauthHttpClient.Do(req)
 	assert.Equal(s.T(), resp.StatusCode, http.StatusOK)
 
 	records := s.gateway.Find()
@@ -144,6 +271,31 @@ func (s *HandlerSuite) TestDelete() {
 func (s *HandlerSuite) TestDelete_withUnknownID() {
 	_, _ = s.gateway.Create("aName", "noop", []byte("aKey"))
 
-	resp, _ := s.oauthHttpClient.Get(fmt.Sprintf("http://%s/integrations/%s", s.server.Addr, "0000"))
-	assert.Equal(s.T(), resp.StatusCode, http.StatusInternalServerError)
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/integrations/%s", s.server.Addr, "0000"), nil)
+	resp, _ := s.oauthHttpClient.Do(req)
+	assert.Equal(s.T(), resp.StatusCode, http.StatusNotFound)
+}
+
+func TestIntegrationsHandler_legacyDelete(t *testing.T) {
+	t.Setenv(orchestrator.EnvLegacyIntegrationDelete, "true")
+	t.Setenv(oauth2support.EnvJwtAuth, "false")
+	t.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), ".hexa", "config.json"))
+
+	config, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+	_, _ = config.Create("anId", "noop", []byte("aKey"))
+
+	listener, _ := net.Listen("tcp", "localhost:0")
+	server := websupport.Create(listener.Addr().String(), orchestrator.LoadHandlers(config, nil, nil), websupport.Options{})
+	go websupport.Start(server, listener)
+	healthsupport.WaitForHealthy(server)
+	defer websupport.Stop(server)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/integrations/%s", server.Addr, "anId"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Deprecation"))
+	assert.Equal(t, `</integrations/anId>; rel="successor-version"`, resp.Header.Get("Link"))
+	assert.Empty(t, config.Find())
 }
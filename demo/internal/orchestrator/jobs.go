@@ -0,0 +1,187 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	logger "golang.org/x/exp/slog"
+)
+
+// JobRunner runs orchestrations in the background, keeping the progress of each in the jobs store so that it can be
+// polled and survives a restart.
+type JobRunner struct {
+	Jobs                dataConfigGateway.JobsDataGateway
+	ApplicationsService ApplicationsService
+}
+
+func NewJobRunner(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider) JobRunner {
+	return JobRunner{
+		Jobs:                configHandler.GetJobDataGateway(),
+		ApplicationsService: newApplicationsService(configHandler, cacheProviders),
+	}
+}
+
+// Submit stores an orchestration to be run by the job scheduler and returns the id of its job.
+func (runner JobRunner) Submit(request Orchestration) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	return runner.Jobs.Create(dataConfigGateway.JobRecord{Author: request.Author, Request: data})
+}
+
+// Run orchestrates a job, saving it as each step starts and once it has finished. The returned error is that of the
+// orchestration, failures to save progress are logged.
+func (runner JobRunner) Run(record dataConfigGateway.JobRecord) error {
+	record.State = dataConfigGateway.JobRunning
+	record.Steps = nil
+	record.Result = nil
+	record.Error = ""
+
+	var request Orchestration
+	err := json.Unmarshal(record.Request, &request)
+	if err == nil {
+		request.Author = record.Author
+		var result OrchestrationResult
+		result, err = runner.ApplicationsService.OrchestrateSteps(request, func(name string) {
+			finishStep(&record, nil)
+			record.Steps = append(record.Steps, dataConfigGateway.JobStepRecord{Name: name, State: dataConfigGateway.JobRunning, StartedAt: time.Now().UTC()})
+			runner.save(record)
+		})
+		if err == nil {
+			record.Result, err = json.Marshal(result)
+		}
+	}
+
+	finishStep(&record, err)
+	record.State = dataConfigGateway.JobSucceeded
+	if err != nil {
+		logger.Error("Run", "job", record.ID, "error", err)
+		record.State = dataConfigGateway.JobFailed
+		record.Error = err.Error()
+	}
+	runner.save(record)
+	return err
+}
+
+func (runner JobRunner) save(record dataConfigGateway.JobRecord) {
+	if err := runner.Jobs.Update(record); err != nil {
+		logger.Error("Run", "job", record.ID, "msg", "unable to save progress", "error", err)
+	}
+}
+
+// finishStep ends the step that is running, if any, as failed when err is set.
+func finishStep(record *dataConfigGateway.JobRecord, err error) {
+	if len(record.Steps) == 0 {
+		return
+	}
+	last := &record.Steps[len(record.Steps)-1]
+	if last.State != dataConfigGateway.JobRunning {
+		return
+	}
+	last.FinishedAt = time.Now().UTC()
+	last.State = dataConfigGateway.JobSucceeded
+	if err != nil {
+		last.State = dataConfigGateway.JobFailed
+		last.Error = err.Error()
+	}
+}
+
+// jobLease is how long a running job is left to its scheduler without a heartbeat before another scheduler, in this
+// process or another sharing the store, takes it over. Heartbeats are sent every jobHeartbeat while a job runs.
+var (
+	jobLease     = 5 * time.Minute
+	jobHeartbeat = time.Minute
+)
+
+// NewJobScheduler returns a scheduler that checks on the given schedule for submitted jobs and runs them. Each job
+// is claimed in the store before it runs, so that schedulers sharing a store run it once. Jobs whose scheduler
+// stopped sending heartbeats, e.g. because the orchestrator stopped, are run again from the start, an orchestration
+// replaces the policies of its target so running it twice is harmless. For the same reason failed jobs are retried
+// with the default retry policy, and then left as dead letters. Checks overlap so that a job being retried does not
+// hold up those submitted after it.
+func NewJobScheduler(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider, schedule workflowsupport.Schedule) workflowsupport.WorkScheduler {
+	runner := NewJobRunner(configHandler, cacheProviders)
+	finder := &jobFinder{jobs: runner.Jobs, deadLetters: configHandler.GetDeadLetterDataGateway(), owner: uuid.NewString()}
+	scheduler := workflowsupport.NewJobScheduler(finder, []workflowsupport.Job{{Name: "jobs", Schedule: schedule, Worker: jobWorker{runner}, Overlap: true}})
+	scheduler.Retry = workflowsupport.DefaultRetryPolicy
+	return scheduler
+}
+
+type jobFinder struct {
+	jobs        dataConfigGateway.JobsDataGateway
+	deadLetters dataConfigGateway.DeadLettersDataGateway
+	owner       string
+}
+
+// FindRequested claims and returns the jobs whose lease has expired, then the pending jobs. Jobs claimed by another
+// scheduler in the meantime are left to it.
+func (finder *jobFinder) FindRequested() []interface{} {
+	expired := time.Now().UTC().Add(-jobLease)
+	requested := make([]interface{}, 0)
+	for _, state := range []string{dataConfigGateway.JobRunning, dataConfigGateway.JobPending} {
+		records, err := finder.jobs.FindByState(state)
+		if err != nil {
+			logger.Error("FindRequested", "msg", "unable to find jobs", "state", state, "error", err)
+			return nil
+		}
+		for _, record := range records {
+			if state == dataConfigGateway.JobRunning && !record.HeartbeatAt.Before(expired) {
+				continue
+			}
+			err = finder.jobs.Claim(record.ID, finder.owner, expired)
+			if errors.Is(err, dataConfigGateway.ErrJobClaimed) {
+				continue
+			}
+			if err != nil {
+				logger.Error("FindRequested", "job", record.ID, "error", err)
+				continue
+			}
+			record.State = dataConfigGateway.JobRunning
+			record.Owner = finder.owner
+			requested = append(requested, record)
+		}
+	}
+	return requested
+}
+
+func (finder *jobFinder) MarkCompleted() {}
+
+func (finder *jobFinder) MarkErroneous() {}
+
+func (finder *jobFinder) ReportFailure(failure workflowsupport.Failure) {
+	saveDeadLetter(finder.deadLetters, DeadLetterJob, failure.Task.(dataConfigGateway.JobRecord).ID, failure)
+}
+
+func (finder *jobFinder) Stop() {}
+
+type jobWorker struct {
+	runner JobRunner
+}
+
+// Run runs the job while sending heartbeats, so that its lease does not expire while it is running.
+func (worker jobWorker) Run(task interface{}) error {
+	record := task.(dataConfigGateway.JobRecord)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := worker.runner.Jobs.Heartbeat(record.ID, record.Owner); err != nil {
+					logger.Error("Run", "job", record.ID, "msg", "unable to send heartbeat", "error", err)
+				}
+			}
+		}
+	}()
+	return worker.runner.Run(record)
+}
@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+// Job is an orchestration run in the background, submitted with POST /orchestration?async=true. Result is set once
+// the job has succeeded.
+type Job struct {
+	ID            string               `json:"id"`
+	State         string               `json:"state"` // pending, running, succeeded or failed
+	Orchestration Orchestration        `json:"orchestration"`
+	Steps         []JobStep            `json:"steps"`
+	Result        *OrchestrationResult `json:"result,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+}
+
+// JobStep is the progress of one of the Step constants.
+type JobStep struct {
+	Name       string     `json:"name"`
+	State      string     `json:"state"` // running, succeeded or failed
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type JobsHandler struct {
+	jobs dataConfigGateway.JobsDataGateway
+}
+
+func (handler JobsHandler) Show(w http.ResponseWriter, r *http.Request) {
+	record, err := handler.jobs.FindById(mux.Vars(r)["id"])
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJob(w, http.StatusOK, *record)
+}
+
+func toJob(record dataConfigGateway.JobRecord) Job {
+	job := Job{
+		ID:        record.ID,
+		State:     record.State,
+		Steps:     make([]JobStep, 0, len(record.Steps)),
+		Error:     record.Error,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+	_ = json.Unmarshal(record.Request, &job.Orchestration)
+	for _, step := range record.Steps {
+		jobStep := JobStep{Name: step.Name, State: step.State, StartedAt: step.StartedAt, Error: step.Error}
+		if !step.FinishedAt.IsZero() {
+			finishedAt := step.FinishedAt
+			jobStep.FinishedAt = &finishedAt
+		}
+		job.Steps = append(job.Steps, jobStep)
+	}
+	if len(record.Result) > 0 {
+		var result OrchestrationResult
+		if json.Unmarshal(record.Result, &result) == nil {
+			job.Result = &result
+		}
+	}
+	return job
+}
+
+func writeJob(w http.ResponseWriter, status int, record dataConfigGateway.JobRecord) {
+	data, _ := json.Marshal(toJob(record))
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dataConfigGateway.ErrJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,74 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobs(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err := data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration?async=true", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		var submitted orchestrator.Job
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&submitted))
+		assert.Equal(t, dataConfigGateway.JobPending, submitted.State)
+		assert.Equal(t, data.toApp, submitted.Orchestration.To)
+		assert.Empty(t, submitted.Steps)
+		assert.Equal(t, "/jobs/"+submitted.ID, resp.Header.Get("Location"))
+
+		showJob := func() orchestrator.Job {
+			resp, err := data.oauthHttpClient.Get(fmt.Sprintf("http://%s/jobs/%s", data.server.Addr, submitted.ID))
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var job orchestrator.Job
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+			return job
+		}
+		assert.Equal(t, dataConfigGateway.JobPending, showJob().State)
+
+		runner := orchestrator.NewJobRunner(data.Data, data.providers)
+		record, _ := runner.Jobs.FindById(submitted.ID)
+		assert.NoError(t, runner.Run(*record))
+
+		job := showJob()
+		assert.Equal(t, dataConfigGateway.JobSucceeded, job.State)
+		assert.Len(t, job.Steps, 4)
+		assert.NotNil(t, job.Steps[3].FinishedAt)
+		assert.NotNil(t, job.Result)
+		assert.Len(t, job.Result.Policies, 2)
+
+		resp, err = data.oauthHttpClient.Get(fmt.Sprintf("http://%s/jobs/anId", data.server.Addr))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestJobs_asyncInBody(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toAppDifferent, Async: true})
+		resp, err := data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, "the orchestration fails once it is run")
+
+		var submitted orchestrator.Job
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&submitted))
+		runner := orchestrator.NewJobRunner(data.Data, data.providers)
+		record, _ := runner.Jobs.FindById(submitted.ID)
+		assert.Error(t, runner.Run(*record))
+
+		record, _ = runner.Jobs.FindById(submitted.ID)
+		assert.Equal(t, dataConfigGateway.JobFailed, record.State)
+		assert.NotEmpty(t, record.Error)
+	})
+}
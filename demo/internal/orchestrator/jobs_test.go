@@ -0,0 +1,122 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobRunner_Run(t *testing.T) {
+	data, provider := newDriftData(t)
+	runner := orchestrator.NewJobRunner(data, map[string]policyprovider.Provider{"anIntegration": provider})
+
+	id, err := runner.Submit(orchestrator.Orchestration{From: "anApp", To: "anotherApp", Author: "anAuthor"})
+	assert.NoError(t, err)
+	record, err := runner.Jobs.FindById(id)
+	assert.NoError(t, err)
+	assert.Equal(t, dataConfigGateway.JobPending, record.State)
+
+	assert.NoError(t, runner.Run(*record))
+	record, err = runner.Jobs.FindById(id)
+	assert.NoError(t, err)
+	assert.Equal(t, dataConfigGateway.JobSucceeded, record.State)
+	assert.Empty(t, record.Error)
+
+	var steps []string
+	for _, step := range record.Steps {
+		steps = append(steps, step.Name)
+		assert.Equal(t, dataConfigGateway.JobSucceeded, step.State)
+		assert.False(t, step.FinishedAt.Before(step.StartedAt))
+	}
+	assert.Equal(t, []string{orchestrator.StepFetchSource, orchestrator.StepTransform, orchestrator.StepFetchTarget, orchestrator.StepWrite}, steps)
+
+	var result orchestrator.OrchestrationResult
+	assert.NoError(t, json.Unmarshal(record.Result, &result))
+	assert.Len(t, result.Policies, 2)
+	assert.True(t, result.Diff.IsEmpty(), "the noop provider already has the policies")
+
+	versions, _ := data.GetPolicyVersionDataGateway().Find("anotherApp")
+	assert.Equal(t, "anAuthor", versions[0].Author, "the author is kept with the job")
+}
+
+func TestJobRunner_Run_withError(t *testing.T) {
+	data, provider := newDriftData(t)
+	runner := orchestrator.NewJobRunner(data, map[string]policyprovider.Provider{"anIntegration": provider})
+	provider.SetTestErr(errors.New("oops"))
+
+	id, _ := runner.Submit(orchestrator.Orchestration{From: "anApp", To: "anotherApp"})
+	record, _ := runner.Jobs.FindById(id)
+	assert.EqualError(t, runner.Run(*record), "oops")
+
+	record, _ = runner.Jobs.FindById(id)
+	assert.Equal(t, dataConfigGateway.JobFailed, record.State)
+	assert.Equal(t, "oops", record.Error)
+	assert.Len(t, record.Steps, 1)
+	assert.Equal(t, orchestrator.StepFetchSource, record.Steps[0].Name)
+	assert.Equal(t, dataConfigGateway.JobFailed, record.Steps[0].State)
+	assert.Empty(t, record.Result)
+}
+
+func TestJobScheduler(t *testing.T) {
+	data, provider := newDriftData(t)
+	jobs := data.GetJobDataGateway()
+	runner := orchestrator.NewJobRunner(data, map[string]policyprovider.Provider{"anIntegration": provider})
+	pending, _ := runner.Submit(orchestrator.Orchestration{From: "anApp", To: "anotherApp"})
+	interrupted, _ := runner.Submit(orchestrator.Orchestration{From: "anApp", To: "anotherApp"})
+	record, _ := jobs.FindById(interrupted)
+	record.State = dataConfigGateway.JobRunning
+	assert.NoError(t, jobs.Update(*record))
+	claimed, _ := runner.Submit(orchestrator.Orchestration{From: "anApp", To: "anotherApp"})
+	assert.NoError(t, jobs.Claim(claimed, "anotherScheduler", time.Now()))
+
+	scheduler := orchestrator.NewJobScheduler(data, map[string]policyprovider.Provider{"anIntegration": provider}, workflowsupport.Every(200*time.Millisecond))
+	scheduler.Start()
+	assert.Eventually(t, func() bool {
+		for _, id := range []string{pending, interrupted} {
+			if record, _ := jobs.FindById(id); record.State != dataConfigGateway.JobSucceeded {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 20*time.Millisecond, "jobs left running by a previous process are resumed")
+	scheduler.Stop()
+
+	record, _ = jobs.FindById(claimed)
+	assert.Equal(t, dataConfigGateway.JobRunning, record.State, "jobs running elsewhere are left to their scheduler")
+	assert.Equal(t, "anotherScheduler", record.Owner)
+}
+
+func TestJobScheduler_deadLetter(t *testing.T) {
+	data, provider := newDriftData(t)
+	provider.SetTestErr(errors.New("oops"))
+	runner := orchestrator.NewJobRunner(data, map[string]policyprovider.Provider{"anIntegration": provider})
+	id, _ := runner.Submit(orchestrator.Orchestration{From: "anApp", To: "anotherApp"})
+
+	scheduler := orchestrator.NewJobScheduler(data, map[string]policyprovider.Provider{"anIntegration": provider}, workflowsupport.Every(200*time.Millisecond))
+	scheduler.Retry = workflowsupport.RetryPolicy{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond}
+	scheduler.Start()
+	deadLetters := data.GetDeadLetterDataGateway()
+	assert.Eventually(t, func() bool {
+		found, _ := deadLetters.Find()
+		return len(found) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	scheduler.Stop()
+
+	found, err := deadLetters.Find()
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, orchestrator.DeadLetterJob, found[0].Kind)
+	assert.Equal(t, id, found[0].TaskId)
+	assert.Equal(t, 2, found[0].Attempts)
+	assert.Equal(t, "oops", found[0].Error)
+
+	record, _ := runner.Jobs.FindById(id)
+	assert.Equal(t, dataConfigGateway.JobFailed, record.State)
+}
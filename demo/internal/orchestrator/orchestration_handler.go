@@ -2,25 +2,143 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
 )
 
 type OrchestrationHandler struct {
 	applicationsService ApplicationsService
+	jobs                JobRunner
 }
 
 type Orchestration struct {
-	From string `json:"from"`
-	To   string `json:"to"`
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Targets   []string       `json:"targets,omitempty"` // orchestrated concurrently along with To, see OrchestrateTargets
+	DryRun    bool           `json:"dry_run,omitempty"`
+	Async     bool           `json:"async,omitempty"`     // run as a job, dry runs are always synchronous
+	Resources []ResourceRule `json:"resources,omitempty"` // maps source object ids to target object ids
+	Reason    string         `json:"reason,omitempty"`    // kept with the version of the target policies
+	Author    string         `json:"-"`
+}
+
+// OrchestrationTargets is returned when an orchestration has several targets.
+type OrchestrationTargets struct {
+	Targets []OrchestrationTargetResult `json:"targets"`
+}
+
+// OrchestrationResult is returned by both dry runs and applied orchestrations. Diff is against the policies the target
+// had before the orchestration.
+type OrchestrationResult struct {
+	Policies         []hexapolicy.PolicyInfo `json:"policies"`
+	Diff             PolicyDiff              `json:"diff"`
+	UnmappedActions  []UnmappedAction        `json:"unmapped_actions,omitempty"`
+	UnmappedSubjects []UnmappedSubject       `json:"unmapped_subjects,omitempty"`
 }
 
 func (o OrchestrationHandler) Update(writer http.ResponseWriter, request *http.Request) {
+	o.applicationsService = o.applicationsService.WithContext(request.Context())
 	var jsonRequest Orchestration
-	_ = json.NewDecoder(request.Body).Decode(&jsonRequest)
-	err := o.applicationsService.Apply(jsonRequest)
+	if err := json.NewDecoder(request.Body).Decode(&jsonRequest); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.URL.Query().Get("dryRun") == "true" {
+		jsonRequest.DryRun = true
+	}
+	if request.URL.Query().Get("async") == "true" {
+		jsonRequest.Async = true
+	}
+	jsonRequest.Author = author(request)
+	applications := slices.DeleteFunc(append([]string{jsonRequest.From, jsonRequest.To}, jsonRequest.Targets...), func(id string) bool { return id == "" })
+	auditsupport.AddTargets(request.Context(), applications...)
+	if !accessOf(request).permitsApplications(o.applicationsService.ApplicationsGateway, applications...) {
+		notPermitted(writer, strings.Join(applications, ", "))
+		return
+	}
+
+	if len(jsonRequest.Targets) > 0 {
+		o.fanOut(writer, jsonRequest)
+		return
+	}
+
+	if jsonRequest.DryRun {
+		result, err := o.applicationsService.Preview(jsonRequest)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, _ := json.Marshal(result)
+		writer.Header().Set("content-type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write(data)
+		return
+	}
+
+	if jsonRequest.Async {
+		o.submit(writer, jsonRequest)
+		return
+	}
+
+	result, err := o.applicationsService.Orchestrate(jsonRequest)
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	data, _ := json.Marshal(result)
+	writer.Header().Set("content-type", "application/json")
 	writer.WriteHeader(http.StatusCreated)
+	_, _ = writer.Write(data)
+}
+
+// fanOut orchestrates to To and each of the Targets. It returns 201, or 200 for a dry run, when every target
+// succeeded and 207 with the error of each failed target otherwise.
+func (o OrchestrationHandler) fanOut(writer http.ResponseWriter, jsonRequest Orchestration) {
+	if jsonRequest.Async && !jsonRequest.DryRun {
+		http.Error(writer, "an orchestration with several targets cannot be run as a job", http.StatusBadRequest)
+		return
+	}
+	targets := make([]string, 0, len(jsonRequest.Targets)+1)
+	for _, to := range append([]string{jsonRequest.To}, jsonRequest.Targets...) {
+		if to != "" && !slices.Contains(targets, to) {
+			targets = append(targets, to)
+		}
+	}
+
+	results := OrchestrationTargets{Targets: o.applicationsService.OrchestrateTargets(jsonRequest, targets)}
+	status := http.StatusCreated
+	if jsonRequest.DryRun {
+		status = http.StatusOK
+	}
+	for _, result := range results.Targets {
+		if result.Error != "" {
+			status = http.StatusMultiStatus
+		}
+	}
+	data, _ := json.Marshal(results)
+	writer.Header().Set("content-type", "application/json")
+	writer.WriteHeader(status)
+	_, _ = writer.Write(data)
+}
+
+// submit queues the orchestration as a job and returns 202, with the job to poll in the Location header.
+func (o OrchestrationHandler) submit(writer http.ResponseWriter, jsonRequest Orchestration) {
+	jsonRequest.Async = false
+	id, err := o.jobs.Submit(jsonRequest)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	record, err := o.jobs.Jobs.FindById(id)
+	if err != nil {
+		writeJobError(writer, err)
+		return
+	}
+	writer.Header().Set("Location", fmt.Sprintf("/jobs/%s", id))
+	writeJob(writer, http.StatusAccepted, *record)
 }
@@ -8,10 +8,14 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
 	"github.com/hexa-org/policy-mapper/pkg/mockOidcSupport"
@@ -19,12 +23,18 @@ import (
 	"github.com/hexa-org/policy-mapper/sdk"
 	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
 	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
 
 	"github.com/hexa-org/policy-mapper/pkg/healthsupport"
 	"github.com/hexa-org/policy-mapper/pkg/websupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type orchestrationHandlerData struct {
@@ -37,6 +47,7 @@ type orchestrationHandlerData struct {
 	toAppDifferent string
 
 	testDir    string
+	auditLog   *auditsupport.Log
 	Data       *dataConfigGateway.ConfigData
 	appGateway dataConfigGateway.ApplicationsDataGateway
 
@@ -91,18 +102,18 @@ func (data *orchestrationHandlerData) SetUp() {
 	_, _ = data.Data.Create("50e00619-9f15-4e85-a7e9-f26d87ea12e7", "noop", []byte("aKey"))
 	integration := data.Data.Integrations["50e00619-9f15-4e85-a7e9-f26d87ea12e7"]
 	apps := []policyprovider.ApplicationInfo{
-		{"anObjectId", "aName", "aDescription", "aService"},
-		{"anotherObjectId", "anotherName", "anotherDescription", "anotherService"},
+		{ObjectID: "anObjectId", Name: "aName", Description: "aDescription", Service: "aService"},
+		{ObjectID: "anotherObjectId", Name: "anotherName", Description: "anotherDescription", Service: "anotherService"},
 	}
 	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff210"] = apps[0]
 	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff211"] = apps[0]
 
 	_, _ = data.Data.Create("50e00619-9f15-4e85-a7e9-f26d87ea12e8", "noop", []byte("aKey"))
 	integration = data.Data.Integrations["50e00619-9f15-4e85-a7e9-f26d87ea12e8"]
-	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff212"] = policyprovider.ApplicationInfo{"andAnotherObjectId", "andAnotherName", "andAnotherDescription", "andAnotherService"}
+	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff212"] = policyprovider.ApplicationInfo{ObjectID: "andAnotherObjectId", Name: "andAnotherName", Description: "andAnotherDescription", Service: "andAnotherService"}
 	_, _ = data.Data.Create("50e00619-9f15-4e85-a7e9-f26d87ea12e9", "noop", []byte("aKey"))
 	integration = data.Data.Integrations["50e00619-9f15-4e85-a7e9-f26d87ea12e8"]
-	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff213"] = policyprovider.ApplicationInfo{"yetAnotherObjectId", "yetAnotherName", "yetAnotherDescription", "yetAnotherService"}
+	integration.Apps["6409776a-367a-483a-a194-5ccf9c4ff213"] = policyprovider.ApplicationInfo{ObjectID: "yetAnotherObjectId", Name: "yetAnotherName", Description: "yetAnotherDescription", Service: "yetAnotherService"}
 
 	data.fromApp = "6409776a-367a-483a-a194-5ccf9c4ff210"
 	data.toApp = "6409776a-367a-483a-a194-5ccf9c4ff211"
@@ -117,7 +128,8 @@ func (data *orchestrationHandlerData) SetUp() {
 	data.providers = make(map[string]policyprovider.Provider)
 	data.providers["50e00619-9f15-4e85-a7e9-f26d87ea12e7"] = &orchestratorNoopProvider.NoopProvider{}
 	// data.providers["azure"] = microsoftazure.NewAzureProvider() This will auto load
-	handlers := orchestrator.LoadHandlers(data.Data, data.providers)
+	data.auditLog, _ = auditsupport.Open(filepath.Join(data.testDir, "audit.log"))
+	handlers := orchestrator.LoadHandlers(data.Data, data.providers, data.auditLog)
 	data.server = websupport.Create(addr, handlers, websupport.Options{})
 	go websupport.Start(data.server, listener)
 	healthsupport.WaitForHealthy(data.server)
@@ -150,6 +162,67 @@ func TestOrchestration(t *testing.T) {
 	})
 }
 
+func TestOrchestration_metrics(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err := data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		recorder := httptest.NewRecorder()
+		prometheussupport.Wrap(http.NotFoundHandler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		metrics := recorder.Body.String()
+		assert.Contains(t, metrics, `hexa_orchestrator_http_requests_total{code="201",method="POST",route="/orchestration"}`)
+		assert.Contains(t, metrics, `hexa_orchestrator_orchestrations_total{outcome="applied"}`)
+		for _, operation := range []string{prometheussupport.OperationGetPolicyInfo, prometheussupport.OperationSetPolicyInfo} {
+			assert.Contains(t, metrics, fmt.Sprintf(`hexa_orchestrator_provider_call_duration_seconds_count{operation="%s",provider="noop"}`, operation))
+		}
+		assert.Contains(t, metrics, `hexa_orchestrator_application_policies{application="anObjectId",provider="noop"} 2`)
+
+		request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/integrations/50e00619-9f15-4e85-a7e9-f26d87ea12e7", data.server.Addr), nil)
+		resp, err = data.oauthHttpClient.Do(request)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		recorder = httptest.NewRecorder()
+		prometheussupport.Wrap(http.NotFoundHandler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.NotContains(t, recorder.Body.String(), `hexa_orchestrator_application_policies{application="anObjectId"`, "the applications of a deleted integration are no longer reported")
+	})
+}
+
+func TestOrchestration_traces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(previous)
+
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/orchestration", data.server.Addr), bytes.NewReader(marshal))
+		request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		resp, err := data.oauthHttpClient.Do(request)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		names := func() []string {
+			names := make([]string, 0)
+			for _, span := range recorder.Ended() {
+				if span.SpanContext().TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+					names = append(names, span.Name())
+				}
+			}
+			return names
+		}
+		assert.Eventually(t, func() bool { return slices.Contains(names(), "POST /orchestration") }, time.Second, 10*time.Millisecond)
+		assert.Subset(t, names(), []string{
+			"ApplicationsService.Orchestrate",
+			"ApplicationsService.GatherRecords",
+			"noop " + prometheussupport.OperationGetPolicyInfo,
+			"noop " + prometheussupport.OperationSetPolicyInfo,
+		})
+	})
+}
+
 func TestOrchestration_failsAcrossProviders(t *testing.T) {
 	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
 		url := fmt.Sprintf("http://%s/orchestration", data.server.Addr)
@@ -160,3 +233,84 @@ func TestOrchestration_failsAcrossProviders(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
 	})
 }
+
+func TestOrchestration_withTargets(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		url := fmt.Sprintf("http://%s/orchestration", data.server.Addr)
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp, Targets: []string{data.toAppDifferent, data.toApp}})
+
+		resp, err := data.oauthHttpClient.Post(url, "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+
+		var results orchestrator.OrchestrationTargets
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+		assert.Len(t, results.Targets, 2, "targets are only orchestrated once")
+		assert.Equal(t, data.toApp, results.Targets[0].To)
+		assert.Empty(t, results.Targets[0].Error)
+		assert.Len(t, results.Targets[0].Result.Policies, 2)
+		assert.Equal(t, data.toAppDifferent, results.Targets[1].To)
+		assert.NotEmpty(t, results.Targets[1].Error, "a failing target does not stop the others")
+		assert.Nil(t, results.Targets[1].Result)
+
+		marshal, _ = json.Marshal(orchestrator.Orchestration{From: data.fromApp, Targets: []string{data.toApp}, DryRun: true})
+		resp, err = data.oauthHttpClient.Post(url, "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		marshal, _ = json.Marshal(orchestrator.Orchestration{From: data.fromApp, Targets: []string{data.toApp}})
+		resp, err = data.oauthHttpClient.Post(url, "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, err = data.oauthHttpClient.Post(url+"?async=true", "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestOrchestration_invalidRequest(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		resp, err := data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", strings.NewReader(`{"from":`))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestOrchestration_dryRun(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		url := fmt.Sprintf("http://%s/orchestration?dryRun=true", data.server.Addr)
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+
+		resp, err := data.oauthHttpClient.Post(url, "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var result orchestrator.OrchestrationResult
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Len(t, result.Policies, 2)
+		assert.True(t, result.Diff.IsEmpty())
+	})
+}
+
+func TestOrchestration_dryRunInBody(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		url := fmt.Sprintf("http://%s/orchestration", data.server.Addr)
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp, DryRun: true})
+
+		resp, err := data.oauthHttpClient.Post(url, "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestOrchestration_dryRunFailsAcrossProviders(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		url := fmt.Sprintf("http://%s/orchestration?dryRun=true", data.server.Addr)
+		marshal, _ := json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toAppDifferent})
+
+		resp, err := data.oauthHttpClient.Post(url, "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	})
+}
@@ -0,0 +1,201 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	logger "golang.org/x/exp/slog"
+)
+
+var ErrOrchestrationRunning = errors.New("orchestration is already running")
+
+// OrchestrationRun is the outcome of running a stored orchestration against each of its targets.
+type OrchestrationRun struct {
+	StartedAt  time.Time                   `json:"started_at"`
+	FinishedAt time.Time                   `json:"finished_at"`
+	Targets    []OrchestrationTargetResult `json:"targets"`
+}
+
+type OrchestrationTargetResult struct {
+	To     string               `json:"to"`
+	Result *OrchestrationResult `json:"result,omitempty"`
+	Error  string               `json:"error,omitempty"`
+}
+
+// ParseSchedule parses the schedule of an orchestration, a cron expression such as "0 2 * * *" or a descriptor such as
+// "@every 15m" (see workflowsupport.ParseCron). Cron expressions are evaluated in UTC. A duration such as 15m, the
+// form schedules were stored in before, runs at that interval. An empty schedule returns nil, the orchestration then
+// only runs on request.
+func ParseSchedule(schedule string) (workflowsupport.Schedule, error) {
+	schedule = strings.TrimSpace(schedule)
+	if schedule == "" {
+		return nil, nil
+	}
+	if interval, err := time.ParseDuration(schedule); err == nil {
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid schedule %s, expected a positive duration such as @every 15m", schedule)
+		}
+		return workflowsupport.Every(interval), nil
+	}
+	return workflowsupport.ParseCron(schedule)
+}
+
+// runningOrchestrations holds the ids of the orchestrations being run, shared by the scheduler and the run endpoint
+// so that a target is never written by two runs at once.
+var runningOrchestrations = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: make(map[string]bool)}
+
+// OrchestrationRunner applies a stored orchestration to each of its targets and records the run.
+type OrchestrationRunner struct {
+	Orchestrations      dataConfigGateway.OrchestrationsDataGateway
+	ApplicationsService ApplicationsService
+	Clock               workflowsupport.Clock // times the runs, SystemClock unless set
+}
+
+func NewOrchestrationRunner(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider) OrchestrationRunner {
+	return OrchestrationRunner{
+		Orchestrations:      configHandler.GetOrchestrationDataGateway(),
+		ApplicationsService: newApplicationsService(configHandler, cacheProviders),
+	}
+}
+
+func (runner OrchestrationRunner) now() time.Time {
+	if runner.Clock == nil {
+		return workflowsupport.SystemClock.Now()
+	}
+	return runner.Clock.Now()
+}
+
+// Run orchestrates the targets concurrently, a failing target does not stop the others. The returned error joins the
+// errors of the failed targets, it is ErrOrchestrationRunning when the orchestration is already running.
+func (runner OrchestrationRunner) Run(record dataConfigGateway.OrchestrationRecord) (OrchestrationRun, error) {
+	runningOrchestrations.Lock()
+	if runningOrchestrations.ids[record.ID] {
+		runningOrchestrations.Unlock()
+		return OrchestrationRun{}, ErrOrchestrationRunning
+	}
+	runningOrchestrations.ids[record.ID] = true
+	runningOrchestrations.Unlock()
+	defer func() {
+		runningOrchestrations.Lock()
+		delete(runningOrchestrations.ids, record.ID)
+		runningOrchestrations.Unlock()
+	}()
+
+	run := OrchestrationRun{StartedAt: runner.now().UTC()}
+	request := Orchestration{From: record.From, Resources: mapResourceRules(record.Resources)}
+	run.Targets = runner.ApplicationsService.OrchestrateTargets(request, record.To)
+	var errs []error
+	for _, target := range run.Targets {
+		if target.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", target.To, target.Error))
+		}
+	}
+	run.FinishedAt = runner.now().UTC()
+
+	err := errors.Join(errs...)
+	recorded := dataConfigGateway.OrchestrationRun{StartedAt: run.StartedAt, FinishedAt: run.FinishedAt}
+	if err != nil {
+		recorded.Error = err.Error()
+	}
+	if recordErr := runner.Orchestrations.RecordRun(record.ID, recorded); recordErr != nil {
+		logger.Error("Run", "orchestration", record.Name, "msg", "unable to record run", "error", recordErr)
+	}
+	return run, err
+}
+
+// Due reports whether a scheduled orchestration should run at now, which is when it has never run or when its
+// schedule has come round since its last run started. Paused and unscheduled orchestrations are never due.
+func Due(record dataConfigGateway.OrchestrationRecord, now time.Time) bool {
+	if record.Paused {
+		return false
+	}
+	schedule, err := ParseSchedule(record.Schedule)
+	if err != nil || schedule == nil {
+		return false
+	}
+	if record.LastRun == nil {
+		return true
+	}
+	next := schedule.Next(record.LastRun.StartedAt.UTC())
+	return !next.IsZero() && !now.Before(next)
+}
+
+// NewOrchestrationScheduler returns a scheduler that checks on the given schedule for orchestrations that are due and
+// runs them, keeping their targets converged with the source. Failed runs are retried with the default retry policy
+// and then left as dead letters. The clock, SystemClock when nil, decides when orchestrations are due and times their
+// runs.
+func NewOrchestrationScheduler(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider, schedule workflowsupport.Schedule, clock workflowsupport.Clock) workflowsupport.WorkScheduler {
+	if clock == nil {
+		clock = workflowsupport.SystemClock
+	}
+	runner := NewOrchestrationRunner(configHandler, cacheProviders)
+	runner.Clock = clock
+	finder := &orchestrationFinder{orchestrations: runner.Orchestrations, deadLetters: configHandler.GetDeadLetterDataGateway(), clock: clock}
+	scheduler := workflowsupport.NewJobScheduler(finder, []workflowsupport.Job{{Name: "orchestrations", Schedule: schedule, Worker: orchestrationWorker{runner}}})
+	scheduler.Retry = workflowsupport.DefaultRetryPolicy
+	scheduler.Clock = clock
+	return scheduler
+}
+
+type orchestrationFinder struct {
+	orchestrations dataConfigGateway.OrchestrationsDataGateway
+	deadLetters    dataConfigGateway.DeadLettersDataGateway
+	clock          workflowsupport.Clock
+}
+
+func (finder *orchestrationFinder) FindRequested() []interface{} {
+	records, err := finder.orchestrations.Find()
+	if err != nil {
+		logger.Error("FindRequested", "msg", "unable to find orchestrations", "error", err)
+		return nil
+	}
+	now := finder.clock.Now()
+	requested := make([]interface{}, 0)
+	for _, record := range records {
+		if Due(record, now) {
+			requested = append(requested, record)
+		}
+	}
+	return requested
+}
+
+func (finder *orchestrationFinder) MarkCompleted() {}
+
+func (finder *orchestrationFinder) MarkErroneous() {}
+
+func (finder *orchestrationFinder) ReportFailure(failure workflowsupport.Failure) {
+	saveDeadLetter(finder.deadLetters, DeadLetterOrchestration, failure.Task.(dataConfigGateway.OrchestrationRecord).ID, failure)
+}
+
+func (finder *orchestrationFinder) Stop() {}
+
+type orchestrationWorker struct {
+	runner OrchestrationRunner
+}
+
+func (worker orchestrationWorker) Run(task interface{}) error {
+	record := task.(dataConfigGateway.OrchestrationRecord)
+	_, err := worker.runner.Run(record)
+	if errors.Is(err, ErrOrchestrationRunning) {
+		// the previous run has not finished yet, it will be picked up again once it has
+		return nil
+	}
+	return err
+}
+
+func mapResourceRules(records []dataConfigGateway.ResourceRuleRecord) []ResourceRule {
+	rules := make([]ResourceRule, 0, len(records))
+	for _, record := range records {
+		rules = append(rules, ResourceRule(record))
+	}
+	return rules
+}
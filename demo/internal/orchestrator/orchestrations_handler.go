@@ -0,0 +1,227 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+type OrchestrationDefinitions struct {
+	Orchestrations []OrchestrationDefinition `json:"orchestrations"`
+}
+
+// OrchestrationDefinition is both the request and the response representation of a stored orchestration. Schedule
+// is a cron expression or "@every <duration>", see ParseSchedule. Paused, LastRun and the timestamps are ignored in
+// requests.
+type OrchestrationDefinition struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	From      string                `json:"from"`
+	To        []string              `json:"to"`
+	Resources []ResourceRule        `json:"resources,omitempty"`
+	Schedule  string                `json:"schedule,omitempty"`
+	Paused    bool                  `json:"paused"`
+	LastRun   *LastOrchestrationRun `json:"last_run,omitempty"`
+	CreatedAt *time.Time            `json:"created_at,omitempty"`
+	UpdatedAt *time.Time            `json:"updated_at,omitempty"`
+}
+
+type LastOrchestrationRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type OrchestrationsHandler struct {
+	orchestrations dataConfigGateway.OrchestrationsDataGateway
+	runner         OrchestrationRunner
+}
+
+// List returns the orchestrations whose applications the token of the request is permitted to access.
+func (handler OrchestrationsHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := handler.orchestrations.Find()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	access := accessOf(r)
+	list := OrchestrationDefinitions{Orchestrations: make([]OrchestrationDefinition, 0, len(records))}
+	for _, record := range records {
+		if handler.permits(access, record) {
+			list.Orchestrations = append(list.Orchestrations, mapOrchestration(record))
+		}
+	}
+	writeOrchestration(w, http.StatusOK, list)
+}
+
+func (handler OrchestrationsHandler) Show(w http.ResponseWriter, r *http.Request) {
+	record, err := handler.orchestrations.FindById(mux.Vars(r)["id"])
+	if err != nil {
+		writeOrchestrationError(w, err)
+		return
+	}
+	writeOrchestration(w, http.StatusOK, mapOrchestration(*record))
+}
+
+func (handler OrchestrationsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	record, err := decodeOrchestration(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !handler.permits(accessOf(r), record) {
+		notPermitted(w, record.Name)
+		return
+	}
+	id, err := handler.orchestrations.Create(record)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	auditsupport.AddTargets(r.Context(), id)
+	handler.show(w, http.StatusCreated, id)
+}
+
+func (handler OrchestrationsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	record, err := decodeOrchestration(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !handler.permits(accessOf(r), record) {
+		notPermitted(w, record.Name)
+		return
+	}
+	record.ID = mux.Vars(r)["id"]
+	if err = handler.orchestrations.Update(record); err != nil {
+		if errors.Is(err, dataConfigGateway.ErrOrchestrationNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	handler.show(w, http.StatusOK, record.ID)
+}
+
+func (handler OrchestrationsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := handler.orchestrations.Delete(mux.Vars(r)["id"]); err != nil {
+		writeOrchestrationError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Run runs the orchestration now, whether it is paused or not. Failed targets are reported in the response rather
+// than failing the request, they are also recorded as the last run.
+func (handler OrchestrationsHandler) Run(w http.ResponseWriter, r *http.Request) {
+	record, err := handler.orchestrations.FindById(mux.Vars(r)["id"])
+	if err != nil {
+		writeOrchestrationError(w, err)
+		return
+	}
+	handler.runner.ApplicationsService = handler.runner.ApplicationsService.WithContext(r.Context())
+	run, err := handler.runner.Run(*record)
+	if errors.Is(err, ErrOrchestrationRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeOrchestration(w, http.StatusOK, run)
+}
+
+func (handler OrchestrationsHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	handler.setPaused(w, r, true)
+}
+
+func (handler OrchestrationsHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	handler.setPaused(w, r, false)
+}
+
+func (handler OrchestrationsHandler) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	id := mux.Vars(r)["id"]
+	if err := handler.orchestrations.SetPaused(id, paused); err != nil {
+		writeOrchestrationError(w, err)
+		return
+	}
+	handler.show(w, http.StatusOK, id)
+}
+
+// permits is whether the orchestration only reads from and writes to applications permitted by access.
+func (handler OrchestrationsHandler) permits(access integrationAccess, record dataConfigGateway.OrchestrationRecord) bool {
+	return access.permitsApplications(handler.runner.ApplicationsService.ApplicationsGateway, append([]string{record.From}, record.To...)...)
+}
+
+func (handler OrchestrationsHandler) show(w http.ResponseWriter, status int, id string) {
+	record, err := handler.orchestrations.FindById(id)
+	if err != nil {
+		writeOrchestrationError(w, err)
+		return
+	}
+	writeOrchestration(w, status, mapOrchestration(*record))
+}
+
+// decodeOrchestration reads a definition from the request, checking the schedule and resource rules before they are
+// stored.
+func decodeOrchestration(r *http.Request) (dataConfigGateway.OrchestrationRecord, error) {
+	var jsonRequest OrchestrationDefinition
+	if err := json.NewDecoder(r.Body).Decode(&jsonRequest); err != nil {
+		return dataConfigGateway.OrchestrationRecord{}, err
+	}
+	if _, err := ParseSchedule(jsonRequest.Schedule); err != nil {
+		return dataConfigGateway.OrchestrationRecord{}, err
+	}
+	if _, err := newResourceMapper(jsonRequest.Resources); err != nil {
+		return dataConfigGateway.OrchestrationRecord{}, err
+	}
+	record := dataConfigGateway.OrchestrationRecord{
+		Name:     jsonRequest.Name,
+		From:     jsonRequest.From,
+		To:       jsonRequest.To,
+		Schedule: jsonRequest.Schedule,
+	}
+	for _, rule := range jsonRequest.Resources {
+		record.Resources = append(record.Resources, dataConfigGateway.ResourceRuleRecord(rule))
+	}
+	return record, nil
+}
+
+func mapOrchestration(record dataConfigGateway.OrchestrationRecord) OrchestrationDefinition {
+	definition := OrchestrationDefinition{
+		ID:        record.ID,
+		Name:      record.Name,
+		From:      record.From,
+		To:        record.To,
+		Schedule:  record.Schedule,
+		Paused:    record.Paused,
+		CreatedAt: &record.CreatedAt,
+		UpdatedAt: &record.UpdatedAt,
+	}
+	if record.LastRun != nil {
+		lastRun := LastOrchestrationRun(*record.LastRun)
+		definition.LastRun = &lastRun
+	}
+	if len(record.Resources) > 0 {
+		definition.Resources = mapResourceRules(record.Resources)
+	}
+	return definition
+}
+
+func writeOrchestration(w http.ResponseWriter, status int, resource any) {
+	data, _ := json.Marshal(resource)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeOrchestrationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dataConfigGateway.ErrOrchestrationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
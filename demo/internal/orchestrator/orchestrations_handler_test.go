@@ -0,0 +1,126 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrchestrations(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		orchestrationsUrl := fmt.Sprintf("http://%s/orchestrations", data.server.Addr)
+
+		marshal, _ := json.Marshal(orchestrator.OrchestrationDefinition{
+			Name:      "aName",
+			From:      data.fromApp,
+			To:        []string{data.toApp},
+			Resources: []orchestrator.ResourceRule{{Match: orchestrator.ResourceMatchPrefix, Source: "/", Target: "/"}},
+			Schedule:  "15m",
+		})
+		resp, err := data.oauthHttpClient.Post(orchestrationsUrl, "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var created orchestrator.OrchestrationDefinition
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		assert.NotEmpty(t, created.ID)
+		assert.Equal(t, "15m", created.Schedule)
+		assert.False(t, created.Paused)
+		assert.Nil(t, created.LastRun)
+
+		orchestrationUrl := fmt.Sprintf("%s/%s", orchestrationsUrl, created.ID)
+		resp, err = data.oauthHttpClient.Get(orchestrationUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var shown orchestrator.OrchestrationDefinition
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&shown))
+		assert.Equal(t, []orchestrator.ResourceRule{{Match: orchestrator.ResourceMatchPrefix, Source: "/", Target: "/"}}, shown.Resources)
+
+		marshal, _ = json.Marshal(orchestrator.OrchestrationDefinition{Name: "aNewName", From: data.fromApp, To: []string{data.toApp, data.toAppDifferent}})
+		req, _ := http.NewRequest(http.MethodPut, orchestrationUrl, bytes.NewReader(marshal))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var updated orchestrator.OrchestrationDefinition
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&updated))
+		assert.Equal(t, "aNewName", updated.Name)
+		assert.Empty(t, updated.Schedule)
+		assert.Empty(t, updated.Resources)
+
+		resp, err = data.oauthHttpClient.Post(orchestrationUrl+"/pause", "application/json", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var paused orchestrator.OrchestrationDefinition
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&paused))
+		assert.True(t, paused.Paused)
+
+		// a paused orchestration can still be run on request, the failing target does not stop the other
+		resp, err = data.oauthHttpClient.Post(orchestrationUrl+"/run", "application/json", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var run orchestrator.OrchestrationRun
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&run))
+		assert.Len(t, run.Targets, 2)
+		assert.Equal(t, data.toApp, run.Targets[0].To)
+		assert.Empty(t, run.Targets[0].Error)
+		assert.NotNil(t, run.Targets[0].Result)
+		assert.Equal(t, data.toAppDifferent, run.Targets[1].To)
+		assert.NotEmpty(t, run.Targets[1].Error)
+
+		resp, err = data.oauthHttpClient.Post(orchestrationUrl+"/resume", "application/json", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var resumed orchestrator.OrchestrationDefinition
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&resumed))
+		assert.False(t, resumed.Paused)
+		assert.NotNil(t, resumed.LastRun)
+		assert.Contains(t, resumed.LastRun.Error, data.toAppDifferent)
+
+		resp, err = data.oauthHttpClient.Get(orchestrationsUrl)
+		assert.NoError(t, err)
+		var list orchestrator.OrchestrationDefinitions
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		assert.Len(t, list.Orchestrations, 1)
+
+		req, _ = http.NewRequest(http.MethodDelete, orchestrationUrl, nil)
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = data.oauthHttpClient.Get(orchestrationUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = data.oauthHttpClient.Post(orchestrationUrl+"/run", "application/json", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestOrchestrations_badRequest(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		orchestrationsUrl := fmt.Sprintf("http://%s/orchestrations", data.server.Addr)
+
+		for _, definition := range []orchestrator.OrchestrationDefinition{
+			{Name: "aName", From: data.fromApp},
+			{Name: "aName", From: data.fromApp, To: []string{data.toApp}, Schedule: "often"},
+			{Name: "aName", From: data.fromApp, To: []string{data.toApp}, Resources: []orchestrator.ResourceRule{{Match: "fuzzy", Source: "/"}}},
+		} {
+			marshal, _ := json.Marshal(definition)
+			resp, err := data.oauthHttpClient.Post(orchestrationsUrl, "application/json", bytes.NewReader(marshal))
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		}
+
+		marshal, _ := json.Marshal(orchestrator.OrchestrationDefinition{Name: "aName", From: data.fromApp, To: []string{data.toApp}})
+		req, _ := http.NewRequest(http.MethodPut, orchestrationsUrl+"/anId", bytes.NewReader(marshal))
+		resp, err := data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,194 @@
+package orchestrator_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	orchestratorNoopProvider "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)
+	schedule, err := orchestrator.ParseSchedule("15m")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(15*time.Minute), schedule.Next(now), "durations run at that interval")
+
+	schedule, err = orchestrator.ParseSchedule("@every 15m")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(15*time.Minute), schedule.Next(now))
+
+	schedule, err = orchestrator.ParseSchedule("0 2 * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.February, 1, 2, 0, 0, 0, time.UTC), schedule.Next(now))
+
+	schedule, err = orchestrator.ParseSchedule("")
+	assert.NoError(t, err)
+	assert.Nil(t, schedule)
+
+	_, err = orchestrator.ParseSchedule("often")
+	assert.EqualError(t, err, "invalid schedule often, expected five fields such as 0 2 * * *")
+	_, err = orchestrator.ParseSchedule("-1m")
+	assert.Error(t, err)
+	_, err = orchestrator.ParseSchedule("@every -1m")
+	assert.Error(t, err)
+}
+
+func TestDue(t *testing.T) {
+	now := time.Now()
+	record := dataConfigGateway.OrchestrationRecord{Schedule: "15m"}
+	assert.True(t, orchestrator.Due(record, now), "never run")
+
+	record.LastRun = &dataConfigGateway.OrchestrationRun{StartedAt: now.Add(-10 * time.Minute)}
+	assert.False(t, orchestrator.Due(record, now))
+
+	record.LastRun.StartedAt = now.Add(-15 * time.Minute)
+	assert.True(t, orchestrator.Due(record, now))
+
+	record.Paused = true
+	assert.False(t, orchestrator.Due(record, now))
+
+	assert.False(t, orchestrator.Due(dataConfigGateway.OrchestrationRecord{}, now), "only runs on request")
+
+	lastRun := time.Date(2024, time.January, 31, 2, 0, 0, 0, time.UTC)
+	nightly := dataConfigGateway.OrchestrationRecord{Schedule: "0 2 * * *", LastRun: &dataConfigGateway.OrchestrationRun{StartedAt: lastRun}}
+	assert.False(t, orchestrator.Due(nightly, lastRun.Add(23*time.Hour)))
+	assert.True(t, orchestrator.Due(nightly, lastRun.Add(24*time.Hour)))
+}
+
+func TestOrchestrationScheduler(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	_, err = data.Create("anIntegration", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	data.Integrations["anIntegration"].Apps = map[string]policyprovider.ApplicationInfo{
+		"anApp":      {ObjectID: "anObject", Name: "anApp"},
+		"anotherApp": {ObjectID: "anotherObject", Name: "anotherApp"},
+	}
+	providers := map[string]policyprovider.Provider{"anIntegration": &orchestratorNoopProvider.NoopProvider{}}
+
+	orchestrations := data.GetOrchestrationDataGateway()
+	scheduled, err := orchestrations.Create(dataConfigGateway.OrchestrationRecord{Name: "scheduled", From: "anApp", To: []string{"anotherApp"}, Schedule: "1h"})
+	assert.NoError(t, err)
+	onRequest, err := orchestrations.Create(dataConfigGateway.OrchestrationRecord{Name: "onRequest", From: "anApp", To: []string{"anotherApp"}})
+	assert.NoError(t, err)
+
+	scheduler := orchestrator.NewOrchestrationScheduler(data, providers, workflowsupport.Every(200*time.Millisecond), nil)
+	scheduler.Start()
+	assert.Eventually(t, func() bool {
+		record, _ := orchestrations.FindById(scheduled)
+		return record.LastRun != nil
+	}, 5*time.Second, 20*time.Millisecond)
+	scheduler.Stop()
+
+	record, err := orchestrations.FindById(scheduled)
+	assert.NoError(t, err)
+	assert.Empty(t, record.LastRun.Error)
+
+	record, err = orchestrations.FindById(onRequest)
+	assert.NoError(t, err)
+	assert.Nil(t, record.LastRun)
+}
+
+// TestOrchestrationScheduler_integrationChanges changes integrations while the scheduler records runs, run it with
+// -race to check that the config file store serializes them.
+func TestOrchestrationScheduler_integrationChanges(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	_, err = data.Create("anIntegration", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	data.Integrations["anIntegration"].Apps = map[string]policyprovider.ApplicationInfo{
+		"anApp":      {ObjectID: "anObject", Name: "anApp"},
+		"anotherApp": {ObjectID: "anotherObject", Name: "anotherApp"},
+	}
+	providers := map[string]policyprovider.Provider{"anIntegration": &orchestratorNoopProvider.NoopProvider{}}
+
+	orchestrations := data.GetOrchestrationDataGateway()
+	scheduled, err := orchestrations.Create(dataConfigGateway.OrchestrationRecord{Name: "scheduled", From: "anApp", To: []string{"anotherApp"}, Schedule: "@every 1h"})
+	assert.NoError(t, err)
+
+	scheduler := orchestrator.NewOrchestrationScheduler(data, providers, workflowsupport.Every(5*time.Millisecond), nil)
+	scheduler.Start()
+	for i := 0; i < 20; i++ {
+		alias, err := data.Create("", "noop", []byte("aKey"))
+		assert.NoError(t, err)
+		alias, err = data.Update(alias, alias+"-renamed", []byte("anotherKey"))
+		assert.NoError(t, err)
+		assert.NoError(t, data.GetActionMappingDataGateway().Save(dataConfigGateway.ActionMappingRecord{
+			From: alias, To: "anIntegration", Actions: map[string][]string{"read": {"get"}},
+		}))
+		_, err = data.GetApplicationDataGateway().Find(false)
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Eventually(t, func() bool {
+		record, _ := orchestrations.FindById(scheduled)
+		return record.LastRun != nil
+	}, 5*time.Second, 20*time.Millisecond)
+	scheduler.Stop()
+
+	assert.Len(t, data.Find(), 21)
+}
+
+// fixedClock always reads the same time, while the scheduler still waits in real time.
+type fixedClock struct {
+	now time.Time
+}
+
+func (clock fixedClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock fixedClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func TestOrchestrationScheduler_clock(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	_, err = data.Create("anIntegration", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	data.Integrations["anIntegration"].Apps = map[string]policyprovider.ApplicationInfo{
+		"anApp":      {ObjectID: "anObject", Name: "anApp"},
+		"anotherApp": {ObjectID: "anotherObject", Name: "anotherApp"},
+	}
+	providers := map[string]policyprovider.Provider{"anIntegration": &orchestratorNoopProvider.NoopProvider{}}
+
+	now := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)
+	orchestrations := data.GetOrchestrationDataGateway()
+	hourly, _ := orchestrations.Create(dataConfigGateway.OrchestrationRecord{Name: "hourly", From: "anApp", To: []string{"anotherApp"}, Schedule: "0 * * * *"})
+	assert.NoError(t, orchestrations.RecordRun(hourly, dataConfigGateway.OrchestrationRun{StartedAt: now.Add(-time.Hour)}))
+	notDue, _ := orchestrations.Create(dataConfigGateway.OrchestrationRecord{Name: "notDue", From: "anApp", To: []string{"anotherApp"}, Schedule: "@every 1h"})
+	assert.NoError(t, orchestrations.RecordRun(notDue, dataConfigGateway.OrchestrationRun{StartedAt: now.Add(-30 * time.Minute)}))
+
+	scheduler := orchestrator.NewOrchestrationScheduler(data, providers, workflowsupport.Every(20*time.Millisecond), fixedClock{now})
+	scheduler.Start()
+	assert.Eventually(t, func() bool {
+		record, _ := orchestrations.FindById(hourly)
+		return record.LastRun.StartedAt.Equal(now)
+	}, 5*time.Second, 20*time.Millisecond, "runs are timed by the clock")
+	scheduler.Stop()
+
+	record, err := orchestrations.FindById(hourly)
+	assert.NoError(t, err)
+	assert.Equal(t, now, record.LastRun.FinishedAt)
+	record, err = orchestrations.FindById(notDue)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-30*time.Minute), record.LastRun.StartedAt, "the clock decides what is due")
+}
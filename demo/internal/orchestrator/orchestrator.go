@@ -1,41 +1,136 @@
 package orchestrator
 
 import (
+	"os"
+
 	"github.com/gorilla/mux"
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
 	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/authzsupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/hexaConstants"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
 	log "golang.org/x/exp/slog"
 )
 
-func LoadHandlers(configHandler *dataConfigGateway.ConfigData, cacheProviders map[string]policyprovider.Provider) func(router *mux.Router) {
-	pb := NewProviderBuilder()
-	if cacheProviders != nil {
-		pb.AddProviders(cacheProviders)
-	}
+// ScopeIntegrationCredentials is required to read integration key material. It is deliberately not implied by the
+// general orchestrator scope.
+const ScopeIntegrationCredentials = hexaConstants.ScopeIntegrationCredentials
+
+// LoadHandlers returns the routes of the orchestrator. Each route accepts the scopes in hexaConstants that cover it,
+// and routes that name an integration, an application or a stored orchestration also refuse tokens restricted to
+// other integrations by hexaConstants.ClaimIntegrations. When authzsupport.EnvAuthzPolicyFile is set, each request
+// must also be authorized by its IDQL policies. Each request that changes something is recorded in the audit log,
+// which may be nil in tests.
+func LoadHandlers(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider, auditLog *auditsupport.Log) func(router *mux.Router) {
 	integrationsGateway := configHandler
 	applicationsGateway := configHandler.GetApplicationDataGateway()
+	actionMappingsGateway := configHandler.GetActionMappingDataGateway()
+	subjectMappingsGateway := configHandler.GetSubjectMappingDataGateway()
+	orchestrationsGateway := configHandler.GetOrchestrationDataGateway()
+	policyStatesGateway := configHandler.GetPolicyStateDataGateway()
+	jobsGateway := configHandler.GetJobDataGateway()
+	deadLettersGateway := configHandler.GetDeadLetterDataGateway()
 
-	applicationsService := ApplicationsService{ApplicationsGateway: applicationsGateway, IntegrationsGateway: integrationsGateway, ProviderBuilder: pb}
+	applicationsService := newApplicationsService(configHandler, cacheProviders)
 
 	applicationsHandler := ApplicationsHandler{applicationsGateway, integrationsGateway, applicationsService}
-	integrationsHandler := IntegrationsHandler{integrationsGateway}
-	orchestrationHandler := OrchestrationHandler{applicationsService: applicationsService}
+	integrationsHandler := IntegrationsHandler{integrationsGateway, applicationsGateway, applicationsService.ProviderBuilder}
+	orchestrationHandler := OrchestrationHandler{applicationsService: applicationsService, jobs: JobRunner{jobsGateway, applicationsService}}
+	jobsHandler := JobsHandler{jobsGateway}
+	healthHandler := IntegrationHealthHandler{NewIntegrationHealthChecker(configHandler, cacheProviders)}
+	guard := integrationGuard{applicationsGateway, orchestrationsGateway, jobsGateway, deadLettersGateway, integrationsGateway}
+	deadLettersHandler := DeadLettersHandler{deadLettersGateway, guard}
+	auditHandler := AuditHandler{auditLog, guard}
+	actionMappingsHandler := ActionMappingsHandler{actionMappingsGateway, applicationsGateway}
+	subjectMappingsHandler := SubjectMappingsHandler{subjectMappingsGateway, applicationsGateway}
+	versionsHandler := PolicyVersionsHandler{applicationsService}
+	driftHandler := DriftHandler{applicationsGateway, DriftDetector{policyStatesGateway, applicationsService}}
+	orchestrationsHandler := OrchestrationsHandler{orchestrationsGateway, OrchestrationRunner{Orchestrations: orchestrationsGateway, ApplicationsService: applicationsService}}
 	jwtHandler, err := oauth2support.NewResourceJwtAuthorizer()
 	if err != nil {
 		log.Error("Error initializing JWT authorizer", "err", err.Error())
 	}
 
-	scopes := []string{"orchestrator"}
+	authorizer, err := authzsupport.NewAuthorizer("", guard.resourceAttributes)
+	if err != nil {
+		log.Error("Error loading authorization policies, requests are denied until they load", "err", err.Error())
+	}
+
+	integrationsRead := []string{hexaConstants.ScopeIntegrationsRead, hexaConstants.ScopeIntegrationsWrite, hexaConstants.ScopeOrchestrator}
+	integrationsWrite := []string{hexaConstants.ScopeIntegrationsWrite, hexaConstants.ScopeOrchestrator}
+	credentialScopes := []string{ScopeIntegrationCredentials}
+	applicationsRead := []string{hexaConstants.ScopeIntegrationsRead, hexaConstants.ScopeIntegrationsWrite, hexaConstants.ScopePoliciesRead, hexaConstants.ScopePoliciesWrite, hexaConstants.ScopeOrchestrator}
+	policiesRead := []string{hexaConstants.ScopePoliciesRead, hexaConstants.ScopePoliciesWrite, hexaConstants.ScopeOrchestrator}
+	policiesWrite := []string{hexaConstants.ScopePoliciesWrite, hexaConstants.ScopeOrchestrator}
+	orchestrationsRead := []string{hexaConstants.ScopeOrchestrationExecute, hexaConstants.ScopePoliciesRead, hexaConstants.ScopePoliciesWrite, hexaConstants.ScopeOrchestrator}
+	execute := []string{hexaConstants.ScopeOrchestrationExecute, hexaConstants.ScopeOrchestrator}
+	auditRead := []string{hexaConstants.ScopeAuditRead, hexaConstants.ScopeOrchestrator}
 
 	return func(router *mux.Router) {
-		router.HandleFunc("/applications", oauth2support.JwtAuthenticationHandler(applicationsHandler.List, jwtHandler, scopes)).Methods("GET")
-		router.HandleFunc("/applications/{id}", oauth2support.JwtAuthenticationHandler(applicationsHandler.Show, jwtHandler, scopes)).Methods("GET")
-		router.HandleFunc("/applications/{id}/policies", oauth2support.JwtAuthenticationHandler(applicationsHandler.GetPolicies, jwtHandler, scopes)).Methods("GET")
-		router.HandleFunc("/applications/{id}/policies", oauth2support.JwtAuthenticationHandler(applicationsHandler.SetPolicies, jwtHandler, scopes)).Methods("POST")
-		router.HandleFunc("/integrations", oauth2support.JwtAuthenticationHandler(integrationsHandler.List, jwtHandler, scopes)).Methods("GET")
-		router.HandleFunc("/integrations", oauth2support.JwtAuthenticationHandler(integrationsHandler.Create, jwtHandler, scopes)).Methods("POST")
-		router.HandleFunc("/integrations/{id}", oauth2support.JwtAuthenticationHandler(integrationsHandler.Delete, jwtHandler, scopes)).Methods("GET")
-		router.HandleFunc("/orchestration", oauth2support.JwtAuthenticationHandler(orchestrationHandler.Update, jwtHandler, scopes)).Methods("POST")
+		router.Use(prometheussupport.Middleware, tracesupport.Middleware)
+		router.HandleFunc("/applications", oauth2support.JwtAuthenticationHandler(authorizer.Handler(applicationsHandler.List), jwtHandler, applicationsRead)).Methods("GET")
+		router.HandleFunc("/applications/{id}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.application(applicationsHandler.Show)), jwtHandler, applicationsRead)).Methods("GET")
+		router.HandleFunc("/applications/{id}/policies", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.application(applicationsHandler.GetPolicies)), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/applications/{id}/policies", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditPoliciesSet, authorizer.Handler(guard.application(applicationsHandler.SetPolicies))), jwtHandler, policiesWrite)).Methods("POST")
+		router.HandleFunc("/applications/{id}/policies/versions", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.application(versionsHandler.List)), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/applications/{id}/policies/versions/{version}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.application(versionsHandler.Show)), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/applications/{id}/policies/versions/{from}/diff/{to}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.application(versionsHandler.Diff)), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/applications/{id}/policies/rollback/{version}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditPoliciesRollback, authorizer.Handler(guard.application(versionsHandler.Rollback))), jwtHandler, policiesWrite)).Methods("POST")
+		router.HandleFunc("/applications/{id}/drift", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.application(driftHandler.Show)), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/applications/{id}/desired", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditDesiredDeclare, authorizer.Handler(guard.application(driftHandler.Declare))), jwtHandler, policiesWrite)).Methods("PUT")
+		router.HandleFunc("/applications/{id}/desired", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditDesiredUndeclare, authorizer.Handler(guard.application(driftHandler.Undeclare))), jwtHandler, policiesWrite)).Methods("DELETE")
+		router.HandleFunc("/integrations", oauth2support.JwtAuthenticationHandler(authorizer.Handler(integrationsHandler.List), jwtHandler, integrationsRead)).Methods("GET")
+		router.HandleFunc("/health/integrations", oauth2support.JwtAuthenticationHandler(authorizer.Handler(healthHandler.List), jwtHandler, integrationsRead)).Methods("GET")
+		router.HandleFunc("/integrations", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditIntegrationCreate, authorizer.Handler(integrationsHandler.Create)), jwtHandler, integrationsWrite)).Methods("POST")
+		if os.Getenv(EnvLegacyIntegrationDelete) == "true" {
+			router.HandleFunc("/integrations/{id}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditIntegrationDelete, authorizer.Handler(guard.integration(integrationsHandler.LegacyDelete))), jwtHandler, integrationsWrite)).Methods("GET")
+		} else {
+			router.HandleFunc("/integrations/{id}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.integration(integrationsHandler.Show)), jwtHandler, integrationsRead)).Methods("GET")
+		}
+		router.HandleFunc("/integrations/{id}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditIntegrationUpdate, authorizer.Handler(guard.integration(integrationsHandler.Update))), jwtHandler, integrationsWrite)).Methods("PUT", "PATCH")
+		router.HandleFunc("/integrations/{id}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditIntegrationDelete, authorizer.Handler(guard.integration(integrationsHandler.Delete))), jwtHandler, integrationsWrite)).Methods("DELETE")
+		router.HandleFunc("/integrations/{id}/credentials", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.integration(integrationsHandler.Credentials)), jwtHandler, credentialScopes)).Methods("GET")
+		router.HandleFunc("/integrations/{id}/credentials", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditIntegrationRotate, authorizer.Handler(guard.integration(integrationsHandler.RotateCredentials))), jwtHandler, integrationsWrite)).Methods("PUT")
+		router.HandleFunc("/orchestration", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditOrchestration, authorizer.Handler(orchestrationHandler.Update)), jwtHandler, execute)).Methods("POST")
+		router.HandleFunc("/jobs/{id}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.job(jobsHandler.Show)), jwtHandler, orchestrationsRead)).Methods("GET")
+		router.HandleFunc("/dead-letters", oauth2support.JwtAuthenticationHandler(authorizer.Handler(deadLettersHandler.List), jwtHandler, orchestrationsRead)).Methods("GET")
+		router.HandleFunc("/dead-letters/{id}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditDeadLetterDelete, authorizer.Handler(guard.deadLetter(deadLettersHandler.Delete))), jwtHandler, execute)).Methods("DELETE")
+		router.HandleFunc("/audit", oauth2support.JwtAuthenticationHandler(authorizer.Handler(auditHandler.List), jwtHandler, auditRead)).Methods("GET")
+		router.HandleFunc("/audit/verify", oauth2support.JwtAuthenticationHandler(authorizer.Handler(auditHandler.Verify), jwtHandler, auditRead)).Methods("GET")
+		router.HandleFunc("/orchestrations", oauth2support.JwtAuthenticationHandler(authorizer.Handler(orchestrationsHandler.List), jwtHandler, orchestrationsRead)).Methods("GET")
+		router.HandleFunc("/orchestrations", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditOrchestrationCreate, authorizer.Handler(orchestrationsHandler.Create)), jwtHandler, execute)).Methods("POST")
+		router.HandleFunc("/orchestrations/{id}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.orchestration(orchestrationsHandler.Show)), jwtHandler, orchestrationsRead)).Methods("GET")
+		router.HandleFunc("/orchestrations/{id}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditOrchestrationUpdate, authorizer.Handler(guard.orchestration(orchestrationsHandler.Update))), jwtHandler, execute)).Methods("PUT")
+		router.HandleFunc("/orchestrations/{id}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditOrchestrationDelete, authorizer.Handler(guard.orchestration(orchestrationsHandler.Delete))), jwtHandler, execute)).Methods("DELETE")
+		router.HandleFunc("/orchestrations/{id}/run", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditOrchestrationRun, authorizer.Handler(guard.orchestration(orchestrationsHandler.Run))), jwtHandler, execute)).Methods("POST")
+		router.HandleFunc("/orchestrations/{id}/pause", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditOrchestrationPause, authorizer.Handler(guard.orchestration(orchestrationsHandler.Pause))), jwtHandler, execute)).Methods("POST")
+		router.HandleFunc("/orchestrations/{id}/resume", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditOrchestrationResume, authorizer.Handler(guard.orchestration(orchestrationsHandler.Resume))), jwtHandler, execute)).Methods("POST")
+		router.HandleFunc("/mappings/actions", oauth2support.JwtAuthenticationHandler(authorizer.Handler(actionMappingsHandler.List), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/mappings/actions/{from}/{to}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.mapping(actionMappingsHandler.Show)), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/mappings/actions/{from}/{to}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditActionMappingUpdate, authorizer.Handler(guard.mapping(actionMappingsHandler.Update))), jwtHandler, policiesWrite)).Methods("PUT")
+		router.HandleFunc("/mappings/actions/{from}/{to}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditActionMappingDelete, authorizer.Handler(guard.mapping(actionMappingsHandler.Delete))), jwtHandler, policiesWrite)).Methods("DELETE")
+		router.HandleFunc("/mappings/subjects", oauth2support.JwtAuthenticationHandler(authorizer.Handler(subjectMappingsHandler.List), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/mappings/subjects/{from}/{to}", oauth2support.JwtAuthenticationHandler(authorizer.Handler(guard.mapping(subjectMappingsHandler.Show)), jwtHandler, policiesRead)).Methods("GET")
+		router.HandleFunc("/mappings/subjects/{from}/{to}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditSubjectMappingUpdate, authorizer.Handler(guard.mapping(subjectMappingsHandler.Update))), jwtHandler, policiesWrite)).Methods("PUT")
+		router.HandleFunc("/mappings/subjects/{from}/{to}", oauth2support.JwtAuthenticationHandler(auditLog.Handler(AuditSubjectMappingDelete, authorizer.Handler(guard.mapping(subjectMappingsHandler.Delete))), jwtHandler, policiesWrite)).Methods("DELETE")
+	}
+}
+
+func newApplicationsService(configHandler dataConfigGateway.DataGateway, cacheProviders map[string]policyprovider.Provider) ApplicationsService {
+	pb := NewProviderBuilder()
+	if cacheProviders != nil {
+		pb.AddProviders(cacheProviders)
+	}
+	return ApplicationsService{
+		ApplicationsGateway:    configHandler.GetApplicationDataGateway(),
+		IntegrationsGateway:    configHandler,
+		ActionMappingsGateway:  configHandler.GetActionMappingDataGateway(),
+		SubjectMappingsGateway: configHandler.GetSubjectMappingDataGateway(),
+		PolicyStatesGateway:    configHandler.GetPolicyStateDataGateway(),
+		PolicyVersionsGateway:  configHandler.GetPolicyVersionDataGateway(),
+		ProviderBuilder:        pb,
 	}
 }
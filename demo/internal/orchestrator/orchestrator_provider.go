@@ -1,15 +1,34 @@
 package orchestrator
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/sdk"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/migrationSupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ProviderBuilder opens and caches a provider for each integration. It is shared by concurrent orchestrations.
 type ProviderBuilder struct {
-	providerCache map[string]policyprovider.Provider
+	providerCache map[string]cachedProvider
+	mu            sync.Mutex
+}
+
+// cachedProvider is a provider opened with key. Providers added by AddProviders are used whatever the key of their
+// integration.
+type cachedProvider struct {
+	provider policyprovider.Provider
+	key      []byte
+	added    bool
 }
 
 // var legacyProviders = map[string]Provider{
@@ -18,7 +37,7 @@ type ProviderBuilder struct {
 // }
 
 func NewProviderBuilder() *ProviderBuilder {
-	return &ProviderBuilder{providerCache: make(map[string]policyprovider.Provider)}
+	return &ProviderBuilder{providerCache: make(map[string]cachedProvider)}
 }
 
 // legacyProviders["google_cloud"] = &googlecloud.GoogleProvider{}
@@ -30,20 +49,33 @@ func NewProviderBuilder() *ProviderBuilder {
 
 // AddProviders is primarily used in testing to allow a test provider to be directly injected rather than from the sdk integration providers
 func (b *ProviderBuilder) AddProviders(cacheProviders map[string]policyprovider.Provider) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	for k, v := range cacheProviders {
-		b.providerCache[k] = v
+		b.providerCache[k] = cachedProvider{provider: v, added: true}
 	}
 }
 
-// GetAppsProvider returns a policyprovider.Provider that can be used to retrieve applications, as well as get and set policies
+// Evict removes the provider of an integration from the cache, so that it is opened again with the current key of
+// the integration when it is next used.
+func (b *ProviderBuilder) Evict(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.providerCache, id)
+}
+
+// GetAppsProvider returns a policyprovider.Provider that can be used to retrieve applications, as well as get and set policies.
+// A cached provider opened with another key is replaced, as the key of the integration has been changed since.
 func (b *ProviderBuilder) GetAppsProvider(id string, providerType string, key []byte) (policyprovider.Provider, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if b.providerCache == nil {
 		fmt.Print("... provider cache is nil! ")
 		return nil, nil
 	}
-	provider, ok := b.providerCache[id]
-	if ok {
-		return provider, nil
+	cached, ok := b.providerCache[id]
+	if ok && (cached.added || bytes.Equal(cached.key, key)) {
+		return instrumentedProvider{Provider: cached.provider, providerType: providerType}, nil
 	}
 
 	info := policyprovider.IntegrationInfo{
@@ -57,8 +89,59 @@ func (b *ProviderBuilder) GetAppsProvider(id string, providerType string, key []
 		return nil, fmt.Errorf("failed to GetOrchestrationProvider. no such provider found %s", providerType)
 	}
 
-	b.providerCache[id] = integration.GetProvider()
+	b.providerCache[id] = cachedProvider{provider: integration.GetProvider(), key: key}
+
+	return instrumentedProvider{Provider: integration.GetProvider(), providerType: providerType}, nil
+
+}
+
+// instrumentedProvider records the latency and errors of each call to a provider, and the policies of each application
+// it reads or writes. Each call is traced with a span, the child of the span in ctx.
+type instrumentedProvider struct {
+	policyprovider.Provider
+	providerType string
+	ctx          context.Context // set by ApplicationsService.GatherRecords, calls are traced as new traces when nil
+}
+
+func (p instrumentedProvider) Unwrap() policyprovider.Provider {
+	return p.Provider
+}
 
-	return integration.GetProvider(), nil
+func (p instrumentedProvider) start(operation string, attributes ...attribute.KeyValue) (trace.Span, time.Time) {
+	attributes = append(attributes, attribute.String("provider.type", p.providerType), attribute.String("provider.operation", operation))
+	_, span := tracesupport.Start(p.ctx, p.providerType+" "+operation, attributes...)
+	return span, time.Now()
+}
+
+func (p instrumentedProvider) DiscoverApplications(info policyprovider.IntegrationInfo) ([]policyprovider.ApplicationInfo, error) {
+	span, started := p.start(prometheussupport.OperationDiscover)
+	apps, err := p.Provider.DiscoverApplications(info)
+	prometheussupport.ObserveProviderCall(p.providerType, prometheussupport.OperationDiscover, started, err)
+	span.SetAttributes(attribute.Int("provider.applications", len(apps)))
+	tracesupport.End(span, err)
+	return apps, err
+}
 
+func (p instrumentedProvider) GetPolicyInfo(integration policyprovider.IntegrationInfo, application policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	span, started := p.start(prometheussupport.OperationGetPolicyInfo, attribute.String("application.object_id", application.ObjectID))
+	policies, err := p.Provider.GetPolicyInfo(integration, application)
+	prometheussupport.ObserveProviderCall(p.providerType, prometheussupport.OperationGetPolicyInfo, started, err)
+	if err == nil {
+		prometheussupport.ObservePolicies(p.providerType, application.ObjectID, len(policies))
+	}
+	span.SetAttributes(attribute.Int("provider.policies", len(policies)))
+	tracesupport.End(span, err)
+	return policies, err
+}
+
+func (p instrumentedProvider) SetPolicyInfo(integration policyprovider.IntegrationInfo, application policyprovider.ApplicationInfo, policies []hexapolicy.PolicyInfo) (int, error) {
+	span, started := p.start(prometheussupport.OperationSetPolicyInfo, attribute.String("application.object_id", application.ObjectID), attribute.Int("provider.policies", len(policies)))
+	status, err := p.Provider.SetPolicyInfo(integration, application, policies)
+	prometheussupport.ObserveProviderCall(p.providerType, prometheussupport.OperationSetPolicyInfo, started, err)
+	if err == nil {
+		prometheussupport.ObservePolicies(p.providerType, application.ObjectID, len(policies))
+	}
+	span.SetAttributes(attribute.Int("provider.status", status))
+	tracesupport.End(span, err)
+	return status, err
 }
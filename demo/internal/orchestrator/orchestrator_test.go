@@ -11,7 +11,10 @@ import (
 	"github.com/hexa-org/policy-mapper/pkg/healthsupport"
 	"github.com/hexa-org/policy-mapper/pkg/websupport"
 	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/authzsupport"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,7 +31,7 @@ func TestOrchestratorHandlers(t *testing.T) {
 
 	config, err := dataConfigGateway.NewIntegrationConfigData()
 	assert.NoError(t, err, "Error initializing config")
-	handlers := orchestrator.LoadHandlers(config, nil)
+	handlers := orchestrator.LoadHandlers(config, nil, nil)
 	server := websupport.Create(listener.Addr().String(), handlers, websupport.Options{})
 
 	go websupport.Start(server, listener)
@@ -43,3 +46,31 @@ func TestOrchestratorHandlers(t *testing.T) {
 
 	_ = os.RemoveAll(tempDir)
 }
+
+func TestOrchestratorHandlers_authorizedByPolicy(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "authz.json")
+	_ = os.WriteFile(policyFile, []byte(`{"policies": [
+  {"meta": {"version": "0.7"}, "subjects": ["user:clientId"], "actions": ["http:GET"], "object": "integrations"},
+  {"meta": {"version": "0.7"}, "subjects": ["user:clientId"], "actions": ["http:GET"], "object": "applications/{id}",
+   "condition": {"Rule": "resource.integration eq \"50e00619-9f15-4e85-a7e9-f26d87ea12e7\""}}
+]}`), 0o600)
+	t.Setenv(authzsupport.EnvAuthzPolicyFile, policyFile)
+
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		status := func(method string, path string) int {
+			req, _ := http.NewRequest(method, fmt.Sprintf("http://%s%s", data.server.Addr, path), nil)
+			resp, err := data.oauthHttpClient.Do(req)
+			assert.NoError(t, err)
+			return resp.StatusCode
+		}
+		assert.Equal(t, http.StatusOK, status(http.MethodGet, "/integrations"))
+		assert.Equal(t, http.StatusOK, status(http.MethodGet, "/applications/"+data.fromApp))
+		assert.Equal(t, http.StatusForbidden, status(http.MethodGet, "/applications/"+data.toAppDifferent), "the application is in another integration")
+		assert.Equal(t, http.StatusForbidden, status(http.MethodDelete, "/integrations/50e00619-9f15-4e85-a7e9-f26d87ea12e7"), "no policy permits deleting")
+
+		entries, _ := data.auditLog.Find(auditsupport.Filter{Action: orchestrator.AuditIntegrationDelete})
+		assert.Len(t, entries, 1)
+		assert.Equal(t, auditsupport.OutcomeFailure, entries[0].Outcome)
+		assert.Len(t, data.Data.Find(), 3)
+	})
+}
@@ -0,0 +1,74 @@
+package orchestrator
+
+import (
+	"slices"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+type PolicyDiff struct {
+	Added   []hexapolicy.PolicyInfo `json:"added"`
+	Removed []hexapolicy.PolicyInfo `json:"removed"`
+	Changed []PolicyChange          `json:"changed"`
+}
+
+type PolicyChange struct {
+	PolicyId    string                `json:"policy_id"`
+	Differences []string              `json:"differences"`
+	Before      hexapolicy.PolicyInfo `json:"before"`
+	After       hexapolicy.PolicyInfo `json:"after"`
+}
+
+func (d PolicyDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffPolicies compares the current policies of an application with a desired set. Policies with the same content
+// are considered unchanged regardless of their meta information. Remaining policies sharing a policy id are reported
+// as changed, everything else is either added or removed.
+func DiffPolicies(current, desired []hexapolicy.PolicyInfo) PolicyDiff {
+	diff := PolicyDiff{
+		Added:   make([]hexapolicy.PolicyInfo, 0),
+		Removed: make([]hexapolicy.PolicyInfo, 0),
+		Changed: make([]PolicyChange, 0),
+	}
+
+	remaining := make([]hexapolicy.PolicyInfo, len(current))
+	copy(remaining, current)
+	unmatched := make([]hexapolicy.PolicyInfo, 0)
+
+	for _, policy := range desired {
+		found := slices.IndexFunc(remaining, func(existing hexapolicy.PolicyInfo) bool {
+			return existing.Equals(policy)
+		})
+		if found < 0 {
+			unmatched = append(unmatched, policy)
+			continue
+		}
+		remaining = slices.Delete(remaining, found, found+1)
+	}
+
+	for _, policy := range unmatched {
+		found := -1
+		if policy.Meta.PolicyId != nil {
+			found = slices.IndexFunc(remaining, func(existing hexapolicy.PolicyInfo) bool {
+				return existing.Meta.PolicyId != nil && *existing.Meta.PolicyId == *policy.Meta.PolicyId
+			})
+		}
+		if found < 0 {
+			diff.Added = append(diff.Added, policy)
+			continue
+		}
+		before := remaining[found]
+		diff.Changed = append(diff.Changed, PolicyChange{
+			PolicyId:    *policy.Meta.PolicyId,
+			Differences: policy.Compare(before),
+			Before:      before,
+			After:       policy,
+		})
+		remaining = slices.Delete(remaining, found, found+1)
+	}
+
+	diff.Removed = append(diff.Removed, remaining...)
+	return diff
+}
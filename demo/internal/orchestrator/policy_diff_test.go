@@ -0,0 +1,49 @@
+package orchestrator_test
+
+import (
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	policyId := "aPolicyId"
+	current := []hexapolicy.PolicyInfo{
+		{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: hexapolicy.SubjectInfo{"user:aUser"}, Object: "anId"},
+		{Meta: hexapolicy.MetaInfo{Version: "aVersion", PolicyId: &policyId}, Actions: []hexapolicy.ActionInfo{"anotherAction"}, Subjects: hexapolicy.SubjectInfo{"user:anotherUser"}, Object: "anId"},
+		{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"oldAction"}, Subjects: hexapolicy.SubjectInfo{"user:oldUser"}, Object: "anId"},
+	}
+	desired := []hexapolicy.PolicyInfo{
+		{Meta: hexapolicy.MetaInfo{Version: "anotherVersion"}, Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: hexapolicy.SubjectInfo{"user:aUser"}, Object: "anId"},
+		{Meta: hexapolicy.MetaInfo{Version: "aVersion", PolicyId: &policyId}, Actions: []hexapolicy.ActionInfo{"anotherAction"}, Subjects: hexapolicy.SubjectInfo{"user:yetAnotherUser"}, Object: "anId"},
+		{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"newAction"}, Subjects: hexapolicy.SubjectInfo{"user:newUser"}, Object: "anId"},
+	}
+
+	diff := orchestrator.DiffPolicies(current, desired)
+	assert.False(t, diff.IsEmpty())
+
+	assert.Len(t, diff.Added, 1)
+	assert.Equal(t, "newAction", diff.Added[0].Actions[0].String())
+
+	assert.Len(t, diff.Removed, 1)
+	assert.Equal(t, "oldAction", diff.Removed[0].Actions[0].String())
+
+	assert.Len(t, diff.Changed, 1)
+	assert.Equal(t, policyId, diff.Changed[0].PolicyId)
+	assert.Equal(t, []string{hexapolicy.CompareDifSubject}, diff.Changed[0].Differences)
+	assert.Equal(t, "user:anotherUser", diff.Changed[0].Before.Subjects[0])
+	assert.Equal(t, "user:yetAnotherUser", diff.Changed[0].After.Subjects[0])
+}
+
+func TestDiffPolicies_noChanges(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: hexapolicy.SubjectInfo{"user:aUser"}, Object: "anId"},
+		{Meta: hexapolicy.MetaInfo{Version: "aVersion"}, Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: hexapolicy.SubjectInfo{"user:aUser"}, Object: "anId"},
+	}
+
+	assert.True(t, orchestrator.DiffPolicies(policies, policies).IsEmpty())
+	assert.Len(t, orchestrator.DiffPolicies(policies, policies[:1]).Removed, 1)
+	assert.Len(t, orchestrator.DiffPolicies(nil, policies).Added, 2)
+}
@@ -0,0 +1,145 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	log "golang.org/x/exp/slog"
+)
+
+// currentVersion may be given in place of a version number to diff against the policies the application has now.
+const currentVersion = "current"
+
+type PolicyVersions struct {
+	Versions []PolicyVersion `json:"versions"`
+}
+
+// PolicyVersion is the policies an application had before a write, Policies is omitted when versions are listed.
+type PolicyVersion struct {
+	Version   int                     `json:"version"`
+	Author    string                  `json:"author,omitempty"`
+	Reason    string                  `json:"reason,omitempty"`
+	CreatedAt time.Time               `json:"created_at"`
+	Policies  []hexapolicy.PolicyInfo `json:"policies,omitempty"`
+}
+
+type PolicyVersionsHandler struct {
+	applicationsService ApplicationsService
+}
+
+func (handler PolicyVersionsHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := handler.applicationsService.PolicyVersionsGateway.Find(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := PolicyVersions{Versions: make([]PolicyVersion, 0, len(records))}
+	for _, record := range records {
+		list.Versions = append(list.Versions, PolicyVersion{Version: record.Version, Author: record.Author, Reason: record.Reason, CreatedAt: record.CreatedAt})
+	}
+	writeVersions(w, http.StatusOK, list)
+}
+
+func (handler PolicyVersionsHandler) Show(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "version must be a number", http.StatusBadRequest)
+		return
+	}
+	record, err := handler.applicationsService.PolicyVersionsGateway.FindByVersion(mux.Vars(r)["id"], version)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	writeVersions(w, http.StatusOK, PolicyVersion{
+		Version:   record.Version,
+		Author:    record.Author,
+		Reason:    record.Reason,
+		CreatedAt: record.CreatedAt,
+		Policies:  record.Policies,
+	})
+}
+
+// Diff returns the changes from one version to another. Either may be current, the policies the application has
+// now.
+func (handler PolicyVersionsHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	handler.applicationsService = handler.applicationsService.WithContext(r.Context())
+	identifier := mux.Vars(r)["id"]
+	from, err := handler.policies(identifier, mux.Vars(r)["from"])
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	to, err := handler.policies(identifier, mux.Vars(r)["to"])
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	writeVersions(w, http.StatusOK, DiffPolicies(from, to))
+}
+
+// Rollback writes the policies of an older version back to the application through its provider.
+func (handler PolicyVersionsHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "version must be a number", http.StatusBadRequest)
+		return
+	}
+	change := Change{Author: author(r), Reason: r.URL.Query().Get("reason")}
+	if err = handler.applicationsService.WithContext(r.Context()).Rollback(mux.Vars(r)["id"], version, change); err != nil {
+		log.Error("Rollback", "application", mux.Vars(r)["id"], "version", version, "error", err)
+		writeVersionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (handler PolicyVersionsHandler) policies(applicationId string, version string) ([]hexapolicy.PolicyInfo, error) {
+	if version == currentVersion {
+		application, integration, provider, err := handler.applicationsService.GatherRecords(applicationId)
+		if err != nil {
+			return nil, err
+		}
+		return provider.GetPolicyInfo(integration, application)
+	}
+	number, err := strconv.Atoi(version)
+	if err != nil {
+		return nil, dataConfigGateway.ErrPolicyVersionNotFound
+	}
+	record, err := handler.applicationsService.PolicyVersionsGateway.FindByVersion(applicationId, number)
+	if err != nil {
+		return nil, err
+	}
+	return record.Policies, nil
+}
+
+// author identifies the caller from the claims the JWT handler copies into the request headers. When authentication
+// is disabled the headers are whatever the caller sent.
+func author(r *http.Request) string {
+	if email := r.Header.Get(oauth2support.Header_Email); email != "" {
+		return email
+	}
+	return r.Header.Get(oauth2support.Header_Subj)
+}
+
+func writeVersions(w http.ResponseWriter, status int, resource any) {
+	data, _ := json.Marshal(resource)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeVersionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dataConfigGateway.ErrPolicyVersionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
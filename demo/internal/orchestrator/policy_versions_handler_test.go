@@ -0,0 +1,85 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyVersions(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		policiesUrl := fmt.Sprintf("http://%s/applications/%s/policies", data.server.Addr, data.toApp)
+		listVersions := func() []orchestrator.PolicyVersion {
+			resp, err := data.oauthHttpClient.Get(policiesUrl + "/versions")
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var list orchestrator.PolicyVersions
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+			return list.Versions
+		}
+		assert.Empty(t, listVersions())
+
+		marshal, _ := json.Marshal(hexapolicy.Policies{Policies: []hexapolicy.PolicyInfo{
+			{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"user:anEmail"}, Object: "aResourceId"},
+		}})
+		resp, err := data.oauthHttpClient.Post(policiesUrl+"?reason=aReason", "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		marshal, _ = json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err = data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		versions := listVersions()
+		assert.Len(t, versions, 2)
+		assert.Equal(t, 1, versions[0].Version)
+		assert.Equal(t, "aReason", versions[0].Reason)
+		assert.Empty(t, versions[0].Policies, "policies are not listed")
+		assert.Equal(t, "orchestration from "+data.fromApp, versions[1].Reason)
+
+		resp, err = data.oauthHttpClient.Get(policiesUrl + "/versions/1")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var version orchestrator.PolicyVersion
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&version))
+		assert.Len(t, version.Policies, 2, "the policies the noop provider had before the first write")
+
+		resp, err = data.oauthHttpClient.Get(policiesUrl + "/versions/1/diff/current")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var diff orchestrator.PolicyDiff
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&diff))
+		assert.True(t, diff.IsEmpty())
+
+		resp, err = data.oauthHttpClient.Post(policiesUrl+"/rollback/1", "application/json", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		versions = listVersions()
+		assert.Len(t, versions, 3)
+		assert.Equal(t, "rollback to version 1", versions[2].Reason)
+
+		for url, status := range map[string]int{
+			policiesUrl + "/versions/9":        http.StatusNotFound,
+			policiesUrl + "/versions/aVersion": http.StatusBadRequest,
+			policiesUrl + "/versions/1/diff/9": http.StatusNotFound,
+			policiesUrl + "/versions/x/diff/1": http.StatusNotFound,
+		} {
+			resp, err = data.oauthHttpClient.Get(url)
+			assert.NoError(t, err)
+			assert.Equal(t, status, resp.StatusCode, url)
+		}
+
+		resp, err = data.oauthHttpClient.Post(policiesUrl+"/rollback/9", "application/json", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Len(t, listVersions(), 3)
+	})
+}
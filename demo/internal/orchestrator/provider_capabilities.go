@@ -0,0 +1,257 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+)
+
+// SubjectKind is the prefix of an IDQL subject, e.g. user:alice@example.com is a SubjectUser. Subjects without a
+// prefix are treated as users.
+type SubjectKind string
+
+const (
+	SubjectUser    SubjectKind = "user"
+	SubjectGroup   SubjectKind = "group"
+	SubjectDomain  SubjectKind = "domain"
+	SubjectRole    SubjectKind = "role"
+	SubjectService SubjectKind = "serviceaccount"
+	SubjectAny     SubjectKind = "any" // any and anyAuthenticated
+)
+
+// ActionVocabulary describes which action uris a provider accepts.
+type ActionVocabulary int
+
+const (
+	// ActionsOpen providers accept any action uri, actions are copied as is.
+	ActionsOpen ActionVocabulary = iota
+	// ActionsTarget providers only understand the actions already used by the target application (e.g. IAP roles or
+	// Azure app roles), actions from another provider must be translated with an action mapping.
+	ActionsTarget
+)
+
+// Capabilities declares what a provider type can express. The orchestration engine uses the target's declaration to
+// transform or reject policies read from a different provider type.
+type Capabilities struct {
+	SubjectKinds      []SubjectKind // nil accepts any kind of subject
+	Actions           ActionVocabulary
+	MultipleResources bool // false when all policies of an application share a single resource
+	Conditions        bool
+}
+
+// CapabilityDeclarer may be implemented by a provider to declare its capabilities directly.
+type CapabilityDeclarer interface {
+	Capabilities() Capabilities
+}
+
+var (
+	capabilitiesMutex    sync.RWMutex
+	providerCapabilities = map[string]Capabilities{
+		sdk.ProviderTypeGoogleCloudIAP: {
+			SubjectKinds: []SubjectKind{SubjectUser, SubjectGroup, SubjectDomain, SubjectService},
+			Actions:      ActionsTarget,
+		},
+		sdk.ProviderTypeAzure: {
+			SubjectKinds: []SubjectKind{SubjectUser},
+			Actions:      ActionsTarget,
+		},
+		sdk.ProviderTypeCognito: {
+			SubjectKinds: []SubjectKind{SubjectUser},
+			Actions:      ActionsTarget,
+		},
+		sdk.ProviderTypeAwsApiGW: {
+			SubjectKinds:      []SubjectKind{SubjectUser},
+			Actions:           ActionsTarget,
+			MultipleResources: true,
+		},
+		sdk.ProviderTypeAvp: {
+			SubjectKinds:      []SubjectKind{SubjectUser, SubjectGroup, SubjectAny},
+			Actions:           ActionsOpen,
+			MultipleResources: true,
+			Conditions:        true,
+		},
+		sdk.ProviderTypeOpa: {
+			Actions:           ActionsOpen,
+			MultipleResources: true,
+			Conditions:        true,
+		},
+		sdk.ProviderTypeMock: {
+			Actions:           ActionsOpen,
+			MultipleResources: true,
+			Conditions:        true,
+		},
+	}
+	// legacyProviderTypes are provider names used before the sdk provider types.
+	legacyProviderTypes = map[string]string{
+		sdk.ProviderTypeGoogleCloudLegacy: sdk.ProviderTypeGoogleCloudIAP,
+		"amazon":                          sdk.ProviderTypeCognito,
+		"open_policy_agent":               sdk.ProviderTypeOpa,
+	}
+)
+
+// sameTypeCapabilities is used when orchestrating between two providers of the same type that have no declaration.
+// It retains the target's resource and accepts everything else, as orchestration did before capabilities existed.
+var sameTypeCapabilities = Capabilities{Actions: ActionsOpen, Conditions: true}
+
+// RegisterCapabilities declares (or replaces) the capabilities of a provider type.
+func RegisterCapabilities(providerType string, capabilities Capabilities) {
+	capabilitiesMutex.Lock()
+	defer capabilitiesMutex.Unlock()
+	providerCapabilities[strings.ToLower(providerType)] = capabilities
+}
+
+// CapabilitiesOf returns the declared capabilities of a provider, and false when none are declared.
+func CapabilitiesOf(provider policyprovider.Provider) (Capabilities, bool) {
+	if instrumented, ok := provider.(instrumentedProvider); ok {
+		provider = instrumented.Unwrap()
+	}
+	if declarer, ok := provider.(CapabilityDeclarer); ok {
+		return declarer.Capabilities(), true
+	}
+	capabilitiesMutex.RLock()
+	defer capabilitiesMutex.RUnlock()
+	providerType := strings.ToLower(provider.Name())
+	if mapped, ok := legacyProviderTypes[providerType]; ok {
+		providerType = mapped
+	}
+	capabilities, ok := providerCapabilities[providerType]
+	return capabilities, ok
+}
+
+func SubjectKindOf(subject string) SubjectKind {
+	prefix, _, found := strings.Cut(subject, ":")
+	if !found {
+		switch strings.ToLower(subject) {
+		case "any", "anyauthenticated":
+			return SubjectAny
+		}
+		return SubjectUser
+	}
+	return SubjectKind(strings.ToLower(prefix))
+}
+
+func (c Capabilities) SupportsSubject(subject string) bool {
+	return c.SubjectKinds == nil || slices.Contains(c.SubjectKinds, SubjectKindOf(subject))
+}
+
+// Translation converts the policies of one provider into policies another provider can hold.
+type Translation struct {
+	FromType       string
+	ToType         string
+	To             Capabilities
+	ActionMapping  map[string][]string // source action uri to target action uris, nil when none is configured
+	ResourceRules  []ResourceRule
+	SubjectMapping *SubjectMapping // nil when subjects are shared by both providers
+}
+
+// Translated holds the policies produced by a Translation, and what could not be translated.
+type Translated struct {
+	Policies         []hexapolicy.PolicyInfo
+	UnmappedActions  []UnmappedAction
+	UnmappedSubjects []UnmappedSubject
+}
+
+// NewTranslation looks up the capabilities needed to orchestrate between two providers. Orchestration between
+// different provider types requires the target to declare its capabilities.
+func NewTranslation(fromProvider, toProvider policyprovider.Provider) (Translation, error) {
+	translation := Translation{FromType: fromProvider.Name(), ToType: toProvider.Name()}
+	to, declared := CapabilitiesOf(toProvider)
+	if !declared {
+		if !translation.sameType() {
+			return Translation{}, fmt.Errorf("orchestration from %s to %s is not supported, no capabilities are declared for %s", translation.FromType, translation.ToType, translation.ToType)
+		}
+		to = sameTypeCapabilities
+	}
+	translation.To = to
+	return translation, nil
+}
+
+func (t Translation) sameType() bool {
+	return t.FromType == t.ToType
+}
+
+// Apply checks each policy against the target capabilities and transforms it to the target's resource and action
+// vocabulary where needed. targetPolicies is only called when the target's current policies are needed.
+//
+// Actions are translated with the ActionMapping when one is configured, actions without an entry are reported as
+// unmapped. Targets with their own action vocabulary are rejected when no mapping is configured.
+// Objects are translated with the ResourceRules when given, otherwise single resource targets keep their resource.
+// Subjects are translated with the SubjectMapping when given, subjects the target cannot hold are reported rather
+// than failing the translation. A policy left without any subject or target object fails it, since the target's
+// policies are replaced as a whole.
+func (t Translation) Apply(policies []hexapolicy.PolicyInfo, targetPolicies func() ([]hexapolicy.PolicyInfo, error)) (Translated, error) {
+	for _, policy := range policies {
+		if policy.Condition != nil && !t.To.Conditions {
+			return Translated{}, fmt.Errorf("%s does not support policy conditions, found in policy %s", t.ToType, policyLabel(policy))
+		}
+	}
+
+	translated := Translated{}
+	var err error
+	if translated.Policies, translated.UnmappedSubjects, err = mapSubjects(policies, t.SubjectMapping, t.To, t.ToType); err != nil {
+		return Translated{}, err
+	}
+
+	switch {
+	case t.ActionMapping != nil:
+		if translated.Policies, translated.UnmappedActions, err = mapActions(translated.Policies, t.ActionMapping, t.ToType); err != nil {
+			return Translated{}, err
+		}
+	case t.To.Actions == ActionsTarget && !t.sameType():
+		return Translated{}, fmt.Errorf("orchestration from %s to %s requires an action mapping, none is configured for the applications or their integrations", t.FromType, t.ToType)
+	}
+
+	switch {
+	case len(t.ResourceRules) > 0:
+		if translated.Policies, err = mapResources(translated.Policies, t.ResourceRules, t.ToType); err != nil {
+			return Translated{}, err
+		}
+	case !t.To.MultipleResources:
+		toPolicies, err := targetPolicies()
+		if err != nil {
+			return Translated{}, err
+		}
+		if translated.Policies, err = retainResource(translated.Policies, toPolicies); err != nil {
+			return Translated{}, err
+		}
+	}
+	return translated, nil
+}
+
+func policyLabel(policy hexapolicy.PolicyInfo) string {
+	if policy.Meta.PolicyId != nil {
+		return *policy.Meta.PolicyId
+	}
+	return policy.Object.String()
+}
+
+func retainResource(fromPolicies, toPolicies []hexapolicy.PolicyInfo) ([]hexapolicy.PolicyInfo, error) {
+	var firstResourceId string
+
+	resourceIds := make([]string, 0)
+	for _, policy := range toPolicies {
+		if firstResourceId == "" {
+			firstResourceId = policy.Object.String()
+		}
+		resourceIds = append(resourceIds, policy.Object.String())
+	}
+
+	for _, foundResourceId := range resourceIds {
+		if firstResourceId != foundResourceId {
+			return []hexapolicy.PolicyInfo{}, errors.New("sorry, found more than one resource id within policies")
+		}
+	}
+
+	modified := make([]hexapolicy.PolicyInfo, 0)
+	for _, policy := range fromPolicies {
+		policy.Object = hexapolicy.ObjectInfo(firstResourceId)
+		modified = append(modified, policy)
+	}
+	return modified, nil
+}
@@ -0,0 +1,198 @@
+package orchestrator_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	orchestratorNoopProvider "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/stretchr/testify/assert"
+)
+
+type declaringProvider struct {
+	orchestratorNoopProvider.NoopProvider
+	capabilities orchestrator.Capabilities
+}
+
+func (d *declaringProvider) Capabilities() orchestrator.Capabilities {
+	return d.capabilities
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	iap, ok := orchestrator.CapabilitiesOf(&orchestratorNoopProvider.NoopProvider{OverrideName: sdk.ProviderTypeGoogleCloudIAP})
+	assert.True(t, ok)
+	assert.Equal(t, orchestrator.ActionsTarget, iap.Actions)
+
+	legacy, ok := orchestrator.CapabilitiesOf(&orchestratorNoopProvider.NoopProvider{OverrideName: "google_cloud"})
+	assert.True(t, ok)
+	assert.Equal(t, iap, legacy)
+
+	_, ok = orchestrator.CapabilitiesOf(&orchestratorNoopProvider.NoopProvider{})
+	assert.False(t, ok, "noop declares nothing")
+
+	declared := orchestrator.Capabilities{MultipleResources: true}
+	capabilities, ok := orchestrator.CapabilitiesOf(&declaringProvider{capabilities: declared})
+	assert.True(t, ok)
+	assert.Equal(t, declared, capabilities)
+
+	orchestrator.RegisterCapabilities("aNewProvider", declared)
+	capabilities, ok = orchestrator.CapabilitiesOf(&orchestratorNoopProvider.NoopProvider{OverrideName: "aNewProvider"})
+	assert.True(t, ok)
+	assert.Equal(t, declared, capabilities)
+}
+
+func TestSubjectKindOf(t *testing.T) {
+	assert.Equal(t, orchestrator.SubjectUser, orchestrator.SubjectKindOf("user:alice@example.com"))
+	assert.Equal(t, orchestrator.SubjectUser, orchestrator.SubjectKindOf("alice@example.com"))
+	assert.Equal(t, orchestrator.SubjectGroup, orchestrator.SubjectKindOf("Group:admins"))
+	assert.Equal(t, orchestrator.SubjectDomain, orchestrator.SubjectKindOf("domain:example.com"))
+	assert.Equal(t, orchestrator.SubjectAny, orchestrator.SubjectKindOf("anyAuthenticated"))
+}
+
+func TestNewTranslation(t *testing.T) {
+	_, err := orchestrator.NewTranslation(&orchestratorNoopProvider.NoopProvider{OverrideName: sdk.ProviderTypeOpa}, &orchestratorNoopProvider.NoopProvider{})
+	assert.EqualError(t, err, "orchestration from opa to noop is not supported, no capabilities are declared for noop")
+
+	translation, err := orchestrator.NewTranslation(&orchestratorNoopProvider.NoopProvider{}, &orchestratorNoopProvider.NoopProvider{})
+	assert.NoError(t, err, "same provider types need no declaration")
+	assert.False(t, translation.To.MultipleResources)
+
+	translation, err = orchestrator.NewTranslation(&orchestratorNoopProvider.NoopProvider{}, &orchestratorNoopProvider.NoopProvider{OverrideName: sdk.ProviderTypeAvp})
+	assert.NoError(t, err, "only the target needs a declaration")
+	assert.Equal(t, sdk.ProviderTypeAvp, translation.ToType)
+}
+
+func translationFor(t *testing.T, from, to string) orchestrator.Translation {
+	translation, err := orchestrator.NewTranslation(&orchestratorNoopProvider.NoopProvider{OverrideName: from}, &orchestratorNoopProvider.NoopProvider{OverrideName: to})
+	assert.NoError(t, err)
+	return translation
+}
+
+func noTargetPolicies(t *testing.T) func() ([]hexapolicy.PolicyInfo, error) {
+	return func() ([]hexapolicy.PolicyInfo, error) {
+		t.Error("target policies should not be needed")
+		return nil, errors.New("unexpected")
+	}
+}
+
+func TestTranslation_Apply_openTargetsKeepPolicies(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Meta: hexapolicy.MetaInfo{Version: "0.7"}, Actions: []hexapolicy.ActionInfo{"GET"}, Subjects: []string{"group:admins"}, Object: "/reports",
+			Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: "allow"}},
+		{Meta: hexapolicy.MetaInfo{Version: "0.7"}, Actions: []hexapolicy.ActionInfo{"POST"}, Subjects: []string{"user:alice"}, Object: "/orders"},
+	}
+
+	translated, err := translationFor(t, sdk.ProviderTypeOpa, sdk.ProviderTypeAvp).Apply(policies, noTargetPolicies(t))
+	assert.NoError(t, err)
+	assert.Equal(t, policies, translated.Policies)
+
+	translated, err = translationFor(t, sdk.ProviderTypeAvp, sdk.ProviderTypeOpa).Apply(policies, noTargetPolicies(t))
+	assert.NoError(t, err)
+	assert.Equal(t, policies, translated.Policies)
+}
+
+func TestTranslation_Apply_rejectsConditions(t *testing.T) {
+	policyId := "aPolicy"
+	conditionPolicy := []hexapolicy.PolicyInfo{{Meta: hexapolicy.MetaInfo{PolicyId: &policyId}, Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"user:alice"}, Object: "anId",
+		Condition: &conditions.ConditionInfo{Rule: "req.ip sw 127", Action: "allow"}}}
+	_, err := translationFor(t, sdk.ProviderTypeOpa, sdk.ProviderTypeCognito).Apply(conditionPolicy, noTargetPolicies(t))
+	assert.EqualError(t, err, "cognito does not support policy conditions, found in policy aPolicy")
+}
+
+func TestTranslation_Apply_reportsUnsupportedSubjects(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"domain:example.com", "user:bob"}, Object: "/reports"},
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"any", "user:alice"}, Object: "/orders"},
+	}
+	translated, err := translationFor(t, sdk.ProviderTypeGoogleCloudIAP, sdk.ProviderTypeAvp).Apply(policies, noTargetPolicies(t))
+	assert.NoError(t, err)
+	assert.Len(t, translated.Policies, 2)
+	assert.Equal(t, []string{"user:bob"}, []string(translated.Policies[0].Subjects))
+	assert.Equal(t, []string{"any", "user:alice"}, []string(translated.Policies[1].Subjects))
+	assert.Equal(t, []orchestrator.UnmappedSubject{
+		{Subject: "domain:example.com", Reason: "avp does not support domain subjects", Policies: []string{"/reports"}},
+	}, translated.UnmappedSubjects)
+
+	policies[0].Subjects = []string{"domain:example.com"}
+	_, err = translationFor(t, sdk.ProviderTypeGoogleCloudIAP, sdk.ProviderTypeAvp).Apply(policies, noTargetPolicies(t))
+	assert.EqualError(t, err, "policy /reports would be removed from avp, none of its subjects can be written: domain:example.com (avp does not support domain subjects)")
+}
+
+func TestTranslation_Apply_retainsTargetResource(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"cognito:admins"}, Subjects: []string{"user:alice"}, Object: "aUserPool"},
+		{Actions: []hexapolicy.ActionInfo{"cognito:readers"}, Subjects: []string{"user:bob"}, Object: "aUserPool"},
+	}
+	target := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, Subjects: []string{"user:carol"}, Object: "aBackendService"},
+	}
+	fetched := 0
+	targetPolicies := func() ([]hexapolicy.PolicyInfo, error) {
+		fetched++
+		return target, nil
+	}
+
+	translation := translationFor(t, sdk.ProviderTypeCognito, sdk.ProviderTypeGoogleCloudIAP)
+	translation.ActionMapping = map[string][]string{
+		"cognito:admins":  {"gcp:roles/iap.httpsResourceAccessor"},
+		"cognito:readers": {"gcp:roles/iap.httpsResourceAccessor"},
+	}
+	translated, err := translation.Apply(policies, targetPolicies)
+	assert.NoError(t, err)
+	assert.Len(t, translated.Policies, 2)
+	for i, policy := range translated.Policies {
+		assert.Equal(t, "aBackendService", policy.Object.String())
+		assert.Equal(t, []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, policy.Actions)
+		assert.Equal(t, policies[i].Subjects, policy.Subjects)
+	}
+	assert.Equal(t, "aUserPool", policies[0].Object.String(), "source policies are not modified")
+	assert.Equal(t, 1, fetched)
+
+	translated, err = translationFor(t, sdk.ProviderTypeCognito, sdk.ProviderTypeCognito).Apply(policies, targetPolicies)
+	assert.NoError(t, err)
+	assert.Equal(t, []hexapolicy.ActionInfo{"cognito:admins"}, translated.Policies[0].Actions, "same provider types keep their actions")
+}
+
+func TestApplicationsService_Apply_acrossDeclaredProviders(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	providers := make(map[string]policyprovider.Provider)
+	for _, providerType := range []string{sdk.ProviderTypeOpa, sdk.ProviderTypeAvp, sdk.ProviderTypeAzure} {
+		_, err = data.Create(providerType, "noop", []byte("aKey"))
+		assert.NoError(t, err)
+		data.Integrations[providerType].Apps = map[string]policyprovider.ApplicationInfo{
+			providerType + "App": {ObjectID: providerType + "Object", Name: providerType},
+		}
+		providers[providerType] = &orchestratorNoopProvider.NoopProvider{OverrideName: providerType}
+	}
+
+	pb := orchestrator.NewProviderBuilder()
+	pb.AddProviders(providers)
+	mappings := data.GetActionMappingDataGateway()
+	service := orchestrator.ApplicationsService{ApplicationsGateway: data.GetApplicationDataGateway(), IntegrationsGateway: data, ActionMappingsGateway: mappings, ProviderBuilder: pb}
+
+	assert.NoError(t, service.Apply(orchestrator.Orchestration{From: "opaApp", To: "avpApp"}))
+	assert.NoError(t, service.Apply(orchestrator.Orchestration{From: "avpApp", To: "opaApp"}))
+	assert.ErrorContains(t, service.Apply(orchestrator.Orchestration{From: "opaApp", To: "azureApp"}), "requires an action mapping", "azure has its own action vocabulary")
+
+	roles := map[string][]string{"anAction": {"aRole"}, "anotherAction": {"aRole"}}
+	assert.NoError(t, mappings.Save(dataConfigGateway.ActionMappingRecord{From: sdk.ProviderTypeOpa, To: sdk.ProviderTypeAzure, Actions: roles}))
+	assert.NoError(t, mappings.Save(dataConfigGateway.ActionMappingRecord{From: sdk.ProviderTypeAvp, To: sdk.ProviderTypeAzure, Actions: roles}))
+	assert.NoError(t, service.Apply(orchestrator.Orchestration{From: "opaApp", To: "azureApp"}))
+
+	result, err := service.Preview(orchestrator.Orchestration{From: "avpApp", To: "azureApp"})
+	assert.NoError(t, err)
+	for _, policy := range result.Policies {
+		assert.Equal(t, []hexapolicy.ActionInfo{"aRole"}, policy.Actions)
+	}
+}
@@ -0,0 +1,103 @@
+package orchestrator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+const (
+	ResourceMatchExact   = "exact"
+	ResourceMatchPrefix  = "prefix"
+	ResourceMatchPattern = "pattern"
+)
+
+// ResourceRule maps source object ids to target object ids. An exact rule maps Source to Target. A prefix rule
+// replaces the Source prefix of an object id with Target, e.g. /api/ to arn:aws:execute-api:...:GET/api/. A pattern
+// rule matches the whole object id with the regular expression Source and expands Target, e.g. ^/users/(.*)$ to
+// User::"$1".
+type ResourceRule struct {
+	Match  string `json:"match"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+type patternRule struct {
+	pattern *regexp.Regexp
+	target  string
+}
+
+// resourceMapper applies the rules of an orchestration. Exact rules take precedence over prefix rules, the longest
+// prefix wins, and patterns are tried in the order they are given.
+type resourceMapper struct {
+	exact    map[string]string
+	prefixes []ResourceRule
+	patterns []patternRule
+}
+
+func newResourceMapper(rules []ResourceRule) (resourceMapper, error) {
+	mapper := resourceMapper{exact: make(map[string]string)}
+	for _, rule := range rules {
+		if rule.Source == "" {
+			return resourceMapper{}, fmt.Errorf("resource rule to %s has no source", rule.Target)
+		}
+		switch strings.ToLower(rule.Match) {
+		case ResourceMatchExact, "":
+			mapper.exact[rule.Source] = rule.Target
+		case ResourceMatchPrefix:
+			mapper.prefixes = append(mapper.prefixes, rule)
+		case ResourceMatchPattern:
+			pattern, err := regexp.Compile("^(?:" + rule.Source + ")$")
+			if err != nil {
+				return resourceMapper{}, fmt.Errorf("invalid resource pattern %s: %w", rule.Source, err)
+			}
+			mapper.patterns = append(mapper.patterns, patternRule{pattern: pattern, target: rule.Target})
+		default:
+			return resourceMapper{}, fmt.Errorf("unknown resource match %s, expected exact, prefix or pattern", rule.Match)
+		}
+	}
+	sort.SliceStable(mapper.prefixes, func(i, j int) bool {
+		return len(mapper.prefixes[i].Source) > len(mapper.prefixes[j].Source)
+	})
+	return mapper, nil
+}
+
+func (m resourceMapper) target(source string) (string, bool) {
+	if target, found := m.exact[source]; found {
+		return target, true
+	}
+	for _, rule := range m.prefixes {
+		if rest, found := strings.CutPrefix(source, rule.Source); found {
+			return rule.Target + rest, true
+		}
+	}
+	for _, rule := range m.patterns {
+		if match := rule.pattern.FindStringSubmatchIndex(source); match != nil {
+			return string(rule.pattern.ExpandString(nil, rule.target, source, match)), true
+		}
+	}
+	return "", false
+}
+
+// mapResources rewrites the object of each policy with the rules. A policy whose object no rule matches fails the
+// mapping, as leaving it out would remove it from the target.
+func mapResources(fromPolicies []hexapolicy.PolicyInfo, rules []ResourceRule, toType string) ([]hexapolicy.PolicyInfo, error) {
+	mapper, err := newResourceMapper(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := make([]hexapolicy.PolicyInfo, 0, len(fromPolicies))
+	for _, policy := range fromPolicies {
+		target, found := mapper.target(policy.Object.String())
+		if !found {
+			return nil, fmt.Errorf("policy %s would be removed from %s, no resource rule matches its object %s", policyLabel(policy), toType, policy.Object.String())
+		}
+		policy.Object = hexapolicy.ObjectInfo(target)
+		modified = append(modified, policy)
+	}
+	return modified, nil
+}
@@ -0,0 +1,124 @@
+package orchestrator_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	orchestratorNoopProvider "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/stretchr/testify/assert"
+)
+
+func objectsOf(policies []hexapolicy.PolicyInfo) []string {
+	objects := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		objects = append(objects, policy.Object.String())
+	}
+	return objects
+}
+
+func TestTranslation_Apply_mapsResources(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"http:GET"}, Subjects: []string{"user:alice"}, Object: "/reports"},
+		{Actions: []hexapolicy.ActionInfo{"http:GET"}, Subjects: []string{"user:alice"}, Object: "/api/orders"},
+		{Actions: []hexapolicy.ActionInfo{"http:GET"}, Subjects: []string{"user:alice"}, Object: "/api/v2/orders"},
+		{Actions: []hexapolicy.ActionInfo{"http:GET"}, Subjects: []string{"user:alice"}, Object: "/users/alice"},
+	}
+
+	translation := translationFor(t, sdk.ProviderTypeOpa, sdk.ProviderTypeAvp)
+	translation.ResourceRules = []orchestrator.ResourceRule{
+		{Match: orchestrator.ResourceMatchPattern, Source: "/users/(.*)", Target: `User::"$1"`},
+		{Match: orchestrator.ResourceMatchPrefix, Source: "/api/", Target: "Route::/"},
+		{Match: orchestrator.ResourceMatchPrefix, Source: "/api/v2/", Target: "RouteV2::/"},
+		{Match: orchestrator.ResourceMatchExact, Source: "/reports", Target: `Report::"all"`},
+		{Source: "/api/orders", Target: `Order::"all"`},
+	}
+	translated, err := translation.Apply(policies, noTargetPolicies(t))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`Report::"all"`, `Order::"all"`, "RouteV2::/orders", `User::"alice"`}, objectsOf(translated.Policies))
+	assert.Equal(t, "/reports", policies[0].Object.String(), "source policies are not modified")
+
+	unknown := append(policies, hexapolicy.PolicyInfo{Actions: []hexapolicy.ActionInfo{"http:GET"}, Subjects: []string{"user:alice"}, Object: "/unknown"})
+	_, err = translation.Apply(unknown, noTargetPolicies(t))
+	assert.EqualError(t, err, "policy /unknown would be removed from avp, no resource rule matches its object /unknown")
+}
+
+func TestTranslation_Apply_resourceRulesAllowManyTargetResources(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, Subjects: []string{"user:alice"}, Object: "aBackendService"},
+		{Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, Subjects: []string{"user:bob"}, Object: "anotherBackendService"},
+	}
+	target := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, Subjects: []string{"user:carol"}, Object: "aTargetService"},
+		{Actions: []hexapolicy.ActionInfo{"gcp:roles/iap.httpsResourceAccessor"}, Subjects: []string{"user:dan"}, Object: "anotherTargetService"},
+	}
+	targetPolicies := func() ([]hexapolicy.PolicyInfo, error) {
+		return target, nil
+	}
+
+	_, err := translationFor(t, sdk.ProviderTypeGoogleCloudIAP, sdk.ProviderTypeGoogleCloudIAP).Apply(policies, targetPolicies)
+	assert.EqualError(t, err, "sorry, found more than one resource id within policies")
+
+	translation := translationFor(t, sdk.ProviderTypeGoogleCloudIAP, sdk.ProviderTypeGoogleCloudIAP)
+	translation.ResourceRules = []orchestrator.ResourceRule{
+		{Match: orchestrator.ResourceMatchPattern, Source: "a(.*)BackendService", Target: "a${1}TargetService"},
+	}
+	translated, err := translation.Apply(policies, targetPolicies)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aTargetService", "anotherTargetService"}, objectsOf(translated.Policies))
+}
+
+func TestTranslation_Apply_invalidResourceRules(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{{Actions: []hexapolicy.ActionInfo{"http:GET"}, Subjects: []string{"user:alice"}, Object: "/reports"}}
+	translation := translationFor(t, sdk.ProviderTypeOpa, sdk.ProviderTypeAvp)
+
+	translation.ResourceRules = []orchestrator.ResourceRule{{Match: orchestrator.ResourceMatchPattern, Source: "(", Target: "aTarget"}}
+	_, err := translation.Apply(policies, noTargetPolicies(t))
+	assert.ErrorContains(t, err, "invalid resource pattern (")
+
+	translation.ResourceRules = []orchestrator.ResourceRule{{Match: "suffix", Source: "/reports", Target: "aTarget"}}
+	_, err = translation.Apply(policies, noTargetPolicies(t))
+	assert.EqualError(t, err, "unknown resource match suffix, expected exact, prefix or pattern")
+
+	translation.ResourceRules = []orchestrator.ResourceRule{{Match: orchestrator.ResourceMatchPrefix, Target: "aTarget"}}
+	_, err = translation.Apply(policies, noTargetPolicies(t))
+	assert.EqualError(t, err, "resource rule to aTarget has no source")
+}
+
+func TestApplicationsService_Preview_resourceRules(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	providers := make(map[string]policyprovider.Provider)
+	for _, providerType := range []string{sdk.ProviderTypeOpa, sdk.ProviderTypeAwsApiGW} {
+		_, err = data.Create(providerType, "noop", []byte("aKey"))
+		assert.NoError(t, err)
+		data.Integrations[providerType].Apps = map[string]policyprovider.ApplicationInfo{
+			providerType + "App": {ObjectID: providerType + "Object", Name: providerType},
+		}
+		providers[providerType] = &orchestratorNoopProvider.NoopProvider{OverrideName: providerType}
+	}
+
+	pb := orchestrator.NewProviderBuilder()
+	pb.AddProviders(providers)
+	mappings := data.GetActionMappingDataGateway()
+	assert.NoError(t, mappings.Save(dataConfigGateway.ActionMappingRecord{From: sdk.ProviderTypeOpa, To: sdk.ProviderTypeAwsApiGW, Actions: map[string][]string{"anAction": {"GET"}, "anotherAction": {"GET"}}}))
+	service := orchestrator.ApplicationsService{ApplicationsGateway: data.GetApplicationDataGateway(), IntegrationsGateway: data, ActionMappingsGateway: mappings, ProviderBuilder: pb}
+
+	result, err := service.Preview(orchestrator.Orchestration{From: "opaApp", To: "awsapigwApp"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"anId", "anId"}, objectsOf(result.Policies), "api gateway keeps objects without rules")
+
+	result, err = service.Preview(orchestrator.Orchestration{From: "opaApp", To: "awsapigwApp", Resources: []orchestrator.ResourceRule{
+		{Match: orchestrator.ResourceMatchPrefix, Source: "an", Target: "/routes/an"},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/routes/anId", "/routes/anId"}, objectsOf(result.Policies))
+}
@@ -0,0 +1,112 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+// SubjectMapping translates subjects between identity domains. Lookups are tried in order: the static Subjects
+// table, then Groups for group subjects, then Domains for domain subjects and subjects with an email address.
+type SubjectMapping struct {
+	Subjects map[string]string // full subject to full subject
+	Domains  map[string]string // lower case domain to domain
+	Groups   map[string]string // group name to group name or full subject
+}
+
+// UnmappedSubject reports a subject that was left out of the translated policies, and why.
+type UnmappedSubject struct {
+	Subject  string   `json:"subject"`
+	Reason   string   `json:"reason"`
+	Policies []string `json:"policies"`
+}
+
+func (m SubjectMapping) translate(subject string) (string, bool) {
+	if target, found := m.Subjects[subject]; found {
+		return target, true
+	}
+
+	prefix, value, hasPrefix := strings.Cut(subject, ":")
+	if !hasPrefix {
+		prefix, value = "", subject
+	}
+	switch SubjectKindOf(subject) {
+	case SubjectGroup:
+		if target, found := m.Groups[value]; found {
+			if strings.Contains(target, ":") {
+				return target, true
+			}
+			return prefix + ":" + target, true
+		}
+	case SubjectDomain:
+		if target, found := m.Domains[strings.ToLower(value)]; found {
+			return prefix + ":" + target, true
+		}
+	}
+
+	if at := strings.LastIndex(value, "@"); at >= 0 {
+		if target, found := m.Domains[strings.ToLower(value[at+1:])]; found {
+			translated := value[:at+1] + target
+			if hasPrefix {
+				translated = prefix + ":" + translated
+			}
+			return translated, true
+		}
+	}
+	return "", false
+}
+
+// mapSubjects translates the subjects of each policy with mapping, when there is one, and checks them against the
+// target capabilities. Subjects that have no mapping, or that the target cannot hold, are left out and reported. A
+// policy left without any subject fails the translation, as leaving it out would remove it from the target. Subjects
+// matching anyone are never mapped.
+func mapSubjects(fromPolicies []hexapolicy.PolicyInfo, mapping *SubjectMapping, to Capabilities, toType string) ([]hexapolicy.PolicyInfo, []UnmappedSubject, error) {
+	unmapped := make(map[string]*UnmappedSubject)
+	var reasons []string
+	report := func(subject string, reason string, policy hexapolicy.PolicyInfo) {
+		reasons = append(reasons, fmt.Sprintf("%s (%s)", subject, reason))
+		entry, exist := unmapped[subject]
+		if !exist {
+			entry = &UnmappedSubject{Subject: subject, Reason: reason, Policies: []string{}}
+			unmapped[subject] = entry
+		}
+		entry.Policies = append(entry.Policies, policyLabel(policy))
+	}
+
+	modified := make([]hexapolicy.PolicyInfo, 0, len(fromPolicies))
+	for _, policy := range fromPolicies {
+		reasons = nil
+		subjects := make([]string, 0, len(policy.Subjects))
+		for _, subject := range policy.Subjects {
+			target := subject
+			if mapping != nil && SubjectKindOf(subject) != SubjectAny {
+				var found bool
+				if target, found = mapping.translate(subject); !found {
+					report(subject, "no subject mapping", policy)
+					continue
+				}
+			}
+			if !to.SupportsSubject(target) {
+				report(subject, fmt.Sprintf("%s does not support %s subjects", toType, SubjectKindOf(target)), policy)
+				continue
+			}
+			subjects = append(subjects, target)
+		}
+		if len(subjects) == 0 && len(policy.Subjects) > 0 {
+			return nil, nil, fmt.Errorf("policy %s would be removed from %s, none of its subjects can be written: %s", policyLabel(policy), toType, strings.Join(reasons, ", "))
+		}
+		policy.Subjects = subjects
+		modified = append(modified, policy)
+	}
+
+	resp := make([]UnmappedSubject, 0, len(unmapped))
+	for _, entry := range unmapped {
+		resp = append(resp, *entry)
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].Subject < resp[j].Subject
+	})
+	return modified, resp, nil
+}
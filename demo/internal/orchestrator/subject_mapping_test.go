@@ -0,0 +1,189 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator"
+	orchestratorNoopProvider "github.com/hexa-org/policy-orchestrator/demo/internal/orchestrator/test"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslation_Apply_mapsSubjects(t *testing.T) {
+	policies := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"user:alice@corp.com", "user:bob@Corp.COM", "carol@corp.com"}, Object: "/reports"},
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"group:admins", "group:readers", "group:writers"}, Object: "/orders"},
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"domain:corp.com", "anyAuthenticated"}, Object: "/users"},
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"user:dan@elsewhere.com", "user:alice@corp.com"}, Object: "/accounts"},
+	}
+
+	translation := translationFor(t, sdk.ProviderTypeGoogleCloudIAP, sdk.ProviderTypeOpa)
+	translation.SubjectMapping = &orchestrator.SubjectMapping{
+		Subjects: map[string]string{"user:alice@corp.com": "user:5f3c0e4e"},
+		Domains:  map[string]string{"corp.com": "corp.onmicrosoft.com"},
+		Groups:   map[string]string{"admins": "0c6a1d2e", "readers": "role:readers"},
+	}
+	translated, err := translation.Apply(policies, noTargetPolicies(t))
+	assert.NoError(t, err)
+	assert.Len(t, translated.Policies, 4)
+	assert.Equal(t, []string{"user:5f3c0e4e", "user:bob@corp.onmicrosoft.com", "carol@corp.onmicrosoft.com"}, []string(translated.Policies[0].Subjects))
+	assert.Equal(t, []string{"group:0c6a1d2e", "role:readers"}, []string(translated.Policies[1].Subjects))
+	assert.Equal(t, []string{"domain:corp.onmicrosoft.com", "anyAuthenticated"}, []string(translated.Policies[2].Subjects))
+	assert.Equal(t, []string{"user:5f3c0e4e"}, []string(translated.Policies[3].Subjects))
+	assert.Equal(t, []orchestrator.UnmappedSubject{
+		{Subject: "group:writers", Reason: "no subject mapping", Policies: []string{"/orders"}},
+		{Subject: "user:dan@elsewhere.com", Reason: "no subject mapping", Policies: []string{"/accounts"}},
+	}, translated.UnmappedSubjects)
+
+	// mapped subjects must still be supported by the target
+	translation = translationFor(t, sdk.ProviderTypeGoogleCloudIAP, sdk.ProviderTypeAzure)
+	translation.SubjectMapping = &orchestrator.SubjectMapping{Groups: map[string]string{"admins": "0c6a1d2e"}, Domains: map[string]string{"corp.com": "corp.onmicrosoft.com"}}
+	translation.ActionMapping = map[string][]string{"anAction": {"azureRole"}}
+	targetPolicies := func() ([]hexapolicy.PolicyInfo, error) {
+		return []hexapolicy.PolicyInfo{{Actions: []hexapolicy.ActionInfo{"azureRole"}, Object: "anAppId"}}, nil
+	}
+	azurePolicies := []hexapolicy.PolicyInfo{
+		policies[0],
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"group:admins", "user:erin@corp.com"}, Object: "/orders"},
+	}
+	translated, err = translation.Apply(azurePolicies, targetPolicies)
+	assert.NoError(t, err)
+	assert.Len(t, translated.Policies, 2)
+	assert.Equal(t, []string{"user:alice@corp.onmicrosoft.com", "user:bob@corp.onmicrosoft.com", "carol@corp.onmicrosoft.com"}, []string(translated.Policies[0].Subjects))
+	assert.Equal(t, []string{"user:erin@corp.onmicrosoft.com"}, []string(translated.Policies[1].Subjects))
+	assert.Equal(t, "group:admins", translated.UnmappedSubjects[0].Subject, "the source subject is reported")
+	assert.Equal(t, "azure does not support group subjects", translated.UnmappedSubjects[0].Reason)
+
+	// a policy left without any subject would be removed from the target
+	_, err = translation.Apply(policies[:2], targetPolicies)
+	assert.EqualError(t, err, "policy /orders would be removed from azure, none of its subjects can be written: group:admins (azure does not support group subjects), group:readers (no subject mapping), group:writers (no subject mapping)")
+}
+
+func TestSubjectMappings(t *testing.T) {
+	testsupport.WithSetUp(&orchestrationHandlerData{}, func(data *orchestrationHandlerData) {
+		mappingUrl := fmt.Sprintf("http://%s/mappings/subjects/%s/%s", data.server.Addr, data.fromApp, data.toApp)
+
+		resp, err := data.oauthHttpClient.Get(mappingUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		marshal, _ := json.Marshal(orchestrator.SubjectMappingResource{Subjects: map[string]string{"user:aUser": "user:aMappedUser"}})
+		req, _ := http.NewRequest(http.MethodPut, mappingUrl, bytes.NewReader(marshal))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, err = data.oauthHttpClient.Get(fmt.Sprintf("http://%s/mappings/subjects", data.server.Addr))
+		assert.NoError(t, err)
+		var list orchestrator.SubjectMappings
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		assert.Equal(t, []orchestrator.SubjectMappingResource{
+			{From: data.fromApp, To: data.toApp, Subjects: map[string]string{"user:aUser": "user:aMappedUser"}},
+		}, list.Mappings)
+
+		marshal, _ = json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err = data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration?dryRun=true", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "the policy of the unmapped user would be removed")
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(body), "user:anotherUser (no subject mapping)")
+
+		marshal, _ = json.Marshal(orchestrator.SubjectMappingResource{Subjects: map[string]string{"user:aUser": "user:aMappedUser", "user:anotherUser": "user:anotherMappedUser"}})
+		req, _ = http.NewRequest(http.MethodPut, mappingUrl, bytes.NewReader(marshal))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		marshal, _ = json.Marshal(orchestrator.Orchestration{From: data.fromApp, To: data.toApp})
+		resp, err = data.oauthHttpClient.Post(fmt.Sprintf("http://%s/orchestration?dryRun=true", data.server.Addr), "application/json", bytes.NewReader(marshal))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var result orchestrator.OrchestrationResult
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Len(t, result.Policies, 2)
+		assert.Equal(t, []string{"user:aMappedUser"}, []string(result.Policies[0].Subjects))
+		assert.Equal(t, []string{"user:anotherMappedUser"}, []string(result.Policies[1].Subjects))
+		assert.Empty(t, result.UnmappedSubjects)
+
+		req, _ = http.NewRequest(http.MethodPut, mappingUrl, bytes.NewReader([]byte(`{}`)))
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		req, _ = http.NewRequest(http.MethodDelete, mappingUrl, nil)
+		resp, err = data.oauthHttpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = data.oauthHttpClient.Get(mappingUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+// writingProvider keeps the policies set on it, as a target would.
+type writingProvider struct {
+	orchestratorNoopProvider.NoopProvider
+	policies []hexapolicy.PolicyInfo
+}
+
+func (p *writingProvider) GetPolicyInfo(policyprovider.IntegrationInfo, policyprovider.ApplicationInfo) ([]hexapolicy.PolicyInfo, error) {
+	return p.policies, nil
+}
+
+func (p *writingProvider) SetPolicyInfo(_ policyprovider.IntegrationInfo, _ policyprovider.ApplicationInfo, policies []hexapolicy.PolicyInfo) (int, error) {
+	p.policies = policies
+	return http.StatusCreated, nil
+}
+
+func TestApplicationsService_Apply_keepsTargetPolicies(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(dataConfigGateway.EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := dataConfigGateway.NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	targetPolicies := []hexapolicy.PolicyInfo{
+		{Actions: []hexapolicy.ActionInfo{"anAction"}, Subjects: []string{"user:aTargetUser"}, Object: "aTargetObject"},
+	}
+	target := &writingProvider{NoopProvider: orchestratorNoopProvider.NoopProvider{OverrideName: sdk.ProviderTypeAvp}, policies: targetPolicies}
+	providers := map[string]policyprovider.Provider{
+		sdk.ProviderTypeOpa: &orchestratorNoopProvider.NoopProvider{OverrideName: sdk.ProviderTypeOpa},
+		sdk.ProviderTypeAvp: target,
+	}
+	for providerType := range providers {
+		_, err = data.Create(providerType, "noop", []byte("aKey"))
+		assert.NoError(t, err)
+		data.Integrations[providerType].Apps = map[string]policyprovider.ApplicationInfo{
+			providerType + "App": {ObjectID: providerType + "Object", Name: providerType},
+		}
+	}
+
+	pb := orchestrator.NewProviderBuilder()
+	pb.AddProviders(providers)
+	subjects := data.GetSubjectMappingDataGateway()
+	service := orchestrator.ApplicationsService{ApplicationsGateway: data.GetApplicationDataGateway(), IntegrationsGateway: data, SubjectMappingsGateway: subjects, ProviderBuilder: pb}
+
+	assert.NoError(t, subjects.Save(dataConfigGateway.SubjectMappingRecord{From: sdk.ProviderTypeOpa, To: sdk.ProviderTypeAvp, Subjects: map[string]string{"user:aUser": "user:aMappedUser"}}))
+	err = service.Apply(orchestrator.Orchestration{From: "opaApp", To: "avpApp"})
+	assert.ErrorContains(t, err, "none of its subjects can be written: user:anotherUser (no subject mapping)")
+	assert.Equal(t, targetPolicies, target.policies, "the target keeps its policies")
+
+	assert.NoError(t, subjects.Save(dataConfigGateway.SubjectMappingRecord{From: sdk.ProviderTypeOpa, To: sdk.ProviderTypeAvp, Subjects: map[string]string{"user:aUser": "user:aMappedUser", "user:anotherUser": "user:anotherMappedUser"}}))
+	err = service.Apply(orchestrator.Orchestration{From: "opaApp", To: "avpApp", Resources: []orchestrator.ResourceRule{{Source: "anotherId", Target: "aTargetObject"}}})
+	assert.ErrorContains(t, err, "no resource rule matches its object anId")
+	assert.Equal(t, targetPolicies, target.policies, "the target keeps its policies")
+
+	assert.NoError(t, service.Apply(orchestrator.Orchestration{From: "opaApp", To: "avpApp"}))
+	assert.Len(t, target.policies, 2)
+}
@@ -0,0 +1,90 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/dataConfigGateway"
+)
+
+type SubjectMappings struct {
+	Mappings []SubjectMappingResource `json:"mappings"`
+}
+
+// SubjectMappingResource is the representation of a subject mapping, for a pair of applications or integrations.
+type SubjectMappingResource struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Subjects map[string]string `json:"subjects,omitempty"`
+	Domains  map[string]string `json:"domains,omitempty"`
+	Groups   map[string]string `json:"groups,omitempty"`
+}
+
+type SubjectMappingsHandler struct {
+	mappings     dataConfigGateway.SubjectMappingsDataGateway
+	applications dataConfigGateway.ApplicationsDataGateway
+}
+
+// List returns the mappings between integrations and applications the token of the request is permitted to access.
+func (handler SubjectMappingsHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := handler.mappings.Find()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := SubjectMappings{Mappings: make([]SubjectMappingResource, 0, len(records))}
+	access := accessOf(r)
+	for _, record := range records {
+		if access.permitsMapping(handler.applications, record.From, record.To) {
+			list.Mappings = append(list.Mappings, SubjectMappingResource(record))
+		}
+	}
+	data, _ := json.Marshal(list)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (handler SubjectMappingsHandler) Show(w http.ResponseWriter, r *http.Request) {
+	record, err := handler.mappings.FindByPair(mux.Vars(r)["from"], mux.Vars(r)["to"])
+	if err != nil {
+		writeSubjectMappingError(w, err)
+		return
+	}
+	data, _ := json.Marshal(SubjectMappingResource(*record))
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (handler SubjectMappingsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var jsonRequest SubjectMappingResource
+	if err := json.NewDecoder(r.Body).Decode(&jsonRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRequest.From, jsonRequest.To = mux.Vars(r)["from"], mux.Vars(r)["to"]
+	if err := handler.mappings.Save(dataConfigGateway.SubjectMappingRecord(jsonRequest)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (handler SubjectMappingsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := handler.mappings.Delete(mux.Vars(r)["from"], mux.Vars(r)["to"]); err != nil {
+		writeSubjectMappingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeSubjectMappingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, dataConfigGateway.ErrSubjectMappingNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,334 @@
+package auditsupport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	"go.opentelemetry.io/otel/trace"
+	log "golang.org/x/exp/slog"
+)
+
+const EnvAuditFile = "ORCHESTRATOR_AUDIT_FILE"
+
+// DefaultAuditFile is where the audit log is kept when EnvAuditFile is not set, next to the default configuration.
+const DefaultAuditFile = ".hexa/audit.log"
+
+// The outcomes of an audited action.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// ErrChainBroken is returned by Verify when an entry of the log was changed, removed or inserted.
+var ErrChainBroken = errors.New("audit log hash chain is broken")
+
+// Entry records who performed an action, on what, and how it went. Hash is the SHA-256 of the entry without its hash,
+// which includes the hash of the entry before it, so that changing any entry breaks the chain from there on.
+type Entry struct {
+	Sequence     int64          `json:"sequence"`
+	Time         time.Time      `json:"time"`
+	Subject      string         `json:"subject"`
+	Email        string         `json:"email,omitempty"`
+	Action       string         `json:"action"`
+	Targets      []string       `json:"targets,omitempty"`
+	Policies     []PolicyChange `json:"policies,omitempty"`
+	Outcome      string         `json:"outcome"`
+	Status       int            `json:"status"`
+	TraceId      string         `json:"trace_id,omitempty"`
+	PreviousHash string         `json:"previous_hash"`
+	Hash         string         `json:"hash"`
+}
+
+// PolicyChange is the hash of the policies of an application before and after they were written. Before is empty
+// when the policies were not read first.
+type PolicyChange struct {
+	Application string `json:"application"`
+	Before      string `json:"before,omitempty"`
+	After       string `json:"after"`
+}
+
+func (entry Entry) hash() string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter selects entries of the log. Fields that are not set select every entry.
+type Filter struct {
+	Subject string
+	Action  string
+	Target  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int              // the latest entries are kept when more match
+	Permits func(Entry) bool // when set, only the entries it permits match, before the limit applies
+}
+
+func (filter Filter) matches(entry Entry) bool {
+	return (filter.Subject == "" || filter.Subject == entry.Subject || filter.Subject == entry.Email) &&
+		(filter.Action == "" || filter.Action == entry.Action) &&
+		(filter.Target == "" || slices.Contains(entry.Targets, filter.Target)) &&
+		(filter.Outcome == "" || filter.Outcome == entry.Outcome) &&
+		(filter.Since.IsZero() || !entry.Time.Before(filter.Since)) &&
+		(filter.Until.IsZero() || entry.Time.Before(filter.Until)) &&
+		(filter.Permits == nil || filter.Permits(entry))
+}
+
+// Log is an append-only file of entries, a line of JSON each. It is safe for concurrent use. A nil log records
+// nothing, so that handlers can be loaded without one in tests.
+type Log struct {
+	path     string
+	mu       sync.Mutex
+	sequence int64
+	lastHash string
+}
+
+// Open opens the log at path, creating it and its directory when they do not exist. An empty path opens the log in
+// EnvAuditFile, or DefaultAuditFile in the home directory.
+func Open(path string) (*Log, error) {
+	if path == "" {
+		path = os.Getenv(EnvAuditFile)
+	}
+	if path == "" {
+		path = DefaultAuditFile
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+
+	auditLog := &Log{path: path}
+	err = auditLog.read(func(entry Entry) bool {
+		auditLog.sequence = entry.Sequence
+		auditLog.lastHash = entry.Hash
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auditLog, nil
+}
+
+// Append chains the entry to the log, setting its sequence, time and hashes, and returns it as written.
+func (l *Log) Append(entry Entry) (Entry, error) {
+	if l == nil {
+		return entry, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Sequence = l.sequence + 1
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.PreviousHash = l.lastHash
+	entry.Hash = entry.hash()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return entry, err
+	}
+	defer func() { _ = file.Close() }()
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return entry, err
+	}
+	if err = file.Sync(); err != nil {
+		return entry, err
+	}
+	l.sequence = entry.Sequence
+	l.lastHash = entry.Hash
+	return entry, nil
+}
+
+// Find returns the entries that match the filter, oldest first.
+func (l *Log) Find(filter Filter) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	if l == nil {
+		return entries, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.read(func(entry Entry) bool {
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+		return true
+	})
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, err
+}
+
+// Verify checks the hash chain of the whole log, returning how many entries it holds. The error wraps ErrChainBroken
+// and names the first entry that does not match when the log was tampered with.
+func (l *Log) Verify() (int64, error) {
+	if l == nil {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var count int64
+	previous := ""
+	var broken error
+	err := l.read(func(entry Entry) bool {
+		count++
+		switch {
+		case entry.Sequence != count:
+			broken = fmt.Errorf("%w: entry %d is numbered %d", ErrChainBroken, count, entry.Sequence)
+		case entry.PreviousHash != previous:
+			broken = fmt.Errorf("%w: entry %d does not follow the entry before it", ErrChainBroken, count)
+		case entry.Hash != entry.hash():
+			broken = fmt.Errorf("%w: entry %d does not match its hash", ErrChainBroken, count)
+		}
+		previous = entry.Hash
+		return broken == nil
+	})
+	if err == nil {
+		err = broken
+	}
+	return count, err
+}
+
+// read calls next with each entry of the file, in order, until next returns false.
+func (l *Log) read(next func(Entry) bool) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("%w: line %d is not an entry: %v", ErrChainBroken, line, err)
+		}
+		if !next(entry) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// pending collects what the handler of an audited request learns about it, such as the policies it wrote.
+type pending struct {
+	mu       sync.Mutex
+	targets  []string
+	policies []PolicyChange
+}
+
+type pendingKey struct{}
+
+// AddTargets adds the ids of what the audited request in ctx acted on, such as an integration it created. It does
+// nothing when the request is not audited.
+func AddTargets(ctx context.Context, ids ...string) {
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, id := range ids {
+			if id != "" && !slices.Contains(p.targets, id) {
+				p.targets = append(p.targets, id)
+			}
+		}
+	}
+}
+
+// AddPolicyChange records the hashes of the policies the audited request in ctx wrote to an application. It does
+// nothing when the request is not audited.
+func AddPolicyChange(ctx context.Context, change PolicyChange) {
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.policies = append(p.policies, change)
+	}
+}
+
+// Handler records an entry for each request to next once it has been served. It must be called by
+// oauth2support.JwtAuthenticationHandler, which sets the subject and email of the caller. The targets are the
+// variables of the route, in order of name, followed by those the handler adds. Requests that return an error status
+// are recorded as failures.
+func (l *Log) Handler(action string, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := &pending{}
+		vars := mux.Vars(r)
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p.targets = append(p.targets, vars[name])
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		ctx := context.WithValue(r.Context(), pendingKey{}, p)
+		next(recorder, r.WithContext(ctx))
+
+		entry := Entry{
+			Subject:  r.Header.Get(oauth2support.Header_Subj),
+			Email:    r.Header.Get(oauth2support.Header_Email),
+			Action:   action,
+			Targets:  p.targets,
+			Policies: p.policies,
+			Outcome:  OutcomeSuccess,
+			Status:   recorder.status,
+		}
+		if recorder.status >= http.StatusBadRequest {
+			entry.Outcome = OutcomeFailure
+		}
+		if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+			entry.TraceId = span.TraceID().String()
+		}
+		if _, err := l.Append(entry); err != nil {
+			log.Error("Audit", "action", action, "targets", entry.Targets, "error", err)
+		}
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,153 @@
+package auditsupport_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/auditsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func openLog(t *testing.T) (*auditsupport.Log, string) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	auditLog, err := auditsupport.Open(path)
+	assert.NoError(t, err)
+	return auditLog, path
+}
+
+func TestAppend(t *testing.T) {
+	auditLog, path := openLog(t)
+	first, err := auditLog.Append(auditsupport.Entry{Subject: "aSubject", Action: "integrations.create", Targets: []string{"anId"}, Outcome: auditsupport.OutcomeSuccess})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), first.Sequence)
+	assert.Empty(t, first.PreviousHash)
+	assert.Len(t, first.Hash, 64)
+	assert.False(t, first.Time.IsZero())
+
+	reopened, err := auditsupport.Open(path)
+	assert.NoError(t, err)
+	second, err := reopened.Append(auditsupport.Entry{Subject: "anotherSubject", Action: "integrations.delete", Targets: []string{"anId"}, Outcome: auditsupport.OutcomeFailure})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), second.Sequence, "the chain carries on after the log is reopened")
+	assert.Equal(t, first.Hash, second.PreviousHash)
+
+	count, err := reopened.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestFind(t *testing.T) {
+	auditLog, _ := openLog(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, entry := range []auditsupport.Entry{
+		{Subject: "aSubject", Email: "a@example.com", Action: "policies.set", Targets: []string{"anApp"}, Outcome: auditsupport.OutcomeSuccess},
+		{Subject: "aSubject", Action: "policies.set", Targets: []string{"anotherApp"}, Outcome: auditsupport.OutcomeFailure},
+		{Subject: "anotherSubject", Action: "integrations.delete", Targets: []string{"anIntegration"}, Outcome: auditsupport.OutcomeSuccess},
+	} {
+		entry.Time = start.Add(time.Duration(i) * time.Hour)
+		_, err := auditLog.Append(entry)
+		assert.NoError(t, err)
+	}
+
+	sequences := func(filter auditsupport.Filter) []int64 {
+		entries, err := auditLog.Find(filter)
+		assert.NoError(t, err)
+		found := make([]int64, 0)
+		for _, entry := range entries {
+			found = append(found, entry.Sequence)
+		}
+		return found
+	}
+	assert.Equal(t, []int64{1, 2, 3}, sequences(auditsupport.Filter{}))
+	assert.Equal(t, []int64{1, 2}, sequences(auditsupport.Filter{Subject: "aSubject"}))
+	assert.Equal(t, []int64{1}, sequences(auditsupport.Filter{Subject: "a@example.com"}))
+	assert.Equal(t, []int64{1, 2}, sequences(auditsupport.Filter{Action: "policies.set"}))
+	assert.Equal(t, []int64{2}, sequences(auditsupport.Filter{Target: "anotherApp"}))
+	assert.Equal(t, []int64{1, 3}, sequences(auditsupport.Filter{Outcome: auditsupport.OutcomeSuccess}))
+	assert.Equal(t, []int64{2, 3}, sequences(auditsupport.Filter{Since: start.Add(time.Hour)}))
+	assert.Equal(t, []int64{1}, sequences(auditsupport.Filter{Until: start.Add(time.Hour)}))
+	assert.Equal(t, []int64{2, 3}, sequences(auditsupport.Filter{Limit: 2}), "the latest entries are kept")
+	notDeleted := func(entry auditsupport.Entry) bool { return entry.Action != "integrations.delete" }
+	assert.Equal(t, []int64{1, 2}, sequences(auditsupport.Filter{Permits: notDeleted, Limit: 2}), "the limit applies to permitted entries")
+}
+
+func TestVerify_tampered(t *testing.T) {
+	auditLog, path := openLog(t)
+	for _, subject := range []string{"aSubject", "anotherSubject", "yetAnotherSubject"} {
+		_, _ = auditLog.Append(auditsupport.Entry{Subject: subject, Action: "policies.set", Outcome: auditsupport.OutcomeSuccess})
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	_ = os.WriteFile(path, []byte(strings.Replace(string(data), "anotherSubject", "someoneElse", 1)), 0o600)
+	_, err := auditLog.Verify()
+	assert.ErrorIs(t, err, auditsupport.ErrChainBroken)
+	assert.ErrorContains(t, err, "entry 2 does not match its hash")
+
+	_ = os.WriteFile(path, []byte(lines[0]+"\n"+lines[2]+"\n"), 0o600)
+	_, err = auditLog.Verify()
+	assert.ErrorIs(t, err, auditsupport.ErrChainBroken)
+	assert.ErrorContains(t, err, "entry 2 is numbered 3")
+
+	_ = os.WriteFile(path, []byte(lines[1]+"\n"+lines[2]+"\n"), 0o600)
+	_, err = auditLog.Verify()
+	assert.ErrorIs(t, err, auditsupport.ErrChainBroken)
+}
+
+func TestHandler(t *testing.T) {
+	auditLog, _ := openLog(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/applications/{id}/policies", auditLog.Handler("policies.set", func(w http.ResponseWriter, r *http.Request) {
+		auditsupport.AddTargets(r.Context(), "anIntegration")
+		auditsupport.AddPolicyChange(r.Context(), auditsupport.PolicyChange{Application: "anApp", Before: "aHash", After: "anotherHash"})
+		w.WriteHeader(http.StatusCreated)
+	})).Methods(http.MethodPost)
+	router.HandleFunc("/integrations/{id}", auditLog.Handler("integrations.delete", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})).Methods(http.MethodDelete)
+
+	request := httptest.NewRequest(http.MethodPost, "/applications/anApp/policies", nil)
+	request.Header.Set(oauth2support.Header_Subj, "aSubject")
+	request.Header.Set(oauth2support.Header_Email, "a@example.com")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/integrations/anIntegration", nil))
+
+	entries, err := auditLog.Find(auditsupport.Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "aSubject", entries[0].Subject)
+	assert.Equal(t, "a@example.com", entries[0].Email)
+	assert.Equal(t, "policies.set", entries[0].Action)
+	assert.Equal(t, []string{"anApp", "anIntegration"}, entries[0].Targets)
+	assert.Equal(t, []auditsupport.PolicyChange{{Application: "anApp", Before: "aHash", After: "anotherHash"}}, entries[0].Policies)
+	assert.Equal(t, auditsupport.OutcomeSuccess, entries[0].Outcome)
+	assert.Equal(t, http.StatusCreated, entries[0].Status)
+
+	assert.Equal(t, "integrations.delete", entries[1].Action)
+	assert.Equal(t, auditsupport.OutcomeFailure, entries[1].Outcome)
+	assert.Equal(t, http.StatusNotFound, entries[1].Status)
+}
+
+func TestNilLog(t *testing.T) {
+	var auditLog *auditsupport.Log
+	called := false
+	auditLog.Handler("policies.set", func(w http.ResponseWriter, r *http.Request) {
+		auditsupport.AddTargets(r.Context(), "anId")
+		called = true
+	})(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.True(t, called)
+
+	auditsupport.AddPolicyChange(context.Background(), auditsupport.PolicyChange{Application: "anApp"})
+	entries, err := auditLog.Find(auditsupport.Filter{})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
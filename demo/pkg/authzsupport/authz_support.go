@@ -0,0 +1,376 @@
+package authzsupport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions"
+	conditionparser "github.com/hexa-org/policy-mapper/pkg/hexapolicy/conditions/parser"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy/types"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicysupport"
+	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	log "golang.org/x/exp/slog"
+)
+
+// EnvAuthzPolicyFile is the IDQL policy file that authorizes calls to the orchestrator. Calls are not authorized by
+// policy when it is not set.
+const EnvAuthzPolicyFile = "ORCHESTRATOR_AUTHZ_POLICY_FILE"
+
+// ErrNotAuthorized is returned with a forbidden status when no policy permits a request, or one denies it.
+var ErrNotAuthorized = errors.New("request is not authorized by policy")
+
+// Request is what policies are evaluated against. Attributes are available to conditions under their names, see
+// Attributes.
+type Request struct {
+	Subject  string
+	Email    string
+	Roles    []string
+	Groups   []string
+	Method   string
+	Route    string // the template of the route without the leading slash, e.g. applications/{id}/policies
+	Path     string // the path without the leading slash, e.g. applications/anId/policies
+	Resource map[string][]string
+}
+
+// Attributes returns the attributes of the request that conditions can refer to: subject.id, subject.email,
+// subject.roles, subject.groups, req.method, req.route, req.path and resource.<name> for each variable of the route
+// and each attribute added by the ResourceResolver, such as resource.integration.
+func (request Request) Attributes() map[string][]string {
+	attributes := map[string][]string{
+		"subject.id":     {request.Subject},
+		"subject.email":  {request.Email},
+		"subject.roles":  request.Roles,
+		"subject.groups": request.Groups,
+		"req.method":     {request.Method},
+		"req.route":      {request.Route},
+		"req.path":       {request.Path},
+	}
+	for name, values := range request.Resource {
+		attributes["resource."+name] = values
+	}
+	return attributes
+}
+
+// ResourceResolver adds attributes of the resource a request acts on, beyond the variables of its route.
+type ResourceResolver func(r *http.Request) map[string][]string
+
+// policy is a PolicyInfo with its condition parsed once when the file is loaded.
+type policy struct {
+	hexapolicy.PolicyInfo
+	condition conditionparser.Expression
+	deny      bool
+}
+
+// Authorizer evaluates the IDQL policies of a file against each request. The subjects of a policy are any,
+// anyAuthenticated, user:<subject or email>, role:<role>, group:<group> or domain:<email domain>, its actions are
+// http:<METHOD> and its object is the route of the request, such as applications/{id}/policies or
+// applications/anId/policies. Actions and objects may use * as a wildcard and an empty object matches every route.
+// A request is authorized when a policy permits it and none whose condition action is deny matches it.
+//
+// The file is reloaded when it changes. When it cannot be read or parsed the policies loaded before are kept, and
+// every request is denied until the file has been loaded once. A nil Authorizer authorizes every request.
+type Authorizer struct {
+	path     string
+	resolve  ResourceResolver
+	mu       sync.RWMutex
+	policies []policy
+	modTime  time.Time // of the file when it was last read, whether it could be parsed or not
+	size     int64
+}
+
+// NewAuthorizer returns an authorizer for the policy file at path, or in EnvAuthzPolicyFile when path is empty. It
+// returns nil when neither is set. The authorizer is returned along with the error when the file cannot be loaded.
+func NewAuthorizer(path string, resolve ResourceResolver) (*Authorizer, error) {
+	if path == "" {
+		path = os.Getenv(EnvAuthzPolicyFile)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	authorizer := &Authorizer{path: path, resolve: resolve}
+	return authorizer, authorizer.reload()
+}
+
+// reload loads the file when it has changed since it was last read.
+func (a *Authorizer) reload() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	a.mu.RLock()
+	unchanged := info.ModTime().Equal(a.modTime) && info.Size() == a.size
+	a.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.modTime = info.ModTime()
+	a.size = info.Size()
+	infos, err := hexapolicysupport.ParsePolicyFile(a.path)
+	if err != nil {
+		return fmt.Errorf("invalid policy file %s: %w", a.path, err)
+	}
+	policies := make([]policy, 0, len(infos))
+	for _, policyInfo := range infos {
+		compiled := policy{PolicyInfo: policyInfo}
+		if policyInfo.Condition != nil && policyInfo.Condition.Rule != "" {
+			if compiled.condition, err = policyInfo.Condition.Ast(); err != nil {
+				return fmt.Errorf("invalid condition %s in policy file %s: %w", policyInfo.Condition.Rule, a.path, err)
+			}
+			compiled.deny = strings.EqualFold(policyInfo.Condition.Action, conditions.ADeny)
+		}
+		policies = append(policies, compiled)
+	}
+	a.policies = policies
+	log.Info("Loaded authorization policies", "file", a.path, "policies", len(policies))
+	return nil
+}
+
+// Authorize reloads the policy file when it has changed and evaluates the request against its policies.
+func (a *Authorizer) Authorize(request Request) bool {
+	if a == nil {
+		return true
+	}
+	if err := a.reload(); err != nil {
+		log.Error("Authorization policies not reloaded", "error", err)
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	attributes := request.Attributes()
+	permitted := false
+	for _, p := range a.policies {
+		if !p.appliesTo(request) {
+			continue
+		}
+		if p.condition == nil {
+			permitted = true
+			continue
+		}
+		if evaluate(p.condition, attributes) {
+			if p.deny {
+				return false
+			}
+			permitted = true
+		}
+	}
+	return permitted
+}
+
+// Handler authorizes each request to next. It must be called by oauth2support.JwtAuthenticationHandler, which sets
+// the subject and email of the caller, and routed by mux so that the route is known.
+func (a *Authorizer) Handler(next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := NewRequest(r)
+		if a.resolve != nil {
+			for name, values := range a.resolve(r) {
+				request.Resource[name] = values
+			}
+		}
+		if !a.Authorize(request) {
+			log.Info("Request denied by policy", "subject", request.Subject, "method", request.Method, "route", request.Route)
+			http.Error(w, ErrNotAuthorized.Error(), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// NewRequest reads the request to authorize from r. The roles and groups are read from the claims of the bearer token,
+// which has already been verified.
+func NewRequest(r *http.Request) Request {
+	request := Request{
+		Subject:  r.Header.Get(oauth2support.Header_Subj),
+		Email:    r.Header.Get(oauth2support.Header_Email),
+		Method:   r.Method,
+		Path:     strings.TrimPrefix(r.URL.Path, "/"),
+		Route:    strings.TrimPrefix(r.URL.Path, "/"),
+		Resource: map[string][]string{},
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			request.Route = strings.TrimPrefix(template, "/")
+		}
+	}
+	for name, value := range mux.Vars(r) {
+		request.Resource[name] = []string{value}
+	}
+
+	scheme, raw, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "bearer") {
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(strings.TrimSpace(raw), claims); err == nil {
+			request.Roles = stringsClaim(claims["roles"])
+			request.Groups = stringsClaim(claims["groups"])
+		}
+	}
+	return request
+}
+
+func stringsClaim(value interface{}) []string {
+	switch claim := value.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		values := make([]string, 0, len(claim))
+		for _, item := range claim {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (p policy) appliesTo(request Request) bool {
+	return p.subjectMatches(request) && p.actionMatches(request) && p.objectMatches(request)
+}
+
+func (p policy) subjectMatches(request Request) bool {
+	for _, member := range p.Subjects {
+		kind, value, _ := strings.Cut(member, ":")
+		switch strings.ToLower(kind) {
+		case strings.ToLower(hexapolicy.SubjectAnyUser):
+			return true
+		case strings.ToLower(hexapolicy.SubjectAnyAuth):
+			if request.Subject != "" {
+				return true
+			}
+		case "user":
+			if strings.EqualFold(value, request.Subject) || (request.Email != "" && strings.EqualFold(value, request.Email)) {
+				return true
+			}
+		case "role":
+			if slices.Contains(request.Roles, value) {
+				return true
+			}
+		case "group":
+			if slices.Contains(request.Groups, value) {
+				return true
+			}
+		case "domain":
+			if request.Email != "" && strings.HasSuffix(strings.ToLower(request.Email), "@"+strings.ToLower(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p policy) actionMatches(request Request) bool {
+	for _, action := range p.Actions {
+		if matches(strings.ToLower(action.String()), "http:"+strings.ToLower(request.Method)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p policy) objectMatches(request Request) bool {
+	object := strings.TrimPrefix(string(p.Object), "/")
+	return object == "" || matches(object, request.Route) || matches(object, request.Path)
+}
+
+// matches is whether value matches pattern, in which * matches any sequence of characters, including slashes.
+func matches(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
+
+// evaluate is whether the condition holds for the attributes. An attribute with several values, such as
+// subject.roles, satisfies a comparison when any of its values does, and ne when none is equal.
+func evaluate(expression conditionparser.Expression, attributes map[string][]string) bool {
+	switch e := expression.(type) {
+	case conditionparser.LogicalExpression:
+		if e.Operator == conditionparser.AND {
+			return evaluate(e.Left, attributes) && evaluate(e.Right, attributes)
+		}
+		return evaluate(e.Left, attributes) || evaluate(e.Right, attributes)
+	case conditionparser.NotExpression:
+		return !evaluate(e.Expression, attributes)
+	case conditionparser.PrecedenceExpression:
+		return evaluate(e.Expression, attributes)
+	case conditionparser.AttributeExpression:
+		return compare(e, attributes)
+	}
+	return false
+}
+
+func compare(e conditionparser.AttributeExpression, attributes map[string][]string) bool {
+	values := make([]string, 0)
+	for _, value := range attributes[e.AttributePath.String()] {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	switch e.Operator {
+	case conditionparser.PR:
+		return len(values) > 0
+	case conditionparser.NE:
+		for _, value := range values {
+			if types.NewString(value).Equals(comparable(e.CompareValue)) {
+				return false
+			}
+		}
+		return true
+	case conditionparser.IN:
+		if array, ok := e.CompareValue.(types.Array); ok {
+			for _, value := range values {
+				for _, item := range array.Value().([]types.ComparableValue) {
+					if types.NewString(value).Equals(item) {
+						return true
+					}
+				}
+			}
+			return false
+		}
+	}
+	right := comparable(e.CompareValue)
+	for _, value := range values {
+		if result, incompatible := types.CompareValues(types.NewString(value), right, string(e.Operator)); result && !incompatible {
+			return true
+		}
+	}
+	return false
+}
+
+// comparable returns the value to compare attributes with. Unquoted words are parsed as entities, which are compared
+// by their name.
+func comparable(value types.Value) types.ComparableValue {
+	if c, ok := value.(types.ComparableValue); ok {
+		return c
+	}
+	if value == nil {
+		return types.NewString("")
+	}
+	return types.NewString(value.String())
+}
@@ -0,0 +1,119 @@
+package authzsupport_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-mapper/pkg/oauth2support"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/authzsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+const policies = `{"policies": [
+  {"meta": {"version": "0.7", "description": "team-a edits the applications of integration X"},
+   "subjects": ["role:team-a"], "actions": ["http:PUT", "http:POST"], "object": "applications/{id}/*",
+   "condition": {"Rule": "resource.integration eq \"X\""}},
+  {"meta": {"version": "0.7"}, "subjects": ["anyAuthenticated"], "actions": ["http:GET"], "object": ""},
+  {"meta": {"version": "0.7", "description": "contractors do not read the audit log"},
+   "subjects": ["domain:contractor.example.com"], "actions": ["http:*"], "object": "*",
+   "condition": {"Rule": "req.route sw \"audit\"", "Action": "deny"}}
+]}`
+
+func writePolicies(t *testing.T, path string, data string) {
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+}
+
+func newAuthorizer(t *testing.T, data string) (*authzsupport.Authorizer, string) {
+	path := filepath.Join(t.TempDir(), "authz.json")
+	writePolicies(t, path, data)
+	authorizer, err := authzsupport.NewAuthorizer(path, nil)
+	assert.NoError(t, err)
+	return authorizer, path
+}
+
+func TestNewAuthorizer_notConfigured(t *testing.T) {
+	t.Setenv(authzsupport.EnvAuthzPolicyFile, "")
+	authorizer, err := authzsupport.NewAuthorizer("", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, authorizer)
+	assert.True(t, authorizer.Authorize(authzsupport.Request{Method: http.MethodDelete, Route: "integrations/{id}"}))
+}
+
+func TestNewAuthorizer_invalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authz.json")
+	writePolicies(t, path, `{"policies": [{"subjects": ["any"], "actions": ["http:GET"]}`)
+	authorizer, err := authzsupport.NewAuthorizer(path, nil)
+	assert.Error(t, err)
+	assert.False(t, authorizer.Authorize(authzsupport.Request{Subject: "aSubject", Method: http.MethodGet, Route: "integrations"}),
+		"nothing is authorized until the file is loaded")
+}
+
+func TestAuthorize(t *testing.T) {
+	authorizer, _ := newAuthorizer(t, policies)
+	editPolicies := func(roles []string, integration string) authzsupport.Request {
+		return authzsupport.Request{Subject: "aSubject", Roles: roles, Method: http.MethodPost, Route: "applications/{id}/policies",
+			Path: "applications/anApp/policies", Resource: map[string][]string{"id": {"anApp"}, "integration": {integration}}}
+	}
+	assert.True(t, authorizer.Authorize(editPolicies([]string{"team-b", "team-a"}, "X")))
+	assert.False(t, authorizer.Authorize(editPolicies([]string{"team-a"}, "Y")), "the condition does not hold")
+	assert.False(t, authorizer.Authorize(editPolicies([]string{"team-b"}, "X")), "the subject does not match")
+
+	read := authzsupport.Request{Subject: "aSubject", Email: "bob@contractor.example.com", Method: http.MethodGet, Route: "integrations", Path: "integrations"}
+	assert.True(t, authorizer.Authorize(read))
+	read.Subject = ""
+	assert.False(t, authorizer.Authorize(read), "anyAuthenticated requires a subject")
+
+	audit := authzsupport.Request{Subject: "aSubject", Email: "alice@example.com", Method: http.MethodGet, Route: "audit", Path: "audit"}
+	assert.True(t, authorizer.Authorize(audit))
+	audit.Email = "bob@contractor.example.com"
+	assert.False(t, authorizer.Authorize(audit), "the deny condition holds")
+
+	deleteIntegration := authzsupport.Request{Subject: "aSubject", Roles: []string{"team-a"}, Method: http.MethodDelete, Route: "integrations/{id}", Path: "integrations/X"}
+	assert.False(t, authorizer.Authorize(deleteIntegration), "no policy permits it")
+}
+
+func TestAuthorize_reloads(t *testing.T) {
+	authorizer, path := newAuthorizer(t, `[{"meta": {"version": "0.7"}, "subjects": ["user:aSubject"], "actions": ["http:GET"], "object": "integrations"}]`)
+	request := authzsupport.Request{Subject: "aSubject", Method: http.MethodGet, Route: "integrations", Path: "integrations"}
+	assert.True(t, authorizer.Authorize(request))
+
+	writePolicies(t, path, `[{"meta": {"version": "0.7"}, "subjects": ["user:anotherSubject"], "actions": ["http:GET"], "object": "integrations"}]`)
+	_ = os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	assert.False(t, authorizer.Authorize(request), "the changed file is reloaded")
+
+	writePolicies(t, path, `[{"meta": {"version": "0.7"}, "subjects": ["user:aSubject"]`)
+	_ = os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+	request.Subject = "anotherSubject"
+	assert.True(t, authorizer.Authorize(request), "the policies loaded before are kept when the file is invalid")
+}
+
+func TestHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authz.json")
+	writePolicies(t, path, policies)
+	authorizer, err := authzsupport.NewAuthorizer(path, func(r *http.Request) map[string][]string {
+		return map[string][]string{"integration": {map[string]string{"anApp": "X", "anotherApp": "Y"}[mux.Vars(r)["id"]]}}
+	})
+	assert.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/applications/{id}/policies", authorizer.Handler(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})).Methods(http.MethodPost)
+
+	post := func(id string) int {
+		token := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJyb2xlcyI6WyJ0ZWFtLWEiXX0." // {"roles":["team-a"]}
+		request := httptest.NewRequest(http.MethodPost, "/applications/"+id+"/policies", nil)
+		request.Header.Set(oauth2support.Header_Subj, "aSubject")
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	assert.Equal(t, http.StatusCreated, post("anApp"))
+	assert.Equal(t, http.StatusForbidden, post("anotherApp"))
+}
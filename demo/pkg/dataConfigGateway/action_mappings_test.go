@@ -0,0 +1,93 @@
+package dataConfigGateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionMappings_config(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	testActionMappings(t, data)
+
+	assert.NoError(t, data.GetActionMappingDataGateway().Save(ActionMappingRecord{From: "anApp", To: "anotherApp", Actions: map[string][]string{"a": {"b"}}}))
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	mappings, _ := reloaded.GetActionMappingDataGateway().Find()
+	assert.Len(t, mappings, 1, "mappings are persisted")
+}
+
+func TestActionMappings_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	data, err := NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer data.Close()
+
+	testActionMappings(t, data)
+}
+
+func testActionMappings(t *testing.T, data DataGateway) {
+	mappings := data.GetActionMappingDataGateway()
+
+	found, err := mappings.Find()
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	_, err = mappings.FindByPair("anApp", "anotherApp")
+	assert.ErrorIs(t, err, ErrActionMappingNotFound)
+
+	err = mappings.Save(ActionMappingRecord{From: "anApp", To: "anotherApp", Actions: map[string][]string{
+		"http:GET":  {"gcp:iap.webServiceVersions.accessViaIAP", " "},
+		"http:POST": {"gcp:roles/iap.httpsResourceAccessor", "gcp:roles/iap.httpsResourceAccessor"},
+		" ":         {"ignored"},
+	}})
+	assert.NoError(t, err)
+
+	mapping, err := mappings.FindByPair("anApp", "anotherApp")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"http:GET":  {"gcp:iap.webServiceVersions.accessViaIAP"},
+		"http:POST": {"gcp:roles/iap.httpsResourceAccessor"},
+	}, mapping.Actions)
+	_, err = mappings.FindByPair("anotherApp", "anApp")
+	assert.ErrorIs(t, err, ErrActionMappingNotFound, "mappings have a direction")
+
+	err = mappings.Save(ActionMappingRecord{From: "anApp", To: "anotherApp", Actions: map[string][]string{"http:GET": {"aRole", "anotherRole"}}})
+	assert.NoError(t, err)
+	mapping, _ = mappings.FindByPair("anApp", "anotherApp")
+	assert.ElementsMatch(t, []string{"aRole", "anotherRole"}, mapping.Actions["http:GET"])
+	assert.Len(t, mapping.Actions, 1, "saving replaces the mapping")
+
+	assert.EqualError(t, mappings.Save(ActionMappingRecord{From: "anApp", To: "anotherApp"}), "an action mapping requires at least one source action with a target action")
+	assert.EqualError(t, mappings.Save(ActionMappingRecord{From: "anApp", Actions: map[string][]string{"a": {"b"}}}), "an action mapping requires from and to")
+
+	// mappings referring to a deleted integration, or to its applications, are removed with it
+	alias, err := data.Create("", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	apps, _ := data.GetApplicationDataGateway().Find(false)
+	assert.NotEmpty(t, apps)
+	assert.NoError(t, mappings.Save(ActionMappingRecord{From: alias, To: "anotherIntegration", Actions: map[string][]string{"a": {"b"}}}))
+	assert.NoError(t, mappings.Save(ActionMappingRecord{From: "anApp", To: apps[0].ID, Actions: map[string][]string{"a": {"b"}}}))
+	found, _ = mappings.Find()
+	assert.Len(t, found, 3)
+	assert.NoError(t, data.Delete(alias))
+
+	found, err = mappings.Find()
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, "anApp", found[0].From)
+	assert.Equal(t, "anotherApp", found[0].To)
+
+	assert.NoError(t, mappings.Delete("anApp", "anotherApp"))
+	assert.ErrorIs(t, mappings.Delete("anApp", "anotherApp"), ErrActionMappingNotFound)
+	found, _ = mappings.Find()
+	assert.Empty(t, found)
+}
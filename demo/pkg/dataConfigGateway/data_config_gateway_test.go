@@ -78,6 +78,9 @@ func (s *testSuite) Test1_IG_FindIntegration() {
 
 	assert.Len(s.T(), recs, 1)
 	assert.Equal(s.T(), s.test1Id, recs[0].ID, "Should be equal")
+	assert.Equal(s.T(), 1, recs[0].AppCount)
+	assert.False(s.T(), recs[0].CreatedAt.IsZero())
+	assert.Equal(s.T(), recs[0].CreatedAt, recs[0].UpdatedAt)
 
 }
 
@@ -116,6 +119,43 @@ func (s *testSuite) Test3_IG_Delete() {
 	assert.Len(s.T(), s.Data.Integrations, 1, "Should only be the original")
 }
 
+func (s *testSuite) Test3_IG_Update() {
+	_, file, _, _ := runtime.Caller(0)
+	keyfile, err := os.ReadFile(filepath.Join(file, "../test/azure_test.json"))
+	assert.NoError(s.T(), err)
+	id, err := s.integDataGateway.Create("anAlias", sdk.ProviderTypeAzure, keyfile)
+	assert.NoError(s.T(), err)
+	apps := s.Data.Integrations[id].Apps
+	s.Data.ActionMappings = append(s.Data.ActionMappings, &ActionMappingRecord{From: id, To: s.test1Id})
+
+	newKey, err := os.ReadFile(filepath.Join(file, "../test/gcp_test.json"))
+	assert.NoError(s.T(), err)
+	alias, err := s.integDataGateway.Update(id, "aNewAlias", newKey)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "aNewAlias", alias)
+	record, err := s.integDataGateway.FindById("aNewAlias")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), newKey, record.Key)
+	assert.True(s.T(), record.UpdatedAt.After(record.CreatedAt))
+	assert.Equal(s.T(), record.UpdatedAt, record.KeyRotatedAt, "the rotation is recorded")
+	assert.Equal(s.T(), apps, s.Data.Integrations["aNewAlias"].Apps, "applications keep their aliases")
+	assert.Equal(s.T(), "aNewAlias", s.Data.ActionMappings[len(s.Data.ActionMappings)-1].From, "mappings follow the new alias")
+	_, err = s.integDataGateway.FindById(id)
+	assert.Error(s.T(), err)
+
+	_, err = s.integDataGateway.Update("aNewAlias", "", nil)
+	assert.NoError(s.T(), err)
+	renamed, _ := s.integDataGateway.FindById("aNewAlias")
+	assert.Equal(s.T(), record.KeyRotatedAt, renamed.KeyRotatedAt, "only replacing the key is a rotation")
+
+	_, err = s.integDataGateway.Update("aNewAlias", s.test1Id, nil)
+	assert.Error(s.T(), err, "alias should be unique")
+	_, err = s.integDataGateway.Update("notfound", "", nil)
+	assert.Error(s.T(), err, "integration does not exist")
+	assert.NoError(s.T(), s.integDataGateway.Delete("aNewAlias"))
+	assert.Len(s.T(), s.Data.Integrations, 1, "Should only be the original")
+}
+
 func (s *testSuite) Test4_AG_Find() {
 	// Gen more test data
 	_, file, _, _ := runtime.Caller(0)
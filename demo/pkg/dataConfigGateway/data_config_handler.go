@@ -2,36 +2,102 @@
 package dataConfigGateway
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"math/rand"
 	"os"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
 	"github.com/hexa-org/policy-mapper/sdk"
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/migrationSupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	"go.opentelemetry.io/otel/attribute"
+	log "golang.org/x/exp/slog"
 )
 
 const EnvIntegrationConfigFile string = "ORCHESTRATOR_CONFIG_FILE"
 
 var ConfigFile = "config.json"
 
+// discoveryOptions limits how many integrations discover their applications at once when applications are
+// refreshed. Refreshing stops at the first integration that fails, as it did when they were discovered in turn.
+var discoveryOptions = workflowsupport.Options{Limit: 4, Mode: workflowsupport.FailFast}
+
+// discover refreshes the applications of an integration from its provider, recording and tracing the call.
+func discover(integration *sdk.Integration, aliasGen func() string) ([]policyprovider.ApplicationInfo, error) {
+	providerType := ""
+	if integration.Opts.Info != nil {
+		providerType = integration.Opts.Info.Name
+	}
+	_, span := tracesupport.Start(context.Background(), providerType+" "+prometheussupport.OperationDiscover,
+		attribute.String("provider.type", providerType), attribute.String("provider.operation", prometheussupport.OperationDiscover))
+	started := time.Now()
+	apps, err := integration.GetPolicyApplicationPoints(aliasGen)
+	prometheussupport.ObserveProviderCall(providerType, prometheussupport.OperationDiscover, started, err)
+	tracesupport.End(span, err)
+	return apps, err
+}
+
 type ConfigData struct {
-	ConfigFile   string                      `json:"-"`
-	Integrations map[string]*sdk.Integration `json:"integrations"`
-	AppData      ApplicationData             `json:"-"`
+	ConfigFile      string                        `json:"-"`
+	Integrations    map[string]*sdk.Integration   `json:"integrations"`
+	Keys            map[string]*EncryptedKey      `json:"keys,omitempty"` // only populated in the stored form, see Save
+	Metadata        map[string]*IntegrationMeta   `json:"metadata,omitempty"`
+	ActionMappings  []*ActionMappingRecord        `json:"actionMappings,omitempty"`
+	SubjectMappings []*SubjectMappingRecord       `json:"subjectMappings,omitempty"`
+	Orchestrations  []*OrchestrationRecord        `json:"orchestrations,omitempty"`
+	PolicyStates    map[string]*PolicyStateRecord `json:"policyStates,omitempty"`
+	PolicyVersions  []*PolicyVersionRecord        `json:"policyVersions,omitempty"`
+	Jobs            []*JobRecord                  `json:"jobs,omitempty"`
+	DeadLetters     []*DeadLetterRecord           `json:"deadLetters,omitempty"`
+	AppData         ApplicationData               `json:"-"`
+	MappingData     ActionMappingData             `json:"-"`
+	SubjectData     SubjectMappingData            `json:"-"`
+	Orchestration   OrchestrationData             `json:"-"`
+	PolicyStateData PolicyStateData               `json:"-"`
+	VersionData     PolicyVersionData             `json:"-"`
+	JobData         JobData                       `json:"-"`
+	DeadLetterData  DeadLetterData                `json:"-"`
+	masterKey       *MasterKey
+	// mu serializes access to the stored records, the scheduled orchestrations, drift checks and jobs save
+	// concurrently with the API
+	mu sync.Mutex
+}
+
+type IntegrationMeta struct {
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	KeyRotatedAt *time.Time `json:"keyRotatedAt,omitempty"`
 }
 
 func NewIntegrationConfigData() (*ConfigData, error) {
-	config := ConfigData{Integrations: make(map[string]*sdk.Integration)}
+	config := ConfigData{Integrations: make(map[string]*sdk.Integration), Metadata: make(map[string]*IntegrationMeta)}
 	err := config.Load(os.Getenv(EnvIntegrationConfigFile))
+	if config.Metadata == nil {
+		config.Metadata = make(map[string]*IntegrationMeta)
+	}
 	config.AppData = ApplicationData{&config}
+	config.MappingData = ActionMappingData{&config}
+	config.SubjectData = SubjectMappingData{&config}
+	config.Orchestration = OrchestrationData{&config}
+	config.PolicyStateData = PolicyStateData{&config}
+	config.VersionData = PolicyVersionData{&config}
+	config.JobData = JobData{&config}
+	config.DeadLetterData = DeadLetterData{&config}
 	return &config, err
 }
 
@@ -39,6 +105,34 @@ func (c *ConfigData) GetApplicationDataGateway() ApplicationsDataGateway {
 	return &c.AppData
 }
 
+func (c *ConfigData) GetActionMappingDataGateway() ActionMappingsDataGateway {
+	return &c.MappingData
+}
+
+func (c *ConfigData) GetSubjectMappingDataGateway() SubjectMappingsDataGateway {
+	return &c.SubjectData
+}
+
+func (c *ConfigData) GetOrchestrationDataGateway() OrchestrationsDataGateway {
+	return &c.Orchestration
+}
+
+func (c *ConfigData) GetPolicyStateDataGateway() PolicyStatesDataGateway {
+	return &c.PolicyStateData
+}
+
+func (c *ConfigData) GetPolicyVersionDataGateway() PolicyVersionsDataGateway {
+	return &c.VersionData
+}
+
+func (c *ConfigData) GetJobDataGateway() JobsDataGateway {
+	return &c.JobData
+}
+
+func (c *ConfigData) GetDeadLetterDataGateway() DeadLettersDataGateway {
+	return &c.DeadLetterData
+}
+
 func (c *ConfigData) GetIntegration(alias string) *sdk.Integration {
 	integration, exist := c.Integrations[alias]
 	if exist {
@@ -63,6 +157,16 @@ func (c *ConfigData) GetApplicationInfo(applicationAlias string) (*sdk.Integrati
 	return nil, nil
 }
 
+// ConfigDir returns the directory of the config file named by EnvIntegrationConfigFile, ~/.hexa by default, creating it
+// when missing. Both data stores keep the master key there.
+func ConfigDir() (string, error) {
+	var config ConfigData
+	if err := config.checkConfigPath(os.Getenv(EnvIntegrationConfigFile)); err != nil {
+		return "", err
+	}
+	return filepath.Dir(config.ConfigFile), nil
+}
+
 func (c *ConfigData) checkConfigPath(configPath string) error {
 
 	if configPath == "" {
@@ -103,6 +207,12 @@ func (c *ConfigData) checkConfigPath(configPath string) error {
 func (c *ConfigData) Load(configPath string) error {
 	// configFile := filepath.Join(g.Config, ConfigFile)
 	c.checkConfigPath(configPath)
+	masterKey, err := LoadMasterKey(filepath.Dir(c.ConfigFile))
+	if err != nil {
+		return err
+	}
+	c.masterKey = masterKey
+
 	if _, err := os.Stat(c.ConfigFile); os.IsNotExist(err) {
 		return nil // No existing configuration
 	}
@@ -118,21 +228,113 @@ func (c *ConfigData) Load(configPath string) error {
 	err = json.Unmarshal(configBytes, c)
 	if err != nil {
 		fmt.Println("Error parsing stored configuration: " + err.Error())
+		return err
 	}
-	return err
+	return c.decryptKeys()
+}
+
+// decryptKeys replaces the stored encrypted keys with the key material. Configurations written before keys were
+// encrypted hold the key material in plaintext, these are re-saved encrypted.
+func (c *ConfigData) decryptKeys() error {
+	plaintextFound := false
+	for alias, integration := range c.Integrations {
+		info := integration.Opts.Info
+		if info == nil {
+			continue
+		}
+		encrypted, exist := c.Keys[alias]
+		if !exist {
+			plaintextFound = plaintextFound || len(info.Key) > 0
+			continue
+		}
+		key, err := c.masterKey.Open(alias, encrypted)
+		if err != nil {
+			return err
+		}
+		info.Key = key
+	}
+	c.Keys = nil
+
+	if plaintextFound {
+		log.Info("Encrypting plaintext integration keys", "file", c.ConfigFile, "masterKey", c.masterKey.Id)
+		return c.Save()
+	}
+	return nil
+}
+
+// RotateMasterKey re-encrypts all integration keys with newKey.
+func (c *ConfigData) RotateMasterKey(newKey *MasterKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous := c.masterKey
+	c.masterKey = newKey
+	if err := c.save(); err != nil {
+		c.masterKey = previous
+		return err
+	}
+	return nil
+}
+
+func (c *ConfigData) MasterKey() *MasterKey {
+	return c.masterKey
+}
+
+// sealed returns the form of the configuration written to disk, where the key material of each integration is
+// replaced by an EncryptedKey.
+func (c *ConfigData) sealed() (*ConfigData, error) {
+	stored := &ConfigData{
+		Integrations:    make(map[string]*sdk.Integration, len(c.Integrations)),
+		Keys:            make(map[string]*EncryptedKey, len(c.Integrations)),
+		Metadata:        c.Metadata,
+		ActionMappings:  c.ActionMappings,
+		SubjectMappings: c.SubjectMappings,
+		Orchestrations:  c.Orchestrations,
+		PolicyStates:    c.PolicyStates,
+		PolicyVersions:  c.PolicyVersions,
+		Jobs:            c.Jobs,
+		DeadLetters:     c.DeadLetters,
+	}
+	for alias, integration := range c.Integrations {
+		storedIntegration := *integration
+		if integration.Opts.Info != nil {
+			info := *integration.Opts.Info
+			encrypted, err := c.masterKey.Seal(alias, info.Key)
+			if err != nil {
+				return nil, err
+			}
+			stored.Keys[alias] = encrypted
+			info.Key = nil
+			storedIntegration.Opts.Info = &info
+		}
+		stored.Integrations[alias] = &storedIntegration
+	}
+	return stored, nil
 }
 
 func (c *ConfigData) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
 
-	out, err := json.MarshalIndent(c, "", " ")
+// save writes the configuration, the caller holds mu.
+func (c *ConfigData) save() error {
+	stored, err := c.sealed()
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(c.ConfigFile, out, 0660)
+
+	out, err := json.MarshalIndent(stored, "", " ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(c.ConfigFile, out, 0600)
 	if err != nil {
 		fmt.Println("Error saving configuration: " + err.Error())
+		return err
 	}
-	return err
+	// files created before keys were encrypted are group readable
+	return os.Chmod(c.ConfigFile, 0600)
 }
 
 func (c *ConfigData) Create(alias string, providerType string, key []byte) (string, error) {
@@ -150,41 +352,144 @@ func (c *ConfigData) Create(alias string, providerType string, key []byte) (stri
 
 	integration.Alias = alias
 
-	_, err = integration.GetPolicyApplicationPoints(func() string {
+	_, err = discover(integration, func() string {
 		return generateAliasOfSize(4)
 	})
 	if err != nil {
 		return "", err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now().UTC()
 	c.Integrations[integration.Alias] = integration
-	c.Save()
+	c.Metadata[integration.Alias] = &IntegrationMeta{CreatedAt: now, UpdatedAt: now}
+	c.save()
 	return integration.Alias, err
 }
 
 func (c *ConfigData) Find() []IntegrationRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	resp := make([]IntegrationRecord, 0)
 	for _, integration := range c.Integrations {
-		resp = append(resp, mapIntegrationRecord(integration))
+		resp = append(resp, c.mapIntegrationRecord(integration))
 	}
 	return resp
 }
 
 func (c *ConfigData) FindById(id string) (IntegrationRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	integration, exist := c.Integrations[id]
 	if !exist {
 		return IntegrationRecord{}, errors.New("integration does not exist")
 	}
-	return mapIntegrationRecord(integration), nil
+	return c.mapIntegrationRecord(integration), nil
+}
+
+func (c *ConfigData) Update(id string, alias string, key []byte) (string, error) {
+	c.mu.Lock()
+	integration, exists := c.Integrations[id]
+	var apps map[string]policyprovider.ApplicationInfo
+	if exists {
+		apps = maps.Clone(integration.Apps)
+	}
+	c.mu.Unlock()
+	if !exists {
+		return "", errors.New("integration does not exist")
+	}
+	if alias == "" {
+		alias = id
+	}
+
+	// the new key is checked before taking the lock again, so that other calls are not held up by the provider
+	var replaced *sdk.Integration
+	if len(key) > 0 {
+		var err error
+		replaced, err = sdk.OpenIntegration(sdk.WithIntegrationInfo(policyprovider.IntegrationInfo{
+			Name: integration.Opts.Info.Name,
+			Key:  key,
+		}))
+		if err != nil {
+			return "", err
+		}
+		// discovery matches the applications to their aliases by object id
+		replaced.Apps = apps
+		if _, err = discover(replaced, func() string {
+			return generateAliasOfSize(4)
+		}); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrKeyRejected, err.Error())
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, exists := c.Integrations[id]; !exists || current != integration {
+		return "", fmt.Errorf("integration %s was changed while it was being updated", id)
+	}
+	if _, taken := c.Integrations[alias]; taken && alias != id {
+		return "", fmt.Errorf("integration %s already exists", alias)
+	}
+	now := time.Now().UTC()
+	meta, exists := c.Metadata[id]
+	if !exists {
+		meta = &IntegrationMeta{}
+	}
+	if replaced != nil {
+		integration = replaced
+		meta.KeyRotatedAt = &now
+	}
+	integration.Alias = alias
+	meta.UpdatedAt = now
+	delete(c.Integrations, id)
+	delete(c.Metadata, id)
+	c.Integrations[alias] = integration
+	c.Metadata[alias] = meta
+	for _, mapping := range c.ActionMappings {
+		mapping.From, mapping.To = renamed(mapping.From, id, alias), renamed(mapping.To, id, alias)
+	}
+	for _, mapping := range c.SubjectMappings {
+		mapping.From, mapping.To = renamed(mapping.From, id, alias), renamed(mapping.To, id, alias)
+	}
+	return alias, c.save()
+}
+
+func renamed(value string, from string, to string) string {
+	if value == from {
+		return to
+	}
+	return value
 }
 
 func (c *ConfigData) Delete(name string) error {
-	_, exists := c.Integrations[name]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	integration, exists := c.Integrations[name]
 	if !exists {
 		return errors.New("integration does not exist")
 	}
+	aliases := map[string]bool{name: true}
+	objectIds := make([]string, 0, len(integration.Apps))
+	for alias, app := range integration.Apps {
+		aliases[alias] = true
+		objectIds = append(objectIds, app.ObjectID)
+	}
+	c.ActionMappings = slices.DeleteFunc(c.ActionMappings, func(mapping *ActionMappingRecord) bool {
+		return aliases[mapping.From] || aliases[mapping.To]
+	})
+	c.SubjectMappings = slices.DeleteFunc(c.SubjectMappings, func(mapping *SubjectMappingRecord) bool {
+		return aliases[mapping.From] || aliases[mapping.To]
+	})
 	delete(c.Integrations, name)
-	return c.Save()
+	delete(c.Metadata, name)
+	if err := c.save(); err != nil {
+		return err
+	}
+	for _, objectId := range objectIds {
+		prometheussupport.ForgetPolicies(integration.GetType(), objectId)
+	}
+	return nil
 }
 
 type ApplicationData struct {
@@ -192,34 +497,86 @@ type ApplicationData struct {
 }
 
 func (a ApplicationData) Find(refresh bool) ([]ApplicationRecord, error) {
-	resp := make([]ApplicationRecord, 0)
+	if refresh {
+		if err := a.refresh(); err != nil {
+			return nil, err
+		}
+	}
 
+	a.data.mu.Lock()
+	defer a.data.mu.Unlock()
+	resp := make([]ApplicationRecord, 0)
 	for _, integration := range a.data.Integrations {
-		if refresh {
-			_, err := integration.GetPolicyApplicationPoints(nil)
-			if err != nil {
-				return nil, err
-			}
-		}
 		for alias, app := range integration.Apps {
 			resp = append(resp, mapApplication(alias, integration, app))
 		}
 	}
 
-	// Sort by App Name
+	// Sort by App Name, applications of the same name in the order their integrations were added
+	added := func(app ApplicationRecord) time.Time {
+		if meta, exist := a.data.Metadata[app.IntegrationId]; exist {
+			return meta.CreatedAt
+		}
+		return time.Time{}
+	}
 	sort.Slice(resp, func(i, j int) bool {
-		return resp[i].Name < resp[j].Name
+		if resp[i].Name != resp[j].Name {
+			return resp[i].Name < resp[j].Name
+		}
+		if !added(resp[i]).Equal(added(resp[j])) {
+			return added(resp[i]).Before(added(resp[j]))
+		}
+		return resp[i].ID < resp[j].ID
 	})
 
 	return resp, nil
 }
 
+// refresh discovers the applications of each integration without holding the lock, so that a slow provider does not
+// hold up other calls, and then stores them for the integrations that were not changed in the meantime.
+func (a ApplicationData) refresh() error {
+	type snapshot struct {
+		id       string
+		original *sdk.Integration
+	}
+	a.data.mu.Lock()
+	snapshots := make(map[*sdk.Integration]snapshot, len(a.data.Integrations))
+	integrations := make([]*sdk.Integration, 0, len(a.data.Integrations))
+	for id, integration := range a.data.Integrations {
+		// discovery replaces the applications of the copy, the provider is shared with the original
+		discovered := *integration
+		snapshots[&discovered] = snapshot{id, integration}
+		integrations = append(integrations, &discovered)
+	}
+	a.data.mu.Unlock()
+
+	_, err := workflowsupport.Process(context.Background(), integrations, discoveryOptions, func(_ context.Context, integration *sdk.Integration) (bool, error) {
+		_, err := discover(integration, nil)
+		return err == nil, err
+	})
+	if err != nil {
+		return err
+	}
+
+	a.data.mu.Lock()
+	defer a.data.mu.Unlock()
+	for _, discovered := range integrations {
+		taken := snapshots[discovered]
+		if current, exists := a.data.Integrations[taken.id]; exists && current == taken.original {
+			taken.original.Apps = discovered.Apps
+		}
+	}
+	return nil
+}
+
 func (a ApplicationData) FindByObjectId(objectId string) (*ApplicationRecord, error) {
 	// GetApplicationInfo works on id or objectid
 	return a.FindById(objectId)
 }
 
 func (a ApplicationData) FindById(id string) (*ApplicationRecord, error) {
+	a.data.mu.Lock()
+	defer a.data.mu.Unlock()
 	integration, app := a.data.GetApplicationInfo(id)
 	if app == nil {
 		return nil, errors.New(fmt.Sprintf("application %s not found", id))
@@ -230,14 +587,474 @@ func (a ApplicationData) FindById(id string) (*ApplicationRecord, error) {
 
 func (a ApplicationData) DeleteById(id string) error {
 	// Comment this used to be important when we were cleaning up database. This doesn't do much, since a refresh auto-populates.
+	a.data.mu.Lock()
+	defer a.data.mu.Unlock()
 	integration, app := a.data.GetApplicationInfo(id)
 	if app == nil {
 		return errors.New(fmt.Sprintf("application %s not found", id))
 	}
 	delete(integration.Apps, id)
+	prometheussupport.ForgetPolicies(integration.GetType(), app.ObjectID)
 	return nil
 }
 
+type ActionMappingData struct {
+	data *ConfigData
+}
+
+func (m ActionMappingData) Find() ([]ActionMappingRecord, error) {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	resp := make([]ActionMappingRecord, 0, len(m.data.ActionMappings))
+	for _, mapping := range m.data.ActionMappings {
+		resp = append(resp, *mapping)
+	}
+	return resp, nil
+}
+
+func (m ActionMappingData) FindByPair(from string, to string) (*ActionMappingRecord, error) {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	for _, mapping := range m.data.ActionMappings {
+		if mapping.From == from && mapping.To == to {
+			found := *mapping
+			return &found, nil
+		}
+	}
+	return nil, ErrActionMappingNotFound
+}
+
+func (m ActionMappingData) Save(record ActionMappingRecord) error {
+	record, err := cleanActionMapping(record)
+	if err != nil {
+		return err
+	}
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	mappings := slices.DeleteFunc(m.data.ActionMappings, func(mapping *ActionMappingRecord) bool {
+		return mapping.From == record.From && mapping.To == record.To
+	})
+	m.data.ActionMappings = append(mappings, &record)
+	return m.data.save()
+}
+
+func (m ActionMappingData) Delete(from string, to string) error {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	count := len(m.data.ActionMappings)
+	m.data.ActionMappings = slices.DeleteFunc(m.data.ActionMappings, func(mapping *ActionMappingRecord) bool {
+		return mapping.From == from && mapping.To == to
+	})
+	if len(m.data.ActionMappings) == count {
+		return ErrActionMappingNotFound
+	}
+	return m.data.save()
+}
+
+type SubjectMappingData struct {
+	data *ConfigData
+}
+
+func (m SubjectMappingData) Find() ([]SubjectMappingRecord, error) {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	resp := make([]SubjectMappingRecord, 0, len(m.data.SubjectMappings))
+	for _, mapping := range m.data.SubjectMappings {
+		resp = append(resp, *mapping)
+	}
+	return resp, nil
+}
+
+func (m SubjectMappingData) FindByPair(from string, to string) (*SubjectMappingRecord, error) {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	for _, mapping := range m.data.SubjectMappings {
+		if mapping.From == from && mapping.To == to {
+			found := *mapping
+			return &found, nil
+		}
+	}
+	return nil, ErrSubjectMappingNotFound
+}
+
+func (m SubjectMappingData) Save(record SubjectMappingRecord) error {
+	record, err := cleanSubjectMapping(record)
+	if err != nil {
+		return err
+	}
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	mappings := slices.DeleteFunc(m.data.SubjectMappings, func(mapping *SubjectMappingRecord) bool {
+		return mapping.From == record.From && mapping.To == record.To
+	})
+	m.data.SubjectMappings = append(mappings, &record)
+	return m.data.save()
+}
+
+func (m SubjectMappingData) Delete(from string, to string) error {
+	m.data.mu.Lock()
+	defer m.data.mu.Unlock()
+	count := len(m.data.SubjectMappings)
+	m.data.SubjectMappings = slices.DeleteFunc(m.data.SubjectMappings, func(mapping *SubjectMappingRecord) bool {
+		return mapping.From == from && mapping.To == to
+	})
+	if len(m.data.SubjectMappings) == count {
+		return ErrSubjectMappingNotFound
+	}
+	return m.data.save()
+}
+
+// OrchestrationData stores orchestration definitions in the config file. Runs are recorded by the scheduler while
+// definitions are edited through the API, so access is serialized.
+type OrchestrationData struct {
+	data *ConfigData
+}
+
+func (o OrchestrationData) Find() ([]OrchestrationRecord, error) {
+	o.data.mu.Lock()
+	defer o.data.mu.Unlock()
+	resp := make([]OrchestrationRecord, 0, len(o.data.Orchestrations))
+	for _, orchestration := range o.data.Orchestrations {
+		resp = append(resp, *orchestration)
+	}
+	return resp, nil
+}
+
+func (o OrchestrationData) FindById(id string) (*OrchestrationRecord, error) {
+	o.data.mu.Lock()
+	defer o.data.mu.Unlock()
+	orchestration, err := o.find(id)
+	if err != nil {
+		return nil, err
+	}
+	found := *orchestration
+	return &found, nil
+}
+
+func (o OrchestrationData) Create(record OrchestrationRecord) (string, error) {
+	if err := checkOrchestration(record); err != nil {
+		return "", err
+	}
+	o.data.mu.Lock()
+	defer o.data.mu.Unlock()
+	now := time.Now().UTC()
+	record.ID = uuid.NewString()
+	record.LastRun = nil
+	record.CreatedAt, record.UpdatedAt = now, now
+	o.data.Orchestrations = append(o.data.Orchestrations, &record)
+	return record.ID, o.data.save()
+}
+
+func (o OrchestrationData) Update(record OrchestrationRecord) error {
+	if err := checkOrchestration(record); err != nil {
+		return err
+	}
+	o.data.mu.Lock()
+	defer o.data.mu.Unlock()
+	orchestration, err := o.find(record.ID)
+	if err != nil {
+		return err
+	}
+	orchestration.Name = record.Name
+	orchestration.From = record.From
+	orchestration.To = record.To
+	orchestration.Resources = record.Resources
+	orchestration.Schedule = record.Schedule
+	orchestration.UpdatedAt = time.Now().UTC()
+	return o.data.save()
+}
+
+func (o OrchestrationData) SetPaused(id string, paused bool) error {
+	o.data.mu.Lock()
+	defer o.data.mu.Unlock()
+	orchestration, err := o.find(id)
+	if err != nil {
+		return err
+	}
+	orchestration.Paused = paused
+	orchestration.UpdatedAt = time.Now().UTC()
+	return o.data.save()
+}
+
+func (o OrchestrationData) RecordRun(id string, run OrchestrationRun) error {
+	o.data.mu.Lock()
+	defer o.data.mu.Unlock()
+	orchestration, err := o.find(id)
+	if err != nil {
+		return err
+	}
+	orchestration.LastRun = &run
+	return o.data.save()
+}
+
+func (o OrchestrationData) Delete(id string) error {
+	o.data.mu.Lock()
+	defer o.data.mu.Unlock()
+	if _, err := o.find(id); err != nil {
+		return err
+	}
+	o.data.Orchestrations = slices.DeleteFunc(o.data.Orchestrations, func(orchestration *OrchestrationRecord) bool {
+		return orchestration.ID == id
+	})
+	return o.data.save()
+}
+
+func (o OrchestrationData) find(id string) (*OrchestrationRecord, error) {
+	for _, orchestration := range o.data.Orchestrations {
+		if orchestration.ID == id {
+			return orchestration, nil
+		}
+	}
+	return nil, ErrOrchestrationNotFound
+}
+
+// PolicyStateData stores the desired policies of applications in the config file, keyed by application alias.
+type PolicyStateData struct {
+	data *ConfigData
+}
+
+func (p PolicyStateData) Find() ([]PolicyStateRecord, error) {
+	p.data.mu.Lock()
+	defer p.data.mu.Unlock()
+	resp := make([]PolicyStateRecord, 0, len(p.data.PolicyStates))
+	for _, state := range p.data.PolicyStates {
+		resp = append(resp, *state)
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].ApplicationId < resp[j].ApplicationId
+	})
+	return resp, nil
+}
+
+func (p PolicyStateData) FindByApplication(applicationId string) (*PolicyStateRecord, error) {
+	p.data.mu.Lock()
+	defer p.data.mu.Unlock()
+	state, exist := p.data.PolicyStates[applicationId]
+	if !exist {
+		return nil, ErrPolicyStateNotFound
+	}
+	found := *state
+	return &found, nil
+}
+
+func (p PolicyStateData) SetDesired(applicationId string, policies []hexapolicy.PolicyInfo, declared bool) error {
+	p.data.mu.Lock()
+	defer p.data.mu.Unlock()
+	if p.data.PolicyStates == nil {
+		p.data.PolicyStates = make(map[string]*PolicyStateRecord)
+	}
+	if policies == nil {
+		policies = []hexapolicy.PolicyInfo{}
+	}
+	p.data.PolicyStates[applicationId] = &PolicyStateRecord{
+		ApplicationId: applicationId,
+		Desired:       policies,
+		Declared:      declared,
+		DesiredAt:     time.Now().UTC(),
+	}
+	return p.data.save()
+}
+
+func (p PolicyStateData) RecordDrift(applicationId string, drift DriftRecord) error {
+	p.data.mu.Lock()
+	defer p.data.mu.Unlock()
+	state, exist := p.data.PolicyStates[applicationId]
+	if !exist {
+		return ErrPolicyStateNotFound
+	}
+	state.Drift = &drift
+	return p.data.save()
+}
+
+func (p PolicyStateData) Delete(applicationId string) error {
+	p.data.mu.Lock()
+	defer p.data.mu.Unlock()
+	if _, exist := p.data.PolicyStates[applicationId]; !exist {
+		return ErrPolicyStateNotFound
+	}
+	delete(p.data.PolicyStates, applicationId)
+	return p.data.save()
+}
+
+// PolicyVersionData stores policy versions in the config file, in the order they were created.
+type PolicyVersionData struct {
+	data *ConfigData
+}
+
+func (v PolicyVersionData) Find(applicationId string) ([]PolicyVersionRecord, error) {
+	v.data.mu.Lock()
+	defer v.data.mu.Unlock()
+	resp := make([]PolicyVersionRecord, 0)
+	for _, version := range v.data.PolicyVersions {
+		if version.ApplicationId == applicationId {
+			resp = append(resp, *version)
+		}
+	}
+	return resp, nil
+}
+
+func (v PolicyVersionData) FindByVersion(applicationId string, version int) (*PolicyVersionRecord, error) {
+	v.data.mu.Lock()
+	defer v.data.mu.Unlock()
+	for _, found := range v.data.PolicyVersions {
+		if found.ApplicationId == applicationId && found.Version == version {
+			record := *found
+			return &record, nil
+		}
+	}
+	return nil, ErrPolicyVersionNotFound
+}
+
+func (v PolicyVersionData) Create(record PolicyVersionRecord) (int, error) {
+	v.data.mu.Lock()
+	defer v.data.mu.Unlock()
+	record.Version = 1
+	for _, found := range v.data.PolicyVersions {
+		if found.ApplicationId == record.ApplicationId && found.Version >= record.Version {
+			record.Version = found.Version + 1
+		}
+	}
+	if record.Policies == nil {
+		record.Policies = []hexapolicy.PolicyInfo{}
+	}
+	record.CreatedAt = time.Now().UTC()
+	v.data.PolicyVersions = append(v.data.PolicyVersions, &record)
+	return record.Version, v.data.save()
+}
+
+// JobData stores jobs in the config file, in the order they were created.
+type JobData struct {
+	data *ConfigData
+}
+
+func (j JobData) FindById(id string) (*JobRecord, error) {
+	j.data.mu.Lock()
+	defer j.data.mu.Unlock()
+	job, err := j.find(id)
+	if err != nil {
+		return nil, err
+	}
+	found := *job
+	found.Steps = slices.Clone(job.Steps)
+	return &found, nil
+}
+
+func (j JobData) FindByState(state string) ([]JobRecord, error) {
+	j.data.mu.Lock()
+	defer j.data.mu.Unlock()
+	resp := make([]JobRecord, 0)
+	for _, job := range j.data.Jobs {
+		if job.State == state {
+			found := *job
+			found.Steps = slices.Clone(job.Steps)
+			resp = append(resp, found)
+		}
+	}
+	return resp, nil
+}
+
+func (j JobData) Create(record JobRecord) (string, error) {
+	j.data.mu.Lock()
+	defer j.data.mu.Unlock()
+	now := time.Now().UTC()
+	record.ID = uuid.NewString()
+	record.State = JobPending
+	record.CreatedAt, record.UpdatedAt = now, now
+	j.data.Jobs = append(j.data.Jobs, &record)
+	return record.ID, j.data.save()
+}
+
+func (j JobData) Update(record JobRecord) error {
+	j.data.mu.Lock()
+	defer j.data.mu.Unlock()
+	job, err := j.find(record.ID)
+	if err != nil {
+		return err
+	}
+	job.State = record.State
+	job.Steps = slices.Clone(record.Steps)
+	job.Result = record.Result
+	job.Error = record.Error
+	job.UpdatedAt = time.Now().UTC()
+	return j.data.save()
+}
+
+func (j JobData) Claim(id, owner string, expired time.Time) error {
+	j.data.mu.Lock()
+	defer j.data.mu.Unlock()
+	job, err := j.find(id)
+	if err != nil {
+		return err
+	}
+	if job.State != JobPending && (job.State != JobRunning || !job.HeartbeatAt.Before(expired)) {
+		return ErrJobClaimed
+	}
+	now := time.Now().UTC()
+	job.State = JobRunning
+	job.Owner = owner
+	job.HeartbeatAt, job.UpdatedAt = now, now
+	return j.data.save()
+}
+
+func (j JobData) Heartbeat(id, owner string) error {
+	j.data.mu.Lock()
+	defer j.data.mu.Unlock()
+	job, err := j.find(id)
+	if err != nil {
+		return err
+	}
+	if job.Owner != owner {
+		return ErrJobClaimed
+	}
+	job.HeartbeatAt = time.Now().UTC()
+	return j.data.save()
+}
+
+func (j JobData) find(id string) (*JobRecord, error) {
+	for _, job := range j.data.Jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// DeadLetterData stores dead letters in the config file, in the order the work failed.
+type DeadLetterData struct {
+	data *ConfigData
+}
+
+func (d DeadLetterData) Find() ([]DeadLetterRecord, error) {
+	d.data.mu.Lock()
+	defer d.data.mu.Unlock()
+	resp := make([]DeadLetterRecord, 0, len(d.data.DeadLetters))
+	for _, deadLetter := range d.data.DeadLetters {
+		resp = append(resp, *deadLetter)
+	}
+	return resp, nil
+}
+
+func (d DeadLetterData) Create(record DeadLetterRecord) (string, error) {
+	d.data.mu.Lock()
+	defer d.data.mu.Unlock()
+	record.ID = uuid.NewString()
+	record.FailedAt = record.FailedAt.UTC()
+	d.data.DeadLetters = append(d.data.DeadLetters, &record)
+	return record.ID, d.data.save()
+}
+
+func (d DeadLetterData) Delete(id string) error {
+	d.data.mu.Lock()
+	defer d.data.mu.Unlock()
+	if !slices.ContainsFunc(d.data.DeadLetters, func(deadLetter *DeadLetterRecord) bool { return deadLetter.ID == id }) {
+		return ErrDeadLetterNotFound
+	}
+	d.data.DeadLetters = slices.DeleteFunc(d.data.DeadLetters, func(deadLetter *DeadLetterRecord) bool {
+		return deadLetter.ID == id
+	})
+	return d.data.save()
+}
+
 func mapApplication(id string, integ *sdk.Integration, app policyprovider.ApplicationInfo) ApplicationRecord {
 	return ApplicationRecord{
 		ID:            id,
@@ -249,14 +1066,26 @@ func mapApplication(id string, integ *sdk.Integration, app policyprovider.Applic
 	}
 }
 
-func mapIntegrationRecord(integration *sdk.Integration) IntegrationRecord {
+func (c *ConfigData) mapIntegrationRecord(integration *sdk.Integration) IntegrationRecord {
 	info := integration.Opts.Info
-	return IntegrationRecord{
+	record := IntegrationRecord{
 		ID:       integration.Alias,
 		Name:     info.Name,
 		Provider: integration.GetType(),
 		Key:      info.Key,
+		AppCount: len(integration.Apps),
+	}
+	if c.masterKey != nil {
+		record.KeyFingerprint = c.masterKey.Fingerprint(info.Key)
+	}
+	if meta, exist := c.Metadata[integration.Alias]; exist {
+		record.CreatedAt = meta.CreatedAt
+		record.UpdatedAt = meta.UpdatedAt
+		if meta.KeyRotatedAt != nil {
+			record.KeyRotatedAt = *meta.KeyRotatedAt
+		}
 	}
+	return record
 }
 
 var src = rand.NewSource(time.Now().UnixNano())
@@ -1,17 +1,40 @@
 package dataConfigGateway
 
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+)
+
+// ErrKeyRejected is returned when the applications of an integration cannot be discovered with a replacement key.
+var ErrKeyRejected = errors.New("the provider did not accept the key")
+
 type IntegrationsDataGateway interface {
 	Create(alias string, providerType string, key []byte) (string, error)
 	Find() []IntegrationRecord
 	Delete(id string) error
 	FindById(id string) (IntegrationRecord, error)
+	// Update renames the integration id to alias and replaces its key, leaving either unchanged when empty, and
+	// returns the alias of the integration. The applications keep their aliases. A replacement key is only stored
+	// once the applications have been discovered with it, otherwise ErrKeyRejected is returned, and the rotation is
+	// recorded as KeyRotatedAt.
+	Update(id string, alias string, key []byte) (string, error)
 }
 
 type IntegrationRecord struct {
-	ID       string
-	Name     string
-	Provider string
-	Key      []byte
+	ID             string
+	Name           string
+	Provider       string
+	Key            []byte
+	KeyFingerprint string    // see MasterKey.Fingerprint
+	CreatedAt      time.Time // zero when the integration predates metadata being recorded
+	UpdatedAt      time.Time
+	KeyRotatedAt   time.Time // zero when the key has not been replaced since the integration was created
+	AppCount       int
 }
 
 type ApplicationRecord struct {
@@ -29,3 +52,262 @@ type ApplicationsDataGateway interface {
 	FindById(id string) (*ApplicationRecord, error)
 	DeleteById(id string) error
 }
+
+var ErrActionMappingNotFound = errors.New("action mapping does not exist")
+
+// ActionMappingRecord translates the action uris used by one integration or application (From) into those used by
+// another (To). Both are aliases, a mapping between two applications takes precedence over one between their
+// integrations.
+type ActionMappingRecord struct {
+	From    string              `json:"from"`
+	To      string              `json:"to"`
+	Actions map[string][]string `json:"actions"` // source action uri to target action uris
+}
+
+type ActionMappingsDataGateway interface {
+	Find() ([]ActionMappingRecord, error)
+	FindByPair(from string, to string) (*ActionMappingRecord, error) // ErrActionMappingNotFound when none is stored
+	Save(record ActionMappingRecord) error                           // replaces any mapping stored for the pair
+	Delete(from string, to string) error
+}
+
+var ErrSubjectMappingNotFound = errors.New("subject mapping does not exist")
+
+// SubjectMappingRecord translates the subjects of one identity domain (From) into another (To), keyed by alias in
+// the same way as ActionMappingRecord.
+type SubjectMappingRecord struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Subjects map[string]string `json:"subjects,omitempty"` // static lookup, e.g. user:alice@corp.com to user:5f3c...
+	Domains  map[string]string `json:"domains,omitempty"`  // domain rewrites, e.g. corp.com to corp.onmicrosoft.com
+	Groups   map[string]string `json:"groups,omitempty"`   // group names, e.g. admins to a group object id
+}
+
+type SubjectMappingsDataGateway interface {
+	Find() ([]SubjectMappingRecord, error)
+	FindByPair(from string, to string) (*SubjectMappingRecord, error) // ErrSubjectMappingNotFound when none is stored
+	Save(record SubjectMappingRecord) error                           // replaces any mapping stored for the pair
+	Delete(from string, to string) error
+}
+
+var ErrOrchestrationNotFound = errors.New("orchestration does not exist")
+
+type ResourceRuleRecord struct {
+	Match  string `json:"match"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// OrchestrationRecord is a named orchestration from one application to one or more target applications. Action and
+// subject mappings are found by application or integration pair, resource rules are stored with the definition.
+type OrchestrationRecord struct {
+	ID        string               `json:"id"`
+	Name      string               `json:"name"`
+	From      string               `json:"from"`
+	To        []string             `json:"to"`
+	Resources []ResourceRuleRecord `json:"resources,omitempty"`
+	Schedule  string               `json:"schedule,omitempty"` // empty when the orchestration only runs on request
+	Paused    bool                 `json:"paused,omitempty"`
+	LastRun   *OrchestrationRun    `json:"lastRun,omitempty"`
+	CreatedAt time.Time            `json:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+type OrchestrationRun struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Error      string    `json:"error,omitempty"` // empty when all targets were updated
+}
+
+type OrchestrationsDataGateway interface {
+	Find() ([]OrchestrationRecord, error)
+	FindById(id string) (*OrchestrationRecord, error) // ErrOrchestrationNotFound when none is stored
+	Create(record OrchestrationRecord) (string, error)
+	Update(record OrchestrationRecord) error // updates the definition, the paused state and last run are kept
+	SetPaused(id string, paused bool) error
+	RecordRun(id string, run OrchestrationRun) error
+	Delete(id string) error
+}
+
+var ErrPolicyStateNotFound = errors.New("no desired policies are recorded for the application")
+
+// PolicyStateRecord holds the policies an application should have: the policies Hexa last wrote to it, or a desired
+// state declared by a user. Drift is the outcome of the last time the application's policies were compared to them.
+type PolicyStateRecord struct {
+	ApplicationId string                  `json:"applicationId"`
+	Desired       []hexapolicy.PolicyInfo `json:"desired"`
+	Declared      bool                    `json:"declared,omitempty"`
+	DesiredAt     time.Time               `json:"desiredAt"`
+	Drift         *DriftRecord            `json:"drift,omitempty"` // nil until the application is checked
+}
+
+type DriftRecord struct {
+	CheckedAt time.Time               `json:"checkedAt"`
+	Drifted   bool                    `json:"drifted"`
+	Found     []hexapolicy.PolicyInfo `json:"found,omitempty"` // the policies read from the application
+	Error     string                  `json:"error,omitempty"` // set when the policies could not be read
+}
+
+type PolicyStatesDataGateway interface {
+	Find() ([]PolicyStateRecord, error)
+	FindByApplication(applicationId string) (*PolicyStateRecord, error)                     // ErrPolicyStateNotFound when none is stored
+	SetDesired(applicationId string, policies []hexapolicy.PolicyInfo, declared bool) error // clears any recorded drift
+	RecordDrift(applicationId string, drift DriftRecord) error
+	Delete(applicationId string) error
+}
+
+var ErrPolicyVersionNotFound = errors.New("policy version does not exist")
+
+// PolicyVersionRecord is a snapshot of the policies an application had before they were overwritten. Versions are
+// numbered from 1 for each application.
+type PolicyVersionRecord struct {
+	ApplicationId string                  `json:"applicationId"`
+	Version       int                     `json:"version"`
+	Policies      []hexapolicy.PolicyInfo `json:"policies"`
+	Author        string                  `json:"author,omitempty"`
+	Reason        string                  `json:"reason,omitempty"`
+	CreatedAt     time.Time               `json:"createdAt"`
+}
+
+type PolicyVersionsDataGateway interface {
+	Find(applicationId string) ([]PolicyVersionRecord, error)                      // oldest first
+	FindByVersion(applicationId string, version int) (*PolicyVersionRecord, error) // ErrPolicyVersionNotFound when none is stored
+	Create(record PolicyVersionRecord) (int, error)                                // numbers the record after the latest version of the application
+}
+
+var ErrJobNotFound = errors.New("job does not exist")
+var ErrJobClaimed = errors.New("job is claimed by another scheduler")
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRecord is an orchestration run in the background. Request and Result hold the json the orchestrator accepts
+// and returns, so that they are stored as they are reported.
+type JobRecord struct {
+	ID        string          `json:"id"`
+	State     string          `json:"state"` // one of the Job constants
+	Author    string          `json:"author,omitempty"`
+	Request   json.RawMessage `json:"request"`
+	Steps     []JobStepRecord `json:"steps,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	// Owner is the scheduler running the job, it refreshes HeartbeatAt until the job has finished.
+	Owner       string    `json:"owner,omitempty"`
+	HeartbeatAt time.Time `json:"heartbeatAt"`
+}
+
+type JobStepRecord struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"` // JobRunning, JobSucceeded or JobFailed
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"` // zero while the step is running
+	Error      string    `json:"error,omitempty"`
+}
+
+type JobsDataGateway interface {
+	FindById(id string) (*JobRecord, error)        // ErrJobNotFound when none is stored
+	FindByState(state string) ([]JobRecord, error) // oldest first
+	Create(record JobRecord) (string, error)       // the job is stored as JobPending
+	Update(record JobRecord) error                 // saves the state, steps, result and error
+	// Claim marks a pending job, or a running job whose heartbeat is before expired, as running for owner. It
+	// returns ErrJobClaimed when the job is neither, so that only one scheduler runs it.
+	Claim(id, owner string, expired time.Time) error
+	Heartbeat(id, owner string) error // ErrJobClaimed when the job is no longer owned by owner
+}
+
+var ErrDeadLetterNotFound = errors.New("dead letter does not exist")
+
+// DeadLetterRecord is background work that failed every attempt it was allowed, kept until it is dismissed.
+type DeadLetterRecord struct {
+	ID       string    `json:"id"`
+	Kind     string    `json:"kind"`   // the work that failed, e.g. orchestration, drift or job
+	TaskId   string    `json:"taskId"` // identifies the orchestration, application or job the work was for
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+type DeadLettersDataGateway interface {
+	Find() ([]DeadLetterRecord, error) // oldest first
+	Create(record DeadLetterRecord) (string, error)
+	Delete(id string) error // ErrDeadLetterNotFound when none is stored
+}
+
+// DataGateway is implemented by each storage backend (the json config file and SQL) and gives access to all stores.
+type DataGateway interface {
+	IntegrationsDataGateway
+	GetApplicationDataGateway() ApplicationsDataGateway
+	GetActionMappingDataGateway() ActionMappingsDataGateway
+	GetSubjectMappingDataGateway() SubjectMappingsDataGateway
+	GetOrchestrationDataGateway() OrchestrationsDataGateway
+	GetPolicyStateDataGateway() PolicyStatesDataGateway
+	GetPolicyVersionDataGateway() PolicyVersionsDataGateway
+	GetJobDataGateway() JobsDataGateway
+	GetDeadLetterDataGateway() DeadLettersDataGateway
+}
+
+// cleanActionMapping drops blank actions and checks that the mapping can be stored.
+func cleanActionMapping(record ActionMappingRecord) (ActionMappingRecord, error) {
+	if record.From == "" || record.To == "" {
+		return ActionMappingRecord{}, errors.New("an action mapping requires from and to")
+	}
+	actions := make(map[string][]string, len(record.Actions))
+	for source, targets := range record.Actions {
+		source = strings.TrimSpace(source)
+		for _, target := range targets {
+			if target = strings.TrimSpace(target); source != "" && target != "" && !slices.Contains(actions[source], target) {
+				actions[source] = append(actions[source], target)
+			}
+		}
+	}
+	if len(actions) == 0 {
+		return ActionMappingRecord{}, errors.New("an action mapping requires at least one source action with a target action")
+	}
+	record.Actions = actions
+	return record, nil
+}
+
+// cleanSubjectMapping drops blank entries and checks that the mapping can be stored. Domains are compared without
+// regard to case and are stored in lower case.
+func cleanSubjectMapping(record SubjectMappingRecord) (SubjectMappingRecord, error) {
+	if record.From == "" || record.To == "" {
+		return SubjectMappingRecord{}, errors.New("a subject mapping requires from and to")
+	}
+	record.Subjects = cleanLookup(record.Subjects, false)
+	record.Domains = cleanLookup(record.Domains, true)
+	record.Groups = cleanLookup(record.Groups, false)
+	if len(record.Subjects)+len(record.Domains)+len(record.Groups) == 0 {
+		return SubjectMappingRecord{}, errors.New("a subject mapping requires at least one subject, domain or group")
+	}
+	return record, nil
+}
+
+func cleanLookup(lookup map[string]string, lower bool) map[string]string {
+	cleaned := make(map[string]string, len(lookup))
+	for source, target := range lookup {
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		if lower {
+			source, target = strings.ToLower(source), strings.ToLower(target)
+		}
+		if source != "" && target != "" {
+			cleaned[source] = target
+		}
+	}
+	if len(cleaned) == 0 {
+		return nil
+	}
+	return cleaned
+}
+
+func checkOrchestration(record OrchestrationRecord) error {
+	if record.Name == "" || record.From == "" || len(record.To) == 0 {
+		return errors.New("an orchestration requires a name, from and at least one target")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package dataConfigGateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetters_config(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	testDeadLetters(t, data)
+
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	found, err := reloaded.GetDeadLetterDataGateway().Find()
+	assert.NoError(t, err, "dead letters are persisted")
+	assert.Len(t, found, 1)
+}
+
+func TestDeadLetters_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	data, err := NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer data.Close()
+
+	testDeadLetters(t, data)
+}
+
+func testDeadLetters(t *testing.T, data DataGateway) {
+	deadLetters := data.GetDeadLetterDataGateway()
+
+	found, err := deadLetters.Find()
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	failedAt := time.Now().Add(-time.Minute)
+	id, err := deadLetters.Create(DeadLetterRecord{Kind: "job", TaskId: "aJob", Attempts: 4, Error: "oops", FailedAt: failedAt})
+	assert.NoError(t, err)
+	_, err = deadLetters.Create(DeadLetterRecord{Kind: "orchestration", TaskId: "anOrchestration", Attempts: 1, Error: "shoot", FailedAt: time.Now()})
+	assert.NoError(t, err)
+
+	found, err = deadLetters.Find()
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, id, found[0].ID)
+	assert.Equal(t, "job", found[0].Kind)
+	assert.Equal(t, "aJob", found[0].TaskId)
+	assert.Equal(t, 4, found[0].Attempts)
+	assert.Equal(t, "oops", found[0].Error)
+	assert.WithinDuration(t, failedAt, found[0].FailedAt, time.Second)
+
+	assert.NoError(t, deadLetters.Delete(id))
+	assert.ErrorIs(t, deadLetters.Delete(id), ErrDeadLetterNotFound)
+	found, err = deadLetters.Find()
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, "anOrchestration", found[0].TaskId)
+}
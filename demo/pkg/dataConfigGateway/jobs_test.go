@@ -0,0 +1,109 @@
+package dataConfigGateway
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobs_config(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	id := testJobs(t, data)
+
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	job, err := reloaded.GetJobDataGateway().FindById(id)
+	assert.NoError(t, err, "jobs are persisted")
+	assert.Equal(t, JobSucceeded, job.State)
+	assert.JSONEq(t, `{"policies":[]}`, string(job.Result))
+}
+
+func TestJobs_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	data, err := NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer data.Close()
+
+	testJobs(t, data)
+}
+
+// testJobs exercises the gateway and returns the id of the job it leaves behind.
+func testJobs(t *testing.T, data DataGateway) string {
+	jobs := data.GetJobDataGateway()
+
+	_, err := jobs.FindById("anId")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.ErrorIs(t, jobs.Update(JobRecord{ID: "anId"}), ErrJobNotFound)
+
+	id, err := jobs.Create(JobRecord{Author: "anAuthor", Request: json.RawMessage(`{"from":"anApp","to":"anotherApp"}`), State: JobSucceeded})
+	assert.NoError(t, err)
+	otherId, err := jobs.Create(JobRecord{Request: json.RawMessage(`{}`)})
+	assert.NoError(t, err)
+
+	pending, err := jobs.FindByState(JobPending)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2, "jobs are created pending")
+	assert.Equal(t, id, pending[0].ID)
+	assert.Equal(t, "anAuthor", pending[0].Author)
+	assert.JSONEq(t, `{"from":"anApp","to":"anotherApp"}`, string(pending[0].Request))
+	assert.WithinDuration(t, time.Now(), pending[0].CreatedAt, time.Minute)
+
+	job := pending[0]
+	job.State = JobSucceeded
+	job.Steps = []JobStepRecord{{Name: "aStep", State: JobSucceeded, StartedAt: time.Now().UTC(), FinishedAt: time.Now().UTC()}}
+	job.Result = json.RawMessage(`{"policies":[]}`)
+	assert.NoError(t, jobs.Update(job))
+
+	found, err := jobs.FindById(id)
+	assert.NoError(t, err)
+	assert.Equal(t, JobSucceeded, found.State)
+	assert.Len(t, found.Steps, 1)
+	assert.Equal(t, "aStep", found.Steps[0].Name)
+	assert.Empty(t, found.Error)
+
+	job = pending[1]
+	job.State = JobFailed
+	job.Error = "oops"
+	assert.NoError(t, jobs.Update(job))
+	found, err = jobs.FindById(otherId)
+	assert.NoError(t, err)
+	assert.Equal(t, "oops", found.Error)
+	assert.Empty(t, found.Steps)
+	assert.Empty(t, found.Result)
+
+	pending, err = jobs.FindByState(JobPending)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	claimedId, err := jobs.Create(JobRecord{Request: json.RawMessage(`{}`)})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, jobs.Claim("anId", "anOwner", time.Now()), ErrJobNotFound)
+	assert.ErrorIs(t, jobs.Heartbeat(claimedId, "anOwner"), ErrJobClaimed, "only the owner sends heartbeats")
+	assert.NoError(t, jobs.Claim(claimedId, "anOwner", time.Now().Add(-time.Minute)))
+	assert.ErrorIs(t, jobs.Claim(claimedId, "anotherOwner", time.Now().Add(-time.Minute)), ErrJobClaimed, "a running job is claimed once")
+	found, err = jobs.FindById(claimedId)
+	assert.NoError(t, err)
+	assert.Equal(t, JobRunning, found.State)
+	assert.Equal(t, "anOwner", found.Owner)
+	assert.WithinDuration(t, time.Now(), found.HeartbeatAt, time.Minute)
+
+	assert.NoError(t, jobs.Heartbeat(claimedId, "anOwner"))
+	assert.ErrorIs(t, jobs.Heartbeat(claimedId, "anotherOwner"), ErrJobClaimed)
+	assert.NoError(t, jobs.Claim(claimedId, "anotherOwner", time.Now().Add(time.Minute)), "a running job whose heartbeat expired is taken over")
+	found, err = jobs.FindById(claimedId)
+	assert.NoError(t, err)
+	assert.Equal(t, "anotherOwner", found.Owner)
+	assert.ErrorIs(t, jobs.Claim(id, "anOwner", time.Now().Add(time.Minute)), ErrJobClaimed, "a finished job is not claimed")
+	return id
+}
@@ -0,0 +1,193 @@
+package dataConfigGateway
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "golang.org/x/exp/slog"
+)
+
+const (
+	EnvMasterKey     string = "ORCHESTRATOR_MASTER_KEY"      // base64 encoded 256-bit key
+	EnvMasterKeyFile string = "ORCHESTRATOR_MASTER_KEY_FILE" // file holding a base64 encoded 256-bit key
+
+	MasterKeyFile = "master.key"
+	masterKeySize = 32
+)
+
+// MasterKey wraps the per-integration data keys used to encrypt integration key material (envelope encryption).
+// Only wrapped data keys are ever written to disk.
+type MasterKey struct {
+	Id     string // fingerprint stored alongside each encrypted key so a wrong master key is reported as such
+	Source string // file the key was read from, empty when read from EnvMasterKey
+	key    []byte
+}
+
+// EncryptedKey is the stored form of an integration's key material.
+type EncryptedKey struct {
+	MasterKeyId string `json:"masterKeyId"`
+	WrappedKey  []byte `json:"wrappedKey"` // data key sealed with the master key
+	Ciphertext  []byte `json:"ciphertext"` // key material sealed with the data key
+}
+
+// NewMasterKey generates a random master key.
+func NewMasterKey() (*MasterKey, error) {
+	key := make([]byte, masterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return newMasterKey(key), nil
+}
+
+// ParseMasterKey decodes a base64 encoded master key.
+func ParseMasterKey(encoded string) (*MasterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("invalid master key: expected %d bytes, found %d", masterKeySize, len(key))
+	}
+	return newMasterKey(key), nil
+}
+
+func newMasterKey(key []byte) *MasterKey {
+	sum := sha256.Sum256(key)
+	return &MasterKey{Id: hex.EncodeToString(sum[:8]), key: key}
+}
+
+// LoadMasterKey returns the master key from EnvMasterKey, or from the file named by EnvMasterKeyFile. When neither is
+// set the key is read from MasterKeyFile in configDir, and generated there on first use.
+func LoadMasterKey(configDir string) (*MasterKey, error) {
+	if encoded := os.Getenv(EnvMasterKey); encoded != "" {
+		return ParseMasterKey(encoded)
+	}
+
+	keyFile := os.Getenv(EnvMasterKeyFile)
+	if keyFile == "" {
+		keyFile = filepath.Join(configDir, MasterKeyFile)
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			log.Warn("No master key configured, generating one", "file", keyFile, "env", EnvMasterKey)
+			masterKey, err := NewMasterKey()
+			if err != nil {
+				return nil, err
+			}
+			if err = masterKey.WriteFile(keyFile); err != nil {
+				return nil, err
+			}
+			return masterKey, nil
+		}
+	}
+
+	encoded, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := ParseMasterKey(string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	masterKey.Source = keyFile
+	return masterKey, nil
+}
+
+func (m *MasterKey) Encode() string {
+	return base64.StdEncoding.EncodeToString(m.key)
+}
+
+// WriteFile stores the encoded key readable by the owner only.
+func (m *MasterKey) WriteFile(path string) error {
+	if err := os.WriteFile(path, []byte(m.Encode()+"\n"), 0600); err != nil {
+		return err
+	}
+	m.Source = path
+	return nil
+}
+
+// Seal encrypts plaintext with a fresh data key and wraps the data key with the master key. The alias is bound to
+// both ciphertexts so encrypted keys cannot be swapped between integrations.
+func (m *MasterKey) Seal(alias string, plaintext []byte) (*EncryptedKey, error) {
+	dataKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dataKey, plaintext, []byte(alias))
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := seal(m.key, dataKey, []byte(alias))
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedKey{MasterKeyId: m.Id, WrappedKey: wrappedKey, Ciphertext: ciphertext}, nil
+}
+
+// Fingerprint identifies key material without revealing it. It is an HMAC keyed by the master key, so unlike a plain
+// hash it cannot be used to confirm a guess of the key material, and it changes when the master key is rotated.
+func (m *MasterKey) Fingerprint(plaintext []byte) string {
+	if len(plaintext) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte("integration key fingerprint\x00"))
+	mac.Write(plaintext)
+	return "HMAC-SHA256:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func (m *MasterKey) Open(alias string, encrypted *EncryptedKey) ([]byte, error) {
+	if encrypted.MasterKeyId != m.Id {
+		return nil, fmt.Errorf("key for integration %s was encrypted with master key %s, current master key is %s", alias, encrypted.MasterKeyId, m.Id)
+	}
+	dataKey, err := open(m.key, encrypted.WrappedKey, []byte(alias))
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap key for integration %s: %w", alias, err)
+	}
+	plaintext, err := open(dataKey, encrypted.Ciphertext, []byte(alias))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt key for integration %s: %w", alias, err)
+	}
+	return plaintext, nil
+}
+
+// seal returns the nonce followed by the AES-GCM ciphertext.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAead(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAead(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,137 @@
+package dataConfigGateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMasterKey_SealAndOpen(t *testing.T) {
+	masterKey, err := NewMasterKey()
+	assert.NoError(t, err)
+
+	encrypted, err := masterKey.Seal("anAlias", []byte("aKey"))
+	assert.NoError(t, err)
+	assert.Equal(t, masterKey.Id, encrypted.MasterKeyId)
+	assert.False(t, bytes.Contains(encrypted.Ciphertext, []byte("aKey")))
+
+	plaintext, err := masterKey.Open("anAlias", encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aKey"), plaintext)
+
+	_, err = masterKey.Open("anotherAlias", encrypted)
+	assert.ErrorContains(t, err, "unable to unwrap key for integration anotherAlias")
+
+	otherKey, _ := NewMasterKey()
+	_, err = otherKey.Open("anAlias", encrypted)
+	assert.ErrorContains(t, err, "was encrypted with master key "+masterKey.Id)
+}
+
+func TestMasterKey_Fingerprint(t *testing.T) {
+	masterKey, err := NewMasterKey()
+	assert.NoError(t, err)
+
+	fingerprint := masterKey.Fingerprint([]byte("aKey"))
+	assert.Regexp(t, "^HMAC-SHA256:[0-9a-f]{16}$", fingerprint)
+	assert.Equal(t, fingerprint, masterKey.Fingerprint([]byte("aKey")))
+	assert.NotEqual(t, fingerprint, masterKey.Fingerprint([]byte("anotherKey")))
+	sum := sha256.Sum256([]byte("aKey"))
+	assert.NotContains(t, fingerprint, hex.EncodeToString(sum[:8]), "the key alone does not give its fingerprint")
+
+	otherKey, _ := NewMasterKey()
+	assert.NotEqual(t, fingerprint, otherKey.Fingerprint([]byte("aKey")), "fingerprints are keyed by the master key")
+	assert.Empty(t, masterKey.Fingerprint(nil))
+}
+
+func TestParseMasterKey(t *testing.T) {
+	masterKey, _ := NewMasterKey()
+	parsed, err := ParseMasterKey(masterKey.Encode() + "\n")
+	assert.NoError(t, err)
+	assert.Equal(t, masterKey.Id, parsed.Id)
+
+	_, err = ParseMasterKey("not base64!")
+	assert.ErrorContains(t, err, "invalid master key")
+
+	_, err = ParseMasterKey("c2hvcnQ=")
+	assert.EqualError(t, err, "invalid master key: expected 32 bytes, found 5")
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvMasterKey, "")
+	t.Setenv(EnvMasterKeyFile, "")
+
+	generated, err := LoadMasterKey(dir)
+	assert.NoError(t, err)
+	keyFile := filepath.Join(dir, MasterKeyFile)
+	assert.Equal(t, keyFile, generated.Source)
+	stat, err := os.Stat(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	loaded, err := LoadMasterKey(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.Id, loaded.Id, "generated key is reused")
+
+	other, _ := NewMasterKey()
+	otherFile := filepath.Join(dir, "other.key")
+	_ = other.WriteFile(otherFile)
+	t.Setenv(EnvMasterKeyFile, otherFile)
+	loaded, err = LoadMasterKey(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, other.Id, loaded.Id)
+	assert.Equal(t, otherFile, loaded.Source)
+
+	t.Setenv(EnvMasterKey, generated.Encode())
+	loaded, err = LoadMasterKey(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.Id, loaded.Id)
+	assert.Empty(t, loaded.Source)
+}
+
+func TestConfigData_encryptsKeys(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvMasterKey, "")
+	t.Setenv(EnvMasterKeyFile, "")
+	configFile := filepath.Join(t.TempDir(), "config.json")
+
+	// a config written before keys were encrypted
+	plaintext := `{"integrations":{"abc":{"alias":"abc","options":{"integrationInfo":{"Name":"noop","Key":"YVBsYWludGV4dEtleQ=="}},"apps":{}}}}`
+	assert.NoError(t, os.WriteFile(configFile, []byte(plaintext), 0660))
+	t.Setenv(EnvIntegrationConfigFile, configFile)
+
+	config, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aPlaintextKey"), config.GetIntegration("abc").Opts.Info.Key)
+	assert.Nil(t, config.Keys)
+
+	stored, _ := os.ReadFile(configFile)
+	assert.False(t, bytes.Contains(stored, []byte("YVBsYWludGV4dEtleQ==")), "plaintext key migrated on load")
+	var storedConfig ConfigData
+	assert.NoError(t, json.Unmarshal(stored, &storedConfig))
+	assert.Nil(t, storedConfig.Integrations["abc"].Opts.Info.Key)
+	assert.Equal(t, config.MasterKey().Id, storedConfig.Keys["abc"].MasterKeyId)
+	stat, _ := os.Stat(configFile)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aPlaintextKey"), reloaded.GetIntegration("abc").Opts.Info.Key)
+
+	newKey, _ := NewMasterKey()
+	assert.NoError(t, reloaded.RotateMasterKey(newKey))
+	_, err = NewIntegrationConfigData()
+	assert.ErrorContains(t, err, "current master key is "+config.MasterKey().Id, "old master key no longer opens the config")
+
+	t.Setenv(EnvMasterKey, newKey.Encode())
+	rotated, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("aPlaintextKey"), rotated.GetIntegration("abc").Opts.Info.Key)
+}
@@ -0,0 +1,104 @@
+package dataConfigGateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrchestrations_config(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	id := testOrchestrations(t, data)
+
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	orchestration, err := reloaded.GetOrchestrationDataGateway().FindById(id)
+	assert.NoError(t, err, "orchestrations are persisted")
+	assert.Equal(t, "aName", orchestration.Name)
+}
+
+func TestOrchestrations_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	data, err := NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer data.Close()
+
+	testOrchestrations(t, data)
+}
+
+// testOrchestrations exercises the gateway and returns the id of the orchestration it leaves behind.
+func testOrchestrations(t *testing.T, data DataGateway) string {
+	orchestrations := data.GetOrchestrationDataGateway()
+
+	found, err := orchestrations.Find()
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	_, err = orchestrations.Create(OrchestrationRecord{Name: "aName", From: "anApp"})
+	assert.EqualError(t, err, "an orchestration requires a name, from and at least one target")
+
+	id, err := orchestrations.Create(OrchestrationRecord{
+		Name:      "aName",
+		From:      "anApp",
+		To:        []string{"anotherApp", "yetAnotherApp"},
+		Resources: []ResourceRuleRecord{{Match: "prefix", Source: "/api/", Target: "/"}},
+		Schedule:  "15m",
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	orchestration, err := orchestrations.FindById(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"anotherApp", "yetAnotherApp"}, orchestration.To)
+	assert.Equal(t, []ResourceRuleRecord{{Match: "prefix", Source: "/api/", Target: "/"}}, orchestration.Resources)
+	assert.Equal(t, "15m", orchestration.Schedule)
+	assert.False(t, orchestration.Paused)
+	assert.Nil(t, orchestration.LastRun)
+	assert.WithinDuration(t, time.Now(), orchestration.CreatedAt, time.Minute)
+
+	started := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, orchestrations.RecordRun(id, OrchestrationRun{StartedAt: started, FinishedAt: started.Add(time.Second), Error: "oops"}))
+	assert.NoError(t, orchestrations.SetPaused(id, true))
+
+	orchestration.Name = "aNewName"
+	orchestration.To = []string{"anotherApp"}
+	orchestration.Resources = nil
+	orchestration.Paused = false
+	orchestration.LastRun = nil
+	assert.NoError(t, orchestrations.Update(*orchestration))
+
+	orchestration, err = orchestrations.FindById(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "aNewName", orchestration.Name)
+	assert.Equal(t, []string{"anotherApp"}, orchestration.To)
+	assert.Empty(t, orchestration.Resources)
+	assert.True(t, orchestration.Paused, "updates keep the paused state")
+	assert.NotNil(t, orchestration.LastRun, "updates keep the last run")
+	assert.True(t, started.Equal(orchestration.LastRun.StartedAt))
+	assert.Equal(t, "oops", orchestration.LastRun.Error)
+
+	other, err := orchestrations.Create(OrchestrationRecord{Name: "aName", From: "anApp", To: []string{"anotherApp"}})
+	assert.NoError(t, err)
+	found, _ = orchestrations.Find()
+	assert.Len(t, found, 2)
+	assert.NoError(t, orchestrations.Delete(other))
+	assert.ErrorIs(t, orchestrations.Delete(other), ErrOrchestrationNotFound)
+	_, err = orchestrations.FindById(other)
+	assert.ErrorIs(t, err, ErrOrchestrationNotFound)
+	assert.ErrorIs(t, orchestrations.SetPaused(other, true), ErrOrchestrationNotFound)
+	assert.ErrorIs(t, orchestrations.RecordRun(other, OrchestrationRun{}), ErrOrchestrationNotFound)
+
+	orchestration.Name = "aName"
+	assert.NoError(t, orchestrations.Update(*orchestration))
+	return id
+}
@@ -0,0 +1,88 @@
+package dataConfigGateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyStates_config(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	testPolicyStates(t, data)
+
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	state, err := reloaded.GetPolicyStateDataGateway().FindByApplication("anApp")
+	assert.NoError(t, err, "policy states are persisted")
+	assert.True(t, state.Declared)
+}
+
+func TestPolicyStates_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	data, err := NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer data.Close()
+
+	testPolicyStates(t, data)
+}
+
+// testPolicyStates exercises the gateway, leaving a declared state behind for anApp.
+func testPolicyStates(t *testing.T, data DataGateway) {
+	states := data.GetPolicyStateDataGateway()
+	policies := []hexapolicy.PolicyInfo{{
+		Subjects: []string{"user:anEmail"},
+		Actions:  []hexapolicy.ActionInfo{"anAction"},
+		Object:   "aResource",
+	}}
+
+	found, err := states.Find()
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	_, err = states.FindByApplication("anApp")
+	assert.ErrorIs(t, err, ErrPolicyStateNotFound)
+	assert.ErrorIs(t, states.RecordDrift("anApp", DriftRecord{}), ErrPolicyStateNotFound)
+
+	assert.NoError(t, states.SetDesired("anApp", policies, false))
+	assert.NoError(t, states.SetDesired("anotherApp", nil, false))
+
+	state, err := states.FindByApplication("anApp")
+	assert.NoError(t, err)
+	assert.Len(t, state.Desired, 1)
+	assert.True(t, policies[0].Equals(state.Desired[0]))
+	assert.False(t, state.Declared)
+	assert.Nil(t, state.Drift)
+	assert.WithinDuration(t, time.Now(), state.DesiredAt, time.Minute)
+
+	checked := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, states.RecordDrift("anApp", DriftRecord{CheckedAt: checked, Drifted: true, Found: []hexapolicy.PolicyInfo{}}))
+	assert.NoError(t, states.RecordDrift("anotherApp", DriftRecord{CheckedAt: checked, Error: "oops"}))
+
+	found, err = states.Find()
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, "anApp", found[0].ApplicationId)
+	assert.True(t, found[0].Drift.Drifted)
+	assert.True(t, checked.Equal(found[0].Drift.CheckedAt))
+	assert.Empty(t, found[1].Desired)
+	assert.Equal(t, "oops", found[1].Drift.Error)
+
+	assert.NoError(t, states.SetDesired("anApp", policies, true))
+	state, err = states.FindByApplication("anApp")
+	assert.NoError(t, err)
+	assert.True(t, state.Declared)
+	assert.Nil(t, state.Drift, "a new desired state clears the drift")
+
+	assert.NoError(t, states.Delete("anotherApp"))
+	assert.ErrorIs(t, states.Delete("anotherApp"), ErrPolicyStateNotFound)
+}
@@ -0,0 +1,98 @@
+package dataConfigGateway
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyVersions_config(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	testPolicyVersions(t, data)
+
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	versions, err := reloaded.GetPolicyVersionDataGateway().Find("anApp")
+	assert.NoError(t, err, "policy versions are persisted")
+	assert.Len(t, versions, 2)
+}
+
+func TestPolicyVersions_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	data, err := NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer data.Close()
+
+	testPolicyVersions(t, data)
+}
+
+func testPolicyVersions(t *testing.T, data DataGateway) {
+	versions := data.GetPolicyVersionDataGateway()
+	policies := []hexapolicy.PolicyInfo{{
+		Subjects: []string{"user:anEmail"},
+		Actions:  []hexapolicy.ActionInfo{"anAction"},
+		Object:   "aResource",
+	}}
+
+	found, err := versions.Find("anApp")
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+
+	version, err := versions.Create(PolicyVersionRecord{ApplicationId: "anApp", Author: "anAuthor", Reason: "aReason"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	version, err = versions.Create(PolicyVersionRecord{ApplicationId: "anotherApp", Policies: policies})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version, "versions are numbered per application")
+	version, err = versions.Create(PolicyVersionRecord{ApplicationId: "anApp", Policies: policies, Version: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	found, err = versions.Find("anApp")
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, 1, found[0].Version)
+	assert.Empty(t, found[0].Policies)
+	assert.Equal(t, "anAuthor", found[0].Author)
+	assert.Equal(t, "aReason", found[0].Reason)
+	assert.WithinDuration(t, time.Now(), found[0].CreatedAt, time.Minute)
+
+	record, err := versions.FindByVersion("anApp", 2)
+	assert.NoError(t, err)
+	assert.Len(t, record.Policies, 1)
+	assert.True(t, policies[0].Equals(record.Policies[0]))
+
+	_, err = versions.FindByVersion("anApp", 3)
+	assert.ErrorIs(t, err, ErrPolicyVersionNotFound)
+
+	var wg sync.WaitGroup
+	created := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			version, err := versions.Create(PolicyVersionRecord{ApplicationId: "aBusyApp", Policies: policies})
+			assert.NoError(t, err)
+			created <- version
+		}()
+	}
+	wg.Wait()
+	close(created)
+	numbered := make(map[int]bool)
+	for version := range created {
+		numbered[version] = true
+	}
+	assert.Len(t, numbered, 10, "concurrent versions of an application are numbered one at a time")
+}
@@ -0,0 +1,1348 @@
+package dataConfigGateway
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hexa-org/policy-mapper/api/policyprovider"
+	"github.com/hexa-org/policy-mapper/pkg/hexapolicy"
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/migrationSupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	log "golang.org/x/exp/slog"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	EnvDatabaseDriver = "ORCHESTRATOR_DB_DRIVER"
+	EnvDatabaseUrl    = "ORCHESTRATOR_DB_URL"
+
+	DriverPostgres = "pgx"
+	DriverSqlite   = "sqlite"
+)
+
+// SqlData stores integrations and applications in a SQL database so that several orchestrator instances can share
+// state. Records are addressed by alias, the same identifiers ConfigData uses. Integration keys are stored sealed
+// with the same MasterKey ConfigData uses.
+type SqlData struct {
+	DB            *sql.DB
+	Driver        string
+	AppData       SqlApplicationData
+	MappingData   SqlActionMappingData
+	SubjectData   SqlSubjectMappingData
+	Orchestration SqlOrchestrationData
+	PolicyStates  SqlPolicyStateData
+	Versions      SqlPolicyVersionData
+	Jobs          SqlJobData
+	DeadLetters   SqlDeadLetterData
+	masterKey     *MasterKey
+}
+
+// NewSqlConfigData opens the database and applies any outstanding migrations. Supported drivers are DriverPostgres
+// (the default) and DriverSqlite.
+func NewSqlConfigData(driver string, dataSource string) (*SqlData, error) {
+	if driver == "" {
+		driver = DriverPostgres
+	}
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	if driver == DriverSqlite {
+		// sqlite only supports a single writer
+		db.SetMaxOpenConns(1)
+	}
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err = Migrate(db, driver); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	masterKey, err := sqlMasterKey()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	data := &SqlData{DB: db, Driver: driver, masterKey: masterKey}
+	data.AppData = SqlApplicationData{data}
+	data.MappingData = SqlActionMappingData{data}
+	data.SubjectData = SqlSubjectMappingData{data}
+	data.Orchestration = SqlOrchestrationData{data}
+	data.PolicyStates = SqlPolicyStateData{data}
+	data.Versions = SqlPolicyVersionData{data}
+	data.Jobs = SqlJobData{data}
+	data.DeadLetters = SqlDeadLetterData{data}
+	if err = data.sealPlaintextKeys(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return data, nil
+}
+
+// sqlMasterKey loads the master key from the directory ConfigData would use, so that both stores share a key.
+func sqlMasterKey() (*MasterKey, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return LoadMasterKey(configDir)
+}
+
+func (s *SqlData) MasterKey() *MasterKey {
+	return s.masterKey
+}
+
+// RotateMasterKey re-encrypts every integration key with newKey in a single transaction.
+func (s *SqlData) RotateMasterKey(newKey *MasterKey) error {
+	if _, err := s.resealKeys(``, newKey); err != nil {
+		return err
+	}
+	s.masterKey = newKey
+	return nil
+}
+
+// sealPlaintextKeys encrypts the keys of integrations stored before keys were sealed.
+func (s *SqlData) sealPlaintextKeys() error {
+	count, err := s.resealKeys(` where master_key_id is null and key is not null`, s.masterKey)
+	if count > 0 {
+		log.Info("Encrypted plaintext integration keys", "count", count, "masterKey", s.masterKey.Id)
+	}
+	return err
+}
+
+// resealKeys opens the keys of the integrations matching where and seals them again with masterKey.
+func (s *SqlData) resealKeys(where string, masterKey *MasterKey) (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query(`select id, key, master_key_id, wrapped_key from integrations` + where)
+	if err != nil {
+		return 0, err
+	}
+	keys := make(map[string][]byte)
+	for rows.Next() {
+		var id string
+		var stored storedKey
+		if err = rows.Scan(&id, &stored.ciphertext, &stored.masterKeyId, &stored.wrappedKey); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		if keys[id], err = s.openKey(id, stored); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+	}
+	_ = rows.Close()
+
+	for id, key := range keys {
+		stored, err := sealKey(masterKey, id, key)
+		if err != nil {
+			return 0, err
+		}
+		if _, err = tx.Exec(`update integrations set key = $1, master_key_id = $2, wrapped_key = $3 where id = $4`,
+			stored.ciphertext, stored.masterKeyId, stored.wrappedKey, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), tx.Commit()
+}
+
+// storedKey is the stored form of an integration key. Rows written before keys were sealed have no master key id and
+// hold the key in plaintext.
+type storedKey struct {
+	ciphertext  []byte
+	masterKeyId sql.NullString
+	wrappedKey  []byte
+}
+
+// sealKey encrypts key bound to the id of its integration row, which unlike the alias never changes.
+func sealKey(masterKey *MasterKey, rowId string, key []byte) (storedKey, error) {
+	encrypted, err := masterKey.Seal(rowId, key)
+	if err != nil {
+		return storedKey{}, err
+	}
+	return storedKey{
+		ciphertext:  encrypted.Ciphertext,
+		masterKeyId: sql.NullString{String: encrypted.MasterKeyId, Valid: true},
+		wrappedKey:  encrypted.WrappedKey,
+	}, nil
+}
+
+func (s *SqlData) openKey(rowId string, stored storedKey) ([]byte, error) {
+	if !stored.masterKeyId.Valid {
+		return stored.ciphertext, nil
+	}
+	if s.masterKey == nil {
+		return nil, errors.New("no master key available to decrypt integration keys")
+	}
+	return s.masterKey.Open(rowId, &EncryptedKey{
+		MasterKeyId: stored.masterKeyId.String,
+		WrappedKey:  stored.wrappedKey,
+		Ciphertext:  stored.ciphertext,
+	})
+}
+
+func (s *SqlData) GetApplicationDataGateway() ApplicationsDataGateway {
+	return &s.AppData
+}
+
+func (s *SqlData) GetActionMappingDataGateway() ActionMappingsDataGateway {
+	return &s.MappingData
+}
+
+func (s *SqlData) GetSubjectMappingDataGateway() SubjectMappingsDataGateway {
+	return &s.SubjectData
+}
+
+func (s *SqlData) GetOrchestrationDataGateway() OrchestrationsDataGateway {
+	return &s.Orchestration
+}
+
+func (s *SqlData) GetPolicyStateDataGateway() PolicyStatesDataGateway {
+	return &s.PolicyStates
+}
+
+func (s *SqlData) GetPolicyVersionDataGateway() PolicyVersionsDataGateway {
+	return &s.Versions
+}
+
+func (s *SqlData) GetJobDataGateway() JobsDataGateway {
+	return &s.Jobs
+}
+
+func (s *SqlData) GetDeadLetterDataGateway() DeadLettersDataGateway {
+	return &s.DeadLetters
+}
+
+func (s *SqlData) Close() error {
+	return s.DB.Close()
+}
+
+func (s *SqlData) Create(alias string, providerType string, key []byte) (string, error) {
+	mapType := migrationSupport.MapSdkProviderName(providerType)
+	integration, err := sdk.OpenIntegration(sdk.WithIntegrationInfo(policyprovider.IntegrationInfo{
+		Name: mapType,
+		Key:  key,
+	}))
+	if err != nil {
+		return "", err
+	}
+	if alias == "" {
+		alias = generateAliasOfSize(3)
+	}
+	integration.Alias = alias
+
+	_, err = discover(integration, func() string {
+		return generateAliasOfSize(4)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	id := uuid.NewString()
+	stored, err := sealKey(s.masterKey, id, key)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`insert into integrations (id, alias, name, provider, key, master_key_id, wrapped_key, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $8)`,
+		id, alias, mapType, integration.GetType(), stored.ciphertext, stored.masterKeyId, stored.wrappedKey, time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	if err = syncApplications(tx, id, map[string]bool{}, integration.Apps); err != nil {
+		return "", err
+	}
+	return alias, tx.Commit()
+}
+
+const selectIntegrations = `select i.id, i.alias, coalesce(i.name, ''), coalesce(i.provider, ''), i.key, i.master_key_id, i.wrapped_key,
+i.created_at, i.updated_at, i.key_rotated_at,
+(select count(*) from applications a where a.integration_id = i.id)
+from integrations i`
+
+func (s *SqlData) Find() []IntegrationRecord {
+	resp := make([]IntegrationRecord, 0)
+	rows, err := s.DB.Query(selectIntegrations + ` order by i.created_at, i.alias`)
+	if err != nil {
+		log.Error("Error accessing database: " + err.Error())
+		return resp
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec, err := s.scanIntegration(rows)
+		if err != nil {
+			log.Error("Error reading integration: " + err.Error())
+			return resp
+		}
+		resp = append(resp, rec)
+	}
+	return resp
+}
+
+func (s *SqlData) FindById(id string) (IntegrationRecord, error) {
+	rec, err := s.scanIntegration(s.DB.QueryRow(selectIntegrations+` where i.alias = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return IntegrationRecord{}, errors.New("integration does not exist")
+	}
+	return rec, err
+}
+
+func (s *SqlData) Update(id string, alias string, key []byte) (string, error) {
+	var rowId, provider string
+	err := s.DB.QueryRow(`select id, coalesce(provider, '') from integrations where alias = $1`, id).Scan(&rowId, &provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errors.New("integration does not exist")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// discovery calls the provider, so it runs before the transaction is opened
+	var apps map[string]policyprovider.ApplicationInfo
+	var existing map[string]bool
+	if len(key) > 0 {
+		if apps, existing, err = discoverWithKey(s.DB, integrationRow{id: rowId, alias: id, provider: provider, key: key}); err != nil {
+			return "", err
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the integration may have been deleted while discovery ran
+	err = tx.QueryRow(`select id from integrations where id = $1`, rowId).Scan(&rowId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errors.New("integration does not exist")
+	}
+	if err != nil {
+		return "", err
+	}
+	if alias == "" {
+		alias = id
+	}
+	now := time.Now().UTC()
+	if len(key) > 0 {
+		if err = syncApplications(tx, rowId, existing, apps); err != nil {
+			return "", err
+		}
+		stored, err := sealKey(s.masterKey, rowId, key)
+		if err != nil {
+			return "", err
+		}
+		if _, err = tx.Exec(`update integrations set key = $1, master_key_id = $2, wrapped_key = $3, key_rotated_at = $4 where id = $5`,
+			stored.ciphertext, stored.masterKeyId, stored.wrappedKey, now, rowId); err != nil {
+			return "", err
+		}
+	}
+	if alias != id {
+		if _, err = tx.Exec(`update integrations set alias = $1 where id = $2`, alias, rowId); err != nil {
+			return "", err
+		}
+		for _, table := range []string{"action_mappings", "subject_mappings"} {
+			for _, column := range []string{"from_id", "to_id"} {
+				if _, err = tx.Exec(`update `+table+` set `+column+` = $1 where `+column+` = $2`, alias, id); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	if _, err = tx.Exec(`update integrations set updated_at = $1 where id = $2`, now, rowId); err != nil {
+		return "", err
+	}
+	return alias, tx.Commit()
+}
+
+func (s *SqlData) Delete(name string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id, provider string
+	err = tx.QueryRow(`select id, coalesce(provider, '') from integrations where alias = $1`, name).Scan(&id, &provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("integration does not exist")
+	}
+	if err != nil {
+		return err
+	}
+	objectIds, err := queryStrings(tx, `select coalesce(object_id, '') from applications where integration_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	// applications cascade in postgres, deleting them explicitly keeps sqlite (foreign keys off by default) consistent
+	for _, table := range []string{"action_mappings", "subject_mappings"} {
+		_, err = tx.Exec(`delete from `+table+` where from_id = $1 or to_id = $1
+or from_id in (select alias from applications where integration_id = $2)
+or to_id in (select alias from applications where integration_id = $2)`, name, id)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(`delete from applications where integration_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`delete from integrations where id = $1`, id); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for _, objectId := range objectIds {
+		prometheussupport.ForgetPolicies(provider, objectId)
+	}
+	return nil
+}
+
+func queryStrings(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		found = append(found, value)
+	}
+	return found, rows.Err()
+}
+
+type SqlApplicationData struct {
+	data *SqlData
+}
+
+const selectApplications = `select a.alias, i.alias, coalesce(a.object_id, ''), coalesce(a.name, ''), coalesce(a.description, ''), coalesce(a.service, '')
+from applications a join integrations i on a.integration_id = i.id`
+
+func (a SqlApplicationData) Find(refresh bool) ([]ApplicationRecord, error) {
+	if refresh {
+		if err := a.refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := a.data.DB.Query(selectApplications + ` order by a.name, a.alias`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]ApplicationRecord, 0)
+	for rows.Next() {
+		rec, err := scanApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, rec)
+	}
+	return resp, rows.Err()
+}
+
+func (a SqlApplicationData) FindByObjectId(objectId string) (*ApplicationRecord, error) {
+	// FindById works on id or objectid
+	return a.FindById(objectId)
+}
+
+func (a SqlApplicationData) FindById(id string) (*ApplicationRecord, error) {
+	row := a.data.DB.QueryRow(selectApplications+` where a.alias = $1 or a.object_id = $1 order by a.alias limit 1`, id)
+	rec, err := scanApplication(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New(fmt.Sprintf("application %s not found", id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (a SqlApplicationData) DeleteById(id string) error {
+	// As with ConfigData, the application returns on the next refresh if the provider still reports it.
+	var provider, objectId string
+	err := a.data.DB.QueryRow(`select coalesce(i.provider, ''), coalesce(a.object_id, '') from applications a join integrations i on a.integration_id = i.id where a.alias = $1`, id).Scan(&provider, &objectId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New(fmt.Sprintf("application %s not found", id))
+	}
+	if err != nil {
+		return err
+	}
+	result, err := a.data.DB.Exec(`delete from applications where alias = $1`, id)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return errors.New(fmt.Sprintf("application %s not found", id))
+	}
+	prometheussupport.ForgetPolicies(provider, objectId)
+	return nil
+}
+
+type integrationRow struct {
+	id       string
+	alias    string
+	provider string
+	key      []byte
+}
+
+// refresh re-runs application discovery for every integration, keeping the aliases of known applications.
+func (a SqlApplicationData) refresh() error {
+	rows, err := a.data.DB.Query(`select id, alias, coalesce(provider, ''), key, master_key_id, wrapped_key from integrations`)
+	if err != nil {
+		return err
+	}
+	var integrations []integrationRow
+	for rows.Next() {
+		var row integrationRow
+		var stored storedKey
+		if err = rows.Scan(&row.id, &row.alias, &row.provider, &stored.ciphertext, &stored.masterKeyId, &stored.wrappedKey); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if row.key, err = a.data.openKey(row.id, stored); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		integrations = append(integrations, row)
+	}
+	_ = rows.Close()
+
+	_, err = workflowsupport.Process(context.Background(), integrations, discoveryOptions, func(_ context.Context, row integrationRow) (bool, error) {
+		err := a.refreshIntegration(row)
+		return err == nil, err
+	})
+	return err
+}
+
+// existingApplications loads the applications stored for an integration into its apps, so that discovery keeps their
+// aliases, and returns their aliases.
+func existingApplications(db queryer, integrationId string, integration *sdk.Integration) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	integration.Apps = make(map[string]policyprovider.ApplicationInfo)
+	appRows, err := db.Query(`select alias, coalesce(object_id, '') from applications where integration_id = $1`, integrationId)
+	if err != nil {
+		return nil, err
+	}
+	defer appRows.Close()
+	for appRows.Next() {
+		var alias, objectId string
+		if err = appRows.Scan(&alias, &objectId); err != nil {
+			return nil, err
+		}
+		existing[alias] = true
+		integration.Apps[alias] = policyprovider.ApplicationInfo{ObjectID: objectId}
+	}
+	return existing, appRows.Err()
+}
+
+// discoverWithKey discovers the applications of an integration with the replacement key in row, keeping the aliases of
+// the applications it still finds. It returns the discovered apps and the aliases of the stored applications, for
+// syncApplications.
+func discoverWithKey(db queryer, row integrationRow) (map[string]policyprovider.ApplicationInfo, map[string]bool, error) {
+	integration, err := sdk.OpenIntegration(sdk.WithIntegrationInfo(policyprovider.IntegrationInfo{
+		Name: row.provider,
+		Key:  row.key,
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	integration.Alias = row.alias
+
+	existing, err := existingApplications(db, row.id, integration)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = discover(integration, func() string {
+		return generateAliasOfSize(4)
+	}); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrKeyRejected, err.Error())
+	}
+	return integration.Apps, existing, nil
+}
+
+func (a SqlApplicationData) refreshIntegration(row integrationRow) error {
+	integration, err := sdk.OpenIntegration(sdk.WithIntegrationInfo(policyprovider.IntegrationInfo{
+		Name: row.provider,
+		Key:  row.key,
+	}))
+	if err != nil {
+		return err
+	}
+	integration.Alias = row.alias
+
+	existing, err := existingApplications(a.data.DB, row.id, integration)
+	if err != nil {
+		return err
+	}
+
+	_, err = discover(integration, func() string {
+		return generateAliasOfSize(4)
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := a.data.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err = syncApplications(tx, row.id, existing, integration.Apps); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// syncApplications makes the stored applications of an integration match the discovered apps (keyed by alias).
+func syncApplications(tx *sql.Tx, integrationId string, existing map[string]bool, apps map[string]policyprovider.ApplicationInfo) error {
+	for alias, app := range apps {
+		var err error
+		if existing[alias] {
+			_, err = tx.Exec(`update applications set object_id = $1, name = $2, description = $3, service = $4 where alias = $5`,
+				app.ObjectID, app.Name, app.Description, app.Service, alias)
+		} else {
+			_, err = tx.Exec(`insert into applications (id, alias, integration_id, object_id, name, description, service) values ($1, $2, $3, $4, $5, $6, $7)`,
+				uuid.NewString(), alias, integrationId, app.ObjectID, app.Name, app.Description, app.Service)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for alias := range existing {
+		if _, found := apps[alias]; found {
+			continue
+		}
+		if _, err := tx.Exec(`delete from applications where alias = $1`, alias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type SqlActionMappingData struct {
+	data *SqlData
+}
+
+func (m SqlActionMappingData) Find() ([]ActionMappingRecord, error) {
+	return m.query(`select from_id, to_id, source_action, target_action from action_mappings order by from_id, to_id, source_action, target_action`)
+}
+
+func (m SqlActionMappingData) FindByPair(from string, to string) (*ActionMappingRecord, error) {
+	found, err := m.query(`select from_id, to_id, source_action, target_action from action_mappings where from_id = $1 and to_id = $2 order by source_action, target_action`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrActionMappingNotFound
+	}
+	return &found[0], nil
+}
+
+func (m SqlActionMappingData) Save(record ActionMappingRecord) error {
+	record, err := cleanActionMapping(record)
+	if err != nil {
+		return err
+	}
+	tx, err := m.data.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.Exec(`delete from action_mappings where from_id = $1 and to_id = $2`, record.From, record.To); err != nil {
+		return err
+	}
+	for source, targets := range record.Actions {
+		for _, target := range targets {
+			_, err = tx.Exec(`insert into action_mappings (from_id, to_id, source_action, target_action) values ($1, $2, $3, $4)`,
+				record.From, record.To, source, target)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (m SqlActionMappingData) Delete(from string, to string) error {
+	result, err := m.data.DB.Exec(`delete from action_mappings where from_id = $1 and to_id = $2`, from, to)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrActionMappingNotFound
+	}
+	return nil
+}
+
+// query folds the rows of the action_mappings table, one per source and target action, into records. Rows must be
+// ordered by pair.
+func (m SqlActionMappingData) query(query string, args ...any) ([]ActionMappingRecord, error) {
+	rows, err := m.data.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]ActionMappingRecord, 0)
+	for rows.Next() {
+		var from, to, source, target string
+		if err = rows.Scan(&from, &to, &source, &target); err != nil {
+			return nil, err
+		}
+		if len(resp) == 0 || resp[len(resp)-1].From != from || resp[len(resp)-1].To != to {
+			resp = append(resp, ActionMappingRecord{From: from, To: to, Actions: make(map[string][]string)})
+		}
+		current := &resp[len(resp)-1]
+		current.Actions[source] = append(current.Actions[source], target)
+	}
+	return resp, rows.Err()
+}
+
+const (
+	subjectKindSubject = "subject"
+	subjectKindDomain  = "domain"
+	subjectKindGroup   = "group"
+)
+
+type SqlSubjectMappingData struct {
+	data *SqlData
+}
+
+func (m SqlSubjectMappingData) Find() ([]SubjectMappingRecord, error) {
+	return m.query(`select from_id, to_id, kind, source, target from subject_mappings order by from_id, to_id`)
+}
+
+func (m SqlSubjectMappingData) FindByPair(from string, to string) (*SubjectMappingRecord, error) {
+	found, err := m.query(`select from_id, to_id, kind, source, target from subject_mappings where from_id = $1 and to_id = $2`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrSubjectMappingNotFound
+	}
+	return &found[0], nil
+}
+
+func (m SqlSubjectMappingData) Save(record SubjectMappingRecord) error {
+	record, err := cleanSubjectMapping(record)
+	if err != nil {
+		return err
+	}
+	tx, err := m.data.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.Exec(`delete from subject_mappings where from_id = $1 and to_id = $2`, record.From, record.To); err != nil {
+		return err
+	}
+	lookups := map[string]map[string]string{subjectKindSubject: record.Subjects, subjectKindDomain: record.Domains, subjectKindGroup: record.Groups}
+	for kind, lookup := range lookups {
+		for source, target := range lookup {
+			_, err = tx.Exec(`insert into subject_mappings (from_id, to_id, kind, source, target) values ($1, $2, $3, $4, $5)`,
+				record.From, record.To, kind, source, target)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (m SqlSubjectMappingData) Delete(from string, to string) error {
+	result, err := m.data.DB.Exec(`delete from subject_mappings where from_id = $1 and to_id = $2`, from, to)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrSubjectMappingNotFound
+	}
+	return nil
+}
+
+// query folds the rows of the subject_mappings table, one per lookup entry, into records. Rows must be ordered by
+// pair.
+func (m SqlSubjectMappingData) query(query string, args ...any) ([]SubjectMappingRecord, error) {
+	rows, err := m.data.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]SubjectMappingRecord, 0)
+	for rows.Next() {
+		var from, to, kind, source, target string
+		if err = rows.Scan(&from, &to, &kind, &source, &target); err != nil {
+			return nil, err
+		}
+		if len(resp) == 0 || resp[len(resp)-1].From != from || resp[len(resp)-1].To != to {
+			resp = append(resp, SubjectMappingRecord{From: from, To: to})
+		}
+		current := &resp[len(resp)-1]
+		var lookup *map[string]string
+		switch kind {
+		case subjectKindDomain:
+			lookup = &current.Domains
+		case subjectKindGroup:
+			lookup = &current.Groups
+		default:
+			lookup = &current.Subjects
+		}
+		if *lookup == nil {
+			*lookup = make(map[string]string)
+		}
+		(*lookup)[source] = target
+	}
+	return resp, rows.Err()
+}
+
+type SqlOrchestrationData struct {
+	data *SqlData
+}
+
+const selectOrchestrations = `select id, name, from_id, targets, coalesce(resources, ''), coalesce(schedule, ''), paused,
+last_started_at, last_finished_at, coalesce(last_error, ''), created_at, updated_at
+from orchestrations`
+
+func (o SqlOrchestrationData) Find() ([]OrchestrationRecord, error) {
+	rows, err := o.data.DB.Query(selectOrchestrations + ` order by created_at, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]OrchestrationRecord, 0)
+	for rows.Next() {
+		rec, err := scanOrchestration(rows)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, rec)
+	}
+	return resp, rows.Err()
+}
+
+func (o SqlOrchestrationData) FindById(id string) (*OrchestrationRecord, error) {
+	rec, err := scanOrchestration(o.data.DB.QueryRow(selectOrchestrations+` where id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrchestrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (o SqlOrchestrationData) Create(record OrchestrationRecord) (string, error) {
+	if err := checkOrchestration(record); err != nil {
+		return "", err
+	}
+	targets, resources, err := marshalOrchestration(record)
+	if err != nil {
+		return "", err
+	}
+	id := uuid.NewString()
+	_, err = o.data.DB.Exec(`insert into orchestrations (id, name, from_id, targets, resources, schedule, paused, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $8)`, id, record.Name, record.From, targets, resources, record.Schedule, record.Paused, time.Now().UTC())
+	return id, err
+}
+
+func (o SqlOrchestrationData) Update(record OrchestrationRecord) error {
+	if err := checkOrchestration(record); err != nil {
+		return err
+	}
+	targets, resources, err := marshalOrchestration(record)
+	if err != nil {
+		return err
+	}
+	result, err := o.data.DB.Exec(`update orchestrations set name = $1, from_id = $2, targets = $3, resources = $4, schedule = $5, updated_at = $6 where id = $7`,
+		record.Name, record.From, targets, resources, record.Schedule, time.Now().UTC(), record.ID)
+	return orchestrationUpdated(result, err)
+}
+
+func (o SqlOrchestrationData) SetPaused(id string, paused bool) error {
+	result, err := o.data.DB.Exec(`update orchestrations set paused = $1, updated_at = $2 where id = $3`, paused, time.Now().UTC(), id)
+	return orchestrationUpdated(result, err)
+}
+
+func (o SqlOrchestrationData) RecordRun(id string, run OrchestrationRun) error {
+	result, err := o.data.DB.Exec(`update orchestrations set last_started_at = $1, last_finished_at = $2, last_error = $3 where id = $4`,
+		run.StartedAt.UTC(), run.FinishedAt.UTC(), run.Error, id)
+	return orchestrationUpdated(result, err)
+}
+
+func (o SqlOrchestrationData) Delete(id string) error {
+	result, err := o.data.DB.Exec(`delete from orchestrations where id = $1`, id)
+	return orchestrationUpdated(result, err)
+}
+
+func orchestrationUpdated(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrOrchestrationNotFound
+	}
+	return nil
+}
+
+// marshalOrchestration returns the json stored in the targets and resources columns.
+func marshalOrchestration(record OrchestrationRecord) (string, string, error) {
+	targets, err := json.Marshal(record.To)
+	if err != nil {
+		return "", "", err
+	}
+	resources := []byte{}
+	if len(record.Resources) > 0 {
+		if resources, err = json.Marshal(record.Resources); err != nil {
+			return "", "", err
+		}
+	}
+	return string(targets), string(resources), nil
+}
+
+func scanOrchestration(row rowScanner) (OrchestrationRecord, error) {
+	var rec OrchestrationRecord
+	var targets, resources string
+	var startedAt, finishedAt, createdAt, updatedAt sql.NullTime
+	var lastError string
+	err := row.Scan(&rec.ID, &rec.Name, &rec.From, &targets, &resources, &rec.Schedule, &rec.Paused,
+		&startedAt, &finishedAt, &lastError, &createdAt, &updatedAt)
+	if err != nil {
+		return rec, err
+	}
+	if err = json.Unmarshal([]byte(targets), &rec.To); err != nil {
+		return rec, err
+	}
+	if resources != "" {
+		if err = json.Unmarshal([]byte(resources), &rec.Resources); err != nil {
+			return rec, err
+		}
+	}
+	if startedAt.Valid {
+		rec.LastRun = &OrchestrationRun{StartedAt: startedAt.Time, FinishedAt: finishedAt.Time, Error: lastError}
+	}
+	rec.CreatedAt = createdAt.Time
+	rec.UpdatedAt = updatedAt.Time
+	return rec, nil
+}
+
+type SqlPolicyStateData struct {
+	data *SqlData
+}
+
+const selectPolicyStates = `select application_id, desired, declared, desired_at, checked_at, drifted, coalesce(found, ''),
+coalesce(drift_error, '') from policy_states`
+
+func (p SqlPolicyStateData) Find() ([]PolicyStateRecord, error) {
+	rows, err := p.data.DB.Query(selectPolicyStates + ` order by application_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]PolicyStateRecord, 0)
+	for rows.Next() {
+		rec, err := scanPolicyState(rows)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, rec)
+	}
+	return resp, rows.Err()
+}
+
+func (p SqlPolicyStateData) FindByApplication(applicationId string) (*PolicyStateRecord, error) {
+	rec, err := scanPolicyState(p.data.DB.QueryRow(selectPolicyStates+` where application_id = $1`, applicationId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPolicyStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (p SqlPolicyStateData) SetDesired(applicationId string, policies []hexapolicy.PolicyInfo, declared bool) error {
+	if policies == nil {
+		policies = []hexapolicy.PolicyInfo{}
+	}
+	desired, err := json.Marshal(policies)
+	if err != nil {
+		return err
+	}
+	tx, err := p.data.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.Exec(`delete from policy_states where application_id = $1`, applicationId); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`insert into policy_states (application_id, desired, declared, desired_at) values ($1, $2, $3, $4)`,
+		applicationId, string(desired), declared, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p SqlPolicyStateData) RecordDrift(applicationId string, drift DriftRecord) error {
+	found := []byte{}
+	if len(drift.Found) > 0 {
+		var err error
+		if found, err = json.Marshal(drift.Found); err != nil {
+			return err
+		}
+	}
+	result, err := p.data.DB.Exec(`update policy_states set checked_at = $1, drifted = $2, found = $3, drift_error = $4 where application_id = $5`,
+		drift.CheckedAt.UTC(), drift.Drifted, string(found), drift.Error, applicationId)
+	return policyStateUpdated(result, err)
+}
+
+func (p SqlPolicyStateData) Delete(applicationId string) error {
+	result, err := p.data.DB.Exec(`delete from policy_states where application_id = $1`, applicationId)
+	return policyStateUpdated(result, err)
+}
+
+func policyStateUpdated(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrPolicyStateNotFound
+	}
+	return nil
+}
+
+func scanPolicyState(row rowScanner) (PolicyStateRecord, error) {
+	var rec PolicyStateRecord
+	var desired, found, driftError string
+	var desiredAt, checkedAt sql.NullTime
+	var drifted bool
+	err := row.Scan(&rec.ApplicationId, &desired, &rec.Declared, &desiredAt, &checkedAt, &drifted, &found, &driftError)
+	if err != nil {
+		return rec, err
+	}
+	if err = json.Unmarshal([]byte(desired), &rec.Desired); err != nil {
+		return rec, err
+	}
+	rec.DesiredAt = desiredAt.Time
+	if !checkedAt.Valid {
+		return rec, nil
+	}
+	rec.Drift = &DriftRecord{CheckedAt: checkedAt.Time, Drifted: drifted, Error: driftError}
+	if found != "" {
+		if err = json.Unmarshal([]byte(found), &rec.Drift.Found); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+type SqlPolicyVersionData struct {
+	data *SqlData
+}
+
+const selectPolicyVersions = `select application_id, version, policies, coalesce(author, ''), coalesce(reason, ''), created_at
+from policy_versions`
+
+func (v SqlPolicyVersionData) Find(applicationId string) ([]PolicyVersionRecord, error) {
+	rows, err := v.data.DB.Query(selectPolicyVersions+` where application_id = $1 order by version`, applicationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]PolicyVersionRecord, 0)
+	for rows.Next() {
+		rec, err := scanPolicyVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, rec)
+	}
+	return resp, rows.Err()
+}
+
+func (v SqlPolicyVersionData) FindByVersion(applicationId string, version int) (*PolicyVersionRecord, error) {
+	rec, err := scanPolicyVersion(v.data.DB.QueryRow(selectPolicyVersions+` where application_id = $1 and version = $2`, applicationId, version))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPolicyVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (v SqlPolicyVersionData) Create(record PolicyVersionRecord) (int, error) {
+	if record.Policies == nil {
+		record.Policies = []hexapolicy.PolicyInfo{}
+	}
+	policies, err := json.Marshal(record.Policies)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := v.data.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// versions of an application are numbered one at a time, otherwise concurrent orchestrations read the same max.
+	// sqlite is opened with a single connection, which already serializes transactions.
+	if v.data.Driver == DriverPostgres {
+		if _, err = tx.Exec(`select pg_advisory_xact_lock(hashtext('policy_versions'), hashtext($1))`, record.ApplicationId); err != nil {
+			return 0, err
+		}
+	}
+	var version int
+	if err = tx.QueryRow(`select coalesce(max(version), 0) + 1 from policy_versions where application_id = $1`, record.ApplicationId).Scan(&version); err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`insert into policy_versions (application_id, version, policies, author, reason, created_at) values ($1, $2, $3, $4, $5, $6)`,
+		record.ApplicationId, version, string(policies), record.Author, record.Reason, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+func scanPolicyVersion(row rowScanner) (PolicyVersionRecord, error) {
+	var rec PolicyVersionRecord
+	var policies string
+	var createdAt sql.NullTime
+	if err := row.Scan(&rec.ApplicationId, &rec.Version, &policies, &rec.Author, &rec.Reason, &createdAt); err != nil {
+		return rec, err
+	}
+	rec.CreatedAt = createdAt.Time
+	return rec, json.Unmarshal([]byte(policies), &rec.Policies)
+}
+
+type SqlJobData struct {
+	data *SqlData
+}
+
+const selectJobs = `select id, state, coalesce(author, ''), request, coalesce(steps, ''), coalesce(result, ''), coalesce(error, ''),
+created_at, updated_at, coalesce(owner, ''), heartbeat_at from jobs`
+
+func (j SqlJobData) FindById(id string) (*JobRecord, error) {
+	rec, err := scanJob(j.data.DB.QueryRow(selectJobs+` where id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (j SqlJobData) FindByState(state string) ([]JobRecord, error) {
+	rows, err := j.data.DB.Query(selectJobs+` where state = $1 order by created_at`, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]JobRecord, 0)
+	for rows.Next() {
+		rec, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, rec)
+	}
+	return resp, rows.Err()
+}
+
+func (j SqlJobData) Create(record JobRecord) (string, error) {
+	id := uuid.NewString()
+	_, err := j.data.DB.Exec(`insert into jobs (id, state, author, request, created_at, updated_at) values ($1, $2, $3, $4, $5, $5)`,
+		id, JobPending, record.Author, string(record.Request), time.Now().UTC())
+	return id, err
+}
+
+func (j SqlJobData) Update(record JobRecord) error {
+	steps := []byte{}
+	if len(record.Steps) > 0 {
+		var err error
+		if steps, err = json.Marshal(record.Steps); err != nil {
+			return err
+		}
+	}
+	result, err := j.data.DB.Exec(`update jobs set state = $1, steps = $2, result = $3, error = $4, updated_at = $5 where id = $6`,
+		record.State, string(steps), string(record.Result), record.Error, time.Now().UTC(), record.ID)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Claim updates the job only while it is still claimable, so that of several schedulers claiming it at once only
+// one affects the row.
+func (j SqlJobData) Claim(id, owner string, expired time.Time) error {
+	now := time.Now().UTC()
+	result, err := j.data.DB.Exec(`update jobs set state = $1, owner = $2, heartbeat_at = $3, updated_at = $3
+where id = $4 and (state = $5 or (state = $1 and (heartbeat_at is null or heartbeat_at < $6)))`,
+		JobRunning, owner, now, id, JobPending, expired)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		if _, err = j.FindById(id); err != nil {
+			return err
+		}
+		return ErrJobClaimed
+	}
+	return nil
+}
+
+func (j SqlJobData) Heartbeat(id, owner string) error {
+	result, err := j.data.DB.Exec(`update jobs set heartbeat_at = $1 where id = $2 and owner = $3`, time.Now().UTC(), id, owner)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		if _, err = j.FindById(id); err != nil {
+			return err
+		}
+		return ErrJobClaimed
+	}
+	return nil
+}
+
+func scanJob(row rowScanner) (JobRecord, error) {
+	var rec JobRecord
+	var request, steps, result string
+	var createdAt, updatedAt, heartbeatAt sql.NullTime
+	err := row.Scan(&rec.ID, &rec.State, &rec.Author, &request, &steps, &result, &rec.Error, &createdAt, &updatedAt, &rec.Owner, &heartbeatAt)
+	if err != nil {
+		return rec, err
+	}
+	rec.Request = json.RawMessage(request)
+	if result != "" {
+		rec.Result = json.RawMessage(result)
+	}
+	if steps != "" {
+		if err = json.Unmarshal([]byte(steps), &rec.Steps); err != nil {
+			return rec, err
+		}
+	}
+	rec.CreatedAt = createdAt.Time
+	rec.UpdatedAt = updatedAt.Time
+	rec.HeartbeatAt = heartbeatAt.Time
+	return rec, nil
+}
+
+type SqlDeadLetterData struct {
+	data *SqlData
+}
+
+func (d SqlDeadLetterData) Find() ([]DeadLetterRecord, error) {
+	rows, err := d.data.DB.Query(`select id, kind, task_id, attempts, coalesce(error, ''), failed_at from dead_letters order by failed_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := make([]DeadLetterRecord, 0)
+	for rows.Next() {
+		var rec DeadLetterRecord
+		var failedAt sql.NullTime
+		if err = rows.Scan(&rec.ID, &rec.Kind, &rec.TaskId, &rec.Attempts, &rec.Error, &failedAt); err != nil {
+			return nil, err
+		}
+		rec.FailedAt = failedAt.Time
+		resp = append(resp, rec)
+	}
+	return resp, rows.Err()
+}
+
+func (d SqlDeadLetterData) Create(record DeadLetterRecord) (string, error) {
+	id := uuid.NewString()
+	_, err := d.data.DB.Exec(`insert into dead_letters (id, kind, task_id, attempts, error, failed_at) values ($1, $2, $3, $4, $5, $6)`,
+		id, record.Kind, record.TaskId, record.Attempts, record.Error, record.FailedAt.UTC())
+	return id, err
+}
+
+func (d SqlDeadLetterData) Delete(id string) error {
+	result, err := d.data.DB.Exec(`delete from dead_letters where id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// queryer is implemented by both sql.DB and sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (s *SqlData) scanIntegration(row rowScanner) (IntegrationRecord, error) {
+	var rec IntegrationRecord
+	var rowId string
+	var stored storedKey
+	var createdAt, updatedAt, keyRotatedAt sql.NullTime
+	err := row.Scan(&rowId, &rec.ID, &rec.Name, &rec.Provider, &stored.ciphertext, &stored.masterKeyId, &stored.wrappedKey,
+		&createdAt, &updatedAt, &keyRotatedAt, &rec.AppCount)
+	if err != nil {
+		return rec, err
+	}
+	rec.CreatedAt = createdAt.Time
+	rec.UpdatedAt = updatedAt.Time
+	rec.KeyRotatedAt = keyRotatedAt.Time
+	if rec.Key, err = s.openKey(rowId, stored); err != nil {
+		return rec, err
+	}
+	rec.KeyFingerprint = s.masterKey.Fingerprint(rec.Key)
+	return rec, nil
+}
+
+func scanApplication(row rowScanner) (ApplicationRecord, error) {
+	var rec ApplicationRecord
+	err := row.Scan(&rec.ID, &rec.IntegrationId, &rec.ObjectId, &rec.Name, &rec.Description, &rec.Service)
+	return rec, err
+}
@@ -0,0 +1,295 @@
+package dataConfigGateway
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type sqlTestSuite struct {
+	suite.Suite
+	testDir          string
+	Data             *SqlData
+	integDataGateway IntegrationsDataGateway
+	appDataGateway   ApplicationsDataGateway
+	test1Id          string
+	testApp          ApplicationRecord
+}
+
+func TestSqlGateway(t *testing.T) {
+	s := sqlTestSuite{}
+
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir, err := os.MkdirTemp("", "hexa-orchestrator-sql-*")
+	assert.NoError(t, err, "Error creating temp dir")
+	s.testDir = dir
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+
+	s.Data, err = NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err, "Should be no error opening database")
+
+	if err == nil {
+		s.integDataGateway = s.Data
+		s.appDataGateway = s.Data.GetApplicationDataGateway()
+		suite.Run(t, &s)
+		_ = s.Data.Close()
+	}
+
+	_ = os.RemoveAll(s.testDir)
+}
+
+func (s *sqlTestSuite) readKey(name string) []byte {
+	_, file, _, _ := runtime.Caller(0)
+	keyfile, err := os.ReadFile(filepath.Join(file, "../test", name))
+	assert.NoError(s.T(), err, "check key file read")
+	return keyfile
+}
+
+func (s *sqlTestSuite) Test1_IG_AddIntegration() {
+	id, err := s.integDataGateway.Create("", sdk.ProviderTypeAwsApiGW, s.readKey("aws_test.json"))
+	assert.NoError(s.T(), err)
+	assert.NotEmpty(s.T(), id)
+	s.test1Id = id
+
+	_, err = s.integDataGateway.Create(id, sdk.ProviderTypeAwsApiGW, s.readKey("aws_test.json"))
+	assert.Error(s.T(), err, "alias should be unique")
+
+	recs := s.integDataGateway.Find()
+	assert.Len(s.T(), recs, 1)
+	assert.Equal(s.T(), s.test1Id, recs[0].ID)
+	assert.Equal(s.T(), sdk.ProviderTypeAwsApiGW, recs[0].Provider)
+	assert.Equal(s.T(), s.readKey("aws_test.json"), recs[0].Key)
+	assert.Equal(s.T(), 1, recs[0].AppCount)
+	assert.WithinDuration(s.T(), time.Now(), recs[0].CreatedAt, time.Minute)
+	assert.Equal(s.T(), recs[0].CreatedAt, recs[0].UpdatedAt)
+	assert.True(s.T(), recs[0].KeyRotatedAt.IsZero())
+}
+
+func (s *sqlTestSuite) Test2_IG_FindIntegrationById() {
+	record, err := s.integDataGateway.FindById(s.test1Id)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), s.test1Id, record.ID)
+
+	_, err = s.integDataGateway.FindById("notfound")
+	assert.EqualError(s.T(), err, "integration does not exist")
+}
+
+func (s *sqlTestSuite) Test3_IG_Delete() {
+	id, err := s.integDataGateway.Create("anAlias", sdk.ProviderTypeAzure, s.readKey("azure_test.json"))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "anAlias", id)
+	assert.Len(s.T(), s.integDataGateway.Find(), 2)
+
+	apps, err := s.appDataGateway.Find(false)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), apps, 2)
+
+	err = s.integDataGateway.Delete(id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), s.integDataGateway.Find(), 1, "Should only be the original")
+
+	apps, err = s.appDataGateway.Find(false)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), apps, 1, "applications of the deleted integration are removed")
+
+	err = s.integDataGateway.Delete("notfound")
+	assert.EqualError(s.T(), err, "integration does not exist")
+	assert.Len(s.T(), s.integDataGateway.Find(), 1)
+}
+
+func (s *sqlTestSuite) Test3_IG_Update() {
+	id, err := s.integDataGateway.Create("anAlias", sdk.ProviderTypeAzure, s.readKey("azure_test.json"))
+	assert.NoError(s.T(), err)
+	apps, _ := s.appDataGateway.Find(false)
+	mappings := s.Data.GetActionMappingDataGateway()
+	assert.NoError(s.T(), mappings.Save(ActionMappingRecord{From: id, To: s.test1Id, Actions: map[string][]string{"http:GET": {"aws:GET"}}}))
+
+	alias, err := s.integDataGateway.Update(id, "aNewAlias", s.readKey("gcp_test.json"))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "aNewAlias", alias)
+	record, err := s.integDataGateway.FindById("aNewAlias")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), s.readKey("gcp_test.json"), record.Key)
+	assert.True(s.T(), record.UpdatedAt.After(record.CreatedAt))
+	assert.Equal(s.T(), record.UpdatedAt, record.KeyRotatedAt, "the rotation is recorded")
+	_, err = s.integDataGateway.FindById(id)
+	assert.EqualError(s.T(), err, "integration does not exist")
+
+	renamedApps, _ := s.appDataGateway.Find(false)
+	assert.Len(s.T(), renamedApps, len(apps))
+	for i, app := range renamedApps {
+		assert.Equal(s.T(), apps[i].ID, app.ID, "applications keep their aliases")
+	}
+	_, err = mappings.FindByPair("aNewAlias", s.test1Id)
+	assert.NoError(s.T(), err, "mappings follow the new alias")
+
+	_, err = s.integDataGateway.Update("aNewAlias", "", nil)
+	assert.NoError(s.T(), err)
+	renamed, _ := s.integDataGateway.FindById("aNewAlias")
+	assert.Equal(s.T(), record.KeyRotatedAt, renamed.KeyRotatedAt, "only replacing the key is a rotation")
+
+	_, err = s.integDataGateway.Update("aNewAlias", s.test1Id, nil)
+	assert.Error(s.T(), err, "alias should be unique")
+	_, err = s.integDataGateway.Update("notfound", "", nil)
+	assert.EqualError(s.T(), err, "integration does not exist")
+	assert.NoError(s.T(), s.integDataGateway.Delete("aNewAlias"))
+}
+
+func (s *sqlTestSuite) Test4_AG_Find() {
+	apps, err := s.appDataGateway.Find(true)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), apps, 1)
+	s.testApp = apps[0]
+	assert.Equal(s.T(), s.test1Id, s.testApp.IntegrationId)
+	assert.NotEmpty(s.T(), s.testApp.ObjectId)
+
+	refreshed, err := s.appDataGateway.Find(true)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), apps, refreshed, "refresh keeps application aliases")
+}
+
+func (s *sqlTestSuite) Test5_AG_FindByObjectId() {
+	app, err := s.appDataGateway.FindByObjectId(s.testApp.ObjectId)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), s.testApp, *app)
+
+	_, err = s.appDataGateway.FindByObjectId("dummy")
+	assert.EqualError(s.T(), err, "application dummy not found")
+}
+
+func (s *sqlTestSuite) Test6_AG_FindById() {
+	app, err := s.appDataGateway.FindById(s.testApp.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), s.testApp, *app)
+
+	_, err = s.appDataGateway.FindById("dummy")
+	assert.EqualError(s.T(), err, "application dummy not found")
+}
+
+func (s *sqlTestSuite) Test7_AG_DeleteById() {
+	err := s.appDataGateway.DeleteById(s.testApp.ID)
+	assert.NoError(s.T(), err)
+	apps, _ := s.appDataGateway.Find(false)
+	assert.Len(s.T(), apps, 0)
+
+	err = s.appDataGateway.DeleteById("dummy")
+	assert.EqualError(s.T(), err, "application dummy not found")
+}
+
+func (s *sqlTestSuite) Test8_AG_FindWithRefresh() {
+	apps, err := s.appDataGateway.Find(true)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), apps, 1)
+	assert.Equal(s.T(), s.testApp.ObjectId, apps[0].ObjectId)
+}
+
+func (s *sqlTestSuite) Test9_ReopenExisting() {
+	// a second instance sharing the database sees the same state and does not re-run migrations
+	other, err := NewSqlConfigData(DriverSqlite, filepath.Join(s.testDir, "orchestrator.db"))
+	assert.NoError(s.T(), err)
+	defer other.Close()
+
+	recs := other.Find()
+	assert.Len(s.T(), recs, 1)
+	assert.Equal(s.T(), s.test1Id, recs[0].ID)
+
+	var version int
+	err = other.DB.QueryRow(`select version from schema_migrations`).Scan(&version)
+	assert.NoError(s.T(), err)
+	migrations, _ := listMigrations()
+	assert.Equal(s.T(), migrations[len(migrations)-1].version, version)
+}
+
+func TestMigrate_existingDatabase(t *testing.T) {
+	db, err := sql.Open(DriverSqlite, filepath.Join(t.TempDir(), "legacy.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// a database migrated to version 2 by the migrate tool, holding a record without an alias
+	assert.NoError(t, migrateUpTo(db, DriverSqlite, 2))
+	_, err = db.Exec(`insert into integrations (id, name, provider) values ('1c8b0ba8-8f0a-4cc2-9c4e-8d8ea4d0e3a1', 'noop', 'noop')`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, Migrate(db, DriverSqlite))
+
+	data := &SqlData{DB: db, Driver: DriverSqlite}
+	record, err := data.FindById("1c8b0ba8-8f0a-4cc2-9c4e-8d8ea4d0e3a1")
+	assert.NoError(t, err, "existing records are addressable by their id")
+	assert.Equal(t, "noop", record.Provider)
+
+	_, err = db.Exec(`update schema_migrations set dirty = true`)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, Migrate(db, DriverSqlite), "dirty")
+}
+
+func TestSqlData_encryptsKeys(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	dbFile := filepath.Join(dir, "orchestrator.db")
+	key := []byte(`{"region":"us-west-1"}`)
+
+	data, err := NewSqlConfigData(DriverSqlite, dbFile)
+	assert.NoError(t, err)
+	alias, err := data.Create("", sdk.ProviderTypeAwsApiGW, key)
+	assert.NoError(t, err)
+
+	var stored []byte
+	var masterKeyId string
+	assert.NoError(t, data.DB.QueryRow(`select key, master_key_id from integrations where alias = $1`, alias).Scan(&stored, &masterKeyId))
+	assert.NotContains(t, string(stored), "us-west-1", "the key is not stored in plaintext")
+	assert.Equal(t, data.MasterKey().Id, masterKeyId)
+
+	record, err := data.FindById(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, key, record.Key)
+	_, err = data.GetApplicationDataGateway().Find(true)
+	assert.NoError(t, err, "refresh opens the keys")
+
+	rotated := []byte(`{"region":"eu-west-3"}`)
+	_, err = data.Update(alias, "", rotated)
+	assert.NoError(t, err)
+	assert.NoError(t, data.DB.QueryRow(`select key from integrations where alias = $1`, alias).Scan(&stored))
+	assert.NotContains(t, string(stored), "eu-west-3", "a rotated key is sealed too")
+	record, err = data.FindById(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, rotated, record.Key)
+
+	// a row written before keys were encrypted is sealed when the database is next opened
+	_, err = data.DB.Exec(`insert into integrations (id, alias, name, provider, key) values ('0b5c2a4e-4a8e-4d43-9d1e-7a3f0d7f6c11', 'old', 'noop', 'noop', $1)`, key)
+	assert.NoError(t, err)
+	_ = data.Close()
+	data, err = NewSqlConfigData(DriverSqlite, dbFile)
+	assert.NoError(t, err)
+	assert.NoError(t, data.DB.QueryRow(`select key, master_key_id from integrations where alias = 'old'`).Scan(&stored, &masterKeyId))
+	assert.NotEqual(t, key, stored)
+	assert.Equal(t, data.MasterKey().Id, masterKeyId)
+
+	newKey, err := NewMasterKey()
+	assert.NoError(t, err)
+	assert.NoError(t, data.RotateMasterKey(newKey))
+	_ = data.Close()
+
+	data, err = NewSqlConfigData(DriverSqlite, dbFile)
+	assert.NoError(t, err)
+	_, err = data.FindById(alias)
+	assert.ErrorContains(t, err, "encrypted with master key", "the previous master key no longer opens the keys")
+	_ = data.Close()
+
+	t.Setenv(EnvMasterKey, newKey.Encode())
+	data, err = NewSqlConfigData(DriverSqlite, dbFile)
+	assert.NoError(t, err)
+	defer data.Close()
+	for id, expected := range map[string][]byte{alias: rotated, "old": key} {
+		record, err = data.FindById(id)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, record.Key)
+	}
+}
@@ -0,0 +1,129 @@
+package dataConfigGateway
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hexa-org/policy-orchestrator/demo/databases"
+	log "golang.org/x/exp/slog"
+)
+
+const migrationsDir = "orchestrator"
+
+type migration struct {
+	version int
+	name    string
+}
+
+// sqliteRewrites translate the postgres flavoured migrations into statements sqlite understands. Identifiers are
+// always generated by the gateway, so dropping the uuid default does not change behaviour.
+var sqliteRewrites = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`(?i)\s+default\s+gen_random_uuid\(\)`), ""},
+	{regexp.MustCompile(`(?i)\bnow\(\)`), "current_timestamp"},
+}
+
+// Migrate applies the embedded orchestrator migrations that have not yet been applied. Progress is tracked in a
+// schema_migrations table compatible with the migrate tool used by the docker and dev scripts, so databases that were
+// migrated with that tool are picked up where they left off.
+func Migrate(db *sql.DB, driver string) error {
+	return migrateUpTo(db, driver, 0)
+}
+
+// migrateUpTo applies migrations up to and including version last, or all migrations when last is 0.
+func migrateUpTo(db *sql.DB, driver string, last int) error {
+	if _, err := db.Exec(`create table if not exists schema_migrations (version bigint not null primary key, dirty boolean not null)`); err != nil {
+		return err
+	}
+
+	current := 0
+	var dirty bool
+	err := db.QueryRow(`select version, dirty from schema_migrations limit 1`).Scan(&current, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database schema version %d is dirty, fix and force the version before starting", current)
+	}
+
+	migrations, err := listMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current || (last > 0 && m.version > last) {
+			continue
+		}
+		if err = applyMigration(db, driver, m); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+		log.Info("Applied database migration", "version", m.version, "name", m.name)
+	}
+	return nil
+}
+
+func listMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(databases.Orchestrator, migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	var migrations []migration
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".up.sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %s", entry.Name())
+		}
+		migrations = append(migrations, migration{version: version, name: entry.Name()})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+func applyMigration(db *sql.DB, driver string, m migration) error {
+	content, err := fs.ReadFile(databases.Orchestrator, migrationsDir+"/"+m.name)
+	if err != nil {
+		return err
+	}
+	statements := string(content)
+	if driver == DriverSqlite {
+		for _, rewrite := range sqliteRewrites {
+			statements = rewrite.pattern.ReplaceAllString(statements, rewrite.replace)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range strings.Split(statements, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err = tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(`delete from schema_migrations`); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`insert into schema_migrations (version, dirty) values ($1, $2)`, m.version, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
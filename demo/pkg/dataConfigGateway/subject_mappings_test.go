@@ -0,0 +1,82 @@
+package dataConfigGateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexa-org/policy-mapper/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectMappings_config(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(t.TempDir(), "config.json"))
+	data, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+
+	testSubjectMappings(t, data)
+
+	assert.NoError(t, data.GetSubjectMappingDataGateway().Save(SubjectMappingRecord{From: "anApp", To: "anotherApp", Groups: map[string]string{"a": "b"}}))
+	reloaded, err := NewIntegrationConfigData()
+	assert.NoError(t, err)
+	mappings, _ := reloaded.GetSubjectMappingDataGateway().Find()
+	assert.Len(t, mappings, 1, "mappings are persisted")
+}
+
+func TestSubjectMappings_sql(t *testing.T) {
+	_ = os.Setenv(sdk.EnvTestProvider, sdk.ProviderTypeMock)
+	dir := t.TempDir()
+	t.Setenv(EnvIntegrationConfigFile, filepath.Join(dir, "config.json"))
+	data, err := NewSqlConfigData(DriverSqlite, filepath.Join(dir, "orchestrator.db"))
+	assert.NoError(t, err)
+	defer data.Close()
+
+	testSubjectMappings(t, data)
+}
+
+func testSubjectMappings(t *testing.T, data DataGateway) {
+	mappings := data.GetSubjectMappingDataGateway()
+
+	found, err := mappings.Find()
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	_, err = mappings.FindByPair("anApp", "anotherApp")
+	assert.ErrorIs(t, err, ErrSubjectMappingNotFound)
+
+	err = mappings.Save(SubjectMappingRecord{
+		From:     "anApp",
+		To:       "anotherApp",
+		Subjects: map[string]string{"user:alice@corp.com": "user:5f3c0e4e", "user:bob@corp.com": " "},
+		Domains:  map[string]string{" Corp.com ": "corp.onmicrosoft.com"},
+		Groups:   map[string]string{"admins": "group:0c6a1d2e"},
+	})
+	assert.NoError(t, err)
+
+	mapping, err := mappings.FindByPair("anApp", "anotherApp")
+	assert.NoError(t, err)
+	assert.Equal(t, SubjectMappingRecord{
+		From:     "anApp",
+		To:       "anotherApp",
+		Subjects: map[string]string{"user:alice@corp.com": "user:5f3c0e4e"},
+		Domains:  map[string]string{"corp.com": "corp.onmicrosoft.com"},
+		Groups:   map[string]string{"admins": "group:0c6a1d2e"},
+	}, *mapping)
+
+	assert.NoError(t, mappings.Save(SubjectMappingRecord{From: "anApp", To: "anotherApp", Groups: map[string]string{"readers": "aGroup"}}))
+	mapping, _ = mappings.FindByPair("anApp", "anotherApp")
+	assert.Equal(t, SubjectMappingRecord{From: "anApp", To: "anotherApp", Groups: map[string]string{"readers": "aGroup"}}, *mapping, "saving replaces the mapping")
+
+	assert.EqualError(t, mappings.Save(SubjectMappingRecord{From: "anApp", To: "anotherApp", Subjects: map[string]string{"a": ""}}), "a subject mapping requires at least one subject, domain or group")
+	assert.EqualError(t, mappings.Save(SubjectMappingRecord{To: "anotherApp", Groups: map[string]string{"a": "b"}}), "a subject mapping requires from and to")
+
+	alias, err := data.Create("", "noop", []byte("aKey"))
+	assert.NoError(t, err)
+	assert.NoError(t, mappings.Save(SubjectMappingRecord{From: "anApp", To: alias, Groups: map[string]string{"a": "b"}}))
+	assert.NoError(t, data.Delete(alias))
+	found, _ = mappings.Find()
+	assert.Len(t, found, 1, "mappings of a deleted integration are removed with it")
+
+	assert.NoError(t, mappings.Delete("anApp", "anotherApp"))
+	assert.ErrorIs(t, mappings.Delete("anApp", "anotherApp"), ErrSubjectMappingNotFound)
+}
@@ -3,3 +3,21 @@ package hexaConstants
 const (
 	HexaOrchestratorVersion string = "v0.8.5"
 )
+
+// The scopes of the orchestrator API. A write scope also grants the read scope of the same
+// resources, and ScopeOrchestrator, the single scope of earlier releases, grants every scope but
+// ScopeIntegrationCredentials.
+const (
+	ScopeOrchestrator           string = "orchestrator"
+	ScopeIntegrationsRead       string = "integrations:read"
+	ScopeIntegrationsWrite      string = "integrations:write"
+	ScopeIntegrationCredentials string = "orchestrator:credentials"
+	ScopePoliciesRead           string = "policies:read"
+	ScopePoliciesWrite          string = "policies:write"
+	ScopeOrchestrationExecute   string = "orchestration:execute"
+	ScopeAuditRead              string = "audit:read"
+)
+
+// ClaimIntegrations is the token claim that restricts a caller to the integrations with the listed aliases, either as
+// an array or as a space separated string like the scope claim. Tokens without the claim are not restricted.
+const ClaimIntegrations string = "integrations"
@@ -0,0 +1,132 @@
+package prometheussupport
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The operations of a provider that are measured.
+const (
+	OperationDiscover      = "Discover"
+	OperationGetPolicyInfo = "GetPolicyInfo"
+	OperationSetPolicyInfo = "SetPolicyInfo"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hexa_orchestrator_http_requests_total",
+		Help: "Requests served by the orchestrator, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hexa_orchestrator_http_request_duration_seconds",
+		Help:    "Time taken to serve requests, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	providerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hexa_orchestrator_provider_call_duration_seconds",
+		Help:    "Time taken by calls to providers, by provider type and operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "operation"})
+	providerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hexa_orchestrator_provider_call_errors_total",
+		Help: "Calls to providers that failed, by provider type and operation.",
+	}, []string{"provider", "operation"})
+
+	orchestrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hexa_orchestrator_orchestrations_total",
+		Help: "Orchestrations by outcome: applied, previewed or failed.",
+	}, []string{"outcome"})
+	applicationPolicies = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hexa_orchestrator_application_policies",
+		Help: "Policies of an application when they were last read or written, by provider type and object id.",
+	}, []string{"provider", "application"})
+
+	clientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hexa_admin_orchestrator_requests_total",
+		Help: "Requests from the admin server to the orchestrator, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	clientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hexa_admin_orchestrator_request_duration_seconds",
+		Help:    "Time taken by requests from the admin server to the orchestrator, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// Middleware counts and times the requests to the routes of a mux router, labelled with the route template so that
+// ids do not each make a new series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		started := time.Now()
+		next.ServeHTTP(recorder, r)
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(started).Seconds())
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// ObserveProviderCall records a call to a provider that started at started and returned err.
+func ObserveProviderCall(provider string, operation string, started time.Time, err error) {
+	providerDuration.WithLabelValues(provider, operation).Observe(time.Since(started).Seconds())
+	if err != nil {
+		providerErrors.WithLabelValues(provider, operation).Inc()
+	}
+}
+
+// ObserveOrchestration counts an orchestration with its outcome.
+func ObserveOrchestration(outcome string) {
+	orchestrations.WithLabelValues(outcome).Inc()
+}
+
+// ObservePolicies records how many policies an application has.
+func ObservePolicies(provider string, application string, count int) {
+	applicationPolicies.WithLabelValues(provider, application).Set(float64(count))
+}
+
+// ForgetPolicies stops reporting the policies of an application that was deleted, with its integration or on its own.
+func ForgetPolicies(provider string, application string) {
+	applicationPolicies.DeleteLabelValues(provider, application)
+}
+
+// ObserveClientRequest records a request to the orchestrator that started at started. The status is 0 when no
+// response was received.
+func ObserveClientRequest(route string, method string, started time.Time, status int) {
+	clientDuration.WithLabelValues(route, method).Observe(time.Since(started).Seconds())
+	clientRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+}
+
+// Wrap serves GET /metrics in the Prometheus text format ahead of next. The /metrics route of websupport does not
+// report any metrics.
+func Wrap(next http.Handler) http.Handler {
+	metrics := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.TrimSuffix(r.URL.Path, "/") == "/metrics" {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
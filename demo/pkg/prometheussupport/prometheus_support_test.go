@@ -0,0 +1,63 @@
+package prometheussupport_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/prometheussupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T) string {
+	recorder := httptest.NewRecorder()
+	prometheussupport.Wrap(http.NotFoundHandler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body, _ := io.ReadAll(recorder.Body)
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(prometheussupport.Middleware)
+	router.HandleFunc("/things/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}).Methods(http.MethodGet)
+
+	for _, id := range []string{"aThing", "anotherThing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/"+id, nil))
+	}
+
+	metrics := scrape(t)
+	assert.Contains(t, metrics, `hexa_orchestrator_http_requests_total{code="418",method="GET",route="/things/{id}"} 2`)
+	assert.Contains(t, metrics, `hexa_orchestrator_http_request_duration_seconds_count{method="GET",route="/things/{id}"} 2`)
+}
+
+func TestObserve(t *testing.T) {
+	prometheussupport.ObserveProviderCall("aProvider", prometheussupport.OperationGetPolicyInfo, time.Now(), nil)
+	prometheussupport.ObserveProviderCall("aProvider", prometheussupport.OperationGetPolicyInfo, time.Now(), errors.New("oops"))
+	prometheussupport.ObserveOrchestration("applied")
+	prometheussupport.ObservePolicies("aProvider", "anApp", 3)
+	prometheussupport.ObserveClientRequest("/applications/{id}", http.MethodGet, time.Now(), http.StatusOK)
+
+	metrics := scrape(t)
+	assert.Contains(t, metrics, `hexa_orchestrator_provider_call_duration_seconds_count{operation="GetPolicyInfo",provider="aProvider"} 2`)
+	assert.Contains(t, metrics, `hexa_orchestrator_provider_call_errors_total{operation="GetPolicyInfo",provider="aProvider"} 1`)
+	assert.Contains(t, metrics, `hexa_orchestrator_orchestrations_total{outcome="applied"} 1`)
+	assert.Contains(t, metrics, `hexa_orchestrator_application_policies{application="anApp",provider="aProvider"} 3`)
+	assert.Contains(t, metrics, `hexa_admin_orchestrator_requests_total{code="200",method="GET",route="/applications/{id}"} 1`)
+
+	prometheussupport.ForgetPolicies("aProvider", "anApp")
+	assert.NotContains(t, scrape(t), `hexa_orchestrator_application_policies{application="anApp"`)
+}
+
+func TestWrap(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	recorder := httptest.NewRecorder()
+	prometheussupport.Wrap(next).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+}
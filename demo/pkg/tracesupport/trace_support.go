@@ -0,0 +1,201 @@
+package tracesupport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	EnvTraceExporter = "HEXA_TRACE_EXPORTER" // none, stdout or file, spans are not recorded when not set
+	EnvTraceFile     = "HEXA_TRACE_FILE"     // the file the file exporter appends to, DefaultTraceFile when not set
+)
+
+// The exporters that can be set with EnvTraceExporter.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+const (
+	DefaultTraceFile = "traces.jsonl"
+	instrumentation  = "github.com/hexa-org/policy-orchestrator/demo"
+)
+
+// Init sets the global tracer provider of the service, with the exporter set by EnvTraceExporter, and the W3C trace
+// context propagator. The propagator is set even when no spans are exported, so that a trace started by a caller
+// carries on past this service. The returned function flushes the spans that have not been exported yet.
+func Init(serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(os.Getenv(EnvTraceExporter), os.Getenv(EnvTraceFile))
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func newExporter(name string, file string) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(name) {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterFile:
+		if file == "" {
+			file = DefaultTraceFile
+		}
+		return otlptrace.New(context.Background(), &fileClient{path: file})
+	}
+	return nil, fmt.Errorf("unknown trace exporter %s, expected %s, %s or %s", name, ExporterNone, ExporterStdout, ExporterFile)
+}
+
+// fileClient writes the spans the OTLP exporter uploads to a file, a line of OTLP JSON for each upload, such as the
+// file exporter of the OpenTelemetry collector reads.
+type fileClient struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (c *fileClient) Start(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	file, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	c.file = file
+	return nil
+}
+
+func (c *fileClient) Stop(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func (c *fileClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	line, err := protojson.Marshal(&tracepb.TracesData{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return errors.New("trace file is closed")
+	}
+	_, err = c.file.Write(append(line, '\n'))
+	return err
+}
+
+// Tracer returns the tracer of the global tracer provider, which does not record spans until Init sets an exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Start starts a span, the child of the span in ctx if there is one.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends a span, marking it as failed when err is set.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for each request to the routes of a mux router, continuing the trace of the caller
+// given by the traceparent header. Spans are named by the route template so that ids do not each make a new name.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", r.URL.Path),
+		))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// StartClient starts a client span for a request and adds the traceparent header of the span to it, so that the
+// server the request is sent to continues the trace.
+func StartClient(req *http.Request, route string) trace.Span {
+	ctx, span := Tracer().Start(req.Context(), req.Method+" "+route, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("http.route", route),
+		attribute.String("server.address", req.URL.Host),
+	))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return span
+}
+
+// EndClient ends the span of a request, marking it as failed when no response was received or the response is an
+// error.
+func EndClient(span trace.Span, resp *http.Response, err error) {
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		}
+	}
+	End(span, err)
+}
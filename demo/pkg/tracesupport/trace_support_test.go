@@ -0,0 +1,104 @@
+package tracesupport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/tracesupport"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestInit_file(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	t.Setenv(tracesupport.EnvTraceExporter, tracesupport.ExporterFile)
+	t.Setenv(tracesupport.EnvTraceFile, file)
+
+	shutdown, err := tracesupport.Init("aService")
+	assert.NoError(t, err)
+	_, span := tracesupport.Start(context.Background(), "aSpan")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"resourceSpans"`)
+	assert.Contains(t, string(data), `"name":"aSpan"`)
+	assert.Contains(t, string(data), `"stringValue":"aService"`)
+}
+
+func TestInit_none(t *testing.T) {
+	t.Setenv(tracesupport.EnvTraceExporter, "")
+	shutdown, err := tracesupport.Init("aService")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestInit_unknownExporter(t *testing.T) {
+	t.Setenv(tracesupport.EnvTraceExporter, "zipkin")
+	_, err := tracesupport.Init("aService")
+	assert.ErrorContains(t, err, "unknown trace exporter zipkin")
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+	router := mux.NewRouter()
+	router.Use(tracesupport.Middleware)
+	router.HandleFunc("/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracesupport.Start(r.Context(), "aChild")
+		tracesupport.End(span, errors.New("oops"))
+		w.WriteHeader(http.StatusInternalServerError)
+	}).Methods(http.MethodGet)
+
+	request := httptest.NewRequest(http.MethodGet, "/things/anId", nil)
+	request.Header.Set("traceparent", traceparent)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+	assert.Equal(t, "GET /things/{id}", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, server.Status().Code)
+	assert.Equal(t, "aChild", child.Name())
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+	assert.Equal(t, codes.Error, child.Status().Code)
+}
+
+func TestStartClient(t *testing.T) {
+	recorder := recordSpans(t)
+	request := httptest.NewRequest(http.MethodPost, "http://localhost:8883/applications/anId/policies", nil)
+	span := tracesupport.StartClient(request, "/applications/{id}/policies")
+	tracesupport.EndClient(span, &http.Response{StatusCode: http.StatusCreated}, nil)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "POST /applications/{id}/policies", spans[0].Name())
+	assert.Contains(t, request.Header.Get("traceparent"), spans[0].SpanContext().TraceID().String())
+	assert.Contains(t, request.Header.Get("traceparent"), spans[0].SpanContext().SpanID().String())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
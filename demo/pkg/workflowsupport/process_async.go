@@ -1,35 +1,100 @@
 package workflowsupport
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"sync"
+)
 
+// ProcessAsync calls block for every input at once and returns the results of those that succeeded, in no particular
+// order.
+//
+// Deprecated: use Process, which limits concurrency, keeps errors and can be cancelled.
 func ProcessAsync[T any, U any](inputs []U, block func(u U) (T, error)) []T {
-	var results []T
-	resultChannel := make(chan T)
-	wg := sync.WaitGroup{}
+	results, _ := Process(context.Background(), inputs, Options{}, func(_ context.Context, input U) (T, error) {
+		return block(input)
+	})
+	var values []T
+	for _, result := range results {
+		if result.Err == nil {
+			values = append(values, result.Value)
+		}
+	}
+	return values
+}
 
-	for _, i := range inputs {
-		wg.Add(1)
+// Result is the outcome of processing one input, see Process.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
 
-		go func(input U) {
-			defer wg.Done()
+// Mode decides what Process does once an input fails.
+type Mode int
 
-			result, err := block(input)
-			if err != nil {
-				return
-			}
+const (
+	CollectAll Mode = iota // every input is processed whatever happens to the others
+	FailFast               // the first failure cancels the inputs still being processed and those not yet started
+)
+
+type Options struct {
+	Limit int // inputs processed at once, all of them when not positive
+	Mode  Mode
+}
 
-			resultChannel <- result
-		}(i)
+// Process calls block for each input, at most Limit at once, and returns the results in the order of the inputs.
+// block is given a context that is cancelled along with ctx, or in FailFast mode once an input has failed. Inputs
+// that had not started by then are not processed, their result holds the error of the context.
+//
+// The error returned is the first failure in FailFast mode, the failures joined in input order in CollectAll mode,
+// or the error of ctx when it was cancelled.
+func Process[T any, U any](ctx context.Context, inputs []U, opts Options, block func(ctx context.Context, u U) (T, error)) ([]Result[T], error) {
+	limit := opts.Limit
+	if limit <= 0 || limit > len(inputs) {
+		limit = len(inputs)
 	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-	go func() {
-		wg.Wait()
-		close(resultChannel)
-	}()
+	results := make([]Result[T], len(inputs))
+	slots := make(chan struct{}, limit)
+	wg := sync.WaitGroup{}
+
+	for i, input := range inputs {
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			// a slot may have been taken as the context was cancelled
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(index int, input U) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
 
-	for result := range resultChannel {
-		results = append(results, result)
+			value, err := block(ctx, input)
+			results[index] = Result[T]{Value: value, Err: err}
+			if err != nil && opts.Mode == FailFast {
+				cancel(err)
+			}
+		}(i, input)
 	}
+	wg.Wait()
 
-	return results
+	if cause := context.Cause(ctx); cause != nil {
+		return results, cause
+	}
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return results, errors.Join(errs...)
 }
@@ -1,10 +1,15 @@
 package workflowsupport
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/testsupport"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestProcessAsync(t *testing.T) {
@@ -22,3 +27,74 @@ func TestProcessAsync(t *testing.T) {
 		"processed:whyDoWeNeedMoreThings",
 	)
 }
+
+func TestProcess(t *testing.T) {
+	things := []string{"thing", "anotherThing", "evenMoreThings", "lotsOfThings", "whyDoWeNeedMoreThings"}
+
+	var running, most int32
+	results, err := Process(context.Background(), things, Options{Limit: 2}, func(_ context.Context, thing string) (string, error) {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&most)
+			if now <= seen || atomic.CompareAndSwapInt32(&most, seen, now) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if thing == "anotherThing" || thing == "lotsOfThings" {
+			return "", fmt.Errorf("oops:%s", thing)
+		}
+		return fmt.Sprintf("processed:%s", thing), nil
+	})
+
+	assert.EqualError(t, err, "oops:anotherThing\noops:lotsOfThings")
+	assert.LessOrEqual(t, most, int32(2))
+	assert.Len(t, results, len(things))
+	assert.Equal(t, "processed:thing", results[0].Value)
+	assert.EqualError(t, results[1].Err, "oops:anotherThing")
+	assert.Equal(t, "processed:whyDoWeNeedMoreThings", results[4].Value, "results are in the order of the inputs")
+	assert.NoError(t, results[4].Err)
+
+	results, err = Process(context.Background(), []string{}, Options{Limit: 2}, func(_ context.Context, thing string) (string, error) {
+		return thing, nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestProcess_failFast(t *testing.T) {
+	things := []string{"thing", "anotherThing", "evenMoreThings", "lotsOfThings"}
+
+	results, err := Process(context.Background(), things, Options{Limit: 2, Mode: FailFast}, func(ctx context.Context, thing string) (string, error) {
+		if thing == "thing" {
+			return "", errors.New("oops")
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+			return thing, nil
+		}
+	})
+
+	assert.EqualError(t, err, "oops")
+	assert.EqualError(t, results[0].Err, "oops")
+	for _, result := range results[1:] {
+		assert.ErrorIs(t, result.Err, context.Canceled, "running and unstarted inputs are cancelled")
+	}
+}
+
+func TestProcess_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var called int32
+	results, err := Process(ctx, []string{"thing", "anotherThing"}, Options{Limit: 1}, func(_ context.Context, thing string) (string, error) {
+		atomic.AddInt32(&called, 1)
+		return thing, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, called)
+	assert.ErrorIs(t, results[1].Err, context.Canceled)
+}
@@ -0,0 +1,187 @@
+package workflowsupport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a job runs next.
+type Schedule interface {
+	// Next returns the first run time after the given time, or the zero time when there is none.
+	Next(after time.Time) time.Time
+}
+
+// Every returns a schedule that runs at a fixed interval.
+func Every(interval time.Duration) Schedule {
+	return everySchedule{interval}
+}
+
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (schedule everySchedule) Next(after time.Time) time.Time {
+	return after.Add(schedule.interval)
+}
+
+func (schedule everySchedule) String() string {
+	return "@every " + schedule.interval.String()
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression with the five fields minute, hour, day of month, month and day of week, such as
+// "0 2 * * *" for every night at 2:00. Fields hold *, numbers, ranges such as 1-5, steps such as */15 and lists of
+// those separated by commas. Sunday is 0 or 7. When both day fields are restricted a day matching either is run, as
+// in cron.
+//
+// The descriptors @yearly, @monthly, @weekly, @daily, @hourly and "@every <duration>", such as "@every 15m", are also
+// accepted. Times are those of the location of the time passed to Next.
+func ParseCron(expression string) (Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if interval, found := strings.CutPrefix(expression, "@every "); found {
+		duration, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid schedule %s, expected a positive duration such as @every 15m", expression)
+		}
+		return Every(duration), nil
+	}
+	fields := strings.Fields(expression)
+	if descriptor, found := cronDescriptors[expression]; found {
+		fields = strings.Fields(descriptor)
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %s, expected five fields such as 0 2 * * *", expression)
+	}
+
+	schedule := cronSchedule{expression: expression}
+	var err error
+	for i, field := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&schedule.minutes, 0, 59},
+		{&schedule.hours, 0, 23},
+		{&schedule.days, 1, 31},
+		{&schedule.months, 1, 12},
+		{&schedule.weekdays, 0, 7},
+	} {
+		if *field.bits, err = parseCronField(fields[i], field.min, field.max); err != nil {
+			return nil, fmt.Errorf("invalid schedule %s: %w", expression, err)
+		}
+	}
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	schedule.anyDay = strings.HasPrefix(fields[2], "*")
+	schedule.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+type cronSchedule struct {
+	expression                             string
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+func (schedule cronSchedule) String() string {
+	return schedule.expression
+}
+
+// Next steps through the fields from the month down, skipping whole months, days and hours that do not match.
+func (schedule cronSchedule) Next(after time.Time) time.Time {
+	next := after.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		switch {
+		case schedule.months&(1<<uint(next.Month())) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !schedule.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case schedule.hours&(1<<uint(next.Hour())) == 0:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case schedule.minutes&(1<<uint(next.Minute())) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func (schedule cronSchedule) matchesDay(t time.Time) bool {
+	day := schedule.days&(1<<uint(t.Day())) != 0
+	weekday := schedule.weekdays&(1<<uint(t.Weekday())) != 0
+	if schedule.anyDay || schedule.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// parseCronField returns the values a field matches as bits.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s", part)
+			}
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("invalid value in %s", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("invalid value in %s", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%s is outside %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Clock is the source of time of a WorkScheduler, replaced in tests so that they do not wait for real time to pass.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
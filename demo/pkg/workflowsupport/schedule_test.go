@@ -0,0 +1,44 @@
+package workflowsupport_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 30, 15, 0, time.UTC) // a Wednesday
+	for expression, expected := range map[string]time.Time{
+		"* * * * *":        time.Date(2024, time.January, 31, 10, 31, 0, 0, time.UTC),
+		"*/15 * * * *":     time.Date(2024, time.January, 31, 10, 45, 0, 0, time.UTC),
+		"0 * * * *":        time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC),
+		"@hourly":          time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC),
+		"0 2 * * *":        time.Date(2024, time.February, 1, 2, 0, 0, 0, time.UTC),
+		"@daily":           time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"30 9-17/4 * * *":  time.Date(2024, time.January, 31, 13, 30, 0, 0, time.UTC),
+		"0 0 * * 0":        time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 7":        time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 1-5":      time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":       time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 1 * 5":        time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 1,15 * *":     time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"@yearly":          time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"@every 1h30m":     time.Date(2024, time.January, 31, 12, 0, 15, 0, time.UTC),
+		"  15 10 31 1 *  ": time.Date(2025, time.January, 31, 10, 15, 0, 0, time.UTC),
+	} {
+		schedule, err := workflowsupport.ParseCron(expression)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expected, schedule.Next(from), expression)
+	}
+
+	schedule, _ := workflowsupport.ParseCron("0 0 30 2 *")
+	assert.True(t, schedule.Next(from).IsZero(), "february has no 30th")
+
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"5-1 * * * *", "*/0 * * * *", "a * * * *", "@every", "@every often", "@every -1m", "@sometimes"} {
+		_, err := workflowsupport.ParseCron(expression)
+		assert.Error(t, err, expression)
+	}
+}
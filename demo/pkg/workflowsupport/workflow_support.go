@@ -3,7 +3,13 @@ package workflowsupport
 // Inspired by code from the Conductor project available at https://github.com/Netflix/conductor
 
 import (
+	"fmt"
 	"log"
+	"maps"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,54 +20,201 @@ type Worker interface {
 type WorkFinder interface {
 	FindRequested() []interface{}
 	MarkCompleted()
-	MarkErroneous()
+	MarkErroneous() // called once a task has failed every attempt its retry policy allows
 	Stop()
 }
 
+// FailureReporter is implemented by finders that need to know which task failed and why. ReportFailure is called
+// with the failure just before MarkErroneous.
+type FailureReporter interface {
+	ReportFailure(failure Failure)
+}
+
+// Failure is a task that could not be completed, with the error of its last attempt.
+type Failure struct {
+	Task     interface{}
+	Attempts int
+	Err      error
+	FailedAt time.Time
+}
+
+// RetryPolicy decides how often a failing task is attempted. The delay before each retry grows exponentially from
+// InitialBackoff up to MaxBackoff, and is reduced by a random fraction of up to Jitter so that retries of tasks that
+// failed together are spread out.
+type RetryPolicy struct {
+	MaxAttempts    int // attempts in total, a task is attempted once when this is less than 2
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64 // 2 when not set
+	Jitter         float64 // between 0 and 1
+}
+
+// DefaultRetryPolicy suits tasks that call cloud provider APIs, which often fail transiently.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.5,
+}
+
+// Backoff returns the delay before the given retry, the first retry being 1.
+func (policy RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	backoff := float64(policy.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		backoff = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		backoff -= backoff * math.Min(policy.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+// RetryableTask is implemented by tasks that need a retry policy other than that of their scheduler.
+type RetryableTask interface {
+	RetryPolicy() RetryPolicy
+}
+
+// Job runs the work found by the finder of its scheduler, with a worker, on a schedule. A random delay of up to Jitter
+// is added to each run so that jobs with the same schedule do not all call providers at once.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Jitter   time.Duration
+	Worker   Worker
+	Overlap  bool // a run is skipped while the previous run of the job is still in progress, unless set
+}
+
 type WorkScheduler struct {
-	Finder  interface{}
+	Finder interface{}
+	Jobs   []Job
+	Retry  RetryPolicy // tasks are attempted once unless set, see RetryableTask
+	Clock  Clock       // SystemClock unless set
+
+	// Deprecated: use Jobs. When no jobs are set, each of the workers runs every Delay milliseconds.
 	Workers []Worker
-	Delay   int64
+	// Deprecated: use Jobs, see Workers.
+	Delay int64
 
-	done chan bool
+	done     chan bool
+	mu       *sync.Mutex
+	nextRuns map[string]time.Time
 }
 
+// NewScheduler returns a scheduler that runs each worker every delay milliseconds.
 func NewScheduler(finder interface{}, workers []Worker, delay int64) WorkScheduler {
+	scheduler := NewJobScheduler(finder, workerJobs(workers, delay))
+	scheduler.Workers = workers
+	scheduler.Delay = delay
+	return scheduler
+}
+
+func workerJobs(workers []Worker, delay int64) []Job {
+	jobs := make([]Job, 0, len(workers))
+	for i, worker := range workers {
+		jobs = append(jobs, Job{Name: fmt.Sprintf("worker-%d", i+1), Schedule: Every(time.Duration(delay) * time.Millisecond), Worker: worker})
+	}
+	return jobs
+}
+
+// NewJobScheduler returns a scheduler that runs each job on its own schedule.
+func NewJobScheduler(finder interface{}, jobs []Job) WorkScheduler {
 	return WorkScheduler{
-		Finder:  finder,
-		Workers: workers,
-		Delay:   delay,
-		done:    make(chan bool),
+		Finder:   finder,
+		Jobs:     jobs,
+		done:     make(chan bool),
+		mu:       &sync.Mutex{},
+		nextRuns: make(map[string]time.Time),
 	}
 }
 
 func (ws *WorkScheduler) Start() {
 	log.Printf("Starting the scheduler.\n")
-	ticker := time.NewTicker(time.Duration(ws.Delay) * time.Millisecond)
-	for _, w := range ws.Workers {
-		go func(worker Worker) {
-			for {
-				select {
-				case <-ws.done:
-					return
-				case <-ticker.C:
-					log.Printf("Scheduling work.\n")
-					ws.checkForWork(worker)
-				}
-			}
-		}(w)
+	if ws.Clock == nil {
+		ws.Clock = SystemClock
+	}
+	// schedulers built as a literal with the deprecated fields
+	if ws.done == nil {
+		ws.done = make(chan bool)
+		ws.mu = &sync.Mutex{}
+		ws.nextRuns = make(map[string]time.Time)
+	}
+	if len(ws.Jobs) == 0 {
+		ws.Jobs = workerJobs(ws.Workers, ws.Delay)
+	}
+	for _, j := range ws.Jobs {
+		go ws.schedule(j)
 	}
 }
 
+// NextRuns returns when each job, by name, runs next. Jobs whose schedule has no run left are not included.
+func (ws *WorkScheduler) NextRuns() map[string]time.Time {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return maps.Clone(ws.nextRuns)
+}
+
+func (ws *WorkScheduler) schedule(job Job) {
+	var running atomic.Bool
+	for {
+		now := ws.Clock.Now()
+		next := job.Schedule.Next(now)
+		if next.IsZero() {
+			ws.setNextRun(job.Name, next)
+			return
+		}
+		if job.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+		}
+		ws.setNextRun(job.Name, next)
+
+		select {
+		case <-ws.done:
+			return
+		case <-ws.Clock.After(next.Sub(now)):
+		}
+
+		if !job.Overlap && !running.CompareAndSwap(false, true) {
+			log.Printf("Skipping %s, its previous run has not finished.\n", job.Name)
+			continue
+		}
+		log.Printf("Scheduling work.\n")
+		go func() {
+			ws.checkForWork(job.Worker)
+			running.Store(false)
+		}()
+	}
+}
+
+func (ws *WorkScheduler) setNextRun(name string, next time.Time) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if next.IsZero() {
+		delete(ws.nextRuns, name)
+		return
+	}
+	ws.nextRuns[name] = next
+}
+
 func (ws *WorkScheduler) checkForWork(worker Worker) {
 	finder := ws.Finder.(WorkFinder)
 	log.Printf("Checking for work.\n")
 
+	var wg sync.WaitGroup
 	for _, t := range finder.FindRequested() {
 		log.Printf("Found work.\n")
 
+		wg.Add(1)
 		go func(task interface{}) {
-			if err := worker.Run(task); err != nil {
+			defer wg.Done()
+			if failure := ws.attempt(worker, task); failure != nil {
+				if reporter, ok := finder.(FailureReporter); ok {
+					reporter.ReportFailure(*failure)
+				}
 				finder.MarkErroneous()
 				return
 			}
@@ -69,10 +222,35 @@ func (ws *WorkScheduler) checkForWork(worker Worker) {
 			finder.MarkCompleted()
 		}(t)
 	}
+	wg.Wait()
+}
+
+// attempt runs the task until it succeeds or its retry policy gives up, which it also does once the scheduler is
+// stopped.
+func (ws *WorkScheduler) attempt(worker Worker, task interface{}) *Failure {
+	policy := ws.Retry
+	if retryable, ok := task.(RetryableTask); ok {
+		policy = retryable.RetryPolicy()
+	}
+	for attempts := 1; ; attempts++ {
+		err := worker.Run(task)
+		if err == nil {
+			return nil
+		}
+		if attempts >= policy.MaxAttempts {
+			return &Failure{Task: task, Attempts: attempts, Err: err, FailedAt: ws.Clock.Now()}
+		}
+		log.Printf("Retrying work after %v.\n", err)
+		select {
+		case <-ws.done:
+			return &Failure{Task: task, Attempts: attempts, Err: err, FailedAt: ws.Clock.Now()}
+		case <-ws.Clock.After(policy.Backoff(attempts)):
+		}
+	}
 }
 
 func (ws *WorkScheduler) Stop() {
-	ws.done <- true
+	close(ws.done)
 	ws.Finder.(WorkFinder).Stop()
 	log.Printf("Scheduler stopped.\n")
 }
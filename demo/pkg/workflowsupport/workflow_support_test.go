@@ -3,7 +3,10 @@ package workflowsupport_test
 import (
 	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hexa-org/policy-orchestrator/demo/pkg/workflowsupport"
 	"github.com/stretchr/testify/assert"
@@ -86,3 +89,248 @@ func TestErroneousWorkflow(t *testing.T) {
 
 	scheduler.Stop()
 }
+
+type FlakyWorker struct {
+	failures int32
+	attempts int32
+}
+
+func (f *FlakyWorker) Run(interface{}) error {
+	if atomic.AddInt32(&f.attempts, 1) <= f.failures {
+		return errors.New("oops")
+	}
+	return nil
+}
+
+type FailureFinder struct {
+	Failures chan workflowsupport.Failure
+	Done     chan bool
+}
+
+func (f *FailureFinder) FindRequested() []interface{} {
+	return []interface{}{"someInfo"}
+}
+
+func (f *FailureFinder) MarkCompleted() {
+	f.Done <- true
+}
+
+func (f *FailureFinder) MarkErroneous() {}
+
+func (f *FailureFinder) ReportFailure(failure workflowsupport.Failure) {
+	f.Failures <- failure
+}
+
+func (f *FailureFinder) Stop() {}
+
+type retryingTask struct{}
+
+func (retryingTask) RetryPolicy() workflowsupport.RetryPolicy {
+	return workflowsupport.RetryPolicy{MaxAttempts: 2}
+}
+
+func TestWorkflow_retries(t *testing.T) {
+	worker := FlakyWorker{failures: 2}
+	finder := FailureFinder{Failures: make(chan workflowsupport.Failure, 10), Done: make(chan bool, 10)}
+
+	scheduler := workflowsupport.NewScheduler(&finder, []workflowsupport.Worker{&worker}, 1000)
+	scheduler.Retry = workflowsupport.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	scheduler.Start()
+	assert.True(t, <-finder.Done, "the task succeeds on its third attempt")
+	scheduler.Stop()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&worker.attempts))
+	assert.Empty(t, finder.Failures)
+}
+
+func TestWorkflow_deadLetter(t *testing.T) {
+	worker := ErroneousWorker{}
+	finder := FailureFinder{Failures: make(chan workflowsupport.Failure, 10), Done: make(chan bool, 10)}
+
+	scheduler := workflowsupport.NewScheduler(&finder, []workflowsupport.Worker{&worker}, 1000)
+	scheduler.Retry = workflowsupport.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	scheduler.Start()
+	failure := <-finder.Failures
+	scheduler.Stop()
+
+	assert.Equal(t, "someInfo", failure.Task)
+	assert.Equal(t, 3, failure.Attempts)
+	assert.EqualError(t, failure.Err, "oops")
+}
+
+func TestWorkflow_failedAtFromClock(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC))
+	finder := FailureFinder{Failures: make(chan workflowsupport.Failure, 10), Done: make(chan bool, 10)}
+
+	scheduler := workflowsupport.NewJobScheduler(&finder, []workflowsupport.Job{{Name: "often", Schedule: workflowsupport.Every(time.Minute), Worker: &ErroneousWorker{}}})
+	scheduler.Clock = clock
+	scheduler.Start()
+	assert.Eventually(t, func() bool { return !scheduler.NextRuns()["often"].IsZero() }, time.Second, time.Millisecond)
+	clock.Advance(time.Minute)
+	failure := <-finder.Failures
+	scheduler.Stop()
+
+	assert.Equal(t, time.Date(2024, time.January, 31, 10, 31, 0, 0, time.UTC), failure.FailedAt)
+}
+
+func TestWorkflow_deprecatedFields(t *testing.T) {
+	worker := NoopWorker{}
+	finder := NewNoopWorkFinder()
+
+	scheduler := workflowsupport.WorkScheduler{Finder: &finder, Workers: []workflowsupport.Worker{&worker}, Delay: 50}
+	scheduler.Start()
+	for i := 0; i < 3; i++ {
+		assert.True(t, <-finder.Results)
+	}
+	scheduler.Stop()
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := workflowsupport.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		backoff := policy.Backoff(2)
+		assert.GreaterOrEqual(t, backoff, time.Second)
+		assert.LessOrEqual(t, backoff, 2*time.Second)
+	}
+
+	worker := ErroneousWorker{}
+	finder := FailureFinder{Failures: make(chan workflowsupport.Failure, 10), Done: make(chan bool, 10)}
+	scheduler := workflowsupport.NewScheduler(&taskFinder{&finder}, []workflowsupport.Worker{&worker}, 1000)
+	scheduler.Start()
+	failure := <-finder.Failures
+	scheduler.Stop()
+	assert.Equal(t, 2, failure.Attempts, "the policy of the task is used over that of the scheduler")
+}
+
+type taskFinder struct {
+	*FailureFinder
+}
+
+func (f *taskFinder) FindRequested() []interface{} {
+	return []interface{}{retryingTask{}}
+}
+
+// fakeClock only moves when advanced, firing the channels returned by After that are due.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters map[chan time.Time]time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiters: make(map[chan time.Time]time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fired := make(chan time.Time, 1)
+	c.waiters[fired] = c.now.Add(d)
+	return fired
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for fired, at := range c.waiters {
+		if !at.After(c.now) {
+			fired <- c.now
+			delete(c.waiters, fired)
+		}
+	}
+}
+
+type BlockingWorker struct {
+	Started chan bool
+	Release chan bool
+}
+
+func (b *BlockingWorker) Run(interface{}) error {
+	b.Started <- true
+	<-b.Release
+	return nil
+}
+
+func TestWorkScheduler_cron(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC))
+	worker := BlockingWorker{Started: make(chan bool, 10), Release: make(chan bool, 10)}
+	finder := FailureFinder{Failures: make(chan workflowsupport.Failure, 10), Done: make(chan bool, 10)}
+	hourly, _ := workflowsupport.ParseCron("@hourly")
+
+	scheduler := workflowsupport.NewJobScheduler(&finder, []workflowsupport.Job{{Name: "hourly", Schedule: hourly, Worker: &worker}})
+	scheduler.Clock = clock
+	scheduler.Start()
+	nextRun := func(expected time.Time) {
+		assert.Eventually(t, func() bool { return scheduler.NextRuns()["hourly"].Equal(expected) }, time.Second, time.Millisecond)
+	}
+	nextRun(time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC))
+
+	clock.Advance(30 * time.Minute)
+	assert.True(t, <-worker.Started)
+	nextRun(time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC))
+
+	clock.Advance(time.Hour)
+	nextRun(time.Date(2024, time.January, 31, 13, 0, 0, 0, time.UTC))
+	assert.Empty(t, worker.Started, "the run is skipped while the previous run is in progress")
+
+	worker.Release <- true
+	assert.True(t, <-finder.Done)
+	// the run is only marked finished after the finder hears of it, so a tick may still be skipped
+	assert.Eventually(t, func() bool {
+		clock.Advance(time.Hour)
+		return len(worker.Started) > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, <-worker.Started)
+	worker.Release <- true
+	assert.True(t, <-finder.Done)
+	scheduler.Stop()
+}
+
+func TestWorkScheduler_overlap(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC))
+	worker := BlockingWorker{Started: make(chan bool, 10), Release: make(chan bool, 10)}
+	finder := FailureFinder{Failures: make(chan workflowsupport.Failure, 10), Done: make(chan bool, 10)}
+
+	scheduler := workflowsupport.NewJobScheduler(&finder, []workflowsupport.Job{{Name: "often", Schedule: workflowsupport.Every(time.Minute), Worker: &worker, Overlap: true}})
+	scheduler.Clock = clock
+	scheduler.Start()
+	for i := 1; i <= 2; i++ {
+		assert.Eventually(t, func() bool { return scheduler.NextRuns()["often"].Equal(clock.Now().Add(time.Minute)) }, time.Second, time.Millisecond)
+		clock.Advance(time.Minute)
+		assert.True(t, <-worker.Started)
+	}
+	worker.Release <- true
+	worker.Release <- true
+	assert.True(t, <-finder.Done)
+	assert.True(t, <-finder.Done)
+	scheduler.Stop()
+}
+
+func TestWorkScheduler_jitter(t *testing.T) {
+	now := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)
+	finder := FailureFinder{}
+	scheduler := workflowsupport.NewJobScheduler(&finder, []workflowsupport.Job{
+		{Name: "jittered", Schedule: workflowsupport.Every(time.Hour), Jitter: time.Minute, Worker: &NoopWorker{}},
+		{Name: "exact", Schedule: workflowsupport.Every(time.Hour), Worker: &NoopWorker{}},
+	})
+	scheduler.Clock = newFakeClock(now)
+	scheduler.Start()
+	assert.Eventually(t, func() bool { return len(scheduler.NextRuns()) == 2 }, time.Second, time.Millisecond)
+	scheduler.Stop()
+
+	nextRuns := scheduler.NextRuns()
+	assert.Equal(t, now.Add(time.Hour), nextRuns["exact"])
+	assert.False(t, nextRuns["jittered"].Before(now.Add(time.Hour)))
+	assert.True(t, nextRuns["jittered"].Before(now.Add(time.Hour+time.Minute)))
+}